@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/elsbrock/plundrio/internal/log"
+	"github.com/elsbrock/plundrio/internal/server"
+	"github.com/spf13/cobra"
+)
+
+var addCmd = &cobra.Command{
+	Use:   "add <magnet|file.torrent|->",
+	Short: "Add a magnet link or .torrent file to the Put.io folder",
+	Long: `Add a magnet link or .torrent file to the Put.io folder.
+
+Pass "-" to read either from stdin, e.g. cat file.torrent | plundrio add -`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		initConfig(cmd)
+
+		client, putioFolder := newPutioClient(cmd)
+
+		data, name, err := readAddInput(args[0])
+		if err != nil {
+			log.Fatal("add").Str("input", args[0]).Err(err).Msg("Failed to read input")
+		}
+		src, err := server.ParseTorrentSource(data, name)
+		if err != nil {
+			log.Fatal("add").Str("input", args[0]).Err(err).Msg("Invalid input")
+		}
+
+		ctx := context.Background()
+		folderID, err := client.EnsureFolder(ctx, putioFolder)
+		if err != nil {
+			log.Fatal("add").Str("folder", putioFolder).Err(err).Msg("Failed to create/get folder")
+		}
+
+		hash, err := server.AddTorrent(ctx, client, folderID, src)
+		if err != nil {
+			log.Fatal("add").Err(err).Msg("Failed to add transfer")
+		}
+		log.Info("add").
+			Str("folder", putioFolder).
+			Str("hash", hash).
+			Msg("Transfer added")
+	},
+}
+
+// readAddInput returns the content to add along with the file name a
+// .torrent is uploaded as. arg is "-" for stdin, a magnet link or the path
+// of a .torrent file.
+func readAddInput(arg string) ([]byte, string, error) {
+	switch {
+	case arg == "-":
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, "", fmt.Errorf("read stdin: %w", err)
+		}
+		return data, "stdin.torrent", nil
+	case strings.HasPrefix(arg, "magnet:"):
+		return []byte(arg), "", nil
+	default:
+		data, err := os.ReadFile(arg)
+		if err != nil {
+			return nil, "", err
+		}
+		return data, filepath.Base(arg), nil
+	}
+}
+
+func init() {
+	addPutioFlags(addCmd)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/elsbrock/go-putio"
+	"github.com/elsbrock/plundrio/internal/api"
+	"github.com/elsbrock/plundrio/internal/download"
+	"github.com/elsbrock/plundrio/internal/log"
+	"github.com/spf13/cobra"
+)
+
+var cancelCmd = &cobra.Command{
+	Use:   "cancel <hash|name>",
+	Short: "Cancel a transfer in the Put.io folder by hash or name",
+	Long: `Cancel a transfer in the Put.io folder by hash or name.
+
+A name matches exactly (ignoring case) or, if no name does, as a substring.
+If the name only matches as a substring, or several transfers match,
+nothing is cancelled unless --force is given.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		initConfig(cmd)
+
+		client, putioFolder := newPutioClient(cmd)
+		query := strings.TrimSpace(args[0])
+		if query == "" {
+			log.Fatal("cancel").Msg("Empty hash or name, refusing to match every transfer")
+		}
+		force, _ := cmd.Flags().GetBool("force")
+		deleteFiles, _ := cmd.Flags().GetBool("delete-files")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		ctx := context.Background()
+		folderID, err := client.EnsureFolder(ctx, putioFolder)
+		if err != nil {
+			log.Fatal("cancel").Str("folder", putioFolder).Err(err).Msg("Failed to create/get folder")
+		}
+		transfers, err := client.GetTransfers(ctx)
+		if err != nil {
+			log.Fatal("cancel").Err(err).Msg("Failed to get transfers")
+		}
+
+		matches, exact := matchTransfers(transfers, folderID, query)
+		switch {
+		case len(matches) == 0:
+			log.Fatal("cancel").Str("query", query).Msg("No matching transfer")
+		case len(matches) > 1 && !force:
+			for _, t := range matches {
+				fmt.Printf("%d\t%s\t%s\n", t.ID, t.Hash, t.Name)
+			}
+			log.Fatal("cancel").Str("query", query).Int("matches", len(matches)).Msg("Several transfers match, use --force to cancel all of them")
+		case !exact && !force:
+			fmt.Printf("%d\t%s\t%s\n", matches[0].ID, matches[0].Hash, matches[0].Name)
+			log.Fatal("cancel").Str("query", query).Msg("Only part of the name matches, use --force to cancel this transfer")
+		}
+
+		for _, t := range matches {
+			fmt.Printf("Cancelling transfer %d (%s)\n", t.ID, t.Name)
+			if dryRun {
+				continue
+			}
+			if err := cancelTransfer(ctx, client, t, deleteFiles); err != nil {
+				log.Fatal("cancel").Int64("transfer_id", t.ID).Err(err).Msg("Failed to cancel transfer")
+			}
+		}
+	},
+}
+
+// matchTransfers returns the transfers in folderID matching query, either by
+// hash or by name, and whether they match exactly. Exact name matches take
+// precedence over substrings. An empty query matches nothing.
+func matchTransfers(transfers []*putio.Transfer, folderID int64, query string) ([]*putio.Transfer, bool) {
+	if strings.TrimSpace(query) == "" {
+		return nil, false
+	}
+	var byHash, exact, partial []*putio.Transfer
+	hash := download.NormalizeHash(query)
+	lower := strings.ToLower(query)
+	for _, t := range transfers {
+		if t.SaveParentID != folderID {
+			continue
+		}
+		name := strings.ToLower(t.Name)
+		switch {
+		case t.Hash != "" && download.NormalizeHash(t.Hash) == hash:
+			byHash = append(byHash, t)
+		case name == lower:
+			exact = append(exact, t)
+		case strings.Contains(name, lower):
+			partial = append(partial, t)
+		}
+	}
+	switch {
+	case len(byHash) > 0:
+		return byHash, true
+	case len(exact) > 0:
+		return exact, true
+	default:
+		return partial, false
+	}
+}
+
+// cancelTransfer deletes a transfer from Put.io and, if deleteFiles is set,
+// the files it downloaded there.
+func cancelTransfer(ctx context.Context, client *api.Client, t *putio.Transfer, deleteFiles bool) error {
+	// Transfers that haven't produced files yet have no file id; deleting
+	// file 0 would target the root folder
+	if deleteFiles && t.FileID != 0 {
+		if err := client.DeleteFile(ctx, t.FileID); err != nil {
+			return fmt.Errorf("delete files: %w", err)
+		}
+	}
+	return client.DeleteTransfer(ctx, t.ID)
+}
+
+func init() {
+	addPutioFlags(cancelCmd)
+	cancelCmd.Flags().Bool("force", false, "Cancel transfers whose name only partially matches, or all of them if several match")
+	cancelCmd.Flags().Bool("delete-files", false, "Also delete the transfer's files on Put.io")
+	cancelCmd.Flags().Bool("dry-run", false, "Only print the transfers that would be cancelled")
+}
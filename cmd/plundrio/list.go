@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/elsbrock/go-putio"
+	"github.com/elsbrock/plundrio/internal/log"
+	"github.com/spf13/cobra"
+)
+
+// listedTransfer is a transfer as printed by the list command
+type listedTransfer struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Status      string `json:"status"`
+	PercentDone int    `json:"percentDone"`
+	Size        int64  `json:"size"`
+	ETA         int64  `json:"eta"` // seconds, 0 if unknown
+}
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the transfers in the Put.io folder",
+	Run: func(cmd *cobra.Command, args []string) {
+		initConfig(cmd)
+
+		client, putioFolder := newPutioClient(cmd)
+
+		ctx := context.Background()
+		if err := client.Authenticate(ctx); err != nil {
+			log.Fatal("list").Err(err).Msg("Failed to authenticate with Put.io")
+		}
+		folderID, err := client.EnsureFolder(ctx, putioFolder)
+		if err != nil {
+			log.Fatal("list").Str("folder", putioFolder).Err(err).Msg("Failed to create/get folder")
+		}
+		transfers, err := client.GetTransfers(ctx)
+		if err != nil {
+			log.Fatal("list").Err(err).Msg("Failed to get transfers")
+		}
+
+		status, _ := cmd.Flags().GetString("status")
+		listed := filterTransfers(transfers, folderID, status)
+
+		if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(listed); err != nil {
+				log.Fatal("list").Err(err).Msg("Failed to encode transfers")
+			}
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tSTATUS\tDONE\tSIZE\tETA")
+		for _, t := range listed {
+			eta := "-"
+			if t.ETA > 0 {
+				eta = (time.Duration(t.ETA) * time.Second).String()
+			}
+			fmt.Fprintf(w, "%s\t%s\t%d%%\t%s\t%s\n", t.Name, t.Status, t.PercentDone, formatSize(t.Size), eta)
+		}
+		w.Flush()
+	},
+}
+
+// filterTransfers returns the transfers saved to folderID, optionally only
+// those with the given Put.io status (case-insensitive).
+func filterTransfers(transfers []*putio.Transfer, folderID int64, status string) []listedTransfer {
+	listed := []listedTransfer{}
+	for _, t := range transfers {
+		if t.SaveParentID != folderID {
+			continue
+		}
+		if status != "" && !strings.EqualFold(t.Status, status) {
+			continue
+		}
+		listed = append(listed, listedTransfer{
+			ID:          t.ID,
+			Name:        t.Name,
+			Status:      t.Status,
+			PercentDone: t.PercentDone,
+			Size:        int64(t.Size),
+			ETA:         t.EstimatedTime,
+		})
+	}
+	return listed
+}
+
+// formatSize formats a byte count with a binary unit, e.g. "1.5 GiB".
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit && exp < 4; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTP"[exp])
+}
+
+func init() {
+	addPutioFlags(listCmd)
+	listCmd.Flags().Bool("json", false, "Print transfers as JSON")
+	listCmd.Flags().String("status", "", "Only list transfers with this Put.io status, e.g. DOWNLOADING or COMPLETED")
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// Bounds of the QR code image, checked before it is decoded
+const (
+	maxQRImageBytes  = 1 << 20
+	maxQRImagePixels = 2048 * 2048
+)
+
+// fetchQRCode downloads the QR code image Put.io offers for the device code
+// flow with client and returns its modules, true meaning dark.
+func fetchQRCode(ctx context.Context, client *http.Client, url string) ([][]bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxQRImageBytes))
+	if err != nil {
+		return nil, err
+	}
+	// A small image can claim huge dimensions, so check them before
+	// decoding allocates the pixels
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > maxQRImagePixels {
+		return nil, fmt.Errorf("image of %dx%d pixels is too large", cfg.Width, cfg.Height)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return qrModules(img)
+}
+
+// qrModules samples the modules of a QR code image. The size of a module is
+// taken from the top-left finder pattern, which is 7 modules wide.
+func qrModules(img image.Image) ([][]bool, error) {
+	dark := func(x, y int) bool {
+		return color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y < 128
+	}
+
+	// Find the bounding box of the dark pixels, i.e. the code without its
+	// quiet zone
+	b := img.Bounds()
+	minX, minY, maxX, maxY := b.Max.X, b.Max.Y, b.Min.X-1, b.Min.Y-1
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if dark(x, y) {
+				minX, minY = min(minX, x), min(minY, y)
+				maxX, maxY = max(maxX, x), max(maxY, y)
+			}
+		}
+	}
+	if maxX < minX {
+		return nil, errors.New("image contains no QR code")
+	}
+
+	run := 0
+	for x := minX; x <= maxX && dark(x, minY); x++ {
+		run++
+	}
+	moduleSize := float64(run) / 7
+	size := int(float64(maxX-minX+1)/moduleSize + 0.5)
+	if moduleSize < 1 || size < 21 || (size-21)%4 != 0 {
+		return nil, fmt.Errorf("image is not a QR code (%d modules)", size)
+	}
+
+	modules := make([][]bool, size)
+	for row := range modules {
+		modules[row] = make([]bool, size)
+		for col := range modules[row] {
+			x := minX + int((float64(col)+0.5)*moduleSize)
+			y := minY + int((float64(row)+0.5)*moduleSize)
+			modules[row][col] = dark(x, y)
+		}
+	}
+	return modules, nil
+}
+
+// renderQR draws modules with Unicode half blocks, two rows per line,
+// surrounded by the quiet zone scanners need. Light modules are drawn as
+// blocks so the code scans on dark terminal backgrounds.
+func renderQR(w io.Writer, modules [][]bool) {
+	const quiet = 2
+	size := len(modules)
+	light := func(row, col int) bool {
+		row, col = row-quiet, col-quiet
+		if row < 0 || col < 0 || row >= size || col >= size {
+			return true
+		}
+		return !modules[row][col]
+	}
+
+	var sb strings.Builder
+	for row := 0; row < size+2*quiet; row += 2 {
+		for col := 0; col < size+2*quiet; col++ {
+			switch top, bottom := light(row, col), light(row+1, col); {
+			case top && bottom:
+				sb.WriteString("█")
+			case top:
+				sb.WriteString("▀")
+			case bottom:
+				sb.WriteString("▄")
+			default:
+				sb.WriteString(" ")
+			}
+		}
+		sb.WriteString("\n")
+	}
+	io.WriteString(w, sb.String())
+}
+
+// printQRCode renders the QR code at url, fetched with client, to stdout if
+// it is a terminal. The code is a convenience, so failures only leave the
+// URL already logged.
+func printQRCode(ctx context.Context, client *http.Client, url string) {
+	if url == "" || !log.IsTerminal(os.Stdout) {
+		log.Debug("auth").Msg("Not showing QR code, stdout is not a terminal")
+		return
+	}
+	modules, err := fetchQRCode(ctx, client, url)
+	if err != nil {
+		log.Warn("auth").Str("qr_url", url).Err(err).Msg("Failed to render QR code, open the URL instead")
+		return
+	}
+	renderQR(os.Stdout, modules)
+}
@@ -0,0 +1,27 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/elsbrock/plundrio/internal/download"
+)
+
+// watchPauseSignal toggles the global download pause whenever the process
+// receives SIGUSR2.
+func watchPauseSignal(m *download.Manager) {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGUSR2)
+	go func() {
+		for range sigChan {
+			if m.Paused() {
+				m.Resume()
+			} else {
+				m.Pause()
+			}
+		}
+	}()
+}
@@ -0,0 +1,8 @@
+//go:build windows
+
+package main
+
+import "github.com/elsbrock/plundrio/internal/download"
+
+// watchPauseSignal is a no-op on Windows, which has no SIGUSR2.
+func watchPauseSignal(m *download.Manager) {}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/elsbrock/plundrio/internal/download"
+	"github.com/elsbrock/plundrio/internal/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var stateCmd = &cobra.Command{
+	Use:   "state",
+	Short: "Inspect or migrate the state file in the target directory",
+}
+
+var stateShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Print the state file as JSON",
+	Run: func(cmd *cobra.Command, args []string) {
+		targetDir := stateTargetDir(cmd)
+
+		data, err := download.DumpState(targetDir)
+		if err != nil {
+			log.Fatal("state").Str("dir", targetDir).Err(err).Msg("Failed to read state")
+		}
+		fmt.Println(string(data))
+	},
+}
+
+var stateMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Upgrade the state file to the current format, keeping a backup",
+	Run: func(cmd *cobra.Command, args []string) {
+		targetDir := stateTargetDir(cmd)
+
+		from, backup, err := download.MigrateState(targetDir)
+		if err != nil {
+			log.Fatal("state").Str("dir", targetDir).Err(err).Msg("Failed to migrate state")
+		}
+		if backup == "" {
+			fmt.Printf("State file is up to date (version %d)\n", from)
+			return
+		}
+		fmt.Printf("Migrated state file from version %d, original saved as %s\n", from, backup)
+	},
+}
+
+// stateTargetDir initializes the configuration for a state subcommand and
+// returns the target directory holding the state file.
+func stateTargetDir(cmd *cobra.Command) string {
+	initConfig(cmd)
+
+	targetDir := viper.GetString("target")
+	if targetDir == "" {
+		log.Error("config").Msg("Target directory is required")
+		cmd.Usage()
+		os.Exit(1)
+	}
+	return targetDir
+}
+
+func init() {
+	stateCmd.PersistentFlags().String("config", "", "Config file (default $HOME/.plundrio.yaml)")
+	stateCmd.PersistentFlags().StringP("target", "t", "", "Target directory for downloads (required)")
+	stateCmd.PersistentFlags().String("log-level", "", "Log level (trace,debug,info,warn,error,fatal,panic,none,pretty)")
+	stateCmd.AddCommand(stateShowCmd)
+	stateCmd.AddCommand(stateMigrateCmd)
+}
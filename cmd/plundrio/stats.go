@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/download"
+	"github.com/elsbrock/plundrio/internal/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show lifetime download statistics",
+	Run: func(cmd *cobra.Command, args []string) {
+		initConfig(cmd)
+
+		targetDir := viper.GetString("target")
+		if targetDir == "" {
+			log.Error("config").Msg("Target directory is required")
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		stats, err := download.LoadLifetimeStats(targetDir)
+		if err != nil {
+			log.Fatal("stats").Str("dir", targetDir).Err(err).Msg("Failed to read lifetime statistics")
+		}
+
+		if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(stats); err != nil {
+				log.Fatal("stats").Err(err).Msg("Failed to encode statistics")
+			}
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "Transfers completed:\t%d\n", stats.TransfersCompleted)
+		fmt.Fprintf(w, "Transfers failed:\t%d\n", stats.TransfersFailed)
+		fmt.Fprintf(w, "Files completed:\t%d\n", stats.FilesCompleted)
+		fmt.Fprintf(w, "Files failed:\t%d\n", stats.FilesFailed)
+		fmt.Fprintf(w, "Bytes downloaded:\t%d\n", stats.BytesDownloaded)
+		fmt.Fprintf(w, "Sessions:\t%d\n", stats.SessionCount)
+		fmt.Fprintf(w, "Time active:\t%s\n", time.Duration(stats.SecondsActive)*time.Second)
+		w.Flush()
+	},
+}
+
+func init() {
+	statsCmd.Flags().String("config", "", "Config file (default $HOME/.plundrio.yaml)")
+	statsCmd.Flags().StringP("target", "t", "", "Target directory for downloads (required)")
+	statsCmd.Flags().String("log-level", "", "Log level (trace,debug,info,warn,error,fatal,panic,none,pretty)")
+	statsCmd.Flags().Bool("json", false, "Print statistics as JSON")
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/api"
+	"github.com/elsbrock/plundrio/internal/config"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// validateReport prints the outcome of each check of the validate command
+// and counts the failures.
+type validateReport struct {
+	failed int
+}
+
+func (r *validateReport) check(name string, err error) {
+	if err != nil {
+		fmt.Printf("FAIL  %s: %v\n", name, err)
+		r.failed++
+		return
+	}
+	fmt.Printf("PASS  %s\n", name)
+}
+
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the configuration without starting downloads",
+	Long: `Validate loads the configuration like run does and checks that the target
+directories are writable, the tokens authenticate with Put.io, the folders
+exist or can be created and all durations parse. It exits non-zero if any
+check fails, e.g. for use as a container pre-start check.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		initConfig(cmd)
+		var r validateReport
+
+		cmd.Flags().VisitAll(func(f *pflag.Flag) {
+			if f.Value.Type() == "duration" {
+				if err := checkDuration(viper.GetString(f.Name)); err != nil {
+					r.check("duration "+f.Name, err)
+				}
+			}
+		})
+
+		putioFolder := strings.ToLower(viper.GetString("folder"))
+		targetDir := viper.GetString("target")
+		if targetDir == "" {
+			r.check("target directory", errors.New("not configured"))
+		} else {
+			r.check("target directory "+targetDir+" is writable", checkWritableDir(targetDir))
+		}
+		mappings, err := parseFolderMappings(viper.GetStringSlice("folder-map"), putioFolder)
+		r.check("folder mappings", err)
+		for _, mapping := range mappings {
+			r.check("target directory "+mapping.TargetDir+" is writable", checkWritableDir(mapping.TargetDir))
+		}
+		if tempDir := viper.GetString("temp-dir"); tempDir != "" {
+			r.check("temp directory "+tempDir+" is writable", checkWritableDir(tempDir))
+		}
+
+		tlsConfig, err := api.NewTLSConfig(viper.GetString("ca-cert"), viper.GetBool("insecure-skip-verify"))
+		r.check("TLS settings", err)
+		proxy, err := api.NewProxyFunc(viper.GetString("proxy"))
+		r.check("proxy", err)
+		if certFile, keyFile := viper.GetString("tls-cert"), viper.GetString("tls-key"); certFile != "" && !viper.GetBool("tls-auto") {
+			_, err := tls.LoadX509KeyPair(certFile, keyFile)
+			r.check("RPC certificate "+certFile, err)
+		}
+
+		tokens := viper.GetStringSlice("token")
+		if len(tokens) == 0 || tokens[0] == "" {
+			r.check("token", errors.New("not configured"))
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		for i, token := range tokens {
+			client := api.NewClient(token, api.ClientOptions{
+				TLSConfig: tlsConfig,
+				Proxy:     proxy,
+				Timeout:   viper.GetDuration("api-timeout"),
+			})
+			err := client.Authenticate(ctx)
+			r.check(fmt.Sprintf("token %d authenticates with Put.io", i+1), err)
+			// New transfers are saved in the folders of the first account
+			if i > 0 || err != nil {
+				continue
+			}
+			if putioFolder == "" {
+				r.check("Put.io folder", errors.New("not configured"))
+				continue
+			}
+			for _, folder := range append([]string{putioFolder}, folderNames(mappings)...) {
+				_, err := client.EnsureFolder(ctx, folder)
+				r.check("Put.io folder "+folder+" exists or was created", err)
+			}
+		}
+
+		if r.failed > 0 {
+			fmt.Printf("\n%d check(s) failed\n", r.failed)
+			os.Exit(1)
+		}
+		fmt.Println("\nConfiguration is valid")
+	},
+}
+
+// checkDuration returns an error if v is neither empty nor a duration such
+// as "30s". Bare numbers other than 0 are rejected as they lack a unit.
+func checkDuration(v string) error {
+	if v == "" {
+		return nil
+	}
+	_, err := time.ParseDuration(v)
+	return err
+}
+
+// checkWritableDir returns an error unless dir is a directory files can be
+// created in.
+func checkWritableDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	f, err := os.CreateTemp(dir, ".plundrio-validate-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// folderNames returns the Put.io folders of mappings.
+func folderNames(mappings []config.FolderMapping) []string {
+	names := make([]string, len(mappings))
+	for i, mapping := range mappings {
+		names[i] = mapping.PutioFolder
+	}
+	return names
+}
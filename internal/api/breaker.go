@@ -0,0 +1,129 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// Tuning of the Put.io circuit breaker
+const (
+	breakerThreshold  = 5                // consecutive 5xx responses before backing off
+	breakerMinBackoff = 30 * time.Second // first backoff once the breaker opens
+	breakerMaxBackoff = 10 * time.Minute // backoff doubles up to this after failed probes
+)
+
+// Circuit breaker states as reported by BreakerStatus
+const (
+	BreakerClosed = "closed" // requests pass through
+	BreakerOpen   = "open"   // requests fail fast until RetryAt
+)
+
+// ErrPutioUnavailable is returned without contacting Put.io while the
+// circuit breaker is open.
+var ErrPutioUnavailable = errors.New("put.io appears to be down, backing off")
+
+// BreakerStatus describes the state of the Put.io circuit breaker
+type BreakerStatus struct {
+	State               string    `json:"state"`
+	ConsecutiveFailures int       `json:"consecutiveFailures"`
+	RetryAt             time.Time `json:"retryAt,omitzero"`
+}
+
+// breaker is an http.RoundTripper that stops sending requests to Put.io
+// after repeated 5xx responses, e.g. during maintenance. Once the backoff has
+// elapsed the next request is let through as a probe; a success closes the
+// breaker, another 5xx doubles the backoff.
+type breaker struct {
+	base http.RoundTripper
+	now  func() time.Time
+
+	mu       sync.Mutex
+	failures int           // consecutive 5xx responses
+	backoff  time.Duration // current backoff, 0 while closed
+	retryAt  time.Time     // when the next probe may be sent
+}
+
+// newBreaker wraps base in a circuit breaker
+func newBreaker(base http.RoundTripper) *breaker {
+	return &breaker{base: base, now: time.Now}
+}
+
+// RoundTrip implements http.RoundTripper
+func (b *breaker) RoundTrip(req *http.Request) (*http.Response, error) {
+	b.mu.Lock()
+	if b.backoff > 0 && b.now().Before(b.retryAt) {
+		b.mu.Unlock()
+		return nil, ErrPutioUnavailable
+	}
+	b.mu.Unlock()
+
+	resp, err := b.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	if resp.StatusCode >= http.StatusInternalServerError {
+		b.recordFailure(resp.StatusCode)
+	} else {
+		b.recordSuccess()
+	}
+	return resp, nil
+}
+
+// recordFailure counts a 5xx response and opens the breaker, or extends its
+// backoff, once the threshold is reached.
+func (b *breaker) recordFailure(status int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.failures < breakerThreshold {
+		return
+	}
+	if b.backoff == 0 {
+		b.backoff = breakerMinBackoff
+		log.Warn("api").
+			Int("status", status).
+			Int("consecutive_failures", b.failures).
+			Dur("backoff", b.backoff).
+			Msg("Put.io appears to be down, backing off")
+	} else {
+		b.backoff = min(2*b.backoff, breakerMaxBackoff)
+		log.Debug("api").
+			Int("status", status).
+			Dur("backoff", b.backoff).
+			Msg("Put.io still unavailable")
+	}
+	b.retryAt = b.now().Add(b.backoff)
+}
+
+// recordSuccess resets the failure count and closes the breaker
+func (b *breaker) recordSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.backoff > 0 {
+		log.Info("api").
+			Int("consecutive_failures", b.failures).
+			Msg("Put.io is reachable again, resuming")
+	}
+	b.failures = 0
+	b.backoff = 0
+	b.retryAt = time.Time{}
+}
+
+// Status returns the breaker's current state
+func (b *breaker) Status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := BreakerStatus{State: BreakerClosed, ConsecutiveFailures: b.failures}
+	if b.backoff > 0 {
+		status.State = BreakerOpen
+		status.RetryAt = b.retryAt
+	}
+	return status
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestBreaker(t *testing.T) {
+	status := http.StatusServiceUnavailable
+	calls := 0
+	b := newBreaker(roundTripFunc(func(*http.Request) (*http.Response, error) {
+		calls++
+		return &http.Response{StatusCode: status, Body: http.NoBody}, nil
+	}))
+	now := time.Unix(1000, 0)
+	b.now = func() time.Time { return now }
+	req := httptest.NewRequest(http.MethodGet, "https://api.put.io/v2/transfers/list", nil)
+
+	for range breakerThreshold {
+		if _, err := b.RoundTrip(req); err != nil {
+			t.Fatalf("unexpected error before threshold: %v", err)
+		}
+	}
+	if got := b.Status(); got.State != BreakerOpen || !got.RetryAt.Equal(now.Add(breakerMinBackoff)) {
+		t.Fatalf("status after threshold = %+v, want open until %v", got, now.Add(breakerMinBackoff))
+	}
+
+	// Requests fail fast while backing off
+	if _, err := b.RoundTrip(req); !errors.Is(err, ErrPutioUnavailable) {
+		t.Fatalf("err = %v, want ErrPutioUnavailable", err)
+	}
+	if calls != breakerThreshold {
+		t.Fatalf("calls = %d, want %d", calls, breakerThreshold)
+	}
+
+	// A failed probe doubles the backoff
+	now = now.Add(breakerMinBackoff)
+	b.RoundTrip(req)
+	if got := b.Status(); !got.RetryAt.Equal(now.Add(2 * breakerMinBackoff)) {
+		t.Fatalf("retry at %v, want %v", got.RetryAt, now.Add(2*breakerMinBackoff))
+	}
+
+	// A successful probe closes the breaker
+	now = now.Add(2 * breakerMinBackoff)
+	status = http.StatusOK
+	if _, err := b.RoundTrip(req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := b.Status(); got.State != BreakerClosed || got.ConsecutiveFailures != 0 {
+		t.Fatalf("status after recovery = %+v, want closed", got)
+	}
+}
@@ -3,27 +3,122 @@ package api
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
 
 	"github.com/elsbrock/go-putio"
+	"github.com/elsbrock/plundrio/internal/log"
 	"golang.org/x/oauth2"
 )
 
+// APIClient is the Put.io API used by plundrio. The download manager and
+// the RPC server each depend on the subset they need, so either can be
+// tested with an in-memory fake instead of the network.
+type APIClient interface {
+	Authenticate(ctx context.Context) error
+	GetAccountInfo(ctx context.Context) (*putio.AccountInfo, error)
+	EnsureFolder(ctx context.Context, name string) (int64, error)
+	AddTransfer(ctx context.Context, magnetLink string, folderID int64) (string, error)
+	UploadFile(ctx context.Context, data []byte, filename string, folderID int64) (string, error)
+	GetTransfers(ctx context.Context) ([]*putio.Transfer, error)
+	RetryTransfer(ctx context.Context, transferID int64) (*putio.Transfer, error)
+	DeleteTransfer(ctx context.Context, transferID int64) error
+	GetFiles(ctx context.Context, folderID int64) ([]*putio.File, error)
+	GetAllTransferFiles(ctx context.Context, fileID int64) ([]*putio.File, error)
+	GetAllTransferFilePaths(ctx context.Context, fileID int64) ([]*putio.File, map[int64]string, error)
+	GetDownloadURL(ctx context.Context, fileID int64) (string, error)
+	DeleteFile(ctx context.Context, fileID int64) error
+	BreakerStatus() BreakerStatus
+}
+
+var _ APIClient = (*Client)(nil)
+
+// uploadAttempts is how often a .torrent upload is tried before failing
+const uploadAttempts = 3
+
+// listPageSize is how many transfers are requested per page
+const listPageSize = 1000
+
+// uploadRetryBackoff is the delay after the first failed upload attempt; it
+// doubles after each further failure
+var uploadRetryBackoff = time.Second
+
 // Client wraps the official Put.io client
 type Client struct {
-	client *putio.Client
+	client  *putio.Client
+	breaker *breaker
+}
+
+// ClientOptions tunes the HTTP connection of a Client.
+type ClientOptions struct {
+	// DebugHTTP logs every request at trace level
+	DebugHTTP bool
+
+	// TLSConfig replaces the default TLS settings, see NewTLSConfig
+	TLSConfig *tls.Config
+
+	// Proxy selects the proxy for each request, see NewProxyFunc; nil uses
+	// the proxy environment variables
+	Proxy ProxyFunc
+
+	// MaxRequestsPerSecond caps the rate of requests to Put.io; 0 means
+	// unlimited
+	MaxRequestsPerSecond float64
+
+	// Timeout bounds each API request, so that a hung connection can't
+	// block its caller; 0 keeps the default of 30s
+	Timeout time.Duration
+}
+
+// NewTransport returns the transport requests to Put.io are sent with,
+// using tlsConfig and proxy if set.
+func NewTransport(tlsConfig *tls.Config, proxy ProxyFunc) http.RoundTripper {
+	if tlsConfig == nil && proxy == nil {
+		return http.DefaultTransport
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.TLSClientConfig = tlsConfig
+	if proxy != nil {
+		t.Proxy = proxy
+	}
+	return t
 }
 
-// NewClient creates a new Put.io API client
-func NewClient(oauthToken string) *Client {
+// NewClient creates a new Put.io API client.
+func NewClient(oauthToken string, opts ClientOptions) *Client {
+	transport := NewTransport(opts.TLSConfig, opts.Proxy)
+	if opts.DebugHTTP {
+		transport = log.NewHTTPTransport(transport, "api")
+	}
+	b := newBreaker(transport)
+	retry := newRetryTransport(b, opts.MaxRequestsPerSecond)
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, &http.Client{Transport: retry})
 	tokenSource := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: oauthToken})
-	oauthClient := oauth2.NewClient(context.Background(), tokenSource)
+	oauthClient := oauth2.NewClient(ctx, tokenSource)
 
+	client := putio.NewClient(oauthClient)
+	if opts.Timeout > 0 {
+		client.Timeout = opts.Timeout
+	}
 	return &Client{
-		client: putio.NewClient(oauthClient),
+		client:  client,
+		breaker: b,
 	}
 }
 
+// BreakerStatus reports whether requests to Put.io are currently being
+// held back after repeated server errors.
+func (c *Client) BreakerStatus() BreakerStatus {
+	return c.breaker.Status()
+}
+
 // Authenticate verifies the OAuth token by fetching account info
 func (c *Client) Authenticate(ctx context.Context) error {
 	account, err := c.client.Account.Info(ctx)
@@ -88,7 +183,7 @@ func (c *Client) AddTransfer(ctx context.Context, magnetLink string, folderID in
 
 // GetTransfers returns the list of current transfers
 func (c *Client) GetTransfers(ctx context.Context) ([]*putio.Transfer, error) {
-	transfers, err := c.client.Transfers.List(ctx)
+	transfers, err := c.listTransfers(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("get transfers: %w", err)
 	}
@@ -101,6 +196,41 @@ func (c *Client) GetTransfers(ctx context.Context) ([]*putio.Transfer, error) {
 	return result, nil
 }
 
+// listTransfers fetches all transfers page by page. Put.io hands out a
+// cursor while more transfers remain, like it does for file listings, which
+// go-putio only follows for the latter.
+func (c *Client) listTransfers(ctx context.Context) ([]putio.Transfer, error) {
+	req, err := c.client.NewRequest(ctx, http.MethodGet, "/v2/transfers/list?per_page="+strconv.Itoa(listPageSize), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var transfers []putio.Transfer
+	for {
+		var page struct {
+			Transfers []putio.Transfer `json:"transfers"`
+			Cursor    string           `json:"cursor"`
+		}
+		if _, err := c.client.Do(req, &page); err != nil {
+			return nil, err
+		}
+		transfers = append(transfers, page.Transfers...)
+		if page.Cursor == "" {
+			return transfers, nil
+		}
+
+		body, err := json.Marshal(map[string]string{"cursor": page.Cursor})
+		if err != nil {
+			return nil, err
+		}
+		req, err = c.client.NewRequest(ctx, http.MethodPost, "/v2/transfers/list/continue", bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+	}
+}
+
 // GetDownloadURL gets the download URL for a file
 func (c *Client) GetDownloadURL(ctx context.Context, fileID int64) (string, error) {
 	url, err := c.client.Files.URL(ctx, fileID, false)
@@ -118,7 +248,8 @@ func (c *Client) DeleteTransfer(ctx context.Context, transferID int64) error {
 	return nil
 }
 
-// GetFiles gets the contents of a folder
+// GetFiles gets the contents of a folder. go-putio follows the cursor of
+// large folders, so all pages are returned.
 func (c *Client) GetFiles(ctx context.Context, folderID int64) ([]*putio.File, error) {
 	files, _, err := c.client.Files.List(ctx, folderID)
 	if err != nil {
@@ -142,10 +273,33 @@ func (c *Client) DeleteFile(ctx context.Context, fileID int64) error {
 }
 
 // UploadFile uploads a torrent file to Put.io and returns the transfer hash
-// if one was created.
+// if one was created. Failures that can't have added the transfer, see
+// uploadRetriable, are retried with backoff.
 func (c *Client) UploadFile(ctx context.Context, data []byte, filename string, folderID int64) (string, error) {
 	reader := bytes.NewReader(data)
-	upload, err := c.client.Files.Upload(ctx, reader, filename, folderID)
+	var upload putio.Upload
+	var err error
+	for attempt := 1; ; attempt++ {
+		// A failed attempt may have consumed the reader
+		reader.Seek(0, io.SeekStart)
+		upload, err = c.client.Files.Upload(ctx, reader, filename, folderID)
+		if err == nil || attempt >= uploadAttempts || !uploadRetriable(err) {
+			break
+		}
+
+		backoff := uploadRetryBackoff << (attempt - 1)
+		log.Warn("api").
+			Str("filename", filename).
+			Int("attempt", attempt).
+			Dur("backoff", backoff).
+			Err(err).
+			Msg("Retrying torrent upload after error")
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return "", fmt.Errorf("failed to upload file: %w", ctx.Err())
+		}
+	}
 	if err != nil {
 		return "", fmt.Errorf("failed to upload file: %w", err)
 	}
@@ -157,22 +311,31 @@ func (c *Client) UploadFile(ctx context.Context, data []byte, filename string, f
 
 // GetAllTransferFiles recursively gets all files in a transfer
 func (c *Client) GetAllTransferFiles(ctx context.Context, fileID int64) ([]*putio.File, error) {
+	files, _, err := c.GetAllTransferFilePaths(ctx, fileID)
+	return files, err
+}
+
+// GetAllTransferFilePaths recursively gets all files in a transfer along
+// with each file's slash-separated path relative to the transfer's folder,
+// keyed by file ID.
+func (c *Client) GetAllTransferFilePaths(ctx context.Context, fileID int64) ([]*putio.File, map[int64]string, error) {
 	// First check if the fileID is a file itself
 	file, err := c.client.Files.Get(ctx, fileID)
 	if err != nil {
-		return nil, fmt.Errorf("get transfer files: %w", err)
+		return nil, nil, fmt.Errorf("get transfer files: %w", err)
 	}
 
 	// If it's a single file, return it directly
 	if !file.IsDir() {
-		return []*putio.File{&file}, nil
+		return []*putio.File{&file}, map[int64]string{file.ID: file.Name}, nil
 	}
 
 	// Otherwise, recursively get all files in the directory
 	var allFiles []*putio.File
-	var getFiles func(id int64) error
+	paths := make(map[int64]string)
+	var getFiles func(id int64, dir string) error
 
-	getFiles = func(id int64) error {
+	getFiles = func(id int64, dir string) error {
 		files, err := c.GetFiles(ctx, id)
 		if err != nil {
 			return err
@@ -180,21 +343,22 @@ func (c *Client) GetAllTransferFiles(ctx context.Context, fileID int64) ([]*puti
 
 		for _, file := range files {
 			if file.IsDir() {
-				if err := getFiles(file.ID); err != nil {
+				if err := getFiles(file.ID, path.Join(dir, file.Name)); err != nil {
 					return err
 				}
 			} else {
 				allFiles = append(allFiles, file)
+				paths[file.ID] = path.Join(dir, file.Name)
 			}
 		}
 		return nil
 	}
 
-	if err := getFiles(fileID); err != nil {
-		return nil, err
+	if err := getFiles(fileID, ""); err != nil {
+		return nil, nil, err
 	}
 
-	return allFiles, nil
+	return allFiles, paths, nil
 }
 
 // RetryTransfer retries a failed transfer
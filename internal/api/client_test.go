@@ -0,0 +1,197 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/elsbrock/go-putio"
+)
+
+func TestUploadFileRetries(t *testing.T) {
+	uploadRetryBackoff = 0
+	defer func() { uploadRetryBackoff = time.Second }()
+
+	tests := []struct {
+		name      string
+		failures  []int // status codes of failed attempts; 0 means a failed dial, -1 a connection reset
+		wantErr   bool
+		wantCalls int
+	}{
+		{"success", nil, false, 1},
+		{"dial error once", []int{0}, false, 2},
+		{"throttled once", []int{http.StatusTooManyRequests}, false, 2},
+		{"persistently throttled", []int{429, 429, 429}, true, 3},
+		// The transfer may have been added before these failed
+		{"connection reset", []int{-1}, true, 1},
+		{"server error", []int{http.StatusBadGateway}, true, 1},
+		{"client error", []int{http.StatusBadRequest}, true, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			c := &Client{client: putio.NewClient(&http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				calls++
+				// Every attempt must upload the complete torrent
+				if got := uploadedFile(t, req); got != "torrent-data" {
+					t.Errorf("attempt %d uploaded %q, want the full torrent", calls, got)
+				}
+				if calls <= len(tt.failures) {
+					switch tt.failures[calls-1] {
+					case 0:
+						return nil, &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+					case -1:
+						return nil, syscall.ECONNRESET
+					}
+					return &http.Response{StatusCode: tt.failures[calls-1], Body: http.NoBody, Request: req}, nil
+				}
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Header:     http.Header{"Content-Type": {"application/json"}},
+					Body:       io.NopCloser(strings.NewReader(`{"transfer":{"hash":"abc"}}`)),
+					Request:    req,
+				}, nil
+			})})}
+
+			hash, err := c.UploadFile(context.Background(), []byte("torrent-data"), "x.torrent", 1)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && hash != "abc" {
+				t.Errorf("hash = %q, want abc", hash)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+// uploadedFile returns the contents of the file part of an upload request
+func uploadedFile(t *testing.T, req *http.Request) string {
+	t.Helper()
+	_, params, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("parse content type: %v", err)
+	}
+	mr := multipart.NewReader(req.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			t.Fatalf("no file part in upload: %v", err)
+		}
+		if part.FormName() == "file" {
+			data, _ := io.ReadAll(part)
+			return string(data)
+		}
+	}
+}
+
+// newPagingServer serves a Put.io API whose file and transfer listings are
+// split into pages of two, linked by cursors
+func newPagingServer(t *testing.T, files, transfers int) *Client {
+	t.Helper()
+	page := func(w http.ResponseWriter, key string, total, offset int) {
+		items := []string{}
+		for i := offset; i < min(offset+2, total); i++ {
+			items = append(items, fmt.Sprintf(`{"id":%d,"name":"item-%d","file_type":"VIDEO"}`, i+1, i))
+		}
+		cursor := ""
+		if offset+2 < total {
+			cursor = strconv.Itoa(offset + 2)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"%s":[%s],"cursor":%q}`, key, strings.Join(items, ","), cursor)
+	}
+	continued := func(t *testing.T, r *http.Request) int {
+		var body struct{ Cursor string }
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode continue request: %v", err)
+		}
+		offset, _ := strconv.Atoi(body.Cursor)
+		return offset
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v2/files/list", func(w http.ResponseWriter, r *http.Request) {
+		page(w, "files", files, 0)
+	})
+	mux.HandleFunc("POST /v2/files/list/continue", func(w http.ResponseWriter, r *http.Request) {
+		page(w, "files", files, continued(t, r))
+	})
+	mux.HandleFunc("GET /v2/transfers/list", func(w http.ResponseWriter, r *http.Request) {
+		page(w, "transfers", transfers, 0)
+	})
+	mux.HandleFunc("POST /v2/transfers/list/continue", func(w http.ResponseWriter, r *http.Request) {
+		page(w, "transfers", transfers, continued(t, r))
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	c := NewClient("token", ClientOptions{})
+	c.client.BaseURL, _ = url.Parse(srv.URL)
+	return c
+}
+
+func TestListingsFollowCursor(t *testing.T) {
+	c := newPagingServer(t, 5, 7)
+	ctx := context.Background()
+
+	files, err := c.GetFiles(ctx, 1)
+	if err != nil {
+		t.Fatalf("GetFiles: %v", err)
+	}
+	if len(files) != 5 {
+		t.Errorf("GetFiles returned %d files, want 5", len(files))
+	}
+
+	transfers, err := c.GetTransfers(ctx)
+	if err != nil {
+		t.Fatalf("GetTransfers: %v", err)
+	}
+	if len(transfers) != 7 {
+		t.Errorf("GetTransfers returned %d transfers, want 7", len(transfers))
+	}
+	for i, tr := range transfers {
+		if tr.ID != int64(i+1) {
+			t.Errorf("transfer %d has id %d, want %d", i, tr.ID, i+1)
+		}
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	c := NewClient("token", ClientOptions{Timeout: 50 * time.Millisecond})
+	c.client.BaseURL, _ = url.Parse(srv.URL)
+
+	start := time.Now()
+	if _, err := c.GetTransfers(context.Background()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("request took %v despite the timeout", elapsed)
+	}
+}
@@ -0,0 +1,263 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/elsbrock/go-putio"
+)
+
+// accountBits is how many low bits of a namespaced id hold the account index
+const accountBits = 4
+
+// MaxAccounts is the number of Put.io accounts a MultiClient can combine
+const MaxAccounts = 1 << accountBits
+
+// MultiClient combines several Put.io accounts behind a single APIClient.
+// Transfer, file and folder ids are namespaced by account so they never
+// collide; a watched folder of every account is reported under the id of
+// the first account's folder of the same name, so transfers from all
+// accounts appear as one list. New transfers are added to the first account.
+type MultiClient struct {
+	clients []APIClient
+	labels  []string  // account usernames, set by Authenticate
+	folders [][]int64 // un-namespaced id per account of every watched folder
+}
+
+var _ APIClient = (*MultiClient)(nil)
+
+// NewMultiClient combines clients, one per Put.io account, the first of
+// which receives new transfers.
+func NewMultiClient(clients ...APIClient) (*MultiClient, error) {
+	if len(clients) == 0 || len(clients) > MaxAccounts {
+		return nil, fmt.Errorf("between 1 and %d accounts are supported, got %d", MaxAccounts, len(clients))
+	}
+	labels := make([]string, len(clients))
+	for i := range labels {
+		labels[i] = fmt.Sprintf("account%d", i+1)
+	}
+	return &MultiClient{clients: clients, labels: labels}, nil
+}
+
+// namespace turns an account's id into a MultiClient id. Zero, meaning "no
+// id" for files and the root folder, is kept as is.
+func namespace(id int64, account int) int64 {
+	if id == 0 {
+		return 0
+	}
+	return id<<accountBits | int64(account)
+}
+
+// split reverses namespace.
+func split(id int64) (int64, int) {
+	return id >> accountBits, int(id & (MaxAccounts - 1))
+}
+
+// client returns the client of the account an id belongs to along with the
+// account's own id.
+func (c *MultiClient) client(id int64) (APIClient, int64, error) {
+	raw, account := split(id)
+	if account >= len(c.clients) {
+		return nil, 0, fmt.Errorf("id %d belongs to unknown account %d", id, account)
+	}
+	return c.clients[account], raw, nil
+}
+
+// TransferAccount returns the name of the account a transfer belongs to.
+func (c *MultiClient) TransferAccount(transferID int64) string {
+	_, account := split(transferID)
+	if account >= len(c.labels) {
+		return ""
+	}
+	return c.labels[account]
+}
+
+// BreakerStatus reports the worst circuit breaker state across accounts.
+func (c *MultiClient) BreakerStatus() BreakerStatus {
+	status := BreakerStatus{State: BreakerClosed}
+	for _, client := range c.clients {
+		s := client.BreakerStatus()
+		if s.State == BreakerOpen {
+			status.State = BreakerOpen
+			if s.RetryAt.After(status.RetryAt) {
+				status.RetryAt = s.RetryAt
+			}
+		}
+		status.ConsecutiveFailures = max(status.ConsecutiveFailures, s.ConsecutiveFailures)
+	}
+	return status
+}
+
+// Authenticate verifies the token of every account and remembers the
+// account usernames.
+func (c *MultiClient) Authenticate(ctx context.Context) error {
+	for i, client := range c.clients {
+		if err := client.Authenticate(ctx); err != nil {
+			return fmt.Errorf("%s: %w", c.labels[i], err)
+		}
+		if info, err := client.GetAccountInfo(ctx); err == nil && info.Username != "" {
+			c.labels[i] = info.Username
+		}
+	}
+	return nil
+}
+
+// GetAccountInfo returns the information of the first account, the one new
+// transfers are added to.
+func (c *MultiClient) GetAccountInfo(ctx context.Context) (*putio.AccountInfo, error) {
+	return c.clients[0].GetAccountInfo(ctx)
+}
+
+// EnsureFolder ensures the folder exists in every account and returns the
+// namespaced id of the first account's folder.
+func (c *MultiClient) EnsureFolder(ctx context.Context, name string) (int64, error) {
+	folders := make([]int64, len(c.clients))
+	for i, client := range c.clients {
+		id, err := client.EnsureFolder(ctx, name)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", c.labels[i], err)
+		}
+		folders[i] = id
+	}
+	if !slices.ContainsFunc(c.folders, func(f []int64) bool { return slices.Equal(f, folders) }) {
+		c.folders = append(c.folders, folders)
+	}
+	return namespace(folders[0], 0), nil
+}
+
+// AddTransfer adds a transfer to the account folderID belongs to.
+func (c *MultiClient) AddTransfer(ctx context.Context, magnetLink string, folderID int64) (string, error) {
+	client, raw, err := c.client(folderID)
+	if err != nil {
+		return "", err
+	}
+	return client.AddTransfer(ctx, magnetLink, raw)
+}
+
+// UploadFile uploads a .torrent file to the account folderID belongs to.
+func (c *MultiClient) UploadFile(ctx context.Context, data []byte, filename string, folderID int64) (string, error) {
+	client, raw, err := c.client(folderID)
+	if err != nil {
+		return "", err
+	}
+	return client.UploadFile(ctx, data, filename, raw)
+}
+
+// GetTransfers returns the transfers of all accounts. It fails if any
+// account can't be listed, so that transfers are never mistaken as removed.
+func (c *MultiClient) GetTransfers(ctx context.Context) ([]*putio.Transfer, error) {
+	var all []*putio.Transfer
+	for i, client := range c.clients {
+		transfers, err := client.GetTransfers(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", c.labels[i], err)
+		}
+		for _, t := range transfers {
+			all = append(all, c.namespaceTransfer(t, i))
+		}
+	}
+	return all, nil
+}
+
+// namespaceTransfer rewrites the ids of an account's transfer in place.
+func (c *MultiClient) namespaceTransfer(t *putio.Transfer, account int) *putio.Transfer {
+	t.ID = namespace(t.ID, account)
+	t.FileID = namespace(t.FileID, account)
+	for _, folders := range c.folders {
+		if t.SaveParentID == folders[account] {
+			t.SaveParentID = namespace(folders[0], 0)
+			return t
+		}
+	}
+	t.SaveParentID = namespace(t.SaveParentID, account)
+	return t
+}
+
+// RetryTransfer retries a transfer in its account.
+func (c *MultiClient) RetryTransfer(ctx context.Context, transferID int64) (*putio.Transfer, error) {
+	client, raw, err := c.client(transferID)
+	if err != nil {
+		return nil, err
+	}
+	t, err := client.RetryTransfer(ctx, raw)
+	if err != nil {
+		return nil, err
+	}
+	_, account := split(transferID)
+	return c.namespaceTransfer(t, account), nil
+}
+
+// DeleteTransfer deletes a transfer from its account.
+func (c *MultiClient) DeleteTransfer(ctx context.Context, transferID int64) error {
+	client, raw, err := c.client(transferID)
+	if err != nil {
+		return err
+	}
+	return client.DeleteTransfer(ctx, raw)
+}
+
+// GetFiles lists a folder of the account it belongs to.
+func (c *MultiClient) GetFiles(ctx context.Context, folderID int64) ([]*putio.File, error) {
+	client, raw, err := c.client(folderID)
+	if err != nil {
+		return nil, err
+	}
+	files, err := client.GetFiles(ctx, raw)
+	_, account := split(folderID)
+	return namespaceFiles(files, account), err
+}
+
+// GetAllTransferFiles lists the files of a transfer in its account.
+func (c *MultiClient) GetAllTransferFiles(ctx context.Context, fileID int64) ([]*putio.File, error) {
+	client, raw, err := c.client(fileID)
+	if err != nil {
+		return nil, err
+	}
+	files, err := client.GetAllTransferFiles(ctx, raw)
+	_, account := split(fileID)
+	return namespaceFiles(files, account), err
+}
+
+// GetAllTransferFilePaths lists the files of a transfer in its account
+// along with their paths within the transfer.
+func (c *MultiClient) GetAllTransferFilePaths(ctx context.Context, fileID int64) ([]*putio.File, map[int64]string, error) {
+	client, raw, err := c.client(fileID)
+	if err != nil {
+		return nil, nil, err
+	}
+	files, paths, err := client.GetAllTransferFilePaths(ctx, raw)
+	_, account := split(fileID)
+	namespaced := make(map[int64]string, len(paths))
+	for id, path := range paths {
+		namespaced[namespace(id, account)] = path
+	}
+	return namespaceFiles(files, account), namespaced, err
+}
+
+// GetDownloadURL returns the download URL of a file from its account.
+func (c *MultiClient) GetDownloadURL(ctx context.Context, fileID int64) (string, error) {
+	client, raw, err := c.client(fileID)
+	if err != nil {
+		return "", err
+	}
+	return client.GetDownloadURL(ctx, raw)
+}
+
+// DeleteFile deletes a file from its account.
+func (c *MultiClient) DeleteFile(ctx context.Context, fileID int64) error {
+	client, raw, err := c.client(fileID)
+	if err != nil {
+		return err
+	}
+	return client.DeleteFile(ctx, raw)
+}
+
+// namespaceFiles rewrites the ids of an account's files in place.
+func namespaceFiles(files []*putio.File, account int) []*putio.File {
+	for _, f := range files {
+		f.ID = namespace(f.ID, account)
+		f.ParentID = namespace(f.ParentID, account)
+	}
+	return files
+}
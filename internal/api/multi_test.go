@@ -0,0 +1,183 @@
+package api
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/elsbrock/go-putio"
+)
+
+// fakeAccount is an APIClient backed by fixed data of a single account. Ids
+// passed in are recorded so tests can check they arrive un-namespaced.
+type fakeAccount struct {
+	APIClient
+	username  string
+	folderID  int64
+	folders   map[string]int64 // folders other than folderID, by name
+	transfers []*putio.Transfer
+	files     map[int64][]*putio.File
+	deleted   []int64
+	added     []int64
+}
+
+func (f *fakeAccount) Authenticate(ctx context.Context) error { return nil }
+
+func (f *fakeAccount) GetAccountInfo(ctx context.Context) (*putio.AccountInfo, error) {
+	return &putio.AccountInfo{Username: f.username}, nil
+}
+
+func (f *fakeAccount) EnsureFolder(ctx context.Context, name string) (int64, error) {
+	if id, ok := f.folders[name]; ok {
+		return id, nil
+	}
+	return f.folderID, nil
+}
+
+func (f *fakeAccount) AddTransfer(ctx context.Context, magnetLink string, folderID int64) (string, error) {
+	f.added = append(f.added, folderID)
+	return "hash", nil
+}
+
+func (f *fakeAccount) GetTransfers(ctx context.Context) ([]*putio.Transfer, error) {
+	var out []*putio.Transfer
+	for _, t := range f.transfers {
+		c := *t
+		out = append(out, &c)
+	}
+	return out, nil
+}
+
+func (f *fakeAccount) GetAllTransferFiles(ctx context.Context, fileID int64) ([]*putio.File, error) {
+	var out []*putio.File
+	for _, file := range f.files[fileID] {
+		c := *file
+		out = append(out, &c)
+	}
+	return out, nil
+}
+
+func (f *fakeAccount) DeleteFile(ctx context.Context, fileID int64) error {
+	f.deleted = append(f.deleted, fileID)
+	return nil
+}
+
+func (f *fakeAccount) BreakerStatus() BreakerStatus {
+	return BreakerStatus{State: BreakerClosed}
+}
+
+func TestMultiClient(t *testing.T) {
+	ctx := context.Background()
+	// Both accounts use the same ids, which must not collide
+	first := &fakeAccount{
+		username:  "alice",
+		folderID:  5,
+		transfers: []*putio.Transfer{{ID: 1, FileID: 10, SaveParentID: 5}},
+		files:     map[int64][]*putio.File{10: {{ID: 100, ParentID: 10}}},
+	}
+	second := &fakeAccount{
+		username:  "bob",
+		folderID:  7,
+		transfers: []*putio.Transfer{{ID: 1, FileID: 10, SaveParentID: 7}, {ID: 2, FileID: 20, SaveParentID: 99}},
+		files:     map[int64][]*putio.File{10: {{ID: 100, ParentID: 10}}},
+	}
+
+	c, err := NewMultiClient(first, second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Authenticate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	folderID, err := c.EnsureFolder(ctx, "plundrio")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transfers, err := c.GetTransfers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(transfers) != 3 {
+		t.Fatalf("got %d transfers, want 3", len(transfers))
+	}
+	a, b, other := transfers[0], transfers[1], transfers[2]
+	if a.ID == b.ID || a.FileID == b.FileID {
+		t.Errorf("ids of both accounts collide: %d/%d", a.ID, b.ID)
+	}
+	if a.SaveParentID != folderID || b.SaveParentID != folderID {
+		t.Errorf("watched folders = %d, %d, want both %d", a.SaveParentID, b.SaveParentID, folderID)
+	}
+	if other.SaveParentID == folderID {
+		t.Error("transfer outside the watched folder reported inside it")
+	}
+	if got := c.TransferAccount(a.ID); got != "alice" {
+		t.Errorf("TransferAccount(first) = %q, want alice", got)
+	}
+	if got := c.TransferAccount(b.ID); got != "bob" {
+		t.Errorf("TransferAccount(second) = %q, want bob", got)
+	}
+
+	// Files are fetched from and deleted in the transfer's own account
+	files, err := c.GetAllTransferFiles(ctx, b.FileID)
+	if err != nil || len(files) != 1 {
+		t.Fatalf("GetAllTransferFiles = %v, %v", files, err)
+	}
+	if err := c.DeleteFile(ctx, files[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if first.deleted != nil || !reflect.DeepEqual(second.deleted, []int64{100}) {
+		t.Errorf("deleted first=%v second=%v, want only 100 in second", first.deleted, second.deleted)
+	}
+
+	// New transfers go to the first account's folder
+	if _, err := c.AddTransfer(ctx, "magnet:?xt=urn:btih:x", folderID); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(first.added, []int64{5}) || second.added != nil {
+		t.Errorf("added first=%v second=%v, want folder 5 in first", first.added, second.added)
+	}
+}
+
+func TestMultiClientSeveralFolders(t *testing.T) {
+	ctx := context.Background()
+	first := &fakeAccount{
+		folderID:  5,
+		folders:   map[string]int64{"movies": 6},
+		transfers: []*putio.Transfer{{ID: 1, SaveParentID: 6}},
+	}
+	second := &fakeAccount{
+		folderID:  7,
+		folders:   map[string]int64{"movies": 8},
+		transfers: []*putio.Transfer{{ID: 1, SaveParentID: 7}, {ID: 2, SaveParentID: 8}},
+	}
+	c, err := NewMultiClient(first, second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tv, _ := c.EnsureFolder(ctx, "tv")
+	movies, _ := c.EnsureFolder(ctx, "movies")
+	c.EnsureFolder(ctx, "tv") // ensuring a folder again changes nothing
+
+	transfers, err := c.GetTransfers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []int64
+	for _, tr := range transfers {
+		got = append(got, tr.SaveParentID)
+	}
+	if want := []int64{movies, tv, movies}; !reflect.DeepEqual(got, want) {
+		t.Errorf("folders = %v, want %v", got, want)
+	}
+}
+
+func TestNewMultiClientLimits(t *testing.T) {
+	if _, err := NewMultiClient(); err == nil {
+		t.Error("expected an error without accounts")
+	}
+	clients := make([]APIClient, MaxAccounts+1)
+	if _, err := NewMultiClient(clients...); err == nil {
+		t.Error("expected an error with too many accounts")
+	}
+}
@@ -0,0 +1,183 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/elsbrock/go-putio"
+	"github.com/elsbrock/plundrio/internal/log"
+	"github.com/elsbrock/plundrio/internal/ratelimit"
+)
+
+const (
+	// retryAttempts is how often a throttled or failed request is sent
+	// before its response is handed back to the caller
+	retryAttempts = 4
+
+	// retryMaxDelay caps both the backoff and a Retry-After from Put.io. A
+	// longer Retry-After is not waited for; the response is returned as is.
+	retryMaxDelay = 30 * time.Second
+)
+
+// retryBaseDelay is the backoff after the first failed attempt; it doubles
+// after each further failure
+var retryBaseDelay = time.Second
+
+// retryTransport resends requests Put.io answered with 429 Too Many
+// Requests or a 5xx status, honouring Retry-After, and spaces out requests
+// with an optional limiter. Server errors are only retried for idempotent
+// methods so that e.g. a transfer is never added twice.
+type retryTransport struct {
+	next    http.RoundTripper
+	limiter *ratelimit.Bucket
+
+	// sleep waits for d or until ctx is done; tests replace it
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+func newRetryTransport(next http.RoundTripper, requestsPerSec float64) *retryTransport {
+	return &retryTransport{
+		next:    next,
+		limiter: ratelimit.New(requestsPerSec),
+		sleep:   sleepContext,
+	}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	for attempt := 1; ; attempt++ {
+		if wait := t.limiter.Reserve(1, time.Now()); wait > 0 {
+			log.Debug("api").
+				Str("path", req.URL.Path).
+				Dur("wait", wait).
+				Msg("Rate limiting Put.io request")
+			if err := t.sleep(ctx, wait); err != nil {
+				return nil, err
+			}
+		}
+
+		resp, err := t.next.RoundTrip(req)
+		if err != nil || attempt == retryAttempts || !retriable(req, resp) {
+			return resp, err
+		}
+		delay, ok := retryDelay(resp, attempt)
+		if !ok {
+			return resp, nil
+		}
+		body, ok := rewind(req)
+		if !ok {
+			return resp, nil
+		}
+
+		log.Warn("api").
+			Str("method", req.Method).
+			Str("path", req.URL.Path).
+			Int("status", resp.StatusCode).
+			Int("attempt", attempt).
+			Dur("delay", delay).
+			Msg("Put.io request throttled or failed, retrying")
+		// Drain the body so the connection can be reused
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		resp.Body.Close()
+
+		if err := t.sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+		req = req.Clone(ctx)
+		req.Body = body
+	}
+}
+
+// retriable reports whether resp may be worth sending req again for.
+func retriable(req *http.Request, resp *http.Response) bool {
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		// Throttled requests were not processed
+		return true
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return req.Method == http.MethodGet || req.Method == http.MethodHead
+	default:
+		return false
+	}
+}
+
+// uploadRetriable reports whether a failed upload may be sent again without
+// risking a duplicate transfer: when Put.io throttled it as retriable
+// decides, or when the connection failed before the request was sent.
+// Requests held back by the circuit breaker and cancelled requests are not
+// retried.
+func uploadRetriable(err error) bool {
+	if errors.Is(err, ErrPutioUnavailable) ||
+		errors.Is(err, context.Canceled) ||
+		errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var respErr *putio.ErrorResponse
+	if errors.As(err, &respErr) {
+		resp := respErr.Response
+		if resp.Request == nil {
+			return resp.StatusCode == http.StatusTooManyRequests
+		}
+		return retriable(resp.Request, resp)
+	}
+
+	var dnsErr *net.DNSError
+	var opErr *net.OpError
+	return errors.As(err, &dnsErr) || errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// retryDelay returns how long to wait before the next attempt: the
+// Retry-After of resp if present, otherwise an exponential backoff. ok is
+// false if Put.io asks for a longer wait than retryMaxDelay.
+func retryDelay(resp *http.Response, attempt int) (d time.Duration, ok bool) {
+	if d, present := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); present {
+		return d, d <= retryMaxDelay
+	}
+	return min(retryBaseDelay<<(attempt-1), retryMaxDelay), true
+}
+
+// parseRetryAfter parses a Retry-After header given either in seconds or as
+// an HTTP date.
+func parseRetryAfter(v string, now time.Time) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return max(time.Duration(secs)*time.Second, 0), true
+	}
+	if at, err := http.ParseTime(v); err == nil {
+		return max(at.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// rewind returns a fresh copy of the request body for another attempt. ok
+// is false for bodies that cannot be replayed, such as streamed uploads.
+func rewind(req *http.Request) (body io.ReadCloser, ok bool) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req.Body, true
+	}
+	if req.GetBody == nil {
+		return nil, false
+	}
+	body, err := req.GetBody()
+	return body, err == nil
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
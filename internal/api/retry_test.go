@@ -0,0 +1,169 @@
+package api
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryTransport(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		statuses   []int
+		retryAfter string
+		wantCalls  int
+		wantStatus int
+		wantDelays []time.Duration
+	}{
+		{
+			name:       "throttled then ok",
+			method:     http.MethodPost,
+			statuses:   []int{429, 429, 200},
+			wantCalls:  3,
+			wantStatus: 200,
+			wantDelays: []time.Duration{time.Second, 2 * time.Second},
+		},
+		{
+			name:       "honours Retry-After",
+			method:     http.MethodGet,
+			statuses:   []int{429, 200},
+			retryAfter: "7",
+			wantCalls:  2,
+			wantStatus: 200,
+			wantDelays: []time.Duration{7 * time.Second},
+		},
+		{
+			name:       "Retry-After too long",
+			method:     http.MethodGet,
+			statuses:   []int{429, 200},
+			retryAfter: "3600",
+			wantCalls:  1,
+			wantStatus: 429,
+		},
+		{
+			name:       "server error on GET",
+			method:     http.MethodGet,
+			statuses:   []int{503, 502, 503, 503, 200},
+			wantCalls:  retryAttempts,
+			wantStatus: 503,
+			wantDelays: []time.Duration{time.Second, 2 * time.Second, 4 * time.Second},
+		},
+		{
+			name:       "server error on POST",
+			method:     http.MethodPost,
+			statuses:   []int{500, 200},
+			wantCalls:  1,
+			wantStatus: 500,
+		},
+		{
+			name:       "client error",
+			method:     http.MethodGet,
+			statuses:   []int{404, 200},
+			wantCalls:  1,
+			wantStatus: 404,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int
+			var bodies []string
+			next := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				if req.Body != nil {
+					b, _ := io.ReadAll(req.Body)
+					bodies = append(bodies, string(b))
+				}
+				status := tt.statuses[calls]
+				calls++
+				resp := &http.Response{StatusCode: status, Header: http.Header{}, Body: http.NoBody}
+				if tt.retryAfter != "" {
+					resp.Header.Set("Retry-After", tt.retryAfter)
+				}
+				return resp, nil
+			})
+			rt := newRetryTransport(next, 0)
+			var delays []time.Duration
+			rt.sleep = func(_ context.Context, d time.Duration) error {
+				delays = append(delays, d)
+				return nil
+			}
+
+			req, _ := http.NewRequest(tt.method, "https://api.put.io/v2/transfers/add", strings.NewReader("url=magnet"))
+			resp, err := rt.RoundTrip(req)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", calls, tt.wantCalls)
+			}
+			if len(delays) != len(tt.wantDelays) {
+				t.Fatalf("delays = %v, want %v", delays, tt.wantDelays)
+			}
+			for i := range delays {
+				if delays[i] != tt.wantDelays[i] {
+					t.Errorf("delay %d = %v, want %v", i, delays[i], tt.wantDelays[i])
+				}
+			}
+			for i, b := range bodies {
+				if b != "url=magnet" {
+					t.Errorf("body of attempt %d = %q, want it replayed", i+1, b)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryTransportCancelled(t *testing.T) {
+	rt := newRetryTransport(roundTripFunc(func(*http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: 429, Header: http.Header{}, Body: http.NoBody}, nil
+	}), 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest(http.MethodGet, "https://api.put.io/v2/transfers/list", nil).WithContext(ctx)
+	if _, err := rt.RoundTrip(req); err != context.Canceled {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+}
+
+func TestRetryTransportUnreplayableBody(t *testing.T) {
+	calls := 0
+	rt := newRetryTransport(roundTripFunc(func(*http.Request) (*http.Response, error) {
+		calls++
+		return &http.Response{StatusCode: 429, Header: http.Header{}, Body: http.NoBody}, nil
+	}), 0)
+	req, _ := http.NewRequest(http.MethodPost, "https://upload.put.io/v2/files/upload", io.NopCloser(strings.NewReader("data")))
+	resp, err := rt.RoundTrip(req)
+	if err != nil || resp.StatusCode != 429 || calls != 1 {
+		t.Fatalf("got status %v, err %v after %d calls, want a single 429", resp.StatusCode, err, calls)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"", 0, false},
+		{"5", 5 * time.Second, true},
+		{"-3", 0, true},
+		{now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second, true},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0, true},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseRetryAfter(tt.value, now)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseRetryAfter(%q) = %v, %v, want %v, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// NewTLSConfig returns the TLS settings for connections to Put.io. caCert is
+// a PEM bundle trusted in addition to the system roots, for environments
+// whose trust store is incomplete; insecureSkipVerify disables certificate
+// verification altogether. It returns nil if neither is set, meaning Go's
+// defaults apply.
+func NewTLSConfig(caCert string, insecureSkipVerify bool) (*tls.Config, error) {
+	if caCert == "" && !insecureSkipVerify {
+		return nil, nil
+	}
+	cfg := &tls.Config{InsecureSkipVerify: insecureSkipVerify}
+	if caCert == "" {
+		return cfg, nil
+	}
+
+	pem, err := os.ReadFile(caCert)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no PEM certificates found in %s", caCert)
+	}
+	cfg.RootCAs = pool
+	return cfg, nil
+}
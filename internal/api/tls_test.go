@@ -0,0 +1,51 @@
+package api
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewTLSConfig(t *testing.T) {
+	if cfg, err := NewTLSConfig("", false); cfg != nil || err != nil {
+		t.Errorf("NewTLSConfig() = %v, %v; want nil for the defaults", cfg, err)
+	}
+	if cfg, err := NewTLSConfig("", true); err != nil || !cfg.InsecureSkipVerify {
+		t.Errorf("NewTLSConfig(insecure) = %v, %v", cfg, err)
+	}
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	// The server's self-signed certificate is only trusted from the bundle
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := http.Get(srv.URL); err == nil {
+		t.Fatal("expected the self-signed certificate to be rejected by default")
+	}
+	cfg, err := NewTLSConfig(bundle, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: cfg}}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("request with the CA bundle failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if err := os.WriteFile(bundle, []byte("not a certificate"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewTLSConfig(bundle, false); err == nil {
+		t.Error("expected an error for a bundle without certificates")
+	}
+	if _, err := NewTLSConfig(filepath.Join(t.TempDir(), "missing.pem"), false); err == nil {
+		t.Error("expected an error for a missing bundle")
+	}
+}
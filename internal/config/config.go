@@ -1,22 +1,389 @@
 package config
 
+import (
+	"crypto/tls"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// FolderMapping pairs a Put.io folder with the local directory its
+// transfers are downloaded to.
+type FolderMapping struct {
+	PutioFolder string
+	TargetDir   string
+	FolderID    int64 // set after creation/lookup
+}
+
 // Config holds the runtime configuration
 type Config struct {
 	// TargetDir is where completed downloads will be stored
 	TargetDir string
 
+	// TempDir holds partial downloads until they are complete, e.g. on a
+	// fast local disk when TargetDir is a network mount (empty keeps them
+	// next to their destination)
+	TempDir string
+
 	// PutioFolder is the name of the folder in Put.io
 	PutioFolder string
 
 	// FolderID is the Put.io folder ID (set after creation/lookup)
 	FolderID int64
 
+	// FolderMappings are further Put.io folders whose transfers are
+	// downloaded to their own target directory
+	FolderMappings []FolderMapping
+
 	// OAuthToken is the Put.io OAuth token
 	OAuthToken string
 
+	// AdditionalOAuthTokens are tokens of further Put.io accounts whose
+	// transfers are downloaded alongside those of the OAuthToken account
+	AdditionalOAuthTokens []string
+
 	// ListenAddr is the address to listen for transmission-rpc requests
 	ListenAddr string
 
 	// WorkerCount is the number of concurrent download workers (default: 4)
 	WorkerCount int
+
+	// TransferCheckInterval is how often Put.io is checked for finished
+	// transfers (default: 30s)
+	TransferCheckInterval time.Duration
+
+	// AdaptiveWorkers scales the number of download workers between
+	// AdaptiveMinWorkers and AdaptiveMaxWorkers based on measured throughput
+	AdaptiveWorkers bool
+
+	// AdaptiveMinWorkers is the lower bound of the adaptive worker count
+	AdaptiveMinWorkers int
+
+	// AdaptiveMaxWorkers is the upper bound of the adaptive worker count
+	AdaptiveMaxWorkers int
+
+	// AdaptiveTargetBandwidth is the aggregate download bandwidth in bytes
+	// per second the adaptive scaler aims for
+	AdaptiveTargetBandwidth int64
+
+	// VerifyExisting enables CRC32 verification of existing same-size files
+	// before they are skipped
+	VerifyExisting bool
+
+	// DisableQuotaMonitor turns off periodic Put.io disk quota checks
+	DisableQuotaMonitor bool
+
+	// QuotaCheckInterval is how often the Put.io disk quota is checked (default: 15m)
+	QuotaCheckInterval time.Duration
+
+	// QueueTimeout is how long a transfer may wait in the Put.io queue before
+	// it is acted upon (0 disables)
+	QueueTimeout time.Duration
+
+	// QueueTimeoutAction is "cancel" to cancel timed out transfers or
+	// "report" to keep them and report them as errored to clients
+	QueueTimeoutAction string
+
+	// TransferStallTimeout is how long a downloading transfer may make no
+	// local progress with none of its files queued or downloading before it
+	// is acted upon (0 disables)
+	TransferStallTimeout time.Duration
+
+	// TransferStallAction is "reenumerate" to list a stalled transfer's
+	// files again and queue missing ones, or "fail" to fail it
+	TransferStallAction string
+
+	// FailedTransferGrace is how long a transfer may stay failed after all
+	// of its files were attempted before it is acted upon (0 disables)
+	FailedTransferGrace time.Duration
+
+	// FailedTransferAction is "requeue" to download the failed files again,
+	// "report" to give up and report the failure to clients, or "delete" to
+	// also delete the transfer on Put.io
+	FailedTransferAction string
+
+	// AvailabilityThreshold is the Put.io availability percentage below
+	// which a preparing or downloading transfer is considered to lack
+	// seeders (default: 5)
+	AvailabilityThreshold int
+
+	// LowAvailabilityGrace is how long a transfer may stay below
+	// AvailabilityThreshold before it is reported (0 disables)
+	LowAvailabilityGrace time.Duration
+
+	// CancelLowAvailability cancels transfers exceeding
+	// LowAvailabilityGrace on Put.io instead of only reporting them
+	CancelLowAvailability bool
+
+	// ProgressSplit is the share of reported progress attributed to the Put.io
+	// phase, the rest being the local download (default: 0.5)
+	ProgressSplit float64
+
+	// CopyBufferSize is the size in bytes of the buffer used to write
+	// downloads to disk (0 uses the default of 32KB)
+	CopyBufferSize int
+
+	// SegmentsPerFile is how many connections a large file is downloaded
+	// over when the server supports range requests (1 downloads files in
+	// one piece)
+	SegmentsPerFile int
+
+	// MinFreeDiskBytes is how much disk space in the target directory must
+	// remain free after a download; downloads that would cut into it fail
+	// before they start
+	MinFreeDiskBytes int64
+
+	// DiskHeadroomPercent is added to a file's size when checking for free
+	// disk space, to account for filesystem overhead
+	DiskHeadroomPercent float64
+
+	// MaxDownloadRate caps the combined download rate of all workers in
+	// bytes per second (0 means unlimited)
+	MaxDownloadRate int64
+
+	// CompletionSettle is how long after Put.io reports a transfer as
+	// finished to wait before enumerating its files (0 disables)
+	CompletionSettle time.Duration
+
+	// HistoryFile is a file to which an entry is appended for every completed
+	// or failed transfer (CSV if it ends in .csv, JSON lines otherwise)
+	HistoryFile string
+
+	// WebhookURL receives a JSON POST for every processed transfer, e.g. to
+	// trigger a media library scan (disabled if empty)
+	WebhookURL string
+
+	// WebhookSecret signs webhook bodies with HMAC-SHA256 if set
+	WebhookSecret string
+
+	// OnCompleteCommand is a program run for every processed transfer with
+	// its name and local path as arguments (disabled if empty)
+	OnCompleteCommand string
+
+	// OnCompleteTimeout kills the completion command if it runs longer
+	// (default: 10m)
+	OnCompleteTimeout time.Duration
+
+	// RPCReadTimeout is the maximum duration for reading an RPC request
+	RPCReadTimeout time.Duration
+
+	// RPCWriteTimeout is the maximum duration for writing an RPC response
+	RPCWriteTimeout time.Duration
+
+	// RPCStrict answers unknown RPC methods with an error instead of an
+	// empty success
+	RPCStrict bool
+
+	// RPCUsername and RPCPassword are the credentials RPC clients must send
+	// as basic auth (no authentication if both are empty)
+	RPCUsername string
+	RPCPassword string
+
+	// RPCTLSCert and RPCTLSKey are the certificate and key files the RPC
+	// server uses to serve HTTPS; plaintext HTTP is served unless both are
+	// set
+	RPCTLSCert string
+	RPCTLSKey  string
+
+	// RPCTLSAuto generates a self-signed certificate at RPCTLSCert and
+	// RPCTLSKey if they don't exist yet
+	RPCTLSAuto bool
+
+	// PersistSessionSettings keeps values set via session-set across restarts
+	// in a sidecar file in the target directory
+	PersistSessionSettings bool
+
+	// StartPaused starts the download manager with downloads paused
+	StartPaused bool
+
+	// AdoptExisting downloads transfers that had already finished in the
+	// watched folder before plundrio started (default: true)
+	AdoptExisting bool
+
+	// FirstRunPolicy is "download-all" to download transfers that had
+	// finished before plundrio first ran against TargetDir, "skip-existing"
+	// to ignore them, or "mark-processed" to report them as downloaded
+	FirstRunPolicy string
+
+	// DiskErrorRetries is how many times a download is retried after a
+	// transient disk error such as ENOSPC or EIO (default: 5)
+	DiskErrorRetries int
+
+	// DownloadMaxRetries is how many times a download is attempted before
+	// transient network errors fail it (default: 3)
+	DownloadMaxRetries int
+
+	// DownloadRetryBaseDelay and DownloadRetryMaxDelay bound the jittered
+	// exponential backoff between attempts (default: 1s and 30s)
+	DownloadRetryBaseDelay time.Duration
+	DownloadRetryMaxDelay  time.Duration
+
+	// CleanupWorkers is how many completed transfers are finalized
+	// concurrently (default: 4)
+	CleanupWorkers int
+
+	// NoFilesRetries is how many scans a completed transfer without files is
+	// re-enumerated before it is failed (default: 3)
+	NoFilesRetries int
+
+	// CheckLocalCompleted reports finished Put.io transfers as complete only
+	// once plundrio has downloaded them (default: true)
+	CheckLocalCompleted bool
+
+	// StatusMapping overrides how Put.io transfer statuses are reported as
+	// Transmission status codes (e.g. "ERROR" → 4)
+	StatusMapping map[string]int
+
+	// DateSubfolder groups downloads into subfolders named after the date
+	// the transfer finished, using a strftime-like format such as "%Y-%m"
+	// ("" disables)
+	DateSubfolder string
+
+	// PreserveStructure recreates the subfolders of a transfer's Put.io
+	// folder locally instead of placing all files directly below the
+	// transfer directory
+	PreserveStructure bool
+
+	// IncludePatterns are glob patterns matched against a file's path
+	// within its transfer; if set, only matching files are downloaded
+	IncludePatterns []string
+
+	// ExcludePatterns are glob patterns of files never downloaded. They take
+	// precedence over IncludePatterns.
+	ExcludePatterns []string
+
+	// MinFileSize is the size in bytes below which files of a transfer are
+	// not downloaded, e.g. to skip samples (0 downloads all files)
+	MinFileSize int64
+
+	// SanitizeNames is "replace" or "strip" to replace or remove characters
+	// in file and folder names that SMB shares and exFAT reject, or "none"
+	// to keep names as they are
+	SanitizeNames string
+
+	// MaxNewPerScan caps how many ready transfers start processing per scan
+	// (0 means unlimited)
+	MaxNewPerScan int
+
+	// MaxFilesPerTransfer caps how many files of a single transfer download
+	// at the same time, leaving the other workers to other transfers (0
+	// means unlimited)
+	MaxFilesPerTransfer int
+
+	// MaxNewPriority is "age" to start the longest finished transfers first
+	// or "size" to start the smallest first when MaxNewPerScan is reached
+	MaxNewPriority string
+
+	// TrashOnRemove moves local data removed via torrent-remove into a .trash
+	// directory below TargetDir and purges it after this long (0 deletes
+	// immediately)
+	TrashOnRemove time.Duration
+
+	// EnableStream exposes the /stream/{hash}/{file} endpoint which proxies
+	// Put.io downloads to the requesting client without writing to disk
+	EnableStream bool
+
+	// StreamToken is the bearer token required by the streaming endpoint
+	StreamToken string
+
+	// HealthMaxPollAge makes /healthz answer 503 once the transfer list
+	// was last fetched from Put.io longer ago than this (0 disables)
+	HealthMaxPollAge time.Duration
+
+	// Version is the plundrio version reported by /healthz
+	Version string
+
+	// EnableMetrics exposes Prometheus metrics on /metrics
+	EnableMetrics bool
+
+	// AdminToken is the bearer token required by admin endpoints such as
+	// POST /rescan ("" disables them)
+	AdminToken string
+
+	// MaxListedTransfers caps how many transfers torrent-get returns, most
+	// recently created first, when no ids are requested (0 means unlimited)
+	MaxListedTransfers int
+
+	// DebugHTTP logs every HTTP request to Put.io at trace level, with
+	// tokens redacted
+	DebugHTTP bool
+
+	// APIRateLimit caps the requests per second sent to the Put.io API of
+	// each account (0 means unlimited)
+	APIRateLimit float64
+
+	// APITimeout bounds each request to the Put.io API (0 uses the default
+	// of 30s)
+	APITimeout time.Duration
+
+	// RemovedGracePeriod is how long a transfer removed via torrent-remove is
+	// hidden from torrent-get, even if a transfer list fetched before the
+	// removal still contains it (0 disables)
+	RemovedGracePeriod time.Duration
+
+	// DownloadDirAsCategory uses the last path segment of the downloadDir sent
+	// with torrent-add as the category, instead of its path relative to
+	// TargetDir
+	DownloadDirAsCategory bool
+
+	// SalvageErrored downloads the files of transfers Put.io reports as
+	// errored if they are all present, before retrying or deleting them
+	SalvageErrored bool
+
+	// DownloadHeaderTimeout is how long to wait for the response headers of a
+	// download (0 disables)
+	DownloadHeaderTimeout time.Duration
+
+	// DownloadReadTimeout is how long a read from a download connection may
+	// block before the connection is dropped and the download retried (0
+	// disables)
+	DownloadReadTimeout time.Duration
+
+	// DownloadStallTimeout is how long a download may go without making
+	// progress, for whatever reason, before it is cancelled and retried (0
+	// disables)
+	DownloadStallTimeout time.Duration
+
+	// PreferIPv4 connects to the download host over IPv4 first, for
+	// networks where IPv6 is routed but black-holed
+	PreferIPv4 bool
+
+	// TLSConfig holds the TLS settings of connections to Put.io, both API
+	// and downloads, built from --ca-cert and --insecure-skip-verify (nil
+	// uses the system defaults)
+	TLSConfig *tls.Config
+
+	// Proxy selects the proxy of connections to Put.io, built from --proxy
+	// (nil uses the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment
+	// variables)
+	Proxy func(*http.Request) (*url.URL, error)
+
+	// DialTimeout bounds how long connecting to the download host may take
+	// (0 uses the default of 30s)
+	DialTimeout time.Duration
+}
+
+// IsWatchedFolder reports whether transfers saved to a Put.io folder are
+// downloaded, i.e. whether it is the primary folder or a mapped one.
+func (c *Config) IsWatchedFolder(folderID int64) bool {
+	if folderID == c.FolderID {
+		return true
+	}
+	for _, mapping := range c.FolderMappings {
+		if folderID == mapping.FolderID {
+			return true
+		}
+	}
+	return false
+}
+
+// TransferTargetDir returns the local directory transfers saved to a Put.io
+// folder are downloaded to. Folders that aren't mapped use TargetDir.
+func (c *Config) TransferTargetDir(folderID int64) string {
+	for _, mapping := range c.FolderMappings {
+		if folderID == mapping.FolderID && folderID != c.FolderID {
+			return mapping.TargetDir
+		}
+	}
+	return c.TargetDir
 }
@@ -0,0 +1,124 @@
+package download
+
+import (
+	"sync"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// Tuning of the adaptive worker scaler
+const (
+	adaptiveSampleInterval = 10 * time.Second // how often throughput is sampled
+	adaptiveSampleWindow   = 3                // samples averaged per decision
+	adaptiveUpperBand      = 1.05             // above target*band: remove a worker
+	adaptiveLowerBand      = 0.90             // below target*band: add a worker if work is queued
+)
+
+// workerPool runs download workers and lets the adaptive scaler or a reload
+// grow or shrink their number at runtime. Retired workers finish their
+// current download before exiting.
+type workerPool struct {
+	m     *Manager
+	mu    sync.Mutex      // protects quits
+	quits []chan struct{} // one per running worker, closed to retire it
+}
+
+// Size returns the number of running workers.
+func (wp *workerPool) Size() int {
+	wp.mu.Lock()
+	defer wp.mu.Unlock()
+	return len(wp.quits)
+}
+
+// Resize starts or retires workers until n are running. Once the manager
+// stops, no workers are started.
+func (wp *workerPool) Resize(n int) {
+	wp.mu.Lock()
+	defer wp.mu.Unlock()
+
+	select {
+	case <-wp.m.stopChan:
+		n = min(n, len(wp.quits))
+	default:
+	}
+	for len(wp.quits) < n {
+		quit := make(chan struct{})
+		wp.quits = append(wp.quits, quit)
+		wp.m.workerWg.Add(1)
+		go func() {
+			defer wp.m.workerWg.Done()
+			wp.m.downloadWorker(quit)
+		}()
+	}
+	for len(wp.quits) > n {
+		last := len(wp.quits) - 1
+		close(wp.quits[last])
+		wp.quits = wp.quits[:last]
+	}
+}
+
+// nextWorkerCount decides how many workers to run given the average
+// throughput in bytes/sec. Workers are removed while the target bandwidth is
+// exceeded and added while it is not reached, but only if downloads are
+// waiting for a worker, since idle workers can't add throughput.
+func nextWorkerCount(current, minWorkers, maxWorkers int, throughput, target float64, queued bool) int {
+	next := current
+	switch {
+	case throughput > target*adaptiveUpperBand:
+		next--
+	case throughput < target*adaptiveLowerBand && queued:
+		next++
+	}
+	return max(minWorkers, min(maxWorkers, next))
+}
+
+// runAdaptiveScaler samples aggregate download throughput and resizes the
+// worker pool towards the configured target bandwidth until the manager
+// stops.
+func (m *Manager) runAdaptiveScaler(pool *workerPool) {
+	cfg := m.dlConfig
+	ticker := time.NewTicker(cfg.AdaptiveSampleInterval)
+	defer ticker.Stop()
+
+	var samples []float64
+	last := m.bytesTransferred.Load()
+	lastTime := time.Now()
+
+	for {
+		select {
+		case <-m.stopChan:
+			return
+		case now := <-ticker.C:
+			total := m.bytesTransferred.Load()
+			samples = append(samples, float64(total-last)/now.Sub(lastTime).Seconds())
+			last, lastTime = total, now
+			if len(samples) > adaptiveSampleWindow {
+				samples = samples[1:]
+			}
+
+			var sum float64
+			for _, s := range samples {
+				sum += s
+			}
+			throughput := sum / float64(len(samples))
+
+			current := pool.Size()
+			next := nextWorkerCount(current, cfg.AdaptiveMinWorkers, cfg.AdaptiveMaxWorkers,
+				throughput, float64(cfg.AdaptiveTargetBandwidth), m.queue.Len() > 0)
+			if next == current {
+				continue
+			}
+
+			log.Info("download").
+				Int("workers", next).
+				Int("previous_workers", current).
+				Float64("throughput_mbps", throughput/1024/1024).
+				Float64("target_mbps", float64(cfg.AdaptiveTargetBandwidth)/1024/1024).
+				Msg("Adjusting download workers")
+			pool.Resize(next)
+			// Start a fresh window so the new worker count is measured on its own
+			samples = samples[:0]
+		}
+	}
+}
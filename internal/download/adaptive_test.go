@@ -0,0 +1,79 @@
+package download
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextWorkerCount(t *testing.T) {
+	const target = 10 * 1024 * 1024
+
+	tests := []struct {
+		name       string
+		current    int
+		throughput float64
+		queued     bool
+		want       int
+	}{
+		{"below target with queued work scales up", 2, target * 0.5, true, 3},
+		{"below target without queued work stays", 2, target * 0.5, false, 2},
+		{"within band stays", 3, target * 0.95, true, 3},
+		{"above target scales down", 3, target * 1.2, true, 2},
+		{"never exceeds max", 4, 0, true, 4},
+		{"never drops below min", 1, target * 2, false, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nextWorkerCount(tt.current, 1, 4, tt.throughput, target, tt.queued); got != tt.want {
+				t.Errorf("nextWorkerCount() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWorkerPoolResize(t *testing.T) {
+	m := newTestManager()
+	pool := &workerPool{m: m}
+
+	pool.Resize(3)
+	if pool.Size() != 3 {
+		t.Fatalf("Size() = %d, want 3", pool.Size())
+	}
+
+	pool.Resize(1)
+	if pool.Size() != 1 {
+		t.Fatalf("Size() = %d, want 1", pool.Size())
+	}
+
+	// Retiring the remaining worker lets all of them exit
+	pool.Resize(0)
+	done := make(chan struct{})
+	go func() {
+		m.workerWg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("retired workers did not exit")
+	}
+}
+
+func TestWorkerPoolResizeAfterStop(t *testing.T) {
+	m := newTestManager()
+	pool := &workerPool{m: m}
+	pool.Resize(2)
+	close(m.stopChan)
+
+	// Stop waits for the workers, so none may be started from now on
+	pool.Resize(4)
+	if pool.Size() != 2 {
+		t.Errorf("Size() = %d after stop, want 2", pool.Size())
+	}
+	pool.Resize(1)
+	if pool.Size() != 1 {
+		t.Errorf("Size() = %d, want 1", pool.Size())
+	}
+	m.workerWg.Wait()
+}
@@ -1,34 +1,54 @@
 package download
 
 import (
-	"encoding/json"
 	"os"
-	"path/filepath"
+	"strings"
 	"sync"
 
 	"github.com/elsbrock/plundrio/internal/log"
 )
 
-const stateFileName = ".plundrio-state.json"
+// NormalizeHash returns the canonical form of a torrent info-hash. Put.io and
+// clients may use different letter cases for the same hash.
+func NormalizeHash(hash string) string {
+	return strings.ToLower(strings.TrimSpace(hash))
+}
 
 // CategoryStore persists a hash → category mapping so that downloads land in
 // the correct sub-directory (e.g. "tv", "movies") even across restarts.
 type CategoryStore struct {
-	mu        sync.RWMutex
-	mapping   map[string]string
-	stateFile string
+	mu      sync.RWMutex
+	mapping map[string]string
+	state   *stateFile
 }
 
 func newCategoryStore(targetDir string) *CategoryStore {
+	return newCategoryStoreWithState(newStateFile(targetDir))
+}
+
+func newCategoryStoreWithState(state *stateFile) *CategoryStore {
 	return &CategoryStore{
-		mapping:   make(map[string]string),
-		stateFile: filepath.Join(targetDir, stateFileName),
+		mapping: make(map[string]string),
+		state:   state,
 	}
 }
 
-// Load reads persisted categories from disk. A missing file is not an error.
+// Load reads persisted categories from disk, first upgrading a state file
+// written in an older format. A missing file is not an error.
 func (cs *CategoryStore) Load() {
-	data, err := os.ReadFile(cs.stateFile)
+	if from, backup, err := cs.state.Migrate(); err != nil {
+		if !os.IsNotExist(err) {
+			log.Error("categories").Err(err).Msg("Failed to migrate state")
+		}
+	} else if backup != "" {
+		log.Info("categories").
+			Int("from_version", from).
+			Int("to_version", stateVersion).
+			Str("backup", backup).
+			Msg("Migrated state file")
+	}
+
+	st, err := cs.state.Read()
 	if err != nil {
 		if !os.IsNotExist(err) {
 			log.Error("categories").Err(err).Msg("Failed to load category state")
@@ -39,8 +59,8 @@ func (cs *CategoryStore) Load() {
 	cs.mu.Lock()
 	defer cs.mu.Unlock()
 
-	if err := json.Unmarshal(data, &cs.mapping); err != nil {
-		log.Error("categories").Err(err).Msg("Failed to parse category state")
+	for hash, category := range st.Categories {
+		cs.mapping[NormalizeHash(hash)] = category
 	}
 }
 
@@ -51,7 +71,7 @@ func (cs *CategoryStore) Set(hash, category string) {
 	}
 
 	cs.mu.Lock()
-	cs.mapping[hash] = category
+	cs.mapping[NormalizeHash(hash)] = category
 	cs.mu.Unlock()
 
 	cs.save()
@@ -61,29 +81,55 @@ func (cs *CategoryStore) Set(hash, category string) {
 func (cs *CategoryStore) Get(hash string) string {
 	cs.mu.RLock()
 	defer cs.mu.RUnlock()
-	return cs.mapping[hash]
+	return cs.mapping[NormalizeHash(hash)]
 }
 
 // Remove deletes the category for a hash and persists to disk.
 func (cs *CategoryStore) Remove(hash string) {
 	cs.mu.Lock()
-	delete(cs.mapping, hash)
+	delete(cs.mapping, NormalizeHash(hash))
 	cs.mu.Unlock()
 
 	cs.save()
 }
 
+// Rename moves the category stored under oldHash to newHash, for transfers
+// whose hash changed after Put.io fetched the torrent metadata. An existing
+// category for newHash is kept.
+func (cs *CategoryStore) Rename(oldHash, newHash string) bool {
+	oldHash, newHash = NormalizeHash(oldHash), NormalizeHash(newHash)
+	if oldHash == newHash {
+		return false
+	}
+
+	cs.mu.Lock()
+	category, ok := cs.mapping[oldHash]
+	if ok {
+		delete(cs.mapping, oldHash)
+		if _, exists := cs.mapping[newHash]; !exists && newHash != "" {
+			cs.mapping[newHash] = category
+		}
+	}
+	cs.mu.Unlock()
+
+	if ok {
+		cs.save()
+	}
+	return ok
+}
+
 func (cs *CategoryStore) save() {
 	cs.mu.RLock()
-	data, err := json.Marshal(cs.mapping)
+	mapping := make(map[string]string, len(cs.mapping))
+	for hash, category := range cs.mapping {
+		mapping[hash] = category
+	}
 	cs.mu.RUnlock()
 
+	err := cs.state.Update(func(st *persistedState) {
+		st.Categories = mapping
+	})
 	if err != nil {
-		log.Error("categories").Err(err).Msg("Failed to marshal category state")
-		return
-	}
-
-	if err := os.WriteFile(cs.stateFile, data, 0644); err != nil {
 		log.Error("categories").Err(err).Msg("Failed to save category state")
 	}
 }
@@ -97,3 +97,41 @@ func TestCategoryStore_RemovePersists(t *testing.T) {
 		t.Errorf("After reload hash2 = %q, want %q", got, "movies")
 	}
 }
+
+func TestCategoryStore_HashCaseInsensitive(t *testing.T) {
+	dir := t.TempDir()
+	cs := newCategoryStore(dir)
+
+	cs.Set("ABC123", "tv")
+	if got := cs.Get("abc123"); got != "tv" {
+		t.Errorf("Get with lowercase hash = %q, want %q", got, "tv")
+	}
+
+	cs.Remove("Abc123")
+	if got := cs.Get("ABC123"); got != "" {
+		t.Errorf("Get after mixed-case Remove = %q, want %q", got, "")
+	}
+}
+
+func TestCategoryStore_Rename(t *testing.T) {
+	cs := newCategoryStore(t.TempDir())
+	cs.Set("old", "tv")
+	cs.Set("taken", "movies")
+
+	if !cs.Rename("old", "NEW") {
+		t.Fatal("Rename of existing hash returned false")
+	}
+	if got := cs.Get("new"); got != "tv" {
+		t.Errorf("Get(new) = %q, want %q", got, "tv")
+	}
+	if cs.Rename("missing", "new") {
+		t.Error("Rename of unknown hash returned true")
+	}
+
+	// An existing mapping for the new hash wins
+	cs.Set("other", "anime")
+	cs.Rename("other", "taken")
+	if got := cs.Get("taken"); got != "movies" {
+		t.Errorf("Get(taken) = %q, want %q", got, "movies")
+	}
+}
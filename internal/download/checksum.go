@@ -0,0 +1,34 @@
+package download
+
+import (
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"strings"
+)
+
+// fileCRC32 computes the IEEE CRC32 checksum of a local file and returns it as
+// a zero-padded lowercase hex string, matching the format of putio.File.CRC32.
+func fileCRC32(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file for checksum: %w", err)
+	}
+	defer f.Close()
+
+	h := crc32.NewIEEE()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to read file for checksum: %w", err)
+	}
+	return fmt.Sprintf("%08x", h.Sum32()), nil
+}
+
+// checksumMatches reports whether the local file at path has the given CRC32.
+func checksumMatches(path, expected string) (bool, error) {
+	actual, err := fileCRC32(path)
+	if err != nil {
+		return false, err
+	}
+	return strings.EqualFold(actual, expected), nil
+}
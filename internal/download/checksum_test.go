@@ -0,0 +1,57 @@
+package download
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileCRC32(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.bin")
+	if err := os.WriteFile(path, []byte("hello world"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := fileCRC32(path)
+	if err != nil {
+		t.Fatalf("fileCRC32 failed: %v", err)
+	}
+	if got != "0d4a1185" {
+		t.Errorf("fileCRC32 = %q, want %q", got, "0d4a1185")
+	}
+}
+
+func TestChecksumMatches(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.bin")
+	if err := os.WriteFile(path, []byte("hello world"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		expected string
+		want     bool
+	}{
+		{name: "exact match", expected: "0d4a1185", want: true},
+		{name: "uppercase match", expected: "0D4A1185", want: true},
+		{name: "mismatch", expected: "deadbeef", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := checksumMatches(path, tt.expected)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("checksumMatches(%q) = %v, want %v", tt.expected, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChecksumMatchesMissingFile(t *testing.T) {
+	if _, err := checksumMatches(filepath.Join(t.TempDir(), "missing"), "0d4a1185"); err == nil {
+		t.Error("expected error for missing file, got nil")
+	}
+}
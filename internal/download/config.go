@@ -1,15 +1,17 @@
 package download
 
-import "time"
+import (
+	"crypto/tls"
+	"net/http"
+	"net/url"
+	"time"
+)
 
 // DownloadConfig contains configuration options for the download manager
 type DownloadConfig struct {
 	// DefaultWorkerCount is the default number of concurrent download workers
 	DefaultWorkerCount int
 
-	// BufferMultiple is used to calculate the job channel buffer size (workerCount * BufferMultiple)
-	BufferMultiple int
-
 	// ProgressUpdateInterval is how often download progress is logged
 	ProgressUpdateInterval time.Duration
 
@@ -19,26 +21,185 @@ type DownloadConfig struct {
 	// IdleConnectionTimeout is the maximum amount of time an idle connection is kept open
 	IdleConnectionTimeout time.Duration
 
-	// DownloadHeaderTimeout is the timeout for receiving the response headers
+	// DownloadHeaderTimeout is the timeout for receiving the response headers (0 disables)
 	DownloadHeaderTimeout time.Duration
 
-	// DownloadStallTimeout is how long a download can stall before being cancelled
+	// DownloadReadTimeout is how long a read from a download connection may block before the connection is considered dead (0 disables)
+	DownloadReadTimeout time.Duration
+
+	// DownloadStallTimeout is how long a download may go without making progress before it is cancelled and retried (0 disables)
 	DownloadStallTimeout time.Duration
 
+	// TLSConfig replaces the default TLS settings of download connections (nil uses the system defaults)
+	TLSConfig *tls.Config
+
+	// Proxy selects the proxy of download connections (nil uses the proxy environment variables)
+	Proxy func(*http.Request) (*url.URL, error)
+
 	// CopyTimeout is the timeout for waiting for the copy operation to complete after cancellation
 	CopyTimeout time.Duration
+
+	// CopyBufferSize is the size in bytes of the buffer used to copy download bodies to disk
+	CopyBufferSize int
+
+	// SegmentsPerFile is how many ranged connections a large file is split across (1 downloads in one piece)
+	SegmentsPerFile int
+
+	// MinFreeDiskBytes is how much disk space must remain free after a download, checked before it starts
+	MinFreeDiskBytes int64
+
+	// DiskHeadroomPercent is added to a file's size when checking for free disk space, for filesystem overhead
+	DiskHeadroomPercent float64
+
+	// MaxDownloadRate caps the combined download rate of all workers in bytes per second (0 means unlimited)
+	MaxDownloadRate int64
+
+	// DownloadMaxRetries is how many times a download is attempted before transient network errors fail it
+	DownloadMaxRetries int
+
+	// DownloadRetryBaseDelay is the delay before the first retry after a network error; it doubles on every retry
+	DownloadRetryBaseDelay time.Duration
+
+	// DownloadRetryMaxDelay caps the delay between retries after network errors
+	DownloadRetryMaxDelay time.Duration
+
+	// DiskErrorRetries is how many times a download is retried after a transient disk error
+	DiskErrorRetries int
+
+	// DiskErrorBackoff is the initial delay before retrying after a disk error; it doubles on every retry
+	DiskErrorBackoff time.Duration
+
+	// NoFilesRetries is how many scans a completed transfer with no files is re-enumerated before failing
+	NoFilesRetries int
+
+	// CleanupWorkers bounds how many completed transfers are finalized concurrently
+	CleanupWorkers int
+
+	// VerifyExisting checks the CRC32 of existing same-size files against Put.io before skipping them
+	VerifyExisting bool
+
+	// AdoptExisting processes transfers that finished before the manager started
+	AdoptExisting bool
+
+	// FirstRunPolicy is what to do with transfers that finished before the first run (FirstRunPolicyDownloadAll, FirstRunPolicySkipExisting or FirstRunPolicyMarkProcessed)
+	FirstRunPolicy string
+
+	// CompletionSettle is how long to wait after a transfer's FinishedAt before enumerating its files
+	CompletionSettle time.Duration
+
+	// AdaptiveWorkers scales the number of download workers towards AdaptiveTargetBandwidth
+	AdaptiveWorkers bool
+
+	// AdaptiveMinWorkers and AdaptiveMaxWorkers bound the adaptive worker count
+	AdaptiveMinWorkers int
+	AdaptiveMaxWorkers int
+
+	// AdaptiveTargetBandwidth is the aggregate download bandwidth in bytes/sec the scaler aims for
+	AdaptiveTargetBandwidth int64
+
+	// AdaptiveSampleInterval is how often the adaptive scaler samples throughput
+	AdaptiveSampleInterval time.Duration
+
+	// DateSubfolder is a strftime-like format (e.g. "%Y-%m") for a per-date subfolder below the category ("" disables)
+	DateSubfolder string
+
+	// SanitizeNames is how names illegal on restrictive filesystems are made safe (SanitizeNamesNone, SanitizeNamesReplace or SanitizeNamesStrip)
+	SanitizeNames string
+
+	// IncludePatterns are globs of which a file must match one to be downloaded (empty downloads all files)
+	IncludePatterns []string
+
+	// ExcludePatterns are globs of files never downloaded, taking precedence over IncludePatterns
+	ExcludePatterns []string
+
+	// MinFileSize is the size in bytes below which files are not downloaded (0 downloads all files)
+	MinFileSize int64
+
+	// PreserveStructure keeps the Put.io subfolders of a transfer locally instead of flattening its files
+	PreserveStructure bool
+
+	// MaxNewPerScan caps how many ready transfers start processing per scan (0 means unlimited)
+	MaxNewPerScan int
+
+	// MaxFilesPerTransfer caps how many files of one transfer download at once (0 means unlimited)
+	MaxFilesPerTransfer int
+
+	// MaxNewPriority picks which transfers start first when capped (PriorityAge or PrioritySize)
+	MaxNewPriority string
+
+	// TransferStallTimeout is how long a downloading transfer may make no progress before action is taken (0 disables)
+	TransferStallTimeout time.Duration
+
+	// TransferStallAction is what to do with stalled transfers (TransferStallActionReenumerate or TransferStallActionFail)
+	TransferStallAction string
+
+	// FailedTransferGrace is how long a transfer may stay failed with all files accounted for before action is taken (0 disables)
+	FailedTransferGrace time.Duration
+
+	// FailedTransferAction is what to do with such transfers (FailedTransferActionRequeue, FailedTransferActionReport or FailedTransferActionDelete)
+	FailedTransferAction string
+
+	// QueueTimeout is how long a transfer may wait in IN_QUEUE/WAITING before action is taken (0 disables)
+	QueueTimeout time.Duration
+
+	// DebugHTTP logs every download request at trace level
+	DebugHTTP bool
+
+	// DialTimeout bounds how long connecting to the download host may take
+	DialTimeout time.Duration
+
+	// SalvageErrored downloads errored transfers whose files are complete on Put.io instead of retrying them
+	SalvageErrored bool
+
+	// PreferIPv4 connects to the download host over IPv4 first, falling back to IPv6 only if that fails
+	PreferIPv4 bool
+
+	// QueueTimeoutAction is what to do with timed out transfers (QueueTimeoutActionCancel or QueueTimeoutActionReport)
+	QueueTimeoutAction string
+
+	// AvailabilityThreshold is the Put.io availability percentage below which a preparing or downloading transfer counts as lacking seeders
+	AvailabilityThreshold int
+
+	// LowAvailabilityGrace is how long a transfer may stay below AvailabilityThreshold before action is taken (0 disables)
+	LowAvailabilityGrace time.Duration
+
+	// TempDir holds partial downloads until they are complete instead of the target directory (empty keeps them next to their destination)
+	TempDir string
+
+	// CancelLowAvailability cancels transfers exceeding LowAvailabilityGrace instead of only logging a warning
+	CancelLowAvailability bool
 }
 
 // GetDefaultConfig returns a DownloadConfig with reasonable default values
 func GetDefaultConfig() *DownloadConfig {
 	return &DownloadConfig{
 		DefaultWorkerCount:     3,                // 3 concurrent downloads by default
-		BufferMultiple:         5,                // Buffer size = 5 * worker count
 		ProgressUpdateInterval: 5 * time.Second,  // Log progress every 5 seconds
 		TransferCheckInterval:  30 * time.Second, // Check for new transfers every 30 seconds
 		IdleConnectionTimeout:  90 * time.Second, // Keep idle connections for 90 seconds
+		DialTimeout:            30 * time.Second, // Same as http.DefaultTransport
 		DownloadHeaderTimeout:  30 * time.Second, // 30 second timeout for response headers
+		DownloadReadTimeout:    2 * time.Minute,  // Drop connections silent for 2 minutes
 		DownloadStallTimeout:   2 * time.Minute,  // Cancel download if stalled for 2 minutes
 		CopyTimeout:            10 * time.Second, // Wait 10 seconds for copy to complete after cancellation
+		CopyBufferSize:         32 * 1024,        // Same as io.Copy's default buffer
+		SegmentsPerFile:        1,                // One connection per file
+		AdoptExisting:          true,             // Sync the folder's backlog on startup
+		FirstRunPolicy:         FirstRunPolicyDownloadAll,
+		SanitizeNames:          SanitizeNamesNone,
+		CleanupWorkers:         4,                // Finalize up to 4 transfers at once
+		NoFilesRetries:         3,                // Give Put.io 3 scans to index files
+		DownloadMaxRetries:     3,                // Attempt downloads 3 times on network errors
+		DownloadRetryBaseDelay: time.Second,      // First network error retry after about a second
+		DownloadRetryMaxDelay:  30 * time.Second, // Never wait longer than 30 seconds between attempts
+		DiskErrorRetries:       5,                // Retry disk errors 5 times (10s, 20s, 40s, ...)
+		DiskErrorBackoff:       10 * time.Second, // First disk error retry after 10 seconds
+		QueueTimeoutAction:     QueueTimeoutActionCancel,
+		AvailabilityThreshold:  5, // Transfers below 5% availability lack seeders
+		TransferStallAction:    TransferStallActionReenumerate,
+		FailedTransferGrace:    30 * time.Minute, // Requeue transfers with failed files after 30 minutes
+		FailedTransferAction:   FailedTransferActionRequeue,
+		MaxNewPriority:         PriorityAge,
+		AdaptiveSampleInterval: adaptiveSampleInterval,
 	}
 }
@@ -3,6 +3,7 @@ package download
 import (
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/elsbrock/plundrio/internal/log"
 )
@@ -11,7 +12,9 @@ import (
 type TransferCoordinator struct {
 	transfers           sync.Map // map[int64]*TransferContext
 	onTransferProcessed func(int64)
-	cleanupHooks        []func(int64) error
+	cleanupHooks        []func(TransferEvent) error
+	failureHooks        []func(TransferEvent, error)
+	completionHooks     []func(TransferEvent)
 }
 
 // NewTransferCoordinator creates a new transfer coordinator.
@@ -19,7 +22,9 @@ type TransferCoordinator struct {
 func NewTransferCoordinator(onProcessed func(int64)) *TransferCoordinator {
 	return &TransferCoordinator{
 		onTransferProcessed: onProcessed,
-		cleanupHooks:        make([]func(int64) error, 0),
+		cleanupHooks:        make([]func(TransferEvent) error, 0),
+		failureHooks:        make([]func(TransferEvent, error), 0),
+		completionHooks:     make([]func(TransferEvent), 0),
 	}
 }
 
@@ -31,11 +36,33 @@ func (tc *TransferCoordinator) RangeTransfers(fn func(transferID int64, ctx *Tra
 	})
 }
 
-// RegisterCleanupHook adds a function to be called during transfer cleanup
-func (tc *TransferCoordinator) RegisterCleanupHook(hook func(int64) error) {
+// RegisterCleanupHook adds a function to be called during transfer cleanup.
+// Hooks run with the transfer context lock held and must not call back into
+// the context.
+func (tc *TransferCoordinator) RegisterCleanupHook(hook func(TransferEvent) error) {
 	tc.cleanupHooks = append(tc.cleanupHooks, hook)
 }
 
+// RegisterFailureHook adds a function to be called when a transfer fails,
+// either explicitly or because all of its files were processed with failures.
+// Hooks run without the transfer context lock held.
+func (tc *TransferCoordinator) RegisterFailureHook(hook func(TransferEvent, error)) {
+	tc.failureHooks = append(tc.failureHooks, hook)
+}
+
+// runFailureHooks calls all registered failure hooks for a transfer
+func (tc *TransferCoordinator) runFailureHooks(event TransferEvent, err error) {
+	for _, hook := range tc.failureHooks {
+		hook(event, err)
+	}
+}
+
+// RegisterCompletionHook adds a function to be called after a transfer has
+// been processed. Hooks run without the transfer context lock held.
+func (tc *TransferCoordinator) RegisterCompletionHook(hook func(TransferEvent)) {
+	tc.completionHooks = append(tc.completionHooks, hook)
+}
+
 // InitiateTransfer starts tracking a new transfer
 func (tc *TransferCoordinator) InitiateTransfer(id int64, name string, fileID int64, totalFiles int) *TransferContext {
 	ctx := &TransferContext{
@@ -43,6 +70,7 @@ func (tc *TransferCoordinator) InitiateTransfer(id int64, name string, fileID in
 		Name:       name,
 		FileID:     fileID,
 		TotalFiles: int32(totalFiles),
+		StartTime:  time.Now(),
 		state:      TransferLifecycleInitial,
 	}
 	tc.transfers.Store(id, ctx)
@@ -90,6 +118,15 @@ func (tc *TransferCoordinator) FileCompleted(transferID int64) error {
 		return nil
 	}
 
+	// Failure hooks run after the lock is released (defers run in reverse order)
+	var failErr error
+	var event TransferEvent
+	defer func() {
+		if failErr != nil {
+			tc.runFailureHooks(event, failErr)
+		}
+	}()
+
 	ctx.mu.Lock()
 	defer ctx.mu.Unlock()
 
@@ -142,11 +179,15 @@ func (tc *TransferCoordinator) FileCompleted(transferID int64) error {
 				Msg("Transfer marked as completed, waiting for final cleanup")
 		} else {
 			ctx.state = TransferLifecycleFailed
+			ctx.failedAt = time.Now()
+			failErr = fmt.Errorf("%d of %d files failed", ctx.failedFiles, ctx.TotalFiles)
+			event = ctx.eventLocked()
 			log.Info("transfer").
 				Int64("id", transferID).
 				Str("name", ctx.Name).
 				Int32("failed", ctx.failedFiles).
 				Int32("total", ctx.TotalFiles).
+				Str("failed_files", ctx.failedFilesSummary()).
 				Msg("Transfer has failed files, keeping for retry")
 		}
 	}
@@ -165,6 +206,15 @@ func (tc *TransferCoordinator) FileFailure(transferID int64) error {
 		return nil
 	}
 
+	// Failure hooks run after the lock is released (defers run in reverse order)
+	var failErr error
+	var event TransferEvent
+	defer func() {
+		if failErr != nil {
+			tc.runFailureHooks(event, failErr)
+		}
+	}()
+
 	ctx.mu.Lock()
 	defer ctx.mu.Unlock()
 
@@ -192,12 +242,16 @@ func (tc *TransferCoordinator) FileFailure(transferID int64) error {
 
 	// Check if all files are processed (completed + failed = total)
 	if completed+failed >= total {
+		ctx.failedAt = time.Now()
+		failErr = fmt.Errorf("%d of %d files failed", failed, total)
+		event = ctx.eventLocked()
 		log.Info("transfer").
 			Int64("id", transferID).
 			Str("name", ctx.Name).
 			Int32("failed", failed).
 			Int32("completed", completed).
 			Int32("total", total).
+			Str("failed_files", ctx.failedFilesSummary()).
 			Msg("All files processed, some failed, keeping transfer for retry")
 	}
 
@@ -212,6 +266,17 @@ func (tc *TransferCoordinator) CompleteTransfer(transferID int64) error {
 		return NewTransferNotFoundError(transferID)
 	}
 
+	// Completion hooks run after the lock is released (defers run in reverse order)
+	processed := false
+	var event TransferEvent
+	defer func() {
+		if processed {
+			for _, hook := range tc.completionHooks {
+				hook(event)
+			}
+		}
+	}()
+
 	ctx.mu.Lock()
 	defer ctx.mu.Unlock()
 
@@ -242,8 +307,9 @@ func (tc *TransferCoordinator) CompleteTransfer(transferID int64) error {
 		Msg("Transfer fully completed and cleaning up")
 
 	// Run cleanup hooks
+	event = ctx.eventLocked()
 	for _, hook := range tc.cleanupHooks {
-		if err := hook(transferID); err != nil {
+		if err := hook(event); err != nil {
 			log.Error("transfer").
 				Int64("id", transferID).
 				Err(err).
@@ -256,6 +322,7 @@ func (tc *TransferCoordinator) CompleteTransfer(transferID int64) error {
 
 	// Notify that the transfer has been processed
 	tc.onTransferProcessed(transferID)
+	processed = true
 
 	log.Info("transfer").
 		Int64("id", transferID).
@@ -272,6 +339,15 @@ func (tc *TransferCoordinator) FailTransfer(transferID int64, err error) error {
 		return NewTransferNotFoundError(transferID)
 	}
 
+	// Failure hooks run after the lock is released (defers run in reverse order)
+	var failErr error
+	var event TransferEvent
+	defer func() {
+		if failErr != nil {
+			tc.runFailureHooks(event, failErr)
+		}
+	}()
+
 	ctx.mu.Lock()
 	defer ctx.mu.Unlock()
 
@@ -289,6 +365,8 @@ func (tc *TransferCoordinator) FailTransfer(transferID int64, err error) error {
 	// For real failures, mark as failed but don't clean up
 	ctx.state = TransferLifecycleFailed
 	ctx.err = err
+	failErr = err
+	event = ctx.eventLocked()
 
 	log.Error("transfer").
 		Int64("id", transferID).
@@ -299,6 +377,41 @@ func (tc *TransferCoordinator) FailTransfer(transferID int64, err error) error {
 	return nil
 }
 
+// AbandonTransfer gives up on a failed transfer, recording err to be
+// reported to clients. Failure hooks are not run again since they already
+// ran when the transfer failed.
+func (tc *TransferCoordinator) AbandonTransfer(transferID int64, err error) error {
+	ctx, ok := tc.GetTransferContext(transferID)
+	if !ok {
+		return NewTransferNotFoundError(transferID)
+	}
+
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+
+	if ctx.state != TransferLifecycleFailed {
+		return fmt.Errorf("cannot abandon transfer %d in state %s", transferID, ctx.state)
+	}
+	ctx.err = err
+
+	log.Error("transfer").
+		Int64("id", transferID).
+		Str("name", ctx.Name).
+		Err(err).
+		Msg("Gave up on failed transfer")
+
+	return nil
+}
+
+// ForgetTransfer stops tracking a transfer, so that it is processed again
+// from scratch when it is next seen as ready.
+func (tc *TransferCoordinator) ForgetTransfer(transferID int64) {
+	tc.transfers.Delete(transferID)
+	log.Debug("transfer").
+		Int64("id", transferID).
+		Msg("Transfer context removed")
+}
+
 // GetTransferContext safely retrieves a transfer context
 func (tc *TransferCoordinator) GetTransferContext(transferID int64) (*TransferContext, bool) {
 	if value, ok := tc.transfers.Load(transferID); ok {
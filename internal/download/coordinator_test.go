@@ -23,8 +23,11 @@ func newTestManager() *Manager {
 		cfg:        cfg,
 		dlConfig:   dlConfig,
 		categories: newCategoryStore(cfg.TargetDir),
+		pause:      newPauseGate(false),
 		stopChan:   make(chan struct{}),
-		jobs:       make(chan downloadJob, 5),
+		queue:      newJobQueue(0),
+		jobs:       make(chan downloadJob),
+		rescans:    make(chan chan rescanResult),
 	}
 	m.processor = newTransferProcessor(m)
 	m.coordinator = NewTransferCoordinator(func(transferID int64) {
@@ -225,17 +228,17 @@ func TestCoordinatorCompleteTransferRunsCleanupHooks(t *testing.T) {
 	var hookCalls []int64
 	var hookMu sync.Mutex
 
-	tc.RegisterCleanupHook(func(transferID int64) error {
+	tc.RegisterCleanupHook(func(event TransferEvent) error {
 		hookMu.Lock()
 		defer hookMu.Unlock()
-		hookCalls = append(hookCalls, transferID)
+		hookCalls = append(hookCalls, event.ID)
 		return nil
 	})
 
-	tc.RegisterCleanupHook(func(transferID int64) error {
+	tc.RegisterCleanupHook(func(event TransferEvent) error {
 		hookMu.Lock()
 		defer hookMu.Unlock()
-		hookCalls = append(hookCalls, transferID)
+		hookCalls = append(hookCalls, event.ID)
 		return nil
 	})
 
@@ -263,11 +266,49 @@ func TestCoordinatorCompleteTransferRunsCleanupHooks(t *testing.T) {
 	}
 }
 
+func TestCoordinatorHooksReceiveTransferEvent(t *testing.T) {
+	m := newTestManager()
+	tc := m.coordinator
+
+	var cleaned, completed TransferEvent
+	tc.RegisterCleanupHook(func(event TransferEvent) error {
+		cleaned = event
+		return nil
+	})
+	tc.RegisterCompletionHook(func(event TransferEvent) {
+		completed = event
+	})
+
+	ctx := tc.InitiateTransfer(1, "My.Show.S01", 100, 1)
+	ctx.SetHash("abc123")
+	ctx.SetLocation("tv", "/downloads/tv/My.Show.S01")
+	tc.StartDownload(1)
+	tc.FileCompleted(1)
+	if err := tc.CompleteTransfer(1); err != nil {
+		t.Fatalf("CompleteTransfer failed: %v", err)
+	}
+
+	want := TransferEvent{
+		ID:       1,
+		Name:     "My.Show.S01",
+		Hash:     "abc123",
+		FileID:   100,
+		Category: "tv",
+		Path:     "/downloads/tv/My.Show.S01",
+	}
+	if cleaned != want {
+		t.Errorf("cleanup hook event = %+v, want %+v", cleaned, want)
+	}
+	if completed != want {
+		t.Errorf("completion hook event = %+v, want %+v", completed, want)
+	}
+}
+
 func TestCoordinatorCleanupHookErrorDoesNotBlockCompletion(t *testing.T) {
 	m := newTestManager()
 	tc := m.coordinator
 
-	tc.RegisterCleanupHook(func(transferID int64) error {
+	tc.RegisterCleanupHook(func(event TransferEvent) error {
 		return errors.New("hook failed")
 	})
 
@@ -377,3 +418,27 @@ func TestCoordinatorCompleteTransferFromProcessedStateErrors(t *testing.T) {
 		t.Fatal("expected error when completing from Processed state")
 	}
 }
+
+func TestTransferContextFileAttempts(t *testing.T) {
+	m := newTestManager()
+	ctx := m.coordinator.InitiateTransfer(1, "test", 100, 3)
+
+	ctx.RecordFileAttempts(10, "ok.mkv", 1, false)
+	ctx.RecordFileAttempts(11, "flaky.mkv", 2, false)
+	ctx.RecordFileAttempts(12, "broken.mkv", 3, true)
+
+	attempts := ctx.GetFileAttempts()
+	if len(attempts) != 2 {
+		t.Fatalf("tracked %d files, want 2 (first-try successes are not tracked)", len(attempts))
+	}
+
+	// A retried transfer accumulates attempts for the same file
+	ctx.RecordFileAttempts(12, "broken.mkv", 3, true)
+
+	ctx.mu.RLock()
+	summary := ctx.failedFilesSummary()
+	ctx.mu.RUnlock()
+	if want := "1 files failed after 6 attempts"; summary != want {
+		t.Errorf("summary = %q, want %q", summary, want)
+	}
+}
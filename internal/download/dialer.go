@@ -0,0 +1,93 @@
+package download
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// dialFunc matches net.Dialer.DialContext.
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// newDownloadHTTPClient returns the HTTP client used for file downloads. Its
+// dialer honors DialTimeout and PreferIPv4 so broken IPv6 paths fail fast
+// instead of stalling the download, and TLSConfig and Proxy apply the same
+// settings as the API client. The client itself has no overall timeout
+// since large files take arbitrarily long; instead the response headers are
+// bounded by DownloadHeaderTimeout and every read by DownloadReadTimeout.
+func newDownloadHTTPClient(cfg *DownloadConfig) *http.Client {
+	dialer := &net.Dialer{Timeout: cfg.DialTimeout, KeepAlive: 30 * time.Second}
+	dial := dialFunc(dialer.DialContext)
+	if cfg.PreferIPv4 {
+		dial = preferIPv4(dial)
+	}
+	if cfg.DownloadReadTimeout > 0 {
+		dial = withReadTimeout(dial, cfg.DownloadReadTimeout)
+	}
+
+	proxy := cfg.Proxy
+	if proxy == nil {
+		proxy = http.ProxyFromEnvironment
+	}
+	var transport http.RoundTripper = &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           dial,
+		IdleConnTimeout:       cfg.IdleConnectionTimeout,
+		ResponseHeaderTimeout: cfg.DownloadHeaderTimeout,
+		TLSClientConfig:       cfg.TLSConfig,
+	}
+	if cfg.DebugHTTP {
+		transport = log.NewHTTPTransport(transport, "download")
+	}
+	return &http.Client{Transport: transport}
+}
+
+// preferIPv4 wraps dial so that TCP connections are attempted over IPv4
+// first and only fall back to IPv6 if that fails.
+func preferIPv4(dial dialFunc) dialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if network != "tcp" {
+			return dial(ctx, network, addr)
+		}
+		conn, err := dial(ctx, "tcp4", addr)
+		if err == nil || ctx.Err() != nil {
+			return conn, err
+		}
+		log.Debug("download").Str("addr", addr).Err(err).Msg("IPv4 connect failed, falling back to IPv6")
+		conn, err6 := dial(ctx, "tcp6", addr)
+		if err6 != nil {
+			return nil, fmt.Errorf("%w (IPv6 fallback: %v)", err, err6)
+		}
+		return conn, nil
+	}
+}
+
+// withReadTimeout wraps dial so that every read on the returned connections
+// fails once no data has arrived for timeout.
+func withReadTimeout(dial dialFunc, timeout time.Duration) dialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return &readTimeoutConn{Conn: conn, timeout: timeout}, nil
+	}
+}
+
+// readTimeoutConn extends the read deadline before every read, turning a
+// connection that goes silent mid-body into a timeout error.
+type readTimeoutConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *readTimeoutConn) Read(b []byte) (int, error) {
+	if err := c.Conn.SetReadDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(b)
+}
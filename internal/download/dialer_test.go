@@ -0,0 +1,133 @@
+package download
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPreferIPv4(t *testing.T) {
+	tests := []struct {
+		name     string
+		network  string
+		fail     map[string]bool
+		want     []string
+		wantErr  bool
+		wantConn bool
+	}{
+		{"IPv4 succeeds", "tcp", nil, []string{"tcp4"}, false, true},
+		{"falls back to IPv6", "tcp", map[string]bool{"tcp4": true}, []string{"tcp4", "tcp6"}, false, true},
+		{"both fail", "tcp", map[string]bool{"tcp4": true, "tcp6": true}, []string{"tcp4", "tcp6"}, true, false},
+		{"explicit network untouched", "tcp6", nil, []string{"tcp6"}, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dialed []string
+			dial := preferIPv4(func(ctx context.Context, network, addr string) (net.Conn, error) {
+				dialed = append(dialed, network)
+				if tt.fail[network] {
+					return nil, errors.New("unreachable")
+				}
+				client, server := net.Pipe()
+				server.Close()
+				return client, nil
+			})
+
+			conn, err := dial(context.Background(), tt.network, "example.com:443")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (conn != nil) != tt.wantConn {
+				t.Errorf("conn = %v, wantConn %v", conn, tt.wantConn)
+			}
+			if conn != nil {
+				conn.Close()
+			}
+			if !reflect.DeepEqual(dialed, tt.want) {
+				t.Errorf("dialed %v, want %v", dialed, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithReadTimeout(t *testing.T) {
+	var server net.Conn
+	dial := withReadTimeout(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		var client net.Conn
+		client, server = net.Pipe()
+		return client, nil
+	}, 50*time.Millisecond)
+
+	conn, err := dial(context.Background(), "tcp", "example.com:443")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	defer server.Close()
+
+	// Data arriving within the timeout is read normally
+	go server.Write([]byte("ok"))
+	buf := make([]byte, 2)
+	if _, err := conn.Read(buf); err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+
+	// A connection that goes silent times out
+	_, err = conn.Read(buf)
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Fatalf("Read error = %v, want a timeout", err)
+	}
+	if !isTransientError(fmt.Errorf("download failed: %w", err)) {
+		t.Error("expected read timeouts to be retried")
+	}
+}
+
+func TestDownloadHTTPClientTLSConfig(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	cfg := GetDefaultConfig()
+	if _, err := newDownloadHTTPClient(cfg).Get(srv.URL); err == nil {
+		t.Fatal("expected the self-signed certificate to be rejected by default")
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	cfg.TLSConfig = &tls.Config{RootCAs: pool}
+	resp, err := newDownloadHTTPClient(cfg).Get(srv.URL)
+	if err != nil {
+		t.Fatalf("download with the configured CA failed: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestDownloadHTTPClientProxy(t *testing.T) {
+	var gotHost string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHost = r.URL.Host
+	}))
+	defer proxy.Close()
+
+	proxyURL, _ := url.Parse(proxy.URL)
+	cfg := GetDefaultConfig()
+	cfg.Proxy = http.ProxyURL(proxyURL)
+	resp, err := newDownloadHTTPClient(cfg).Get("http://download.put.io.invalid/file.mkv")
+	if err != nil {
+		t.Fatalf("request through proxy failed: %v", err)
+	}
+	resp.Body.Close()
+	if gotHost != "download.put.io.invalid" {
+		t.Errorf("proxy saw host %q, want download.put.io.invalid", gotHost)
+	}
+}
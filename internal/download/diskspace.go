@@ -0,0 +1,36 @@
+package download
+
+import (
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// diskFree reports the free space of the filesystem holding a directory,
+// replaced in tests
+var diskFree = freeDiskSpace
+
+// checkDiskSpace fails with an InsufficientDiskSpace error if writing size
+// more bytes to dir would leave less free space than MinFreeDiskBytes, with
+// DiskHeadroomPercent of size added for filesystem overhead. Platforms
+// without a free space query are not checked.
+func (m *Manager) checkDiskSpace(dir, filename string, size int64) error {
+	size = max(size, 0)
+	needed := size + int64(float64(size)*m.dlConfig.DiskHeadroomPercent/100) + m.dlConfig.MinFreeDiskBytes
+	if needed == 0 {
+		return nil
+	}
+	free, err := diskFree(dir)
+	if err != nil {
+		log.Debug("download").Str("dir", dir).Err(err).Msg("Could not determine free disk space")
+		return nil
+	}
+	if free >= needed {
+		return nil
+	}
+	log.Warn("download").
+		Str("file_name", filename).
+		Str("dir", dir).
+		Int64("needed_bytes", needed).
+		Int64("free_bytes", free).
+		Msg("Not enough free disk space, not starting download")
+	return NewInsufficientDiskSpaceError(filename, needed, free)
+}
@@ -0,0 +1,16 @@
+//go:build !unix
+
+package download
+
+import "errors"
+
+// freeDiskSpace is not implemented on this platform, so downloads start
+// without checking for free space.
+func freeDiskSpace(dir string) (int64, error) {
+	return 0, errors.ErrUnsupported
+}
+
+// hasHoles is not implemented on this platform and reports no holes.
+func hasHoles(path string) bool {
+	return false
+}
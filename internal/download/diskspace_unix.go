@@ -0,0 +1,25 @@
+//go:build unix
+
+package download
+
+import "syscall"
+
+// freeDiskSpace returns the bytes available to unprivileged users on the
+// filesystem holding dir.
+func freeDiskSpace(dir string) (int64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, err
+	}
+	return int64(st.Bavail) * int64(st.Bsize), nil
+}
+
+// hasHoles reports whether fewer bytes are allocated to the file at path
+// than its size, as happens when it was written at offsets with gaps.
+func hasHoles(path string) bool {
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		return false
+	}
+	return int64(st.Blocks)*512 < st.Size
+}
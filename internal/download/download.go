@@ -2,10 +2,14 @@ package download
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math/rand/v2"
+	"net"
 	"os"
 	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 
 	grab "github.com/cavaliergopher/grab/v3"
@@ -13,13 +17,23 @@ import (
 )
 
 // downloadWorker processes download jobs from the queue
-func (m *Manager) downloadWorker() {
+func (m *Manager) downloadWorker(quit <-chan struct{}) {
 	for {
+		// Don't pick up new jobs while downloads are paused
+		if !m.pause.Wait(m.stopChan) {
+			log.Info("download").Msg("Worker stopping due to shutdown request")
+			return
+		}
+
 		select {
 		case <-m.stopChan:
 			// Immediate shutdown requested
 			log.Info("download").Msg("Worker stopping due to shutdown request")
 			return
+		case <-quit:
+			// Retired by the adaptive scaler
+			log.Debug("download").Msg("Worker retired")
+			return
 		case job, ok := <-m.jobs:
 			if !ok {
 				return
@@ -27,10 +41,16 @@ func (m *Manager) downloadWorker() {
 			state := &DownloadState{
 				FileID:     job.FileID,
 				Name:       job.Name,
+				Size:       job.Size,
 				TransferID: job.TransferID,
+				TargetDir:  job.TargetDir,
 				StartTime:  time.Now(),
 			}
+			m.counters.downloading.Add(1)
 			err := m.downloadWithRetry(state)
+			m.counters.downloading.Add(-1)
+			m.queue.Done(job.TransferID)
+			m.recordFileAttempts(job, state, err)
 			if err != nil {
 				if downloadErr, ok := err.(*DownloadError); ok && downloadErr.Type == "DownloadCancelled" {
 					log.Info("download").
@@ -53,38 +73,139 @@ func (m *Manager) downloadWorker() {
 
 				// Mark this file as failed in the transfer context
 				m.handleFileFailure(job.TransferID)
+				m.stats.FileFailed()
+				m.counters.filesFailed.Add(1)
 				continue
 			}
-			// Pass both transferID and fileID to handleFileCompletion
-			// The file cleanup is now handled inside handleFileCompletion
+			state.mu.Lock()
+			m.stats.FileCompleted(state.downloaded)
+			state.mu.Unlock()
+			m.counters.filesCompleted.Add(1)
+			// Also removes the file from the active files
 			m.handleFileCompletion(job.TransferID, job.FileID)
-			// Do NOT call m.activeFiles.Delete here - now handled in handleFileCompletion
 		}
 	}
 }
 
+// fileAttemptsWarnThreshold is the number of attempts after which a single
+// file is reported as problematic
+const fileAttemptsWarnThreshold = 3
+
+// recordFileAttempts stores the attempts a file took on its transfer context
+// and warns about files that needed many attempts.
+func (m *Manager) recordFileAttempts(job downloadJob, state *DownloadState, err error) {
+	if downloadErr, ok := err.(*DownloadError); ok && downloadErr.Type == "DownloadCancelled" {
+		return
+	}
+	if state.Attempts >= fileAttemptsWarnThreshold {
+		log.Warn("download").
+			Str("file_name", job.Name).
+			Int64("file_id", job.FileID).
+			Int64("transfer_id", job.TransferID).
+			Int("attempts", state.Attempts).
+			Bool("failed", err != nil).
+			Msg("File needed repeated download attempts")
+	}
+	if ctx, ok := m.coordinator.GetTransferContext(job.TransferID); ok {
+		ctx.RecordFileAttempts(job.FileID, job.Name, state.Attempts, err != nil)
+	}
+}
+
 // downloadWithRetry attempts to download a file with retries on transient errors
 func (m *Manager) downloadWithRetry(state *DownloadState) error {
-	const maxRetries = 3
+	return m.retryDownload(state, m.downloadFile)
+}
+
+// retryWait waits for d unless ctx is cancelled first, reporting whether the
+// full delay passed. Tests replace it to observe delays without waiting.
+var retryWait = func(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// retryJitter returns a random duration in [0, d). Tests replace it to make
+// backoff deterministic.
+var retryJitter = func(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return rand.N(d)
+}
+
+// retryBackoff returns the delay before the retry following the given
+// attempt: base doubled for every earlier attempt and capped at maxDelay.
+// Half of it is randomized so that workers failing together don't retry in
+// lockstep.
+func retryBackoff(base, maxDelay time.Duration, attempt int) time.Duration {
+	d := maxDelay
+	if shift := attempt - 1; shift < 32 && base<<shift > 0 && base<<shift < maxDelay {
+		d = base << shift
+	}
+	return d/2 + retryJitter(d-d/2)
+}
+
+// retryDownload runs download with retries. Transient network errors are
+// attempted up to DownloadMaxRetries times with jittered exponential
+// backoff; transient disk errors are retried separately up to
+// DiskErrorRetries times with exponential backoff.
+func (m *Manager) retryDownload(state *DownloadState, download func(*DownloadState) error) error {
+	maxRetries := max(1, m.downloadMaxRetries())
 	var lastErr error
+	diskRetries := 0
 
 	for attempt := 1; attempt <= maxRetries; attempt++ {
-		if err := m.downloadFile(state); err != nil {
+		state.Attempts++
+		if err := download(state); err != nil {
 			// Check for cancellation first - pass it through without wrapping
 			if downloadErr, ok := err.(*DownloadError); ok && downloadErr.Type == "DownloadCancelled" {
 				return err
 			}
 
 			lastErr = err
+
+			// Disk errors get their own retry budget and don't use up network attempts
+			if isDiskError(err) {
+				if diskRetries >= m.dlConfig.DiskErrorRetries {
+					return fmt.Errorf("disk error persisted after %d retries: %w", diskRetries, err)
+				}
+				backoff := m.dlConfig.DiskErrorBackoff << diskRetries
+				diskRetries++
+				m.counters.retries.Add(1)
+				log.Warn("download").
+					Str("file_name", state.Name).
+					Int("disk_retry", diskRetries).
+					Dur("backoff", backoff).
+					Err(err).
+					Msg("Disk error, retrying download after backoff")
+
+				if !retryWait(m.Context(), backoff) {
+					return NewDownloadCancelledError(state.Name, "shutdown during disk error backoff")
+				}
+				attempt--
+				continue
+			}
+
 			if !isTransientError(err) {
 				return fmt.Errorf("permanent error on attempt %d: %w", attempt, err)
 			}
+			if attempt == maxRetries {
+				break
+			}
+			backoff := retryBackoff(m.dlConfig.DownloadRetryBaseDelay, m.dlConfig.DownloadRetryMaxDelay, attempt)
 			log.Warn("download").
 				Str("file_name", state.Name).
 				Int("attempt", attempt).
+				Dur("backoff", backoff).
 				Err(err).
 				Msg("Retrying download after error")
-			time.Sleep(time.Second * time.Duration(attempt))
+			m.counters.retries.Add(1)
+			if !retryWait(m.Context(), backoff) {
+				return NewDownloadCancelledError(state.Name, "shutdown during retry backoff")
+			}
 			continue
 		}
 		return nil
@@ -92,40 +213,100 @@ func (m *Manager) downloadWithRetry(state *DownloadState) error {
 	return fmt.Errorf("failed after %d attempts, last error: %w", maxRetries, lastErr)
 }
 
+// isDiskError reports whether err is a local storage error that may clear up
+// on its own, such as a full disk that gets cleaned or an NFS hiccup.
+func isDiskError(err error) bool {
+	return errors.Is(err, syscall.ENOSPC) ||
+		errors.Is(err, syscall.EIO) ||
+		errors.Is(err, syscall.EDQUOT) ||
+		errors.Is(err, syscall.ESTALE)
+}
+
+// transientPatterns are messages of network errors worth retrying. They are
+// matched anywhere in the error chain, since grab and net/http wrap them.
+var transientPatterns = []string{
+	"connection reset",
+	"connection refused",
+	"i/o timeout",
+}
+
 // isTransientError determines if an error is potentially recoverable
 func isTransientError(err error) bool {
 	if err == nil {
 		return false
 	}
 
-	// Check for cancellation errors - these should be passed through
-	if downloadErr, ok := err.(*DownloadError); ok && downloadErr.Type == "DownloadCancelled" {
-		return false
+	// Cancellations are passed through, however deeply wrapped
+	var downloadErr *DownloadError
+	if errors.As(err, &downloadErr) {
+		switch downloadErr.Type {
+		case "DownloadCancelled":
+			return false
+		case "InvalidContent", "DownloadStalled":
+			// HTML error pages in place of the file are usually temporary,
+			// and a stalled download may well pick up again on a fresh
+			// connection
+			return true
+		}
 	}
 
-	// Check for grab errors
-	if err.Error() == "connection reset" ||
-		err.Error() == "connection refused" ||
-		err.Error() == "i/o timeout" {
+	// Dial, response header and read timeouts of the download transport
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
 		return true
 	}
 
+	msg := err.Error()
+	for _, pattern := range transientPatterns {
+		if strings.Contains(msg, pattern) {
+			return true
+		}
+	}
+
 	// Check for specific grab HTTP errors
-	if strings.Contains(err.Error(), "429") || // Too Many Requests
-		strings.Contains(err.Error(), "503") || // Service Unavailable
-		strings.Contains(err.Error(), "504") || // Gateway Timeout
-		strings.Contains(err.Error(), "502") { // Bad Gateway
+	if strings.Contains(msg, "429") || // Too Many Requests
+		strings.Contains(msg, "503") || // Service Unavailable
+		strings.Contains(msg, "504") || // Gateway Timeout
+		strings.Contains(msg, "502") { // Bad Gateway
 		return true
 	}
 
 	return false
 }
 
+// Files are downloaded under a partial name and only renamed to their final
+// name once complete, so media importers never pick up a partial file. The
+// leading dot hides them from directory scans.
+const (
+	partialPrefix = "."
+	partialSuffix = ".part"
+)
+
+// partialPath returns the path a file is downloaded to before it is complete
+func partialPath(targetPath string) string {
+	return filepath.Join(filepath.Dir(targetPath), partialPrefix+filepath.Base(targetPath)+partialSuffix)
+}
+
+// finalPath returns the path a partial download is renamed to once complete.
+// Other paths are returned unchanged.
+func finalPath(path string) string {
+	base := filepath.Base(path)
+	if !strings.HasPrefix(base, partialPrefix) || !strings.HasSuffix(base, partialSuffix) ||
+		len(base) <= len(partialPrefix)+len(partialSuffix) {
+		return path
+	}
+	return filepath.Join(filepath.Dir(path), strings.TrimSuffix(strings.TrimPrefix(base, partialPrefix), partialSuffix))
+}
+
 // downloadFile downloads a file from Put.io to the target directory using grab
 func (m *Manager) downloadFile(state *DownloadState) error {
-	// Derive context from manager's lifecycle context
-	ctx, cancel := context.WithCancel(m.Context())
-	defer cancel()
+	// Derive context from manager's lifecycle context; monitorDownloadStall
+	// cancels it with the reason the download stalled
+	ctx, cancel := context.WithCancelCause(m.Context())
+	defer cancel(nil)
 
 	// Get download URL
 	url, err := m.client.GetDownloadURL(ctx, state.FileID)
@@ -134,16 +315,54 @@ func (m *Manager) downloadFile(state *DownloadState) error {
 	}
 
 	// Prepare target path
-	targetPath := filepath.Join(m.cfg.TargetDir, state.Name)
-	if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
-		return fmt.Errorf("failed to create directory: %w", err)
+	targetDir := state.TargetDir
+	if targetDir == "" {
+		targetDir = m.cfg.TargetDir
+	}
+	targetPath := filepath.Join(targetDir, state.Name)
+	partial := m.partialFile(targetDir, state.Name)
+	for _, dir := range []string{filepath.Dir(targetPath), filepath.Dir(partial)} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+	}
+
+	// A partial file written by a segmented download has gaps and can only
+	// be resumed segment by segment
+	segments := m.segmentCount(partial, state.Size)
+	if segments <= 1 {
+		discardSegments(partial)
+	}
+	// Bytes resumed from the partial file were already counted, either by an
+	// earlier attempt or when the transfer was enumerated
+	resumed := partialBytes(partial)
+
+	// Don't start writing what won't fit
+	if state.Size > 0 {
+		if err := m.checkDiskSpace(filepath.Dir(partial), state.Name, state.Size-resumed); err != nil {
+			return err
+		}
+	}
+
+	// Large files may be fetched over several connections at once
+	if segments > 1 {
+		err := m.downloadSegmented(ctx, cancel, state, url, partial, segments)
+		if err == nil {
+			return m.finishDownload(state, partial, targetPath, state.Size)
+		}
+		if !errors.Is(err, errRangesUnsupported) {
+			return err
+		}
+		discardSegments(partial)
+		resumed = partialBytes(partial)
 	}
 
 	// Create grab client with our configuration
 	client := grab.NewClient()
+	client.HTTPClient = newDownloadHTTPClient(m.dlConfig)
 
-	// Create grab request
-	req, err := grab.NewRequest(targetPath, url)
+	// Create grab request; an existing partial file is resumed
+	req, err := grab.NewRequest(partial, url)
 	if err != nil {
 		return fmt.Errorf("failed to create download request: %w", err)
 	}
@@ -151,6 +370,19 @@ func (m *Manager) downloadFile(state *DownloadState) error {
 	// Set request context for cancellation
 	req = req.WithContext(ctx)
 
+	// Larger buffers mean fewer syscalls on fast links
+	req.BufferSize = m.dlConfig.CopyBufferSize
+
+	// All workers share one limiter so the combined rate stays under the cap
+	if share := m.limiter.acquire(state.TransferID); share != nil {
+		defer m.limiter.release(share)
+		req.RateLimiter = share
+	}
+
+	// Reject HTML error pages served in place of the file
+	req.BeforeCopy = checkResponseContentType
+	req.AfterCopy = checkDownloadedContent
+
 	// Set request headers
 	req.HTTPRequest.Header.Set("User-Agent", "plundrio/1.0")
 	req.HTTPRequest.Header.Set("Accept", "*/*")
@@ -172,13 +404,16 @@ func (m *Manager) downloadFile(state *DownloadState) error {
 
 	// Initialize state
 	state.mu.Lock()
-	state.downloaded = 0
+	state.downloaded = resumed
 	state.Progress = 0
 	state.LastProgress = time.Now()
 	state.mu.Unlock()
 
 	// Monitor download progress
-	go m.monitorGrabDownloadProgress(ctx, state, resp, done, progressTicker)
+	go m.monitorDownloadProgress(ctx, state, resp, done, progressTicker)
+	if m.dlConfig.DownloadStallTimeout > 0 {
+		go monitorDownloadStall(ctx, cancel, state.Name, m.dlConfig.DownloadStallTimeout, resp.BytesComplete)
+	}
 
 	// Wait for completion or cancellation
 	select {
@@ -187,6 +422,9 @@ func (m *Manager) downloadFile(state *DownloadState) error {
 		// Check for errors
 		if err := resp.Err(); err != nil {
 			if ctx.Err() != nil {
+				if err := stallError(ctx); err != nil {
+					return err
+				}
 				return NewDownloadCancelledError(state.Name, "download stopped")
 			}
 			return fmt.Errorf("download failed: %w", err)
@@ -197,46 +435,67 @@ func (m *Manager) downloadFile(state *DownloadState) error {
 			return fmt.Errorf("download incomplete: %s", state.Name)
 		}
 
-		// Log completion
-		elapsed := time.Since(state.StartTime).Seconds()
-		totalSize := resp.Size()
-		averageSpeedMBps := (float64(totalSize) / 1024 / 1024) / elapsed
-
-		// Flush any remaining bytes not yet reported by the progress ticker.
-		// The ticker adds incremental deltas; this catches the gap between
-		// the last tick and actual completion so we don't double-count.
-		if transferCtx, exists := m.coordinator.GetTransferContext(state.TransferID); exists {
-			state.mu.Lock()
-			finalDelta := totalSize - state.downloaded
-			state.downloaded = totalSize
-			state.mu.Unlock()
+		return m.finishDownload(state, resp.Filename, targetPath, resp.Size())
 
-			if finalDelta > 0 {
-				transferCtx.AddDownloadedBytes(finalDelta)
+	case <-ctx.Done():
+		close(done)
+		if err := stallError(ctx); err != nil {
+			// Let the copy wind down before the retry resumes the same partial file
+			select {
+			case <-resp.Done:
+			case <-time.After(m.dlConfig.CopyTimeout):
 			}
+			return err
+		}
+		return NewDownloadCancelledError(state.Name, "context cancelled")
+	}
+}
 
-			downloadedSize, transferTotal, _, _ := transferCtx.GetProgress()
-			log.Debug("download").
-				Str("file_name", state.Name).
-				Int64("transfer_id", state.TransferID).
-				Int64("final_delta", finalDelta).
-				Int64("transfer_downloaded", downloadedSize).
-				Int64("transfer_total", transferTotal).
-				Msg("Flushed remaining download bytes")
+// finishDownload moves a complete partial file into place and accounts for
+// the bytes the progress monitor hasn't reported yet.
+func (m *Manager) finishDownload(state *DownloadState, partial, targetPath string, totalSize int64) error {
+	// Reveal the file under its final name only now that it is complete
+	if err := moveIntoPlace(partial, targetPath); err != nil {
+		return fmt.Errorf("failed to move download into place: %w", err)
+	}
+
+	// Log completion
+	elapsed := time.Since(state.StartTime).Seconds()
+	averageSpeedMBps := (float64(totalSize) / 1024 / 1024) / elapsed
+
+	// Flush any remaining bytes not yet reported by the progress ticker.
+	// The ticker adds incremental deltas; this catches the gap between
+	// the last tick and actual completion so we don't double-count.
+	state.mu.Lock()
+	finalDelta := totalSize - state.downloaded
+	state.downloaded = totalSize
+	state.mu.Unlock()
+	if finalDelta > 0 {
+		m.bytesTransferred.Add(finalDelta)
+	}
+
+	if transferCtx, exists := m.coordinator.GetTransferContext(state.TransferID); exists {
+		if finalDelta > 0 {
+			transferCtx.AddDownloadedBytes(finalDelta)
 		}
 
-		log.Info("download").
+		downloadedSize, transferTotal, _, _ := transferCtx.GetProgress()
+		log.Debug("download").
 			Str("file_name", state.Name).
-			Float64("size_mb", float64(totalSize)/1024/1024).
-			Float64("speed_mbps", averageSpeedMBps).
-			Dur("duration", time.Since(state.StartTime)).
-			Str("target_path", targetPath).
-			Msg("Download completed")
+			Int64("transfer_id", state.TransferID).
+			Int64("final_delta", finalDelta).
+			Int64("transfer_downloaded", downloadedSize).
+			Int64("transfer_total", transferTotal).
+			Msg("Flushed remaining download bytes")
+	}
 
-		return nil
+	log.Info("download").
+		Str("file_name", state.Name).
+		Float64("size_mb", float64(totalSize)/1024/1024).
+		Float64("speed_mbps", averageSpeedMBps).
+		Dur("duration", time.Since(state.StartTime)).
+		Str("target_path", targetPath).
+		Msg("Download completed")
 
-	case <-ctx.Done():
-		close(done)
-		return NewDownloadCancelledError(state.Name, "context cancelled")
-	}
+	return nil
 }
@@ -1,9 +1,22 @@
 package download
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"syscall"
 	"testing"
+	"time"
+
+	grab "github.com/cavaliergopher/grab/v3"
+	"github.com/elsbrock/go-putio"
 )
 
 func TestIsTransientError(t *testing.T) {
@@ -57,19 +70,30 @@ func TestIsTransientError(t *testing.T) {
 			err:  errors.New("gateway timeout 504"),
 			want: true,
 		},
+		{
+			name: "wrapped_invalid_content",
+			err:  fmt.Errorf("download failed: %w", NewInvalidContentError("test.mkv", "HTML page")),
+			want: true,
+		},
 		{
 			name: "random_non_transient_error",
 			err:  errors.New("some random error"),
 			want: false,
 		},
 		{
-			// Known bug: isTransientError uses exact equality (err.Error() == "connection reset")
-			// rather than checking the error chain or using strings.Contains for these patterns.
-			// A wrapped error's Error() string is "request failed: connection reset", which does
-			// not match "connection reset" exactly, so it is not detected as transient.
-			name: "wrapped_connection_reset_not_detected_known_bug",
+			name: "wrapped_connection_reset",
 			err:  fmt.Errorf("request failed: %w", errors.New("connection reset")),
-			want: false, // should be true, but exact match fails on wrapped errors
+			want: true,
+		},
+		{
+			name: "wrapped_econnrefused",
+			err:  fmt.Errorf("dial tcp: %w", syscall.ECONNREFUSED),
+			want: true,
+		},
+		{
+			name: "wrapped_download_cancelled",
+			err:  fmt.Errorf("download failed: %w", NewDownloadCancelledError("test.mkv", "connection reset by shutdown")),
+			want: false,
 		},
 	}
 
@@ -82,3 +106,479 @@ func TestIsTransientError(t *testing.T) {
 		})
 	}
 }
+
+// BenchmarkCopyBufferSize measures download throughput for different
+// Request.BufferSize values against a local HTTP server.
+func BenchmarkCopyBufferSize(b *testing.B) {
+	payload := bytes.Repeat([]byte{0xab}, 64<<20)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "payload.bin", time.Time{}, bytes.NewReader(payload))
+	}))
+	defer srv.Close()
+
+	for _, size := range []int{32 << 10, 256 << 10, 1 << 20} {
+		b.Run(fmt.Sprintf("%dKB", size>>10), func(b *testing.B) {
+			client := grab.NewClient()
+			b.SetBytes(int64(len(payload)))
+			for i := 0; i < b.N; i++ {
+				req, err := grab.NewRequest(filepath.Join(b.TempDir(), "payload.bin"), srv.URL)
+				if err != nil {
+					b.Fatal(err)
+				}
+				req.BufferSize = size
+				if err := client.Do(req).Err(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// flakyWriter fails with err for the first failures writes, then succeeds.
+type flakyWriter struct {
+	failures int
+	err      error
+	written  int
+}
+
+func (w *flakyWriter) Write(p []byte) (int, error) {
+	if w.failures > 0 {
+		w.failures--
+		return 0, &os.PathError{Op: "write", Path: "/downloads/file.mkv", Err: w.err}
+	}
+	w.written += len(p)
+	return len(p), nil
+}
+
+func TestRetryDownloadDiskErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int
+		err       error
+		wantErr   bool
+		wantCalls int
+	}{
+		{"recovers from full disk", 2, syscall.ENOSPC, false, 3},
+		{"recovers from io error", 1, syscall.EIO, false, 2},
+		{"gives up after disk retries", 10, syscall.ENOSPC, true, 4},
+		{"permanent error is not retried", 5, syscall.EACCES, true, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestManager()
+			m.dlConfig.DiskErrorRetries = 3
+			m.dlConfig.DiskErrorBackoff = time.Millisecond
+
+			w := &flakyWriter{failures: tt.failures, err: tt.err}
+			calls := 0
+			err := m.retryDownload(&DownloadState{Name: "file.mkv"}, func(*DownloadState) error {
+				calls++
+				if _, err := w.Write([]byte("data")); err != nil {
+					return fmt.Errorf("download failed: %w", err)
+				}
+				return nil
+			})
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("retryDownload() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("download called %d times, want %d", calls, tt.wantCalls)
+			}
+			if !tt.wantErr && w.written == 0 {
+				t.Error("expected data to be written after recovery")
+			}
+		})
+	}
+}
+
+func TestRetryDownloadBackoff(t *testing.T) {
+	// Without jitter, every delay is at the top of its range
+	defer func(wait func(context.Context, time.Duration) bool, jitter func(time.Duration) time.Duration) {
+		retryWait, retryJitter = wait, jitter
+	}(retryWait, retryJitter)
+	var delays []time.Duration
+	retryWait = func(ctx context.Context, d time.Duration) bool {
+		delays = append(delays, d)
+		return true
+	}
+	retryJitter = func(d time.Duration) time.Duration { return d }
+
+	m := newTestManager()
+	m.dlConfig.DownloadMaxRetries = 6
+	m.dlConfig.DownloadRetryBaseDelay = time.Second
+	m.dlConfig.DownloadRetryMaxDelay = 10 * time.Second
+
+	calls := 0
+	err := m.retryDownload(&DownloadState{Name: "file.mkv"}, func(*DownloadState) error {
+		calls++
+		return fmt.Errorf("download failed: %w", syscall.ECONNRESET)
+	})
+	if err == nil || calls != 6 {
+		t.Fatalf("retryDownload() = %v after %d calls, want an error after 6", err, calls)
+	}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second}
+	if !reflect.DeepEqual(delays, want) {
+		t.Errorf("delays = %v, want %v", delays, want)
+	}
+
+	// Shutting down during the backoff stops retrying
+	retryWait = func(ctx context.Context, d time.Duration) bool { return false }
+	calls = 0
+	err = m.retryDownload(&DownloadState{Name: "file.mkv"}, func(*DownloadState) error {
+		calls++
+		return fmt.Errorf("download failed: %w", syscall.ECONNRESET)
+	})
+	var dlErr *DownloadError
+	if !errors.As(err, &dlErr) || dlErr.Type != "DownloadCancelled" || calls != 1 {
+		t.Errorf("retryDownload() = %v after %d calls, want cancellation after 1", err, calls)
+	}
+}
+
+func TestRetryBackoffJitter(t *testing.T) {
+	for attempt := 1; attempt <= 40; attempt++ {
+		d := retryBackoff(time.Second, time.Minute, attempt)
+		ceiling := min(time.Minute, time.Second<<min(attempt-1, 6))
+		if d < ceiling/2 || d > ceiling {
+			t.Errorf("attempt %d: backoff %v outside [%v, %v]", attempt, d, ceiling/2, ceiling)
+		}
+	}
+}
+
+// urlPutioClient serves a fixed download URL for every file
+type urlPutioClient struct {
+	fakePutioClient
+	url string
+}
+
+func (c *urlPutioClient) GetDownloadURL(ctx context.Context, fileID int64) (string, error) {
+	return c.url, nil
+}
+
+func TestDownloadFileRevealsOnlyCompleteFiles(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "8")
+		w.Write([]byte("0123"))
+		w.(http.Flusher).Flush()
+		<-release
+		w.Write([]byte("4567"))
+	}))
+	defer srv.Close()
+
+	m := newTestManager()
+	m.cfg.TargetDir = t.TempDir()
+	m.client = &urlPutioClient{url: srv.URL}
+	target := filepath.Join(m.cfg.TargetDir, "Show", "episode.mkv")
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- m.downloadFile(&DownloadState{FileID: 1, Name: filepath.Join("Show", "episode.mkv"), StartTime: time.Now()})
+	}()
+
+	// Wait for the first half to be written
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if info, err := os.Stat(partialPath(target)); err == nil && info.Size() == 4 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("partial file was not written")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Fatalf("final path visible mid-download (stat err = %v)", err)
+	}
+
+	close(release)
+	if err := <-errc; err != nil {
+		t.Fatalf("downloadFile() error = %v", err)
+	}
+	if data, err := os.ReadFile(target); err != nil || string(data) != "01234567" {
+		t.Errorf("final file = %q, %v; want complete content", data, err)
+	}
+	if _, err := os.Stat(partialPath(target)); !os.IsNotExist(err) {
+		t.Errorf("partial file left behind (stat err = %v)", err)
+	}
+}
+
+func TestDownloadWorkerFinalizesTransferOnce(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("data"))
+	}))
+	defer srv.Close()
+
+	m := newTestManager()
+	m.cfg.TargetDir = t.TempDir()
+	m.stats = newStatsStore(newStateFile(m.cfg.TargetDir))
+	m.client = &urlPutioClient{url: srv.URL}
+
+	var mu sync.Mutex
+	finalized := 0
+	done := make(chan struct{}, 2)
+	m.coordinator.RegisterCompletionHook(func(event TransferEvent) {
+		mu.Lock()
+		finalized++
+		mu.Unlock()
+		done <- struct{}{}
+	})
+
+	m.coordinator.InitiateTransfer(1, "Show", 100, 2)
+	m.coordinator.StartDownload(1)
+	jobs := []downloadJob{
+		{FileID: 11, Name: filepath.Join("Show", "a.mkv"), TransferID: 1},
+		{FileID: 12, Name: filepath.Join("Show", "b.mkv"), TransferID: 1},
+	}
+	for _, job := range jobs {
+		m.activeFiles.Store(job.FileID, job.TransferID)
+	}
+
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.downloadWorker(nil)
+		}()
+	}
+	for _, job := range jobs {
+		m.jobs <- job
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("transfer was not finalized")
+	}
+	close(m.stopChan)
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if finalized != 1 {
+		t.Errorf("transfer finalized %d times, want once", finalized)
+	}
+	for _, job := range jobs {
+		if _, active := m.activeFiles.Load(job.FileID); active {
+			t.Errorf("file %d still active after completing", job.FileID)
+		}
+	}
+	if !m.processor.isTransferProcessed(1) {
+		t.Error("transfer not marked processed after finalizing")
+	}
+}
+
+func TestFinalPath(t *testing.T) {
+	for _, name := range []string{"episode.mkv", ".hidden", "index.html", ".part"} {
+		target := filepath.Join("tv", name)
+		if got := finalPath(partialPath(target)); got != target {
+			t.Errorf("finalPath(partialPath(%q)) = %q", target, got)
+		}
+	}
+	if got := finalPath(filepath.Join("tv", "episode.mkv")); got != filepath.Join("tv", "episode.mkv") {
+		t.Errorf("finalPath changed a regular path: %q", got)
+	}
+}
+
+func TestResumedDownloadKeepsProgress(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "episode.mkv", time.Time{}, bytes.NewReader([]byte("01234567")))
+	}))
+	defer srv.Close()
+
+	m := newTestManager()
+	m.cfg.TargetDir = t.TempDir()
+	m.client = &urlPutioClient{
+		fakePutioClient: fakePutioClient{files: map[int64][]*putio.File{10: {{ID: 100, Name: "episode.mkv", Size: 8}}}},
+		url:             srv.URL,
+	}
+
+	// Half of the file was downloaded before the restart
+	target := filepath.Join(m.cfg.TargetDir, "Show", "episode.mkv")
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(partialPath(target), []byte("0123"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	transfer := &putio.Transfer{ID: 1, Name: "Show", FileID: 10, Status: "COMPLETED"}
+	m.workerWg.Add(1)
+	m.processor.processTransfer(context.Background(), transfer)
+
+	transferCtx, ok := m.coordinator.GetTransferContext(transfer.ID)
+	if !ok {
+		t.Fatal("transfer not initiated")
+	}
+	if downloaded, _, _, _ := transferCtx.GetProgress(); downloaded != 4 {
+		t.Errorf("downloaded after restart = %d, want the 4 resumed bytes", downloaded)
+	}
+
+	job, ok := m.queue.Pop()
+	if !ok {
+		t.Fatal("file not queued")
+	}
+	state := &DownloadState{FileID: job.FileID, Name: job.Name, TransferID: job.TransferID, StartTime: time.Now()}
+	if err := m.downloadFile(state); err != nil {
+		t.Fatalf("downloadFile() error = %v", err)
+	}
+	if downloaded, _, _, _ := transferCtx.GetProgress(); downloaded != 8 {
+		t.Errorf("downloaded after resume = %d, want 8", downloaded)
+	}
+	if data, err := os.ReadFile(target); err != nil || string(data) != "01234567" {
+		t.Errorf("final file = %q, %v; want complete content", data, err)
+	}
+}
+
+func TestDownloadFileStalled(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "8")
+		w.Write([]byte("0123"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	m := newTestManager()
+	m.cfg.TargetDir = t.TempDir()
+	m.dlConfig.DownloadStallTimeout = 200 * time.Millisecond
+	m.client = &urlPutioClient{url: srv.URL}
+
+	start := time.Now()
+	err := m.downloadFile(&DownloadState{FileID: 1, Name: "episode.mkv", StartTime: time.Now()})
+	if err == nil {
+		t.Fatal("stalled download succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("download gave up after %s, want about %s", elapsed, m.dlConfig.DownloadStallTimeout)
+	}
+	if !isTransientError(err) {
+		t.Errorf("downloadFile() error = %v, want it retried", err)
+	}
+}
+
+func TestDownloadFileInsufficientDiskSpace(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte("01234567"))
+	}))
+	defer srv.Close()
+
+	free := int64(100)
+	diskFree = func(string) (int64, error) { return free, nil }
+	defer func() { diskFree = freeDiskSpace }()
+
+	m := newTestManager()
+	m.cfg.TargetDir = t.TempDir()
+	m.dlConfig.MinFreeDiskBytes = 50
+	m.client = &urlPutioClient{url: srv.URL}
+	target := filepath.Join(m.cfg.TargetDir, "episode.mkv")
+
+	// 60 bytes plus 50 to keep free don't fit into 100
+	err := m.retryDownload(&DownloadState{FileID: 1, Name: "episode.mkv", Size: 60, StartTime: time.Now()}, m.downloadFile)
+	var downloadErr *DownloadError
+	if !errors.As(err, &downloadErr) || downloadErr.Type != "InsufficientDiskSpace" {
+		t.Fatalf("error = %v, want InsufficientDiskSpace", err)
+	}
+	if requests != 0 {
+		t.Errorf("made %d requests, want none and no retries", requests)
+	}
+	if _, err := os.Stat(partialPath(target)); !os.IsNotExist(err) {
+		t.Errorf("partial file created (stat err = %v)", err)
+	}
+
+	// Headroom counts against the file's size
+	m.dlConfig.MinFreeDiskBytes = 0
+	m.dlConfig.DiskHeadroomPercent = 100
+	if err := m.downloadFile(&DownloadState{FileID: 1, Name: "episode.mkv", Size: 60, StartTime: time.Now()}); err == nil {
+		t.Error("expected 60 bytes with 100% headroom not to fit into 100")
+	}
+
+	free = 1 << 20
+	if err := m.downloadFile(&DownloadState{FileID: 1, Name: "episode.mkv", Size: 8, StartTime: time.Now()}); err != nil {
+		t.Fatalf("downloadFile() error = %v", err)
+	}
+}
+
+func TestMaxFilesPerTransfer(t *testing.T) {
+	// Downloads hang until released so the test controls what runs
+	started := make(chan string, 8)
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- r.URL.Query().Get("file")
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+		w.Write([]byte("data"))
+	}))
+	defer srv.Close()
+
+	m := newTestManager()
+	m.cfg.TargetDir = t.TempDir()
+	m.stats = newStatsStore(newStateFile(m.cfg.TargetDir))
+	m.queue = newJobQueue(1)
+	m.client = &fileURLPutioClient{base: srv.URL}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		m.feedJobs()
+	}()
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.downloadWorker(nil)
+		}()
+	}
+	defer func() {
+		close(m.stopChan)
+		close(release)
+		wg.Wait()
+	}()
+
+	// A big transfer is queued first, a small one right after
+	for i := int64(1); i <= 3; i++ {
+		m.QueueDownload(downloadJob{FileID: 10 + i, Name: fmt.Sprintf("big%d.mkv", i), TransferID: 1})
+	}
+	m.QueueDownload(downloadJob{FileID: 21, Name: "small.mkv", TransferID: 2})
+
+	// Both workers are busy, but only one with the big transfer
+	got := map[string]bool{}
+	for range 2 {
+		select {
+		case name := <-started:
+			got[name] = true
+		case <-time.After(5 * time.Second):
+			t.Fatalf("downloads started = %v, want two", got)
+		}
+	}
+	if !got["11"] || !got["21"] {
+		t.Errorf("downloads started = %v, want the first big file and the small one", got)
+	}
+	select {
+	case name := <-started:
+		t.Errorf("file %s started beyond the per-transfer limit", name)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// fileURLPutioClient serves a download URL naming the requested file
+type fileURLPutioClient struct {
+	fakePutioClient
+	base string
+}
+
+func (c *fileURLPutioClient) GetDownloadURL(ctx context.Context, fileID int64) (string, error) {
+	return fmt.Sprintf("%s/?file=%d", c.base, fileID), nil
+}
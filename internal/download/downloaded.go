@@ -0,0 +1,115 @@
+package download
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/elsbrock/go-putio"
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// DownloadedStore remembers which transfers have been downloaded, so that
+// after a restart finished transfers can be reported as complete without
+// asking Put.io for their files. Transfers are forgotten once they are gone
+// from Put.io.
+type DownloadedStore struct {
+	mu    sync.RWMutex
+	ids   map[int64]time.Time // transfer ID -> when it was downloaded
+	state *stateFile
+}
+
+func newDownloadedStore(state *stateFile) *DownloadedStore {
+	return &DownloadedStore{
+		ids:   make(map[int64]time.Time),
+		state: state,
+	}
+}
+
+// Load reads the persisted downloaded transfers from disk. A missing file is
+// not an error.
+func (ds *DownloadedStore) Load() {
+	st, err := ds.state.Read()
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Error("transfers").Err(err).Msg("Failed to load downloaded transfers")
+		}
+		return
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	for id, at := range st.Downloaded {
+		ds.ids[id] = at
+	}
+}
+
+// Add records a transfer as downloaded and persists to disk. A nil store
+// records nothing.
+func (ds *DownloadedStore) Add(transferID int64, now time.Time) {
+	if ds == nil {
+		return
+	}
+	ds.mu.Lock()
+	if _, ok := ds.ids[transferID]; ok {
+		ds.mu.Unlock()
+		return
+	}
+	ds.ids[transferID] = now
+	ds.mu.Unlock()
+
+	ds.save()
+}
+
+// Has reports whether a transfer has been recorded as downloaded.
+func (ds *DownloadedStore) Has(transferID int64) bool {
+	if ds == nil {
+		return false
+	}
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	_, ok := ds.ids[transferID]
+	return ok
+}
+
+// Retain forgets the transfers that are not among transfers, the full list
+// of the watched folders.
+func (ds *DownloadedStore) Retain(transfers []*putio.Transfer) {
+	if ds == nil {
+		return
+	}
+	seen := make(map[int64]bool, len(transfers))
+	for _, t := range transfers {
+		seen[t.ID] = true
+	}
+
+	ds.mu.Lock()
+	removed := 0
+	for id := range ds.ids {
+		if !seen[id] {
+			delete(ds.ids, id)
+			removed++
+		}
+	}
+	ds.mu.Unlock()
+
+	if removed > 0 {
+		ds.save()
+	}
+}
+
+func (ds *DownloadedStore) save() {
+	ds.mu.RLock()
+	ids := make(map[int64]time.Time, len(ds.ids))
+	for id, at := range ds.ids {
+		ids[id] = at
+	}
+	ds.mu.RUnlock()
+
+	err := ds.state.Update(func(st *persistedState) {
+		st.Downloaded = ids
+	})
+	if err != nil {
+		log.Error("transfers").Err(err).Msg("Failed to save downloaded transfers")
+	}
+}
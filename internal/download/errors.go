@@ -2,6 +2,7 @@ package download
 
 import (
 	"fmt"
+	"time"
 )
 
 // DownloadError is the base error type for download-related errors
@@ -23,6 +24,34 @@ func NewDownloadCancelledError(filename, reason string) error {
 	}
 }
 
+// NewInvalidContentError creates a new error for download bodies that are not
+// the requested file, such as HTML error pages
+func NewInvalidContentError(filename, reason string) error {
+	return &DownloadError{
+		Type:    "InvalidContent",
+		Message: fmt.Sprintf("Download of %s returned invalid content: %s", filename, reason),
+	}
+}
+
+// NewDownloadStalledError creates a new error for downloads cancelled because
+// they made no progress for too long
+func NewDownloadStalledError(filename string, stalled time.Duration) error {
+	return &DownloadError{
+		Type:    "DownloadStalled",
+		Message: fmt.Sprintf("Download of %s made no progress for %s", filename, stalled.Round(time.Second)),
+	}
+}
+
+// NewInsufficientDiskSpaceError creates a new error for downloads not started
+// because the target filesystem lacks free space
+func NewInsufficientDiskSpaceError(filename string, needed, free int64) error {
+	return &DownloadError{
+		Type: "InsufficientDiskSpace",
+		Message: fmt.Sprintf("Download of %s needs %.1f MiB of free disk space, only %.1f MiB available",
+			filename, float64(needed)/(1<<20), float64(free)/(1<<20)),
+	}
+}
+
 // NewTransferNotFoundError creates a new error for transfer not found situations
 func NewTransferNotFoundError(transferID int64) error {
 	return &DownloadError{
@@ -38,3 +67,21 @@ func NewNoFilesFoundError(transferID int64) error {
 		Message: fmt.Sprintf("No files found for transfer %d", transferID),
 	}
 }
+
+// NewTransferStalledError creates a new error for transfers whose download
+// made no progress for too long
+func NewTransferStalledError(transferID int64, stalled time.Duration) error {
+	return &DownloadError{
+		Type:    "TransferStalled",
+		Message: fmt.Sprintf("Transfer %d made no progress for %s", transferID, stalled.Round(time.Second)),
+	}
+}
+
+// NewFilesFailedError creates a new error for transfers given up on because
+// some of their files could not be downloaded
+func NewFilesFailedError(failed, total int32) error {
+	return &DownloadError{
+		Type:    "FilesFailed",
+		Message: fmt.Sprintf("%d of %d files could not be downloaded", failed, total),
+	}
+}
@@ -0,0 +1,92 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// defaultCommandTimeout bounds the completion command if no timeout is set
+const defaultCommandTimeout = 10 * time.Minute
+
+// commandHook runs an external program for every processed transfer.
+type commandHook struct {
+	command string
+	timeout time.Duration
+}
+
+// newCommandHook returns a hook running command, or nil if command is empty.
+func newCommandHook(command string, timeout time.Duration) *commandHook {
+	if command == "" {
+		return nil
+	}
+	if timeout <= 0 {
+		timeout = defaultCommandTimeout
+	}
+	return &commandHook{command: command, timeout: timeout}
+}
+
+// Run executes the command with the transfer name and local path as
+// arguments and details of the transfer in PLDR_* environment variables.
+// The command is killed once the timeout passes. It returns the combined
+// output of the command.
+func (h *commandHook) Run(ctx context.Context, event TransferEvent, files int32, size int64) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, h.command, event.Name, event.Path)
+	cmd.Env = append(os.Environ(),
+		"PLDR_TRANSFER_ID="+strconv.FormatInt(event.ID, 10),
+		"PLDR_TRANSFER_NAME="+event.Name,
+		"PLDR_TRANSFER_HASH="+event.Hash,
+		"PLDR_TRANSFER_PATH="+event.Path,
+		"PLDR_CATEGORY="+event.Category,
+		"PLDR_FILE_COUNT="+strconv.Itoa(int(files)),
+		"PLDR_TOTAL_SIZE="+strconv.FormatInt(size, 10),
+	)
+	// Don't wait for children of the command still holding its output open
+	cmd.WaitDelay = 5 * time.Second
+	out, err := cmd.CombinedOutput()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return out, ctx.Err()
+	}
+	return out, err
+}
+
+// runCompleteCommand runs the completion command for a processed transfer in
+// the background, so that a hanging script never holds up other transfers.
+// Failures and non-zero exits are only logged.
+func (m *Manager) runCompleteCommand(event TransferEvent) {
+	var files int32
+	var size int64
+	if ctx, ok := m.coordinator.GetTransferContext(event.ID); ok {
+		_, size, files, _ = ctx.GetProgress()
+	}
+
+	go func() {
+		out, err := m.completeCmd.Run(context.Background(), event, files, size)
+		if len(out) > 0 {
+			log.Debug("command").
+				Int64("transfer_id", event.ID).
+				Str("output", string(out)).
+				Msg("Completion command output")
+		}
+		if err != nil {
+			log.Warn("command").
+				Int64("transfer_id", event.ID).
+				Str("name", event.Name).
+				Str("command", m.completeCmd.command).
+				Err(err).
+				Msg("Completion command failed")
+			return
+		}
+		log.Debug("command").
+			Int64("transfer_id", event.ID).
+			Msg("Completion command finished")
+	}()
+}
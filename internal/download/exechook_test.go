@@ -0,0 +1,46 @@
+//go:build unix
+
+package download
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCommandHookRun(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "hook.sh")
+	os.WriteFile(script, []byte("#!/bin/sh\necho \"$1|$2|$PLDR_TRANSFER_ID|$PLDR_FILE_COUNT|$PLDR_TOTAL_SIZE\"\nexit 3\n"), 0755)
+
+	h := newCommandHook(script, time.Minute)
+	event := TransferEvent{ID: 7, Name: "My.Show.S01", Path: "/downloads/tv/My.Show.S01"}
+	out, err := h.Run(context.Background(), event, 2, 2048)
+	if got, want := strings.TrimSpace(string(out)), "My.Show.S01|/downloads/tv/My.Show.S01|7|2|2048"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+	if err == nil {
+		t.Error("expected the non-zero exit to be reported")
+	}
+}
+
+func TestCommandHookTimeout(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "hang.sh")
+	os.WriteFile(script, []byte("#!/bin/sh\nexec sleep 10\n"), 0755)
+
+	h := newCommandHook(script, 50*time.Millisecond)
+	start := time.Now()
+	_, err := h.Run(context.Background(), TransferEvent{}, 0, 0)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want a deadline error", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("hanging command ran for %v", elapsed)
+	}
+	if newCommandHook("", time.Minute) != nil {
+		t.Error("expected nil hook without command")
+	}
+}
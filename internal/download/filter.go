@@ -0,0 +1,52 @@
+package download
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ValidatePatterns checks that include or exclude patterns are valid globs.
+func ValidatePatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// matchesPattern reports whether the relative path of a file within its
+// transfer matches a glob pattern, ignoring case. Patterns without a slash
+// match the file's name in any folder, so "*.nfo" also matches
+// "Extras/info.nfo"; others match the whole path.
+func matchesPattern(pattern, name string) bool {
+	pattern = strings.ToLower(pattern)
+	name = strings.ToLower(filepath.ToSlash(name))
+	if !strings.Contains(pattern, "/") {
+		name = path.Base(name)
+	}
+	ok, _ := path.Match(pattern, name)
+	return ok
+}
+
+// fileWanted reports whether a file passes the include and exclude
+// patterns. Exclude patterns take precedence; with include patterns, a file
+// has to match one of them.
+func (m *Manager) fileWanted(name string) bool {
+	for _, pattern := range m.dlConfig.ExcludePatterns {
+		if matchesPattern(pattern, name) {
+			return false
+		}
+	}
+	if len(m.dlConfig.IncludePatterns) == 0 {
+		return true
+	}
+	for _, pattern := range m.dlConfig.IncludePatterns {
+		if matchesPattern(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
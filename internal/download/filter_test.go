@@ -0,0 +1,119 @@
+package download
+
+import (
+	"context"
+	"testing"
+
+	"github.com/elsbrock/go-putio"
+)
+
+func TestFileWanted(t *testing.T) {
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		file    string
+		want    bool
+	}{
+		{"no patterns", nil, nil, "info.nfo", true},
+		{"excluded", nil, []string{"*.nfo"}, "info.nfo", false},
+		{"excluded in subfolder", nil, []string{"*.nfo"}, "Extras/info.nfo", false},
+		{"case-insensitive", nil, []string{"*sample*"}, "Movie.SAMPLE.mkv", false},
+		{"not excluded", nil, []string{"*.nfo"}, "movie.mkv", true},
+		{"path pattern", nil, []string{"Sample/*"}, "Sample/movie.mkv", false},
+		{"path pattern elsewhere", nil, []string{"Sample/*"}, "movie.mkv", true},
+		{"included", []string{"*.mkv"}, nil, "movie.mkv", true},
+		{"not included", []string{"*.mkv"}, nil, "movie.txt", false},
+		{"second include", []string{"*.mkv", "*.srt"}, nil, "Subs/movie.en.srt", true},
+		{"exclude wins", []string{"*.mkv"}, []string{"*sample*"}, "sample.mkv", false},
+		{"included, not excluded", []string{"*.mkv"}, []string{"*sample*"}, "movie.mkv", true},
+		{"excluded, not included", []string{"*.mkv"}, []string{"*.nfo"}, "info.nfo", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestManager()
+			m.dlConfig.IncludePatterns = tt.include
+			m.dlConfig.ExcludePatterns = tt.exclude
+			if got := m.fileWanted(tt.file); got != tt.want {
+				t.Errorf("fileWanted(%q) = %v, want %v", tt.file, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidatePatterns(t *testing.T) {
+	if err := ValidatePatterns([]string{"*.nfo", "Sample/*"}); err != nil {
+		t.Errorf("ValidatePatterns() error = %v", err)
+	}
+	if err := ValidatePatterns([]string{"[unterminated"}); err == nil {
+		t.Error("expected an error for a malformed pattern")
+	}
+}
+
+func TestProcessTransferSkipsFilteredFiles(t *testing.T) {
+	m := newTestManager()
+	m.cfg.TargetDir = t.TempDir()
+	m.dlConfig.ExcludePatterns = []string{"*.nfo"}
+	m.client = &fakePutioClient{files: map[int64][]*putio.File{10: {
+		{ID: 100, Name: "movie.mkv", Size: 10},
+		{ID: 101, Name: "movie.nfo", Size: 1},
+	}}}
+	transfer := &putio.Transfer{ID: 1, Name: "Movie", FileID: 10, Status: "COMPLETED"}
+
+	m.workerWg.Add(1)
+	m.processor.processTransfer(context.Background(), transfer)
+
+	if job, ok := m.queue.Pop(); !ok || job.FileID != 100 {
+		t.Fatalf("Pop() = file %d, %v; want only movie.mkv queued", job.FileID, ok)
+	}
+	if job, ok := m.queue.Pop(); ok {
+		t.Errorf("filtered file %d queued", job.FileID)
+	}
+	// The filtered file counts as done so the transfer can finish
+	ctx, ok := m.coordinator.GetTransferContext(transfer.ID)
+	if !ok {
+		t.Fatal("transfer not initiated")
+	}
+	if _, _, completed, _ := ctx.GetProgress(); completed != 1 {
+		t.Errorf("completed files = %d, want 1", completed)
+	}
+}
+
+func TestProcessTransferSkipsSmallFiles(t *testing.T) {
+	m := newTestManager()
+	m.cfg.TargetDir = t.TempDir()
+	m.dlConfig.MinFileSize = 50
+	m.client = &fakePutioClient{files: map[int64][]*putio.File{10: {
+		{ID: 100, Name: "movie.mkv", Size: 100},
+		{ID: 101, Name: "sample.mkv", Size: 10},
+		{ID: 102, Name: "movie.en.srt", Size: 50},
+	}}}
+	transfer := &putio.Transfer{ID: 1, Name: "Movie", FileID: 10, Status: "COMPLETED"}
+
+	m.workerWg.Add(1)
+	m.processor.processTransfer(context.Background(), transfer)
+
+	var queued []int64
+	for {
+		job, ok := m.queue.Pop()
+		if !ok {
+			break
+		}
+		queued = append(queued, job.FileID)
+	}
+	if len(queued) != 2 || queued[0] != 100 || queued[1] != 102 {
+		t.Errorf("queued files = %v, want [100 102]", queued)
+	}
+
+	// The skipped file counts as done, including its size, so progress can
+	// reach 100%
+	ctx, ok := m.coordinator.GetTransferContext(transfer.ID)
+	if !ok {
+		t.Fatal("transfer not initiated")
+	}
+	downloaded, total, completed, _ := ctx.GetProgress()
+	if completed != 1 || downloaded != 10 || total != 160 {
+		t.Errorf("progress = %d/%d bytes, %d files completed; want 10/160, 1", downloaded, total, completed)
+	}
+}
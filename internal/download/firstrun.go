@@ -0,0 +1,68 @@
+package download
+
+import (
+	"os"
+	"time"
+
+	"github.com/elsbrock/go-putio"
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// First run policies decide what happens to transfers that had already
+// finished before plundrio first ran against the target directory
+const (
+	FirstRunPolicyDownloadAll   = "download-all"   // download them like any other transfer
+	FirstRunPolicySkipExisting  = "skip-existing"  // leave them alone
+	FirstRunPolicyMarkProcessed = "mark-processed" // report them as downloaded without downloading them
+)
+
+// loadFirstRun returns when plundrio first ran against the target directory.
+// If the state file holds no first run yet, now is recorded as the first run.
+func loadFirstRun(state *stateFile, now time.Time) time.Time {
+	st, err := state.Read()
+	if err != nil && !os.IsNotExist(err) {
+		log.Warn("transfers").Err(err).Msg("Failed to read first run from state")
+		return time.Time{}
+	}
+	if !st.FirstRun.IsZero() {
+		return st.FirstRun
+	}
+
+	if err := state.Update(func(st *persistedState) {
+		if st.FirstRun.IsZero() {
+			st.FirstRun = now
+		}
+	}); err != nil {
+		log.Warn("transfers").Err(err).Msg("Failed to record first run in state")
+	}
+	log.Info("transfers").
+		Time("first_run", now).
+		Msg("First run against this target directory")
+	return now
+}
+
+// skipFirstRunBacklog reports whether a ready transfer belongs to the backlog
+// that had finished before the first run and is not to be downloaded under
+// the configured first run policy. With FirstRunPolicyMarkProcessed such
+// transfers are marked as processed.
+func (p *TransferProcessor) skipFirstRunBacklog(transfer *putio.Transfer) bool {
+	policy := p.manager.dlConfig.FirstRunPolicy
+	if policy == FirstRunPolicyDownloadAll || p.firstRun.IsZero() || !finishedBefore(transfer, p.firstRun) {
+		return false
+	}
+
+	if policy == FirstRunPolicyMarkProcessed {
+		p.MarkTransferProcessed(transfer.ID)
+		log.Info("transfers").
+			Int64("transfer_id", transfer.ID).
+			Str("name", transfer.Name).
+			Msg("Marked transfer that finished before the first run as processed")
+		return true
+	}
+
+	log.Debug("transfers").
+		Int64("transfer_id", transfer.ID).
+		Str("name", transfer.Name).
+		Msg("Ignoring transfer that finished before the first run")
+	return true
+}
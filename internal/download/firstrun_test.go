@@ -0,0 +1,57 @@
+package download
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/elsbrock/go-putio"
+)
+
+func TestLoadFirstRunPersists(t *testing.T) {
+	state := newStateFile(t.TempDir())
+	first := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	if got := loadFirstRun(state, first); !got.Equal(first) {
+		t.Fatalf("first run = %v, want %v", got, first)
+	}
+	// Later runs keep the original first run
+	if got := loadFirstRun(state, first.Add(24*time.Hour)); !got.Equal(first) {
+		t.Errorf("first run after restart = %v, want %v", got, first)
+	}
+}
+
+func TestFirstRunPolicyMarkProcessed(t *testing.T) {
+	firstRun := time.Now().Add(-time.Hour)
+	old := &putio.Transfer{ID: 1, Name: "Old", FileID: 10, Status: "COMPLETED",
+		FinishedAt: &putio.Time{Time: firstRun.Add(-24 * time.Hour)}}
+	recent := &putio.Transfer{ID: 2, Name: "Recent", FileID: 20, Status: "COMPLETED",
+		FinishedAt: &putio.Time{Time: firstRun.Add(time.Minute)}}
+	client := &fakePutioClient{files: map[int64][]*putio.File{
+		10: {{ID: 100, Name: "old.mkv", Size: 10}},
+		20: {{ID: 200, Name: "recent.mkv", Size: 10}},
+	}}
+
+	m := newTestManager()
+	m.cfg.TargetDir = t.TempDir()
+	m.dlConfig.FirstRunPolicy = FirstRunPolicyMarkProcessed
+	m.client = client
+	m.processor.firstRun = firstRun
+	m.processor.transfers = map[string][]*putio.Transfer{"COMPLETED": {old, recent}}
+
+	m.processor.processReadyTransfers(context.Background())
+	m.workerWg.Wait()
+
+	if len(client.listed) != 1 || client.listed[0] != 20 {
+		t.Errorf("listed files of %v, want only the recent transfer", client.listed)
+	}
+	if !m.processor.isTransferProcessed(old.ID) {
+		t.Error("expected the old transfer to be marked as processed")
+	}
+	if !m.HasLocalData(old) {
+		t.Error("expected the old transfer to be reported as downloaded")
+	}
+	if m.processor.isTransferProcessed(recent.ID) {
+		t.Error("recent transfer marked as processed before it was downloaded")
+	}
+}
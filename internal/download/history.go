@@ -0,0 +1,123 @@
+package download
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// History outcomes
+const (
+	HistoryOutcomeCompleted = "completed"
+	HistoryOutcomeFailed    = "failed"
+)
+
+// historyCSVHeader is written as the first line of new CSV history files
+var historyCSVHeader = []string{"time", "name", "hash", "bytes", "duration_seconds", "outcome", "error", "category"}
+
+// HistoryEntry is one line of the transfer history file.
+type HistoryEntry struct {
+	Time            time.Time `json:"time"`
+	Name            string    `json:"name"`
+	Hash            string    `json:"hash,omitempty"`
+	Bytes           int64     `json:"bytes"`
+	DurationSeconds float64   `json:"durationSeconds"`
+	Outcome         string    `json:"outcome"`
+	Error           string    `json:"error,omitempty"`
+	Category        string    `json:"category,omitempty"`
+}
+
+// historyWriter appends transfer outcomes to a file. Files ending in .csv
+// are written as CSV, anything else as JSON lines.
+type historyWriter struct {
+	mu   sync.Mutex
+	path string
+	csv  bool
+}
+
+// newHistoryWriter returns a writer for path, or nil if path is empty.
+func newHistoryWriter(path string) *historyWriter {
+	if path == "" {
+		return nil
+	}
+	return &historyWriter{
+		path: path,
+		csv:  strings.EqualFold(filepath.Ext(path), ".csv"),
+	}
+}
+
+// Append writes a single entry to the history file.
+func (h *historyWriter) Append(e HistoryEntry) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	f, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open history file: %w", err)
+	}
+	defer f.Close()
+
+	if !h.csv {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return fmt.Errorf("failed to marshal history entry: %w", err)
+		}
+		_, err = f.Write(append(data, '\n'))
+		return err
+	}
+
+	w := csv.NewWriter(f)
+	if info, err := f.Stat(); err == nil && info.Size() == 0 {
+		w.Write(historyCSVHeader)
+	}
+	w.Write([]string{
+		e.Time.Format(time.RFC3339),
+		e.Name,
+		e.Hash,
+		strconv.FormatInt(e.Bytes, 10),
+		strconv.FormatFloat(e.DurationSeconds, 'f', 0, 64),
+		e.Outcome,
+		e.Error,
+		e.Category,
+	})
+	w.Flush()
+	return w.Error()
+}
+
+// recordHistory appends the outcome of a transfer to the history file.
+func (m *Manager) recordHistory(event TransferEvent, outcome string, transferErr error) {
+	ctx, ok := m.coordinator.GetTransferContext(event.ID)
+	if !ok {
+		return
+	}
+
+	downloaded, _, _, _ := ctx.GetProgress()
+	entry := HistoryEntry{
+		Time:            time.Now(),
+		Name:            event.Name,
+		Hash:            event.Hash,
+		Category:        event.Category,
+		Bytes:           downloaded,
+		DurationSeconds: time.Since(ctx.StartTime).Seconds(),
+		Outcome:         outcome,
+	}
+	if transferErr != nil {
+		entry.Error = transferErr.Error()
+	}
+
+	if err := m.history.Append(entry); err != nil {
+		log.Error("history").
+			Int64("transfer_id", event.ID).
+			Str("path", m.history.path).
+			Err(err).
+			Msg("Failed to write transfer history")
+	}
+}
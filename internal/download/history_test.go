@@ -0,0 +1,94 @@
+package download
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHistoryWriter_JSONLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	h := newHistoryWriter(path)
+
+	for _, outcome := range []string{HistoryOutcomeCompleted, HistoryOutcomeFailed} {
+		if err := h.Append(HistoryEntry{Name: "show", Outcome: outcome}); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %d: %q", len(lines), data)
+	}
+	var e HistoryEntry
+	if err := json.Unmarshal([]byte(lines[1]), &e); err != nil {
+		t.Fatalf("invalid JSON line: %v", err)
+	}
+	if e.Outcome != HistoryOutcomeFailed {
+		t.Errorf("outcome = %q, want %q", e.Outcome, HistoryOutcomeFailed)
+	}
+}
+
+func TestHistoryWriter_CSVHeaderOnce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.csv")
+	h := newHistoryWriter(path)
+
+	h.Append(HistoryEntry{Name: "a", Outcome: HistoryOutcomeCompleted})
+	h.Append(HistoryEntry{Name: "b, with comma", Outcome: HistoryOutcomeCompleted})
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected header + 2 rows, got %d: %q", len(lines), data)
+	}
+	if !strings.HasPrefix(lines[0], "time,name,hash") {
+		t.Errorf("unexpected header %q", lines[0])
+	}
+	if !strings.Contains(lines[2], `"b, with comma"`) {
+		t.Errorf("expected quoted name in %q", lines[2])
+	}
+}
+
+func TestNewHistoryWriter_Disabled(t *testing.T) {
+	if h := newHistoryWriter(""); h != nil {
+		t.Error("expected nil writer for empty path")
+	}
+}
+
+func TestRecordHistory(t *testing.T) {
+	m := newTestManager()
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	m.history = newHistoryWriter(path)
+	m.coordinator.RegisterFailureHook(func(event TransferEvent, err error) {
+		m.recordHistory(event, HistoryOutcomeFailed, err)
+	})
+
+	ctx := m.coordinator.InitiateTransfer(1, "My.Show.S01", 100, 1)
+	ctx.SetHash("abc123")
+	ctx.SetLocation("tv", "/downloads/tv/My.Show.S01")
+	ctx.AddDownloadedBytes(42)
+	m.coordinator.StartDownload(1)
+	m.coordinator.FailTransfer(1, errors.New("boom"))
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var e HistoryEntry
+	if err := json.Unmarshal(data, &e); err != nil {
+		t.Fatalf("invalid history entry: %v", err)
+	}
+	if e.Name != "My.Show.S01" || e.Hash != "abc123" || e.Bytes != 42 || e.Error != "boom" || e.Category != "tv" {
+		t.Errorf("unexpected entry %+v", e)
+	}
+}
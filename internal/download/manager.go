@@ -3,22 +3,29 @@ package download
 import (
 	"context"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/elsbrock/go-putio"
+	"github.com/elsbrock/plundrio/internal/api"
 	"github.com/elsbrock/plundrio/internal/config"
 	"github.com/elsbrock/plundrio/internal/log"
 )
 
 // PutioClient abstracts the put.io API methods used by the download manager.
+// It is a subset of api.APIClient.
 type PutioClient interface {
 	GetTransfers(ctx context.Context) ([]*putio.Transfer, error)
 	GetAllTransferFiles(ctx context.Context, fileID int64) ([]*putio.File, error)
+	GetAllTransferFilePaths(ctx context.Context, fileID int64) ([]*putio.File, map[int64]string, error)
 	RetryTransfer(ctx context.Context, transferID int64) (*putio.Transfer, error)
 	DeleteTransfer(ctx context.Context, transferID int64) error
 	DeleteFile(ctx context.Context, fileID int64) error
 	GetDownloadURL(ctx context.Context, fileID int64) (string, error)
 }
 
+var _ PutioClient = api.APIClient(nil)
+
 // Manager handles downloading completed transfers from Put.io.
 // It supports concurrent downloads, progress tracking, and automatic cleanup
 // of completed transfers. The manager uses a worker pool pattern to process
@@ -29,8 +36,20 @@ type Manager struct {
 	dlConfig *DownloadConfig // Download-specific configuration
 
 	coordinator *TransferCoordinator // Coordinates transfer lifecycle
+	state       *stateFile           // State file shared by the persistent stores
 	categories  *CategoryStore       // Maps transfer hash → category subfolder
+	stats       *StatsStore          // Lifetime statistics persisted across restarts
+	downloaded  *DownloadedStore     // Transfers downloaded, persisted across restarts
+	history     *historyWriter       // Optional transfer history file, nil if disabled
+	webhook     *webhookNotifier     // Optional completion webhook, nil if disabled
+	completeCmd *commandHook         // Optional completion command, nil if disabled
+	pause       *pauseGate           // Global pause switch for download workers
 	activeFiles sync.Map             // map[int64]int64 - tracks files being downloaded, FileID -> TransferID
+	priorities  sync.Map             // map[string]int - bandwidth priority set by clients, hash -> priority
+	queue       *jobQueue            // Jobs waiting for a worker, served round-robin per transfer
+	limiter     *downloadLimiter     // Caps the combined download rate, shared by priority
+	workers     *workerPool          // Download workers, nil until started
+	ticker      *time.Ticker         // Paces transfer checks, nil until monitoring starts
 
 	ctx    context.Context
 	cancel context.CancelFunc
@@ -42,8 +61,15 @@ type Manager struct {
 	monitorWg sync.WaitGroup // tracks monitor goroutine
 
 	jobs    chan downloadJob
-	mu      sync.Mutex // protects job queueing
-	running bool       // tracks if manager is running
+	mu      sync.Mutex  // protects job queueing and settings changed by Reload
+	running bool        // tracks if manager is running
+	ready   atomic.Bool // set once the first transfer list has been loaded
+
+	bytesTransferred atomic.Int64    // bytes downloaded this session, sampled by the adaptive scaler
+	counters         sessionCounters // events of this session, reported by Metrics
+	lastPoll         atomic.Int64    // unix nanoseconds of the last successful transfer list fetch
+
+	rescans chan chan rescanResult // out of band scans requested via Rescan
 
 	processor *TransferProcessor // Handles transfer processing
 }
@@ -57,6 +83,21 @@ func (m *Manager) Context() context.Context {
 	return context.Background()
 }
 
+// LastPoll returns when the transfer list was last fetched from Put.io
+// successfully, or the zero time if it never was.
+func (m *Manager) LastPoll() time.Time {
+	if n := m.lastPoll.Load(); n != 0 {
+		return time.Unix(0, n)
+	}
+	return time.Time{}
+}
+
+// Ready reports whether the manager has loaded the transfer list from Put.io
+// at least once. Until then GetTransfers returns an incomplete view.
+func (m *Manager) Ready() bool {
+	return m.ready.Load()
+}
+
 // GetTransfers returns all tracked transfers for the configured folder.
 func (m *Manager) GetTransfers() []*putio.Transfer {
 	if m.processor == nil {
@@ -65,6 +106,15 @@ func (m *Manager) GetTransfers() []*putio.Transfer {
 	return m.processor.GetTransfers()
 }
 
+// TransferError returns the error plundrio reports for a transfer on top of
+// the one from Put.io, e.g. for timing out in the queue, or "" if none.
+func (m *Manager) TransferError(transferID int64) string {
+	if m.processor == nil {
+		return ""
+	}
+	return m.processor.transferError(transferID)
+}
+
 // GetTransferContext returns the lifecycle context for a transfer, if tracked.
 func (m *Manager) GetTransferContext(transferID int64) (*TransferContext, bool) {
 	return m.coordinator.GetTransferContext(transferID)
@@ -85,52 +135,178 @@ func (m *Manager) RemoveCategory(hash string) {
 	m.categories.Remove(hash)
 }
 
+// HasLocalData reports whether a finished transfer has been downloaded,
+// either during this session or, after a restart, in an earlier one. Only
+// what plundrio recorded is consulted, so it is cheap enough for every
+// client poll. Transfers plundrio leaves alone, per --adopt-existing or the
+// first run policy, count as downloaded since they never will be.
+func (m *Manager) HasLocalData(transfer *putio.Transfer) bool {
+	return m.processor.isTransferProcessed(transfer.ID) ||
+		m.downloaded.Has(transfer.ID) ||
+		m.processor.leavesAlone(transfer)
+}
+
+// GetLifetimeStats returns the cumulative statistics across all sessions.
+func (m *Manager) GetLifetimeStats() LifetimeStats {
+	return m.stats.Snapshot()
+}
+
 // New creates a new download manager
 func New(cfg *config.Config, client PutioClient) *Manager {
 	// Get default download configuration
 	dlConfig := GetDefaultConfig()
+	dlConfig.VerifyExisting = cfg.VerifyExisting
+	if cfg.CopyBufferSize > 0 {
+		dlConfig.CopyBufferSize = cfg.CopyBufferSize
+	}
+	if cfg.SegmentsPerFile > 0 {
+		dlConfig.SegmentsPerFile = cfg.SegmentsPerFile
+	}
+	dlConfig.MaxDownloadRate = cfg.MaxDownloadRate
+	dlConfig.MinFreeDiskBytes = cfg.MinFreeDiskBytes
+	dlConfig.DiskHeadroomPercent = cfg.DiskHeadroomPercent
+	dlConfig.QueueTimeout = cfg.QueueTimeout
+	dlConfig.CompletionSettle = cfg.CompletionSettle
+	dlConfig.AdoptExisting = cfg.AdoptExisting
+	if cfg.FirstRunPolicy != "" {
+		dlConfig.FirstRunPolicy = cfg.FirstRunPolicy
+	}
+	if cfg.NoFilesRetries >= 0 {
+		dlConfig.NoFilesRetries = cfg.NoFilesRetries
+	}
+	if cfg.CleanupWorkers > 0 {
+		dlConfig.CleanupWorkers = cfg.CleanupWorkers
+	}
+	if cfg.DiskErrorRetries >= 0 {
+		dlConfig.DiskErrorRetries = cfg.DiskErrorRetries
+	}
+	if cfg.TransferCheckInterval > 0 {
+		dlConfig.TransferCheckInterval = cfg.TransferCheckInterval
+	}
+	if cfg.DownloadMaxRetries > 0 {
+		dlConfig.DownloadMaxRetries = cfg.DownloadMaxRetries
+	}
+	if cfg.DownloadRetryBaseDelay > 0 {
+		dlConfig.DownloadRetryBaseDelay = cfg.DownloadRetryBaseDelay
+	}
+	if cfg.DownloadRetryMaxDelay > 0 {
+		dlConfig.DownloadRetryMaxDelay = cfg.DownloadRetryMaxDelay
+	}
+	dlConfig.DateSubfolder = cfg.DateSubfolder
+	dlConfig.TempDir = cfg.TempDir
+	dlConfig.DebugHTTP = cfg.DebugHTTP
+	dlConfig.PreferIPv4 = cfg.PreferIPv4
+	dlConfig.TLSConfig = cfg.TLSConfig
+	dlConfig.Proxy = cfg.Proxy
+	dlConfig.DownloadHeaderTimeout = cfg.DownloadHeaderTimeout
+	dlConfig.DownloadReadTimeout = cfg.DownloadReadTimeout
+	dlConfig.DownloadStallTimeout = cfg.DownloadStallTimeout
+	dlConfig.SalvageErrored = cfg.SalvageErrored
+	if cfg.DialTimeout > 0 {
+		dlConfig.DialTimeout = cfg.DialTimeout
+	}
+	dlConfig.PreserveStructure = cfg.PreserveStructure
+	dlConfig.IncludePatterns = cfg.IncludePatterns
+	dlConfig.ExcludePatterns = cfg.ExcludePatterns
+	dlConfig.MinFileSize = cfg.MinFileSize
+	if cfg.SanitizeNames != "" {
+		dlConfig.SanitizeNames = cfg.SanitizeNames
+	}
+	if cfg.MaxNewPerScan > 0 {
+		dlConfig.MaxNewPerScan = cfg.MaxNewPerScan
+	}
+	dlConfig.MaxFilesPerTransfer = cfg.MaxFilesPerTransfer
+	if cfg.MaxNewPriority != "" {
+		dlConfig.MaxNewPriority = cfg.MaxNewPriority
+	}
+	if cfg.QueueTimeoutAction != "" {
+		dlConfig.QueueTimeoutAction = cfg.QueueTimeoutAction
+	}
+	dlConfig.TransferStallTimeout = cfg.TransferStallTimeout
+	if cfg.TransferStallAction != "" {
+		dlConfig.TransferStallAction = cfg.TransferStallAction
+	}
+	dlConfig.FailedTransferGrace = cfg.FailedTransferGrace
+	if cfg.AvailabilityThreshold > 0 {
+		dlConfig.AvailabilityThreshold = cfg.AvailabilityThreshold
+	}
+	dlConfig.LowAvailabilityGrace = cfg.LowAvailabilityGrace
+	dlConfig.CancelLowAvailability = cfg.CancelLowAvailability
+	if cfg.FailedTransferAction != "" {
+		dlConfig.FailedTransferAction = cfg.FailedTransferAction
+	}
 
-	// Override with user config if provided
-	workerCount := cfg.WorkerCount
-	if workerCount <= 0 {
-		workerCount = dlConfig.DefaultWorkerCount
+	if cfg.AdaptiveWorkers {
+		dlConfig.AdaptiveWorkers = true
+		dlConfig.AdaptiveMinWorkers = max(1, cfg.AdaptiveMinWorkers)
+		dlConfig.AdaptiveMaxWorkers = max(dlConfig.AdaptiveMinWorkers, cfg.AdaptiveMaxWorkers)
+		dlConfig.AdaptiveTargetBandwidth = cfg.AdaptiveTargetBandwidth
 	}
 
+	state := newStateFile(cfg.TargetDir)
+
 	m := &Manager{
 		cfg:         cfg,
 		client:      client,
 		dlConfig:    dlConfig,
-		categories:  newCategoryStore(cfg.TargetDir),
+		state:       state,
+		categories:  newCategoryStoreWithState(state),
+		stats:       newStatsStore(state),
+		downloaded:  newDownloadedStore(state),
+		history:     newHistoryWriter(cfg.HistoryFile),
+		webhook:     newWebhookNotifier(cfg.WebhookURL, cfg.WebhookSecret),
+		completeCmd: newCommandHook(cfg.OnCompleteCommand, cfg.OnCompleteTimeout),
+		pause:       newPauseGate(cfg.StartPaused),
 		stopChan:    make(chan struct{}),
-		jobs:        make(chan downloadJob, workerCount*dlConfig.BufferMultiple),
+		queue:       newJobQueue(dlConfig.MaxFilesPerTransfer),
+		jobs:        make(chan downloadJob),
+		rescans:     make(chan chan rescanResult),
 		activeFiles: sync.Map{},
 	}
 
+	m.limiter = newDownloadLimiter(dlConfig.MaxDownloadRate, m.transferPriority)
+
 	// Initialize coordinator and processor
 	m.processor = newTransferProcessor(m)
 	m.coordinator = NewTransferCoordinator(func(transferID int64) {
 		m.processor.MarkTransferProcessed(transferID)
+		m.stats.TransferCompleted()
+		m.counters.transfersCompleted.Add(1)
 	})
+	m.coordinator.RegisterFailureHook(func(event TransferEvent, err error) {
+		m.stats.TransferFailed()
+		m.counters.transfersFailed.Add(1)
+	})
+	if m.history != nil {
+		m.coordinator.RegisterCompletionHook(func(event TransferEvent) {
+			m.recordHistory(event, HistoryOutcomeCompleted, nil)
+		})
+		m.coordinator.RegisterFailureHook(func(event TransferEvent, err error) {
+			m.recordHistory(event, HistoryOutcomeFailed, err)
+		})
+	}
+	if m.webhook != nil {
+		m.coordinator.RegisterCompletionHook(m.notifyWebhook)
+	}
+	if m.completeCmd != nil {
+		m.coordinator.RegisterCompletionHook(m.runCompleteCommand)
+	}
 
 	// Register cleanup hooks
-	m.coordinator.RegisterCleanupHook(func(transferID int64) error {
-		state, ok := m.coordinator.GetTransferContext(transferID)
-		if !ok {
-			return NewTransferNotFoundError(transferID)
-		}
-
+	m.coordinator.RegisterCleanupHook(func(event TransferEvent) error {
 		// Delete only the source file from Put.io, but keep the transfer
-		if err := m.client.DeleteFile(m.Context(), state.FileID); err != nil {
+		if err := m.client.DeleteFile(m.Context(), event.FileID); err != nil {
 			log.Error("cleanup").
-				Int64("transfer_id", transferID).
-				Int64("file_id", state.FileID).
+				Int64("transfer_id", event.ID).
+				Int64("file_id", event.FileID).
 				Err(err).
 				Msg("Failed to delete source file")
 			return err
 		}
 
 		log.Info("cleanup").
-			Int64("transfer_id", transferID).
+			Int64("transfer_id", event.ID).
+			Str("category", event.Category).
 			Msg("Deleted source file")
 
 		return nil
@@ -152,6 +328,10 @@ func (m *Manager) Start() {
 	m.ctx, m.cancel = context.WithCancel(context.Background())
 
 	m.categories.Load()
+	m.stats.Load()
+	m.downloaded.Load()
+	m.cleanTempDir(time.Now())
+	m.processor.firstRun = loadFirstRun(m.state, time.Now())
 
 	workerCount := m.cfg.WorkerCount
 	if workerCount <= 0 {
@@ -159,13 +339,32 @@ func (m *Manager) Start() {
 	}
 
 	// Start download workers with proper synchronization
-	for i := 0; i < workerCount; i++ {
-		m.workerWg.Add(1)
+	pool := &workerPool{m: m}
+	m.mu.Lock()
+	m.workers = pool
+	if m.dlConfig.AdaptiveWorkers {
+		pool.Resize(max(m.dlConfig.AdaptiveMinWorkers, min(m.dlConfig.AdaptiveMaxWorkers, workerCount)))
+		log.Info("download").
+			Int("workers", pool.Size()).
+			Int("min_workers", m.dlConfig.AdaptiveMinWorkers).
+			Int("max_workers", m.dlConfig.AdaptiveMaxWorkers).
+			Msg("Adaptive worker scaling enabled")
+		m.monitorWg.Add(1)
 		go func() {
-			defer m.workerWg.Done()
-			m.downloadWorker()
+			defer m.monitorWg.Done()
+			m.runAdaptiveScaler(pool)
 		}()
+	} else {
+		pool.Resize(workerCount)
 	}
+	m.mu.Unlock()
+
+	// Feed queued jobs to the workers
+	m.monitorWg.Add(1)
+	go func() {
+		defer m.monitorWg.Done()
+		m.feedJobs()
+	}()
 
 	// Start transfer monitor
 	m.monitorWg.Add(1)
@@ -173,6 +372,13 @@ func (m *Manager) Start() {
 		defer m.monitorWg.Done()
 		m.monitorTransfers()
 	}()
+
+	// Persist lifetime statistics
+	m.monitorWg.Add(1)
+	go func() {
+		defer m.monitorWg.Done()
+		m.flushStats()
+	}()
 }
 
 // Stop gracefully shuts down the manager
@@ -183,27 +389,24 @@ func (m *Manager) Stop() {
 		return
 	}
 	m.running = false
-	m.mu.Unlock()
-
+	// Close stopChan under the lock so that Reload can't start workers
+	// once they are being waited for
 	m.stopOnce.Do(func() {
 		// Cancel context first so in-flight API calls abort
 		m.cancel()
-		// Signal workers to stop via stopChan
+		// Signal workers and the job feeder to stop via stopChan
 		close(m.stopChan)
-		// Close jobs channel to prevent new submissions
-		close(m.jobs)
-		// Drain any remaining jobs to prevent deadlock
-		go func() {
-			for range m.jobs {
-				// Drain jobs channel
-			}
-		}()
 	})
+	m.mu.Unlock()
 
+	// Wait for monitors first: the transfer monitor and the adaptive
+	// scaler start workers, which must not race the wait for them
+	m.monitorWg.Wait()
 	// Wait for all workers to finish
 	m.workerWg.Wait()
-	// Wait for monitor to finish
-	m.monitorWg.Wait()
+
+	// Persist statistics and active time accumulated since the last flush
+	m.stats.Flush()
 }
 
 // QueueDownload adds a download job to the queue if not already downloading
@@ -216,15 +419,16 @@ func (m *Manager) QueueDownload(job downloadJob) {
 		return
 	}
 
-	// Mark file as being downloaded before queueing, storing TransferID
-	m.activeFiles.Store(job.FileID, job.TransferID)
 	select {
-	case m.jobs <- job:
-		// Successfully queued
 	case <-m.stopChan:
-		// Manager is shutting down, just remove from active files
-		m.activeFiles.Delete(job.FileID)
+		// Manager is shutting down, don't queue any more work
+		return
+	default:
 	}
+
+	// Mark file as being downloaded before queueing, storing TransferID
+	m.activeFiles.Store(job.FileID, job.TransferID)
+	m.queue.Push(job)
 }
 
 // cleanupTransfer handles the deletion of a completed transfer and its source files
@@ -0,0 +1,50 @@
+package download
+
+import "sync/atomic"
+
+// Metrics is a snapshot of what the download manager did during this
+// process, exposed by the RPC server on /metrics.
+type Metrics struct {
+	ActiveTransfers    int   // Transfers whose files are being downloaded
+	DownloadingFiles   int   // Files being downloaded by a worker
+	JobsQueued         int   // Files waiting for a worker
+	FilesCompleted     int64 // Files downloaded
+	FilesFailed        int64 // Files given up on after retries
+	DownloadRetries    int64 // Download attempts retried after an error
+	TransfersCompleted int64 // Transfers with all files downloaded
+	TransfersFailed    int64 // Transfers that failed
+	BytesDownloaded    int64 // Bytes written to the target directory
+}
+
+// sessionCounters count events since the process started, unlike the
+// lifetime statistics which persist across restarts.
+type sessionCounters struct {
+	downloading        atomic.Int64
+	filesCompleted     atomic.Int64
+	filesFailed        atomic.Int64
+	retries            atomic.Int64
+	transfersCompleted atomic.Int64
+	transfersFailed    atomic.Int64
+}
+
+// Metrics returns a snapshot of the manager's counters and gauges.
+func (m *Manager) Metrics() Metrics {
+	active := 0
+	m.coordinator.RangeTransfers(func(_ int64, ctx *TransferContext) bool {
+		if ctx.GetState() == TransferLifecycleDownloading {
+			active++
+		}
+		return true
+	})
+	return Metrics{
+		ActiveTransfers:    active,
+		DownloadingFiles:   int(m.counters.downloading.Load()),
+		JobsQueued:         m.queue.Len(),
+		FilesCompleted:     m.counters.filesCompleted.Load(),
+		FilesFailed:        m.counters.filesFailed.Load(),
+		DownloadRetries:    m.counters.retries.Load(),
+		TransfersCompleted: m.counters.transfersCompleted.Load(),
+		TransfersFailed:    m.counters.transfersFailed.Load(),
+		BytesDownloaded:    m.bytesTransferred.Load(),
+	}
+}
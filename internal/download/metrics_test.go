@@ -0,0 +1,28 @@
+package download
+
+import "testing"
+
+func TestMetrics(t *testing.T) {
+	m := newTestManager()
+
+	m.coordinator.InitiateTransfer(1, "Show", 10, 2)
+	if err := m.coordinator.StartDownload(1); err != nil {
+		t.Fatal(err)
+	}
+	m.coordinator.InitiateTransfer(2, "Movie", 20, 1)
+	m.QueueDownload(downloadJob{FileID: 100, Name: "Show/e01.mkv", TransferID: 1})
+	m.QueueDownload(downloadJob{FileID: 101, Name: "Show/e02.mkv", TransferID: 1})
+	m.counters.filesCompleted.Add(3)
+	m.bytesTransferred.Add(42)
+
+	got := m.Metrics()
+	if got.ActiveTransfers != 1 {
+		t.Errorf("ActiveTransfers = %d, want only the transfer downloading", got.ActiveTransfers)
+	}
+	if got.JobsQueued != 2 {
+		t.Errorf("JobsQueued = %d, want 2", got.JobsQueued)
+	}
+	if got.FilesCompleted != 3 || got.BytesDownloaded != 42 {
+		t.Errorf("FilesCompleted = %d, BytesDownloaded = %d; want 3 and 42", got.FilesCompleted, got.BytesDownloaded)
+	}
+}
@@ -0,0 +1,148 @@
+package download
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/elsbrock/go-putio"
+)
+
+// strftimeLayouts maps the supported strftime directives to Go time layouts
+var strftimeLayouts = map[byte]string{
+	'Y': "2006",
+	'y': "06",
+	'm': "01",
+	'd': "02",
+	'H': "15",
+	'M': "04",
+	'b': "Jan",
+	'B': "January",
+	'j': "002",
+}
+
+// formatDate formats t according to a strftime-like format such as "%Y-%m".
+// Unsupported directives are kept as-is and "%%" yields a literal percent.
+func formatDate(format string, t time.Time) string {
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 == len(format) {
+			b.WriteByte(format[i])
+			continue
+		}
+		i++
+		if format[i] == '%' {
+			b.WriteByte('%')
+		} else if layout, ok := strftimeLayouts[format[i]]; ok {
+			b.WriteString(t.Format(layout))
+		} else {
+			b.WriteByte('%')
+			b.WriteByte(format[i])
+		}
+	}
+	return b.String()
+}
+
+// dateSubfolder returns the date subfolder for a transfer, based on when it
+// finished on Put.io (or was created, if that is unknown). It is empty if
+// no format is configured or the transfer has no timestamp.
+func dateSubfolder(format string, transfer *putio.Transfer) string {
+	if format == "" {
+		return ""
+	}
+	ts := transfer.FinishedAt
+	if ts == nil || ts.IsZero() {
+		ts = transfer.CreatedAt
+	}
+	if ts == nil || ts.IsZero() {
+		return ""
+	}
+	return formatDate(format, ts.Time)
+}
+
+// TransferTargetDir returns the target directory a transfer is downloaded
+// to, which depends on the Put.io folder it is saved to.
+func (m *Manager) TransferTargetDir(transfer *putio.Transfer) string {
+	return m.cfg.TransferTargetDir(transfer.SaveParentID)
+}
+
+// TransferDir returns the directory, relative to the target directory, that
+// a transfer's files are written to: <category>/<date subfolder>/<name>.
+func (m *Manager) TransferDir(transfer *putio.Transfer) string {
+	category := m.GetCategory(transfer.Hash)
+	name := sanitizeName(transfer.Name, m.dlConfig.SanitizeNames)
+	return filepath.Join(category, dateSubfolder(m.dlConfig.DateSubfolder, transfer), name)
+}
+
+// filePath returns the path, relative to the target directory, that a file
+// of a transfer is written to.
+func (m *Manager) filePath(transfer *putio.Transfer, file *putio.File) string {
+	return filepath.Join(m.TransferDir(transfer), sanitizePath(file.Name, m.dlConfig.SanitizeNames))
+}
+
+// Policies for making file and folder names safe for restrictive
+// filesystems such as SMB shares and exFAT
+const (
+	SanitizeNamesNone    = "none"    // keep names as they are on Put.io
+	SanitizeNamesReplace = "replace" // replace illegal characters with an underscore
+	SanitizeNamesStrip   = "strip"   // remove illegal characters
+)
+
+// illegalNameChars are the characters Windows, and thus SMB and exFAT,
+// reject in file names
+const illegalNameChars = `<>:"/\|?*`
+
+// reservedNames are file names Windows reserves for devices, with or
+// without an extension
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// sanitizeName makes a single file or folder name safe according to policy.
+// Illegal and control characters are replaced or stripped, trailing dots
+// and spaces removed and reserved device names prefixed with an underscore.
+// Other characters, including non-ASCII ones, are kept. Names are mapped
+// deterministically, so the same Put.io name always yields the same local
+// name and local data can be found again for cleanup.
+func sanitizeName(name, policy string) string {
+	if name == "" || (policy != SanitizeNamesReplace && policy != SanitizeNamesStrip) {
+		return name
+	}
+
+	var b strings.Builder
+	for _, r := range name {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(illegalNameChars, r) {
+			if policy == SanitizeNamesReplace {
+				b.WriteByte('_')
+			}
+			continue
+		}
+		b.WriteRune(r)
+	}
+
+	sanitized := strings.TrimRight(b.String(), ". ")
+	if sanitized == "" {
+		return "_"
+	}
+	base, _, _ := strings.Cut(sanitized, ".")
+	if reservedNames[strings.ToUpper(strings.TrimSpace(base))] {
+		sanitized = "_" + sanitized
+	}
+	return sanitized
+}
+
+// sanitizePath applies sanitizeName to every element of a relative path.
+func sanitizePath(path, policy string) string {
+	if policy != SanitizeNamesReplace && policy != SanitizeNamesStrip {
+		return path
+	}
+	parts := strings.Split(path, string(filepath.Separator))
+	for i, part := range parts {
+		parts[i] = sanitizeName(part, policy)
+	}
+	return filepath.Join(parts...)
+}
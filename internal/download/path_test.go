@@ -0,0 +1,142 @@
+package download
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/elsbrock/go-putio"
+	"github.com/elsbrock/plundrio/internal/config"
+)
+
+func TestFormatDate(t *testing.T) {
+	ts := time.Date(2024, 6, 9, 14, 5, 0, 0, time.UTC)
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"%Y-%m", "2024-06"},
+		{"%Y/%m/%d", "2024/06/09"},
+		{"%y%m%d-%H%M", "240609-1405"},
+		{"%B %Y", "June 2024"},
+		{"100%%", "100%"},
+		{"%Q", "%Q"},
+		{"trailing%", "trailing%"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			if got := formatDate(tt.format, ts); got != tt.want {
+				t.Errorf("formatDate(%q) = %q, want %q", tt.format, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransferDir(t *testing.T) {
+	finished := &putio.Time{Time: time.Date(2024, 6, 9, 14, 5, 0, 0, time.UTC)}
+	created := &putio.Time{Time: time.Date(2024, 5, 30, 0, 0, 0, 0, time.UTC)}
+
+	m := newTestManager()
+	m.SetCategory("abc", "tv")
+
+	tests := []struct {
+		name     string
+		format   string
+		transfer *putio.Transfer
+		want     string
+	}{
+		{"disabled", "", &putio.Transfer{Hash: "abc", Name: "Show", FinishedAt: finished}, filepath.Join("tv", "Show")},
+		{"with category", "%Y-%m", &putio.Transfer{Hash: "abc", Name: "Show", FinishedAt: finished}, filepath.Join("tv", "2024-06", "Show")},
+		{"without category", "%Y-%m", &putio.Transfer{Hash: "def", Name: "Movie", FinishedAt: finished}, filepath.Join("2024-06", "Movie")},
+		{"falls back to created", "%Y-%m", &putio.Transfer{Hash: "def", Name: "Movie", CreatedAt: created}, filepath.Join("2024-05", "Movie")},
+		{"no timestamp", "%Y-%m", &putio.Transfer{Hash: "def", Name: "Movie"}, "Movie"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m.dlConfig.DateSubfolder = tt.format
+			if got := m.TransferDir(tt.transfer); got != tt.want {
+				t.Errorf("TransferDir() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransferTargetDir(t *testing.T) {
+	m := newTestManager()
+	m.cfg.FolderID = 7
+	m.cfg.FolderMappings = []config.FolderMapping{{PutioFolder: "movies", TargetDir: "/media/movies", FolderID: 8}}
+
+	tests := []struct {
+		parent  int64
+		want    string
+		watched bool
+	}{
+		{7, m.cfg.TargetDir, true},
+		{8, "/media/movies", true},
+		{9, m.cfg.TargetDir, false},
+	}
+	for _, tt := range tests {
+		if got := m.TransferTargetDir(&putio.Transfer{SaveParentID: tt.parent}); got != tt.want {
+			t.Errorf("TransferTargetDir(folder %d) = %q, want %q", tt.parent, got, tt.want)
+		}
+		if watched := m.cfg.IsWatchedFolder(tt.parent); watched != tt.watched {
+			t.Errorf("folder %d watched = %v, want %v", tt.parent, watched, tt.watched)
+		}
+	}
+}
+
+func TestSanitizeName(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		replace string
+		strip   string
+	}{
+		{"plain", "Show.S01E01.1080p.mkv", "Show.S01E01.1080p.mkv", "Show.S01E01.1080p.mkv"},
+		{"windows illegal", `Movie: Part 1? <Director's "Cut"> a|b*c\d`, `Movie_ Part 1_ _Director's _Cut__ a_b_c_d`, `Movie Part 1 Director's Cut abcd`},
+		{"control characters", "Tab\there\x00", "Tab_here_", "Tabhere"},
+		{"trailing dots and spaces", "Name. . ", "Name", "Name"},
+		{"only illegal", "???", "___", "_"},
+		{"reserved device name", "CON.mkv", "_CON.mkv", "_CON.mkv"},
+		{"reserved name is case insensitive", "lpt1", "_lpt1", "_lpt1"},
+		{"reserved name as part of a word", "Console.mkv", "Console.mkv", "Console.mkv"},
+		{"unicode kept", "Amélie (2001) – 日本語 🎬.mkv", "Amélie (2001) – 日本語 🎬.mkv", "Amélie (2001) – 日本語 🎬.mkv"},
+		{"unicode with illegal", "Léon: The Professional", "Léon_ The Professional", "Léon The Professional"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sanitizeName(tt.in, SanitizeNamesReplace); got != tt.replace {
+				t.Errorf("replace: sanitizeName(%q) = %q, want %q", tt.in, got, tt.replace)
+			}
+			if got := sanitizeName(tt.in, SanitizeNamesStrip); got != tt.strip {
+				t.Errorf("strip: sanitizeName(%q) = %q, want %q", tt.in, got, tt.strip)
+			}
+			if got := sanitizeName(tt.in, SanitizeNamesNone); got != tt.in {
+				t.Errorf("none: sanitizeName(%q) = %q, want it unchanged", tt.in, got)
+			}
+		})
+	}
+}
+
+func TestFilePathSanitized(t *testing.T) {
+	m := newTestManager()
+	m.SetCategory("abc", "movies")
+	m.dlConfig.SanitizeNames = SanitizeNamesReplace
+
+	transfer := &putio.Transfer{Hash: "abc", Name: "Alien: Romulus (2024)"}
+	file := &putio.File{Name: filepath.Join("Extras?", "Behind the Scenes: Part 1.mkv")}
+
+	wantDir := filepath.Join("movies", "Alien_ Romulus (2024)")
+	if got := m.TransferDir(transfer); got != wantDir {
+		t.Errorf("TransferDir() = %q, want %q", got, wantDir)
+	}
+	// Local data is found under the same name for cleanup
+	want := filepath.Join(wantDir, "Extras_", "Behind the Scenes_ Part 1.mkv")
+	if got := m.filePath(transfer, file); got != want {
+		t.Errorf("filePath() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,91 @@
+package download
+
+import (
+	"sync"
+
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// pauseGate blocks download workers while downloading is paused globally.
+type pauseGate struct {
+	mu     sync.Mutex
+	paused bool
+	resume chan struct{} // closed on resume; replaced on every pause
+}
+
+func newPauseGate(paused bool) *pauseGate {
+	g := &pauseGate{resume: make(chan struct{})}
+	if paused {
+		g.paused = true
+	} else {
+		close(g.resume)
+	}
+	return g
+}
+
+// Pause stops workers from picking up new jobs. It returns false if
+// downloading was already paused.
+func (g *pauseGate) Pause() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.paused {
+		return false
+	}
+	g.paused = true
+	g.resume = make(chan struct{})
+	return true
+}
+
+// Resume re-admits workers. It returns false if downloading was not paused.
+func (g *pauseGate) Resume() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.paused {
+		return false
+	}
+	g.paused = false
+	close(g.resume)
+	return true
+}
+
+// Paused reports whether downloading is paused.
+func (g *pauseGate) Paused() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.paused
+}
+
+// Wait blocks while paused. It returns false if stop was closed first.
+func (g *pauseGate) Wait(stop <-chan struct{}) bool {
+	g.mu.Lock()
+	resume := g.resume
+	g.mu.Unlock()
+
+	select {
+	case <-resume:
+		return true
+	case <-stop:
+		return false
+	}
+}
+
+// Pause stops download workers from starting new downloads. Downloads in
+// progress run to completion; transfer monitoring and the RPC server keep
+// running.
+func (m *Manager) Pause() {
+	if m.pause.Pause() {
+		log.Info("manager").Msg("Downloads paused")
+	}
+}
+
+// Resume lets download workers pick up queued downloads again.
+func (m *Manager) Resume() {
+	if m.pause.Resume() {
+		log.Info("manager").Msg("Downloads resumed")
+	}
+}
+
+// Paused reports whether downloads are paused globally.
+func (m *Manager) Paused() bool {
+	return m.pause.Paused()
+}
@@ -0,0 +1,57 @@
+package download
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPauseGate(t *testing.T) {
+	g := newPauseGate(true)
+	stop := make(chan struct{})
+
+	waited := make(chan bool, 1)
+	go func() { waited <- g.Wait(stop) }()
+
+	select {
+	case <-waited:
+		t.Fatal("Wait returned while paused")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	if !g.Resume() {
+		t.Fatal("Resume of paused gate returned false")
+	}
+	select {
+	case ok := <-waited:
+		if !ok {
+			t.Error("Wait returned false after resume")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Wait did not return after resume")
+	}
+
+	if g.Resume() {
+		t.Error("Resume of running gate returned true")
+	}
+	if !g.Pause() || g.Pause() {
+		t.Error("expected only the first Pause to change state")
+	}
+	if !g.Paused() {
+		t.Error("expected gate to be paused")
+	}
+
+	close(stop)
+	if g.Wait(stop) {
+		t.Error("Wait returned true after stop")
+	}
+}
+
+func TestPauseGateNotPaused(t *testing.T) {
+	g := newPauseGate(false)
+	if g.Paused() {
+		t.Fatal("expected gate to start unpaused")
+	}
+	if !g.Wait(make(chan struct{})) {
+		t.Error("Wait should return immediately when not paused")
+	}
+}
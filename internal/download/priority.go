@@ -0,0 +1,38 @@
+package download
+
+// Bandwidth priorities as used by transmission-rpc's bandwidthPriority
+const (
+	BandwidthPriorityLow    = -1
+	BandwidthPriorityNormal = 0
+	BandwidthPriorityHigh   = 1
+)
+
+// SetPriority stores the bandwidth priority a client set for a transfer.
+// Normal priority is the default and is not stored.
+func (m *Manager) SetPriority(hash string, priority int) {
+	hash = NormalizeHash(hash)
+	if priority == BandwidthPriorityNormal {
+		m.priorities.Delete(hash)
+	} else {
+		m.priorities.Store(hash, priority)
+	}
+	// Running downloads of the transfer get their new share right away
+	m.limiter.rebalance()
+}
+
+// GetPriority returns the bandwidth priority of a transfer hash
+func (m *Manager) GetPriority(hash string) int {
+	if priority, ok := m.priorities.Load(NormalizeHash(hash)); ok {
+		return priority.(int)
+	}
+	return BandwidthPriorityNormal
+}
+
+// transferPriority returns the bandwidth priority of a transfer by ID.
+func (m *Manager) transferPriority(transferID int64) int {
+	ctx, ok := m.coordinator.GetTransferContext(transferID)
+	if !ok {
+		return BandwidthPriorityNormal
+	}
+	return m.GetPriority(ctx.GetHash())
+}
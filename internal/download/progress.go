@@ -2,14 +2,25 @@ package download
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	grab "github.com/cavaliergopher/grab/v3"
 	"github.com/elsbrock/plundrio/internal/log"
 )
 
-// monitorGrabDownloadProgress starts a goroutine to monitor and log download progress from grab
-func (m *Manager) monitorGrabDownloadProgress(ctx context.Context, state *DownloadState, resp *grab.Response, done chan struct{}, progressTicker *time.Ticker) {
+// downloadProgress reports the progress of a running download. It is
+// satisfied by *grab.Response and by segmented downloads.
+type downloadProgress interface {
+	Size() int64
+	BytesComplete() int64
+	Progress() float64
+}
+
+var _ downloadProgress = (*grab.Response)(nil)
+
+// monitorDownloadProgress starts a goroutine to monitor and log download progress
+func (m *Manager) monitorDownloadProgress(ctx context.Context, state *DownloadState, resp downloadProgress, done chan struct{}, progressTicker *time.Ticker) {
 	fileSize := resp.Size()
 
 	go func() {
@@ -56,6 +67,9 @@ func (m *Manager) monitorGrabDownloadProgress(ctx context.Context, state *Downlo
 					eta := time.Until(state.ETA).Round(time.Second)
 					state.LastProgress = time.Now()
 					state.mu.Unlock()
+					if bytesDelta > 0 {
+						m.bytesTransferred.Add(bytesDelta)
+					}
 
 					// Update transfer context with downloaded bytes if it exists
 					if exists && bytesDelta > 0 {
@@ -93,3 +107,43 @@ func (m *Manager) monitorGrabDownloadProgress(ctx context.Context, state *Downlo
 		}
 	}()
 }
+
+// monitorDownloadStall cancels a download with a DownloadStalled error once
+// bytesComplete has not advanced for timeout. Unlike the read timeout of the
+// download connections, it also catches downloads stuck outside of a read,
+// such as on a hung disk write. It returns when ctx is done.
+func monitorDownloadStall(ctx context.Context, cancel context.CancelCauseFunc, filename string, timeout time.Duration, bytesComplete func() int64) {
+	ticker := time.NewTicker(timeout / 4)
+	defer ticker.Stop()
+
+	last, lastChange := bytesComplete(), time.Now()
+	for {
+		select {
+		case <-ticker.C:
+			if n := bytesComplete(); n != last {
+				last, lastChange = n, time.Now()
+				continue
+			}
+			if stalled := time.Since(lastChange); stalled >= timeout {
+				log.Warn("download").
+					Str("file_name", filename).
+					Dur("stalled", stalled).
+					Msg("Download made no progress, cancelling")
+				cancel(NewDownloadStalledError(filename, stalled))
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// stallError returns the error a download was cancelled with by
+// monitorDownloadStall, or nil if it was cancelled for another reason.
+func stallError(ctx context.Context) error {
+	var downloadErr *DownloadError
+	if err := context.Cause(ctx); errors.As(err, &downloadErr) && downloadErr.Type == "DownloadStalled" {
+		return err
+	}
+	return nil
+}
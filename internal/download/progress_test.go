@@ -0,0 +1,49 @@
+package download
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMonitorDownloadStall(t *testing.T) {
+	const timeout = 100 * time.Millisecond
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+
+	// A slow reader that keeps trickling bytes for a while, then goes silent
+	var read atomic.Int64
+	trickling := time.Now().Add(3 * timeout)
+	go func() {
+		for time.Now().Before(trickling) {
+			read.Add(1)
+			time.Sleep(timeout / 10)
+		}
+	}()
+
+	start := time.Now()
+	go monitorDownloadStall(ctx, cancel, "episode.mkv", timeout, read.Load)
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("stalled download was not cancelled")
+	}
+	if elapsed := time.Since(start); elapsed < 3*timeout+timeout {
+		t.Errorf("cancelled after %s, before the reader stalled for %s", elapsed, timeout)
+	}
+	if stallError(ctx) == nil {
+		t.Errorf("cause = %v, want a DownloadStalled error", context.Cause(ctx))
+	}
+	if !isTransientError(stallError(ctx)) {
+		t.Error("expected stalled downloads to be retried")
+	}
+
+	// Other cancellations are not mistaken for stalls
+	ctx, cancel = context.WithCancelCause(context.Background())
+	cancel(nil)
+	if err := stallError(ctx); err != nil {
+		t.Errorf("stallError() = %v for a plain cancellation", err)
+	}
+}
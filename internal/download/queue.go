@@ -0,0 +1,121 @@
+package download
+
+import (
+	"slices"
+	"sync"
+)
+
+// jobQueue holds download jobs per transfer and hands them out round-robin,
+// one file per transfer at a time, so a large transfer queued first can't
+// starve the transfers queued after it. Optionally, only a few files of a
+// transfer are handed out at once, leaving the other workers to files of
+// other transfers.
+type jobQueue struct {
+	mu          sync.Mutex
+	pending     map[int64][]downloadJob // TransferID -> jobs in queueing order
+	order       []int64                 // transfers with pending jobs, next to serve first
+	running     map[int64]int           // TransferID -> jobs handed out and not yet done
+	perTransfer int                     // max running jobs per transfer, 0 means unlimited
+	notify      chan struct{}           // signalled when a job is pushed or done
+}
+
+func newJobQueue(perTransfer int) *jobQueue {
+	return &jobQueue{
+		pending:     make(map[int64][]downloadJob),
+		running:     make(map[int64]int),
+		perTransfer: perTransfer,
+		notify:      make(chan struct{}, 1),
+	}
+}
+
+// Push appends a job to its transfer's queue.
+func (q *jobQueue) Push(job downloadJob) {
+	q.mu.Lock()
+	if _, ok := q.pending[job.TransferID]; !ok {
+		q.order = append(q.order, job.TransferID)
+	}
+	q.pending[job.TransferID] = append(q.pending[job.TransferID], job)
+	q.mu.Unlock()
+	q.wake()
+}
+
+// Pop returns the next job of the transfer whose turn it is and moves that
+// transfer to the back of the rotation. Transfers with perTransfer jobs
+// running keep their turn until one of them is done. It returns false if
+// no job can be handed out.
+func (q *jobQueue) Pop() (downloadJob, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, id := range q.order {
+		if q.perTransfer > 0 && q.running[id] >= q.perTransfer {
+			continue
+		}
+		q.order = slices.Delete(q.order, i, i+1)
+		jobs := q.pending[id]
+		job := jobs[0]
+		if len(jobs) > 1 {
+			q.pending[id] = jobs[1:]
+			q.order = append(q.order, id)
+		} else {
+			delete(q.pending, id)
+		}
+		q.running[id]++
+		return job, true
+	}
+	return downloadJob{}, false
+}
+
+// Done records that a job returned by Pop finished, so that the next file
+// of its transfer may start.
+func (q *jobQueue) Done(transferID int64) {
+	q.mu.Lock()
+	if q.running[transferID] > 1 {
+		q.running[transferID]--
+	} else {
+		delete(q.running, transferID)
+	}
+	q.mu.Unlock()
+	q.wake()
+}
+
+// wake lets feedJobs look for a job to hand out.
+func (q *jobQueue) wake() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Len returns the number of pending jobs across all transfers.
+func (q *jobQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n := 0
+	for _, jobs := range q.pending {
+		n += len(jobs)
+	}
+	return n
+}
+
+// feedJobs hands queued jobs to the download workers in round-robin order
+// until the manager stops. The jobs channel is unbuffered so the next job is
+// only chosen once a worker is free to take it.
+func (m *Manager) feedJobs() {
+	for {
+		job, ok := m.queue.Pop()
+		if !ok {
+			select {
+			case <-m.queue.notify:
+				continue
+			case <-m.stopChan:
+				return
+			}
+		}
+		select {
+		case m.jobs <- job:
+		case <-m.stopChan:
+			return
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package download
+
+import "testing"
+
+func TestJobQueueRoundRobin(t *testing.T) {
+	q := newJobQueue(0)
+	// A large transfer is queued before two small ones
+	for i := int64(1); i <= 4; i++ {
+		q.Push(downloadJob{FileID: 100 + i, TransferID: 1})
+	}
+	q.Push(downloadJob{FileID: 201, TransferID: 2})
+	q.Push(downloadJob{FileID: 301, TransferID: 3})
+	q.Push(downloadJob{FileID: 302, TransferID: 3})
+
+	if got := q.Len(); got != 7 {
+		t.Fatalf("Len() = %d, want 7", got)
+	}
+
+	want := []int64{101, 201, 301, 102, 302, 103, 104}
+	for i, id := range want {
+		job, ok := q.Pop()
+		if !ok {
+			t.Fatalf("Pop() %d: queue empty, want file %d", i, id)
+		}
+		if job.FileID != id {
+			t.Errorf("Pop() %d = file %d, want %d", i, job.FileID, id)
+		}
+	}
+	if _, ok := q.Pop(); ok {
+		t.Error("expected queue to be empty")
+	}
+
+	// A transfer that drained rejoins at the back of the rotation
+	q.Push(downloadJob{FileID: 105, TransferID: 1})
+	if job, _ := q.Pop(); job.FileID != 105 {
+		t.Errorf("Pop() after refill = file %d, want 105", job.FileID)
+	}
+}
+
+func TestJobQueuePerTransferLimit(t *testing.T) {
+	q := newJobQueue(1)
+	for i := int64(1); i <= 3; i++ {
+		q.Push(downloadJob{FileID: 100 + i, TransferID: 1})
+	}
+
+	if job, ok := q.Pop(); !ok || job.FileID != 101 {
+		t.Fatalf("Pop() = file %d, %v; want 101", job.FileID, ok)
+	}
+	// The transfer already has a file running
+	if job, ok := q.Pop(); ok {
+		t.Fatalf("Pop() = file %d beyond the limit", job.FileID)
+	}
+
+	// A transfer added later gets the free worker
+	q.Push(downloadJob{FileID: 201, TransferID: 2})
+	if job, ok := q.Pop(); !ok || job.FileID != 201 {
+		t.Fatalf("Pop() = file %d, %v; want 201", job.FileID, ok)
+	}
+
+	q.Done(1)
+	if job, ok := q.Pop(); !ok || job.FileID != 102 {
+		t.Fatalf("Pop() after Done = file %d, %v; want 102", job.FileID, ok)
+	}
+	if got := q.Len(); got != 1 {
+		t.Errorf("Len() = %d, want 1", got)
+	}
+}
@@ -0,0 +1,140 @@
+package download
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/ratelimit"
+)
+
+// ParseRate parses a transfer rate such as "5MiB", "500KB/s" or "1048576"
+// into bytes per second, using the units of ParseSize. An empty string
+// means unlimited and returns 0.
+func ParseRate(s string) (int64, error) {
+	return ParseSize(strings.TrimSuffix(strings.TrimSpace(strings.ToLower(s)), "/s"))
+}
+
+// SetSessionRateLimit limits the combined download rate to bytesPerSec on
+// behalf of RPC clients, 0 lifting their limit. MaxDownloadRate stays an
+// upper bound.
+func (m *Manager) SetSessionRateLimit(bytesPerSec int64) {
+	rate := m.dlConfig.MaxDownloadRate
+	if bytesPerSec > 0 && (rate <= 0 || bytesPerSec < rate) {
+		rate = bytesPerSec
+	}
+	m.limiter.setRate(rate)
+}
+
+// priorityWeights are the relative shares of the download rate that
+// transfers get per bandwidth priority
+var priorityWeights = map[int]float64{
+	BandwidthPriorityLow:    1,
+	BandwidthPriorityNormal: 2,
+	BandwidthPriorityHigh:   4,
+}
+
+// downloadLimiter caps the combined rate of all downloads. The rate is
+// split between transfers with running downloads in proportion to the
+// weight of their bandwidth priority, so that on a constrained link a
+// high-priority transfer finishes before a low-priority backlog.
+type downloadLimiter struct {
+	mu       sync.Mutex
+	rate     float64 // bytes per second, 0 for unlimited
+	shares   map[*downloadShare]struct{}
+	priority func(transferID int64) int
+}
+
+// downloadShare is the part of the rate of a downloadLimiter that one
+// download may use. It satisfies grab.RateLimiter.
+type downloadShare struct {
+	ratelimit.Bucket
+	transferID int64
+}
+
+// newDownloadLimiter returns a limiter for bytesPerSec, 0 or less meaning
+// unlimited, that looks up the bandwidth priority of transfers with
+// priority.
+func newDownloadLimiter(bytesPerSec int64, priority func(transferID int64) int) *downloadLimiter {
+	return &downloadLimiter{
+		rate:     float64(max(bytesPerSec, 0)),
+		shares:   make(map[*downloadShare]struct{}),
+		priority: priority,
+	}
+}
+
+// acquire returns the share of the rate for a download of a file of
+// transferID. It must be released once the download stops. A nil limiter
+// returns a nil share.
+func (l *downloadLimiter) acquire(transferID int64) *downloadShare {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s := &downloadShare{transferID: transferID}
+	l.shares[s] = struct{}{}
+	l.split()
+	return s
+}
+
+// release returns the share of a finished download to the others.
+func (l *downloadLimiter) release(s *downloadShare) {
+	if l == nil || s == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.shares, s)
+	l.split()
+}
+
+// setRate changes the combined rate to bytesPerSec, 0 or less meaning
+// unlimited. Running downloads adopt it right away.
+func (l *downloadLimiter) setRate(bytesPerSec int64) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rate = float64(max(bytesPerSec, 0))
+	l.split()
+}
+
+// rebalance splits the rate anew, e.g. after a priority changed.
+func (l *downloadLimiter) rebalance() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.split()
+}
+
+// split gives every transfer its weighted part of the rate, divided evenly
+// between the shares of its files being downloaded, so that downloading
+// more files at once doesn't earn a transfer more bandwidth. l.mu must be
+// held.
+func (l *downloadLimiter) split() {
+	weights := make(map[int64]float64)
+	counts := make(map[int64]int)
+	var total float64
+	for s := range l.shares {
+		counts[s.transferID]++
+		if _, ok := weights[s.transferID]; ok {
+			continue
+		}
+		w := priorityWeights[BandwidthPriorityNormal]
+		if l.priority != nil {
+			if pw, ok := priorityWeights[l.priority(s.transferID)]; ok {
+				w = pw
+			}
+		}
+		weights[s.transferID] = w
+		total += w
+	}
+	now := time.Now()
+	for s := range l.shares {
+		s.SetRate(l.rate*weights[s.transferID]/total/float64(counts[s.transferID]), now)
+	}
+}
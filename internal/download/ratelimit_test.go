@@ -0,0 +1,158 @@
+package download
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"0", 0, false},
+		{"1048576", 1 << 20, false},
+		{"5MiB", 5 << 20, false},
+		{"5M", 5 << 20, false},
+		{"5MB", 5000000, false},
+		{"500KB/s", 500000, false},
+		{"1.5 GiB", 3 << 29, false},
+		{"fast", 0, true},
+		{"5XB", 0, true},
+		{"-1MiB", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRate(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseRate(%q) = %d, %v; want %d, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestMaxDownloadRateSharedByWorkers(t *testing.T) {
+	payload := bytes.Repeat([]byte{0xab}, 64<<10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "episode.mkv", time.Time{}, bytes.NewReader(payload))
+	}))
+	defer srv.Close()
+
+	m := newTestManager()
+	m.cfg.TargetDir = t.TempDir()
+	m.dlConfig.CopyBufferSize = 8 << 10
+	m.limiter = newDownloadLimiter(64<<10, nil)
+	m.client = &urlPutioClient{url: srv.URL}
+
+	// Two files downloaded in parallel share the 64KiB/s cap, so the 128KiB
+	// take about a second once the initial burst is used up
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			state := &DownloadState{FileID: int64(i), Name: fmt.Sprintf("episode%d.mkv", i), StartTime: time.Now()}
+			if err := m.downloadFile(state); err != nil {
+				t.Errorf("downloadFile() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if elapsed := time.Since(start); elapsed < 800*time.Millisecond {
+		t.Errorf("downloads took %s, want them held to the shared rate", elapsed)
+	}
+}
+
+func TestDownloadLimiterPriorityShares(t *testing.T) {
+	priorities := map[int64]int{1: BandwidthPriorityHigh, 2: BandwidthPriorityLow}
+	l := newDownloadLimiter(5000, func(id int64) int { return priorities[id] })
+
+	high := l.acquire(1)
+	low := l.acquire(2)
+	defer l.release(low)
+
+	// Weights 4 and 1 split 5000 bytes/s into 4000 and 1000; past the
+	// initial burst, each second brings four times the bytes for high
+	waitFor := func(s *downloadShare, n float64) time.Duration {
+		now := time.Now()
+		s.Reserve(n, now) // use up the burst
+		return s.Reserve(n, now)
+	}
+	near := func(got, want time.Duration) bool {
+		return got > want-50*time.Millisecond && got <= want
+	}
+	if got := waitFor(high, 4000); !near(got, time.Second) {
+		t.Errorf("high priority waits %s for 4000 bytes, want 1s", got)
+	}
+	if got := waitFor(low, 1000); !near(got, time.Second) {
+		t.Errorf("low priority waits %s for 1000 bytes, want 1s", got)
+	}
+
+	// Once the high-priority download is done, the other gets the whole rate
+	l.release(high)
+	// and pays off the 1000 bytes it owes at that rate, too
+	if got := low.Reserve(5000, time.Now()); !near(got, 1200*time.Millisecond) {
+		t.Errorf("remaining download waits %s for 5000 bytes, want 1.2s", got)
+	}
+}
+
+func TestDownloadLimiterSharesPerTransfer(t *testing.T) {
+	priorities := map[int64]int{1: BandwidthPriorityHigh, 2: BandwidthPriorityLow}
+	l := newDownloadLimiter(5000, func(id int64) int { return priorities[id] })
+
+	// Four files of the low-priority transfer split its 1000 bytes/s, so
+	// running more downloads doesn't earn it more than its weight
+	high := l.acquire(1)
+	defer l.release(high)
+	var low []*downloadShare
+	for range 4 {
+		s := l.acquire(2)
+		defer l.release(s)
+		low = append(low, s)
+	}
+
+	waitFor := func(s *downloadShare, n float64) time.Duration {
+		now := time.Now()
+		s.Reserve(n, now) // use up the burst
+		return s.Reserve(n, now)
+	}
+	near := func(got, want time.Duration) bool {
+		return got > want-50*time.Millisecond && got <= want
+	}
+	if got := waitFor(high, 4000); !near(got, time.Second) {
+		t.Errorf("high priority waits %s for 4000 bytes, want 1s", got)
+	}
+	for i, s := range low {
+		if got := waitFor(s, 250); !near(got, time.Second) {
+			t.Errorf("low priority file %d waits %s for 250 bytes, want 1s", i, got)
+		}
+	}
+}
+
+func TestSetSessionRateLimit(t *testing.T) {
+	m := newTestManager()
+	m.dlConfig.MaxDownloadRate = 2000
+	m.limiter = newDownloadLimiter(m.dlConfig.MaxDownloadRate, nil)
+	share := m.limiter.acquire(1)
+	defer m.limiter.release(share)
+
+	for _, tc := range []struct {
+		limit int64
+		want  float64
+	}{
+		{1000, 1000},
+		{5000, 2000}, // --max-download-rate stays the cap
+		{0, 2000},
+	} {
+		m.SetSessionRateLimit(tc.limit)
+		if m.limiter.rate != tc.want {
+			t.Errorf("SetSessionRateLimit(%d): rate = %v, want %v", tc.limit, m.limiter.rate, tc.want)
+		}
+	}
+}
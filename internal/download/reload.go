@@ -0,0 +1,80 @@
+package download
+
+import (
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/config"
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// Reload applies the settings of cfg that can change while the manager
+// runs: the number of workers, the transfer check interval, the
+// availability threshold and the download retries. Unset (zero) settings
+// are left alone. Retired workers finish their current download first.
+func (m *Manager) Reload(cfg *config.Config) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.workers != nil && cfg.WorkerCount > 0 && cfg.WorkerCount != m.workers.Size() {
+		if m.dlConfig.AdaptiveWorkers {
+			log.Warn("config").
+				Int("workers", cfg.WorkerCount).
+				Msg("Worker count is managed by adaptive scaling, ignoring change")
+		} else {
+			log.Info("config").
+				Int("from", m.workers.Size()).
+				Int("to", cfg.WorkerCount).
+				Msg("Resizing worker pool")
+			m.workers.Resize(cfg.WorkerCount)
+		}
+	}
+
+	if cfg.TransferCheckInterval > 0 && cfg.TransferCheckInterval != m.dlConfig.TransferCheckInterval {
+		log.Info("config").
+			Dur("from", m.dlConfig.TransferCheckInterval).
+			Dur("to", cfg.TransferCheckInterval).
+			Msg("Changing transfer check interval")
+		m.dlConfig.TransferCheckInterval = cfg.TransferCheckInterval
+		if m.ticker != nil {
+			m.ticker.Reset(cfg.TransferCheckInterval)
+		}
+	}
+
+	if cfg.AvailabilityThreshold > 0 && cfg.AvailabilityThreshold != m.dlConfig.AvailabilityThreshold {
+		log.Info("config").
+			Int("from", m.dlConfig.AvailabilityThreshold).
+			Int("to", cfg.AvailabilityThreshold).
+			Msg("Changing availability threshold")
+		m.dlConfig.AvailabilityThreshold = cfg.AvailabilityThreshold
+	}
+
+	if cfg.DownloadMaxRetries > 0 && cfg.DownloadMaxRetries != m.dlConfig.DownloadMaxRetries {
+		log.Info("config").
+			Int("from", m.dlConfig.DownloadMaxRetries).
+			Int("to", cfg.DownloadMaxRetries).
+			Msg("Changing download retries")
+		m.dlConfig.DownloadMaxRetries = cfg.DownloadMaxRetries
+	}
+}
+
+// transferCheckInterval returns how often transfers are checked.
+func (m *Manager) transferCheckInterval() time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.dlConfig.TransferCheckInterval
+}
+
+// availabilityThreshold returns the availability percentage below which a
+// transfer lacks seeders.
+func (m *Manager) availabilityThreshold() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.dlConfig.AvailabilityThreshold
+}
+
+// downloadMaxRetries returns how often a download is attempted.
+func (m *Manager) downloadMaxRetries() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.dlConfig.DownloadMaxRetries
+}
@@ -0,0 +1,93 @@
+package download
+
+import (
+	"testing"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/config"
+)
+
+func TestReload(t *testing.T) {
+	m := newTestManager()
+	m.workers = &workerPool{m: m}
+	m.workers.Resize(1)
+	defer func() {
+		close(m.stopChan)
+		m.workerWg.Wait()
+	}()
+	m.ticker = time.NewTicker(time.Hour)
+	defer m.ticker.Stop()
+
+	m.Reload(&config.Config{
+		WorkerCount:           3,
+		TransferCheckInterval: 10 * time.Millisecond,
+		AvailabilityThreshold: 20,
+		DownloadMaxRetries:    7,
+	})
+
+	if got := m.workers.Size(); got != 3 {
+		t.Errorf("workers = %d, want 3", got)
+	}
+	select {
+	case <-m.ticker.C:
+	case <-time.After(time.Second):
+		t.Error("ticker not reset to the new interval")
+	}
+	if got := m.transferCheckInterval(); got != 10*time.Millisecond {
+		t.Errorf("transfer check interval = %v, want 10ms", got)
+	}
+	if got := m.availabilityThreshold(); got != 20 {
+		t.Errorf("availability threshold = %d, want 20", got)
+	}
+	if got := m.downloadMaxRetries(); got != 7 {
+		t.Errorf("download retries = %d, want 7", got)
+	}
+
+	// Unset settings are kept
+	m.Reload(&config.Config{WorkerCount: 2})
+	if got := m.workers.Size(); got != 2 {
+		t.Errorf("workers after shrinking = %d, want 2", got)
+	}
+	if got := m.downloadMaxRetries(); got != 7 {
+		t.Errorf("download retries = %d, want them kept at 7", got)
+	}
+}
+
+func TestReloadAdaptiveWorkers(t *testing.T) {
+	m := newTestManager()
+	m.dlConfig.AdaptiveWorkers = true
+	m.workers = &workerPool{m: m}
+	m.workers.Resize(2)
+	defer func() {
+		close(m.stopChan)
+		m.workerWg.Wait()
+	}()
+
+	m.Reload(&config.Config{WorkerCount: 5})
+	if got := m.workers.Size(); got != 2 {
+		t.Errorf("workers = %d, want the adaptive scaler's 2", got)
+	}
+}
+
+func TestReloadWhileScaling(t *testing.T) {
+	m := newTestManager()
+	m.dlConfig.AdaptiveWorkers = true
+	m.workers = &workerPool{m: m}
+	defer func() {
+		close(m.stopChan)
+		m.workerWg.Wait()
+	}()
+
+	// The adaptive scaler resizes the pool while a reload looks at it
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := range 100 {
+			m.workers.Resize(i%4 + 1)
+		}
+	}()
+	for range 100 {
+		m.Reload(&config.Config{WorkerCount: 8})
+	}
+	<-done
+}
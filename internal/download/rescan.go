@@ -0,0 +1,87 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"slices"
+)
+
+// RescanSummary describes what an out of band scan of the transfer list
+// changed in the watched folder.
+type RescanSummary struct {
+	Statuses map[string]int `json:"statuses"` // Transfers per Put.io status after the scan
+	Added    []int64        `json:"added"`    // Transfers that appeared
+	Removed  []int64        `json:"removed"`  // Transfers that disappeared
+	Changed  []int64        `json:"changed"`  // Transfers whose status changed
+}
+
+// rescanResult is handed back to Rescan by the transfer monitor
+type rescanResult struct {
+	summary RescanSummary
+	err     error
+}
+
+// Rescan makes the transfer monitor fetch the transfer list and process it
+// right away instead of waiting for the next check interval, e.g. to pick up
+// changes made in the Put.io web UI. It returns once the scan is done.
+func (m *Manager) Rescan(ctx context.Context) (RescanSummary, error) {
+	done := make(chan rescanResult, 1)
+	select {
+	case m.rescans <- done:
+	case <-m.stopChan:
+		return RescanSummary{}, errors.New("download manager is stopped")
+	case <-ctx.Done():
+		return RescanSummary{}, ctx.Err()
+	}
+
+	select {
+	case res := <-done:
+		return res.summary, res.err
+	case <-ctx.Done():
+		return RescanSummary{}, ctx.Err()
+	}
+}
+
+// rescan runs a transfer check and compares the transfer list before and
+// after it. It must be called from the transfer monitor goroutine.
+func (p *TransferProcessor) rescan(ctx context.Context) rescanResult {
+	before := p.statusByID()
+	if err := p.checkTransfers(ctx); err != nil {
+		return rescanResult{err: err}
+	}
+	after := p.statusByID()
+
+	summary := RescanSummary{
+		Statuses: make(map[string]int),
+		Added:    []int64{},
+		Removed:  []int64{},
+		Changed:  []int64{},
+	}
+	for id, status := range after {
+		summary.Statuses[status]++
+		if prev, ok := before[id]; !ok {
+			summary.Added = append(summary.Added, id)
+		} else if prev != status {
+			summary.Changed = append(summary.Changed, id)
+		}
+	}
+	for id := range before {
+		if _, ok := after[id]; !ok {
+			summary.Removed = append(summary.Removed, id)
+		}
+	}
+	slices.Sort(summary.Added)
+	slices.Sort(summary.Removed)
+	slices.Sort(summary.Changed)
+	return rescanResult{summary: summary}
+}
+
+// statusByID returns the Put.io status of every transfer in the watched
+// folder as of the last check.
+func (p *TransferProcessor) statusByID() map[int64]string {
+	statuses := make(map[int64]string)
+	for _, t := range p.GetTransfers() {
+		statuses[t.ID] = t.Status
+	}
+	return statuses
+}
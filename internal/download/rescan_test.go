@@ -0,0 +1,67 @@
+package download
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/elsbrock/go-putio"
+)
+
+func TestRescan(t *testing.T) {
+	m := newTestManager()
+	m.cfg.TargetDir = t.TempDir()
+	m.stats = newStatsStore(newStateFile(m.cfg.TargetDir))
+	client := &fakePutioClient{transfers: []*putio.Transfer{
+		{ID: 1, Name: "stays", Status: "DOWNLOADING"},
+		{ID: 2, Name: "finishes", Status: "DOWNLOADING"},
+		{ID: 3, Name: "removed", Status: "IN_QUEUE"},
+	}}
+	m.client = client
+	m.dlConfig.TransferCheckInterval = time.Hour
+
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+	m.running = true
+	m.monitorWg.Add(1)
+	go func() {
+		defer m.monitorWg.Done()
+		m.monitorTransfers()
+	}()
+	defer m.Stop()
+	for !m.Ready() {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Changes made in the web UI since the initial scan
+	client.transfers = []*putio.Transfer{
+		{ID: 1, Name: "stays", Status: "DOWNLOADING"},
+		{ID: 2, Name: "finishes", Status: "ERROR"},
+		{ID: 4, Name: "added", Status: "IN_QUEUE"},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	summary, err := m.Rescan(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := RescanSummary{
+		Statuses: map[string]int{"DOWNLOADING": 1, "ERROR": 1, "IN_QUEUE": 1},
+		Added:    []int64{4},
+		Removed:  []int64{3},
+		Changed:  []int64{2},
+	}
+	if !reflect.DeepEqual(summary, want) {
+		t.Errorf("summary = %+v, want %+v", summary, want)
+	}
+}
+
+func TestRescanStopped(t *testing.T) {
+	m := newTestManager()
+	close(m.stopChan)
+	if _, err := m.Rescan(context.Background()); err == nil {
+		t.Error("expected an error from a stopped manager")
+	}
+}
@@ -0,0 +1,379 @@
+package download
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// segmentsSuffix names the file next to a partial file that records how far
+// each segment of a segmented download got, so that it can be resumed.
+const segmentsSuffix = ".segments"
+
+// segmentsSaveInterval is how often the progress of a segmented download
+// is recorded while it runs.
+const segmentsSaveInterval = 5 * time.Second
+
+// minSegmentSize keeps segments large enough to be worth a connection of
+// their own; smaller files are downloaded in one piece. Tests lower it.
+var minSegmentSize int64 = 16 << 20
+
+// errRangesUnsupported is returned by downloadSegmented if the server can't
+// serve byte ranges; the file is then downloaded in one piece instead.
+var errRangesUnsupported = errors.New("server does not support range requests")
+
+// segment is a byte range [start, end) of a file downloaded over its own
+// connection, of which done bytes have been written.
+type segment struct {
+	start, end int64
+	done       atomic.Int64
+}
+
+// segmentRecord is a segment as persisted in the segments file.
+type segmentRecord struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+	Done  int64 `json:"done"`
+}
+
+// segmentsFile is the resume state of a segmented download.
+type segmentsFile struct {
+	Size     int64           `json:"size"`
+	Segments []segmentRecord `json:"segments"`
+}
+
+// segmentedProgress reports the combined progress of all segments.
+type segmentedProgress struct {
+	size     int64
+	segments []*segment
+}
+
+func (p *segmentedProgress) Size() int64 { return p.size }
+
+func (p *segmentedProgress) BytesComplete() int64 {
+	var n int64
+	for _, s := range p.segments {
+		n += s.done.Load()
+	}
+	return n
+}
+
+func (p *segmentedProgress) Progress() float64 {
+	if p.size == 0 {
+		return 0
+	}
+	return float64(p.BytesComplete()) / float64(p.size)
+}
+
+// segmentCount returns how many segments a file of size bytes downloaded to
+// partial is split into, 1 meaning it is downloaded in one piece. A partial
+// file left by a download in one piece is resumed as such; one without a
+// segments file but with holes was written at offsets and is not.
+func (m *Manager) segmentCount(partial string, size int64) int {
+	n := m.dlConfig.SegmentsPerFile
+	if n <= 1 || size < 2*minSegmentSize {
+		return 1
+	}
+	if _, err := os.Stat(partial); err == nil {
+		if _, err := os.Stat(partial + segmentsSuffix); err != nil && !hasHoles(partial) {
+			return 1
+		}
+	}
+	return int(min(int64(n), size/minSegmentSize))
+}
+
+// planSegments splits size bytes into n contiguous segments.
+func planSegments(size int64, n int) []*segment {
+	segments := make([]*segment, n)
+	chunk := size / int64(n)
+	for i := range segments {
+		segments[i] = &segment{start: int64(i) * chunk, end: int64(i+1) * chunk}
+	}
+	segments[n-1].end = size
+	return segments
+}
+
+// loadSegments returns the segments recorded for partial if they describe
+// a file of size bytes, or nil if the download has to start over.
+func loadSegments(partial string, size int64) []*segment {
+	data, err := os.ReadFile(partial + segmentsSuffix)
+	if err != nil {
+		return nil
+	}
+	if _, err := os.Stat(partial); err != nil {
+		return nil
+	}
+	var state segmentsFile
+	if err := json.Unmarshal(data, &state); err != nil || state.Size != size || len(state.Segments) == 0 {
+		return nil
+	}
+	segments := make([]*segment, len(state.Segments))
+	for i, r := range state.Segments {
+		if r.Start < 0 || r.End > size || r.Done < 0 || r.Done > r.End-r.Start {
+			return nil
+		}
+		segments[i] = &segment{start: r.Start, end: r.End}
+		segments[i].done.Store(r.Done)
+	}
+	return segments
+}
+
+// saveSegments records the progress of the segments of partial.
+func saveSegments(partial string, size int64, segments []*segment) error {
+	state := segmentsFile{Size: size}
+	for _, s := range segments {
+		state.Segments = append(state.Segments, segmentRecord{Start: s.start, End: s.end, Done: s.done.Load()})
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(partial+segmentsSuffix, data, 0644)
+}
+
+// discardSegments removes a partial file left by a segmented download. Its
+// gaps make it unsuitable for resuming in one piece. Without a segments
+// file, the holes left by the gaps give such a partial file away.
+func discardSegments(partial string) {
+	if _, err := os.Stat(partial + segmentsSuffix); err != nil && !hasHoles(partial) {
+		return
+	}
+	os.Remove(partial)
+	os.Remove(partial + segmentsSuffix)
+}
+
+// partialBytes returns how many bytes of a file have been downloaded to
+// partial, which for segmented downloads is less than its size.
+func partialBytes(partial string) int64 {
+	info, err := os.Stat(partial)
+	if err != nil {
+		return 0
+	}
+	data, err := os.ReadFile(partial + segmentsSuffix)
+	if err != nil {
+		return info.Size()
+	}
+	var state segmentsFile
+	if err := json.Unmarshal(data, &state); err != nil {
+		return 0
+	}
+	var n int64
+	for _, r := range state.Segments {
+		n += r.Done
+	}
+	return n
+}
+
+// probeRanges checks with a HEAD request that url serves byte ranges of a
+// file of size bytes. It returns errRangesUnsupported if not.
+func probeRanges(ctx context.Context, client *http.Client, url, name string, size int64) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Accept-Ranges") != "bytes" || resp.ContentLength != size {
+		return errRangesUnsupported
+	}
+	if !isHTMLFileName(name) && isHTMLContentType(resp.Header.Get("Content-Type")) {
+		return NewInvalidContentError(filepath.Base(name), "server returned an HTML page")
+	}
+	return nil
+}
+
+// downloadSegmented downloads url to partial over n connections, each
+// fetching a disjoint byte range and writing it at its offset. Progress is
+// recorded next to the partial file before the first byte is written,
+// periodically and when the download stops early, so a retry, even after a
+// crash, resumes every segment where it left off. It returns
+// errRangesUnsupported without writing anything if the server can't serve
+// ranges.
+func (m *Manager) downloadSegmented(ctx context.Context, cancel context.CancelCauseFunc, state *DownloadState, url, partial string, n int) error {
+	client := newDownloadHTTPClient(m.dlConfig)
+	if err := probeRanges(ctx, client, url, state.Name, state.Size); err != nil {
+		if errors.Is(err, errRangesUnsupported) {
+			log.Debug("download").
+				Str("file_name", state.Name).
+				Msg("Server doesn't support range requests, downloading in one piece")
+		}
+		return err
+	}
+
+	segments := loadSegments(partial, state.Size)
+	if segments == nil {
+		// The recorded segments don't match the file any more
+		os.Remove(partial)
+		segments = planSegments(state.Size, n)
+	}
+	if err := saveSegments(partial, state.Size, segments); err != nil {
+		return fmt.Errorf("failed to record segments: %w", err)
+	}
+	f, err := os.OpenFile(partial, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open partial file: %w", err)
+	}
+	progress := &segmentedProgress{size: state.Size, segments: segments}
+
+	state.mu.Lock()
+	state.downloaded = progress.BytesComplete()
+	state.Progress = 0
+	state.LastProgress = time.Now()
+	state.mu.Unlock()
+
+	log.Info("download").
+		Str("file_name", state.Name).
+		Int("segments", len(segments)).
+		Msg("Starting segmented download")
+
+	done := make(chan struct{})
+	progressTicker := time.NewTicker(m.dlConfig.ProgressUpdateInterval)
+	defer progressTicker.Stop()
+	go m.monitorDownloadProgress(ctx, state, progress, done, progressTicker)
+	if m.dlConfig.DownloadStallTimeout > 0 {
+		go monitorDownloadStall(ctx, cancel, state.Name, m.dlConfig.DownloadStallTimeout, progress.BytesComplete)
+	}
+	recorded := make(chan struct{})
+	go func() {
+		defer close(recorded)
+		recordSegments(state.Name, partial, state.Size, segments, done)
+	}()
+
+	// The segments of a file share its download's part of the rate limit
+	share := m.limiter.acquire(state.TransferID)
+	defer m.limiter.release(share)
+
+	// The first failing segment cancels the others
+	segCtx, segCancel := context.WithCancelCause(ctx)
+	defer segCancel(nil)
+	var wg sync.WaitGroup
+	for _, s := range segments {
+		if s.done.Load() >= s.end-s.start {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := m.downloadSegment(segCtx, client, url, f, s, share); err != nil {
+				segCancel(err)
+			}
+		}()
+	}
+	wg.Wait()
+	close(done)
+	<-recorded
+
+	err = context.Cause(segCtx)
+	if errors.Is(err, context.Canceled) && ctx.Err() == nil {
+		// Cancelled by the deferred segCancel only
+		err = nil
+	}
+	if syncErr := f.Sync(); err == nil && syncErr != nil {
+		err = syncErr
+	}
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		err = closeErr
+	}
+
+	if err != nil || progress.BytesComplete() != state.Size {
+		if saveErr := saveSegments(partial, state.Size, segments); saveErr != nil {
+			log.Warn("download").Str("file_name", state.Name).Err(saveErr).Msg("Failed to record segment progress")
+		}
+		switch {
+		case ctx.Err() != nil:
+			if stallErr := stallError(ctx); stallErr != nil {
+				return stallErr
+			}
+			return NewDownloadCancelledError(state.Name, "context cancelled")
+		case err != nil:
+			return fmt.Errorf("download failed: %w", err)
+		default:
+			return fmt.Errorf("download incomplete: %s", state.Name)
+		}
+	}
+
+	if info, err := os.Stat(partial); err != nil || info.Size() != state.Size {
+		discardSegments(partial)
+		return fmt.Errorf("download incomplete: %s", state.Name)
+	}
+	os.Remove(partial + segmentsSuffix)
+	return checkFileContent(partial, state.Name)
+}
+
+// recordSegments records the progress of segments every
+// segmentsSaveInterval until done is closed. A segment only counts bytes
+// already written, so the record never claims data the file lacks.
+func recordSegments(name, partial string, size int64, segments []*segment, done <-chan struct{}) {
+	ticker := time.NewTicker(segmentsSaveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := saveSegments(partial, size, segments); err != nil {
+				log.Warn("download").Str("file_name", name).Err(err).Msg("Failed to record segment progress")
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// downloadSegment fetches the rest of segment s and writes it to f, at
+// the rate share allows if it isn't nil.
+func (m *Manager) downloadSegment(ctx context.Context, client *http.Client, url string, f *os.File, s *segment, share *downloadShare) error {
+	offset := s.start + s.done.Load()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, s.end-1))
+	req.Header.Set("User-Agent", "plundrio/1.0")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return fmt.Errorf("range request for bytes %d-%d answered %s", offset, s.end-1, resp.Status)
+	}
+
+	buf := make([]byte, max(m.dlConfig.CopyBufferSize, 1))
+	for offset < s.end {
+		k, readErr := resp.Body.Read(buf[:min(int64(len(buf)), s.end-offset)])
+		if k > 0 {
+			if share != nil {
+				if err := share.WaitN(ctx, k); err != nil {
+					return err
+				}
+			}
+			if _, err := f.WriteAt(buf[:k], offset); err != nil {
+				return err
+			}
+			offset += int64(k)
+			s.done.Add(int64(k))
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+	if offset < s.end {
+		return fmt.Errorf("range request for bytes up to %d ended at %d: %w", s.end-1, offset, io.ErrUnexpectedEOF)
+	}
+	return nil
+}
@@ -0,0 +1,279 @@
+package download
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// rangeServer serves content with support for range requests and records
+// the Range header of every GET.
+type rangeServer struct {
+	content []byte
+	mu      sync.Mutex
+	ranges  []string
+}
+
+func (s *rangeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		s.mu.Lock()
+		s.ranges = append(s.ranges, r.Header.Get("Range"))
+		s.mu.Unlock()
+	}
+	http.ServeContent(w, r, "episode.mkv", time.Time{}, bytes.NewReader(s.content))
+}
+
+func segmentTestContent() []byte {
+	content := make([]byte, 64)
+	for i := range content {
+		content[i] = byte('a' + i%26)
+	}
+	return content
+}
+
+func TestDownloadFileSegmented(t *testing.T) {
+	defer func(old int64) { minSegmentSize = old }(minSegmentSize)
+	minSegmentSize = 16
+
+	rs := &rangeServer{content: segmentTestContent()}
+	srv := httptest.NewServer(rs)
+	defer srv.Close()
+
+	m := newTestManager()
+	m.cfg.TargetDir = t.TempDir()
+	m.dlConfig.SegmentsPerFile = 8
+	m.client = &urlPutioClient{url: srv.URL}
+
+	state := &DownloadState{FileID: 1, Name: "episode.mkv", Size: int64(len(rs.content)), StartTime: time.Now()}
+	if err := m.downloadFile(state); err != nil {
+		t.Fatalf("downloadFile() error = %v", err)
+	}
+
+	target := filepath.Join(m.cfg.TargetDir, "episode.mkv")
+	if data, err := os.ReadFile(target); err != nil || !bytes.Equal(data, rs.content) {
+		t.Errorf("final file = %q, %v; want complete content", data, err)
+	}
+	// 64 bytes allow four segments of at least 16 bytes
+	if len(rs.ranges) != 4 {
+		t.Fatalf("range requests = %q, want 4", rs.ranges)
+	}
+	for _, r := range rs.ranges {
+		if r == "" {
+			t.Errorf("segment fetched without a Range header")
+		}
+	}
+	if _, err := os.Stat(partialPath(target) + segmentsSuffix); !os.IsNotExist(err) {
+		t.Errorf("segments file left behind (stat err = %v)", err)
+	}
+}
+
+func TestDownloadFileSegmentedWithoutRanges(t *testing.T) {
+	defer func(old int64) { minSegmentSize = old }(minSegmentSize)
+	minSegmentSize = 16
+
+	content := segmentTestContent()
+	var ranged bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranged = ranged || r.Header.Get("Range") != ""
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		if r.Method == http.MethodGet {
+			w.Write(content)
+		}
+	}))
+	defer srv.Close()
+
+	m := newTestManager()
+	m.cfg.TargetDir = t.TempDir()
+	m.dlConfig.SegmentsPerFile = 4
+	m.client = &urlPutioClient{url: srv.URL}
+
+	state := &DownloadState{FileID: 1, Name: "episode.mkv", Size: int64(len(content)), StartTime: time.Now()}
+	if err := m.downloadFile(state); err != nil {
+		t.Fatalf("downloadFile() error = %v", err)
+	}
+	if ranged {
+		t.Error("range request sent to a server without Accept-Ranges")
+	}
+	if data, err := os.ReadFile(filepath.Join(m.cfg.TargetDir, "episode.mkv")); err != nil || !bytes.Equal(data, content) {
+		t.Errorf("final file = %q, %v; want complete content", data, err)
+	}
+}
+
+func TestDownloadFileSegmentedResumes(t *testing.T) {
+	defer func(old int64) { minSegmentSize = old }(minSegmentSize)
+	minSegmentSize = 16
+
+	rs := &rangeServer{content: segmentTestContent()}
+	srv := httptest.NewServer(rs)
+	defer srv.Close()
+
+	m := newTestManager()
+	m.cfg.TargetDir = t.TempDir()
+	m.dlConfig.SegmentsPerFile = 2
+	m.client = &urlPutioClient{url: srv.URL}
+
+	// The first segment is complete, the second got 8 of its 32 bytes
+	partial := partialPath(filepath.Join(m.cfg.TargetDir, "episode.mkv"))
+	data := make([]byte, 64)
+	copy(data, rs.content[:40])
+	if err := os.WriteFile(partial, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	segments := planSegments(64, 2)
+	segments[0].done.Store(32)
+	segments[1].done.Store(8)
+	if err := saveSegments(partial, 64, segments); err != nil {
+		t.Fatal(err)
+	}
+	if n := partialBytes(partial); n != 40 {
+		t.Fatalf("partialBytes() = %d, want 40", n)
+	}
+
+	state := &DownloadState{FileID: 1, Name: "episode.mkv", Size: 64, StartTime: time.Now()}
+	if err := m.downloadFile(state); err != nil {
+		t.Fatalf("downloadFile() error = %v", err)
+	}
+	if len(rs.ranges) != 1 || rs.ranges[0] != "bytes=40-63" {
+		t.Errorf("range requests = %q, want only the rest of the second segment", rs.ranges)
+	}
+	if got, err := os.ReadFile(filepath.Join(m.cfg.TargetDir, "episode.mkv")); err != nil || !bytes.Equal(got, rs.content) {
+		t.Errorf("final file = %q, %v; want complete content", got, err)
+	}
+}
+
+func TestDownloadFileSegmentedStalled(t *testing.T) {
+	defer func(old int64) { minSegmentSize = old }(minSegmentSize)
+	minSegmentSize = 16
+
+	content := segmentTestContent()
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Accept-Ranges", "bytes")
+		if r.Method == http.MethodHead {
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			return
+		}
+		// Every segment sends 4 bytes and then hangs
+		var start, end int
+		if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end); err != nil {
+			t.Errorf("bad Range header %q", r.Header.Get("Range"))
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(end-start+1))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(content[start : start+4])
+		w.(http.Flusher).Flush()
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	m := newTestManager()
+	m.cfg.TargetDir = t.TempDir()
+	m.dlConfig.SegmentsPerFile = 2
+	m.dlConfig.DownloadStallTimeout = 200 * time.Millisecond
+	m.client = &urlPutioClient{url: srv.URL}
+
+	err := m.downloadFile(&DownloadState{FileID: 1, Name: "episode.mkv", Size: int64(len(content)), StartTime: time.Now()})
+	if err == nil {
+		t.Fatal("stalled download succeeded")
+	}
+	if !isTransientError(err) {
+		t.Errorf("downloadFile() error = %v, want it retried", err)
+	}
+	// Both segments stopped, and their progress was recorded for the retry
+	partial := partialPath(filepath.Join(m.cfg.TargetDir, "episode.mkv"))
+	if n := partialBytes(partial); n != 8 {
+		t.Errorf("partialBytes() = %d, want the 8 bytes received", n)
+	}
+}
+
+func TestDownloadFileSegmentedRecordsFirst(t *testing.T) {
+	defer func(old int64) { minSegmentSize = old }(minSegmentSize)
+	minSegmentSize = 16
+
+	m := newTestManager()
+	m.cfg.TargetDir = t.TempDir()
+	m.dlConfig.SegmentsPerFile = 2
+	partial := partialPath(filepath.Join(m.cfg.TargetDir, "episode.mkv"))
+
+	// A crash while segments are written must leave their record behind
+	rs := &rangeServer{content: segmentTestContent()}
+	var unrecorded bool
+	var mu sync.Mutex
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			if _, err := os.Stat(partial + segmentsSuffix); err != nil {
+				mu.Lock()
+				unrecorded = true
+				mu.Unlock()
+			}
+		}
+		rs.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	m.client = &urlPutioClient{url: srv.URL}
+
+	if err := m.downloadFile(&DownloadState{FileID: 1, Name: "episode.mkv", Size: 64, StartTime: time.Now()}); err != nil {
+		t.Fatalf("downloadFile() error = %v", err)
+	}
+	if unrecorded {
+		t.Error("segments fetched before they were recorded")
+	}
+	if _, err := os.Stat(partial + segmentsSuffix); !os.IsNotExist(err) {
+		t.Errorf("segments file left behind (stat err = %v)", err)
+	}
+}
+
+func TestSegmentedPartialWithoutRecord(t *testing.T) {
+	defer func(old int64) { minSegmentSize = old }(minSegmentSize)
+	minSegmentSize = 16
+
+	m := newTestManager()
+	m.dlConfig.SegmentsPerFile = 2
+	dir := t.TempDir()
+
+	// A partial file written in one piece is resumed in one piece
+	contiguous := filepath.Join(dir, "contiguous.part")
+	if err := os.WriteFile(contiguous, make([]byte, 1<<20), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if n := m.segmentCount(contiguous, 2<<20); n != 1 {
+		t.Errorf("segmentCount() = %d for a contiguous partial file, want 1", n)
+	}
+	discardSegments(contiguous)
+	if _, err := os.Stat(contiguous); err != nil {
+		t.Errorf("contiguous partial file discarded: %v", err)
+	}
+
+	// One with holes was written at offsets and can't be resumed that way
+	holey := filepath.Join(dir, "holey.part")
+	f, err := os.Create(holey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte("tail"), 1<<20); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if !hasHoles(holey) {
+		t.Skip("filesystem does not report holes")
+	}
+	if n := m.segmentCount(holey, 2<<20); n != 2 {
+		t.Errorf("segmentCount() = %d for a partial file with holes, want 2", n)
+	}
+	discardSegments(holey)
+	if _, err := os.Stat(holey); !os.IsNotExist(err) {
+		t.Errorf("partial file with holes kept (stat err = %v)", err)
+	}
+}
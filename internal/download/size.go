@@ -0,0 +1,45 @@
+package download
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// sizeUnits maps the suffixes accepted by ParseSize to their size in bytes
+var sizeUnits = map[string]float64{
+	"":    1,
+	"b":   1,
+	"k":   1 << 10,
+	"kb":  1000,
+	"kib": 1 << 10,
+	"m":   1 << 20,
+	"mb":  1000 * 1000,
+	"mib": 1 << 20,
+	"g":   1 << 30,
+	"gb":  1000 * 1000 * 1000,
+	"gib": 1 << 30,
+	"t":   1 << 40,
+	"tb":  1000 * 1000 * 1000 * 1000,
+	"tib": 1 << 40,
+}
+
+// ParseSize parses a size such as "10GiB", "500KB" or "1048576" into bytes.
+// Bare numbers are bytes; K, M, G and T are binary units like KiB. An empty
+// string returns 0.
+func ParseSize(s string) (int64, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return 0, nil
+	}
+	unit := strings.TrimLeft(s, "0123456789.")
+	mult, ok := sizeUnits[strings.TrimSpace(unit)]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit %q in size %q", unit, s)
+	}
+	value, err := strconv.ParseFloat(strings.TrimSuffix(s, unit), 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(value * mult), nil
+}
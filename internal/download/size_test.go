@@ -0,0 +1,26 @@
+package download
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"4096", 4096, false},
+		{"10GiB", 10 << 30, false},
+		{"10G", 10 << 30, false},
+		{"2TB", 2000000000000, false},
+		{"1.5 KiB", 1536, false},
+		{"lots", 0, true},
+		{"5MiB/s", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSize(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseSize(%q) = %d, %v; want %d, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
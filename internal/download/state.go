@@ -0,0 +1,179 @@
+package download
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const stateFileName = ".plundrio-state.json"
+
+// stateVersion is the current version of the state file format. Files
+// without a version are version 0: either the legacy flat hash → category
+// object or the sectioned layout that preceded versioning.
+const stateVersion = 1
+
+// persistedState is the on-disk layout of the state file. Each section is
+// owned by one store; stores only ever rewrite their own section.
+type persistedState struct {
+	Version    int                 `json:"version"`
+	Categories map[string]string   `json:"categories,omitempty"`
+	Stats      LifetimeStats       `json:"stats"`
+	FirstRun   time.Time           `json:"firstRun,omitzero"`    // When plundrio first ran against the target dir
+	Downloaded map[int64]time.Time `json:"downloaded,omitempty"` // Transfers downloaded, by ID
+}
+
+// stateFile serializes access to the state file shared by the persistent
+// stores (categories, lifetime statistics).
+type stateFile struct {
+	mu   sync.Mutex
+	path string
+}
+
+func newStateFile(targetDir string) *stateFile {
+	return &stateFile{
+		path: filepath.Join(targetDir, stateFileName),
+	}
+}
+
+// Read returns the current persisted state. A missing file yields an empty
+// state and os.ErrNotExist.
+func (sf *stateFile) Read() (persistedState, error) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	return sf.read()
+}
+
+// Update applies fn to the persisted state and writes the result back.
+func (sf *stateFile) Update(fn func(*persistedState)) error {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+
+	st, err := sf.read()
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	fn(&st)
+	return sf.write(st)
+}
+
+// Migrate upgrades the state file to the current format in place, keeping
+// a copy of the original next to it. It returns the version the file had
+// and the path of the backup, which is empty if the file was already
+// current.
+func (sf *stateFile) Migrate() (int, string, error) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+
+	data, err := os.ReadFile(sf.path)
+	if err != nil {
+		return 0, "", err
+	}
+	var st persistedState
+	if err := decodeState(data, &st); err != nil {
+		return 0, "", fmt.Errorf("failed to parse state: %w", err)
+	}
+	if st.Version > stateVersion {
+		return st.Version, "", fmt.Errorf("state file version %d is newer than supported version %d", st.Version, stateVersion)
+	}
+	if st.Version == stateVersion {
+		return st.Version, "", nil
+	}
+
+	backup := fmt.Sprintf("%s.v%d.bak", sf.path, st.Version)
+	if err := os.WriteFile(backup, data, 0644); err != nil {
+		return st.Version, "", fmt.Errorf("failed to back up state: %w", err)
+	}
+	return st.Version, backup, sf.write(st)
+}
+
+func (sf *stateFile) read() (persistedState, error) {
+	var st persistedState
+
+	data, err := os.ReadFile(sf.path)
+	if err != nil {
+		return st, err
+	}
+	if err := decodeState(data, &st); err != nil {
+		return st, fmt.Errorf("failed to parse state: %w", err)
+	}
+	// Refuse to work with, and later overwrite, state written by a newer version
+	if st.Version > stateVersion {
+		return st, fmt.Errorf("state file version %d is newer than supported version %d", st.Version, stateVersion)
+	}
+	return st, nil
+}
+
+// write replaces the state file with st. The new state is written to a
+// temporary file next to it that is renamed into place once synced, so a
+// crash or full disk can't leave a truncated state file behind.
+func (sf *stateFile) write(st persistedState) error {
+	st.Version = stateVersion
+	data, err := json.Marshal(st)
+	if err != nil {
+		return fmt.Errorf("failed to marshal state: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(sf.path), stateFileName+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), sf.path); err != nil {
+		return fmt.Errorf("failed to replace state: %w", err)
+	}
+	return nil
+}
+
+// MigrateState upgrades the state file in targetDir to the current format.
+// It returns the version the file had and the path of the backup of the
+// original, which is empty if no migration was needed.
+func MigrateState(targetDir string) (int, string, error) {
+	return newStateFile(targetDir).Migrate()
+}
+
+// DumpState returns the state file in targetDir, decoded into the current
+// format, as indented JSON.
+func DumpState(targetDir string) ([]byte, error) {
+	st, err := newStateFile(targetDir).Read()
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(st, "", "  ")
+}
+
+// decodeState parses the state file contents. Older versions stored only a
+// flat hash → category object, which is read into the categories section.
+func decodeState(data []byte, st *persistedState) error {
+	var sections map[string]json.RawMessage
+	if err := json.Unmarshal(data, &sections); err != nil {
+		return err
+	}
+
+	_, hasVersion := sections["version"]
+	_, hasCategories := sections["categories"]
+	_, hasStats := sections["stats"]
+	if !hasVersion && !hasCategories && !hasStats && len(sections) > 0 {
+		return json.Unmarshal(data, &st.Categories)
+	}
+
+	return json.Unmarshal(data, st)
+}
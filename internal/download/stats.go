@@ -0,0 +1,154 @@
+package download
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// LifetimeStats are cumulative counters persisted across restarts.
+type LifetimeStats struct {
+	TransfersCompleted int64 `json:"transfersCompleted"`
+	TransfersFailed    int64 `json:"transfersFailed"`
+	FilesCompleted     int64 `json:"filesCompleted"`
+	FilesFailed        int64 `json:"filesFailed"`
+	BytesDownloaded    int64 `json:"bytesDownloaded"`
+	SessionCount       int64 `json:"sessionCount"`
+	SecondsActive      int64 `json:"secondsActive"`
+}
+
+// statsFlushInterval is how often changed lifetime statistics are written
+// to the state file. They are also written when the manager stops.
+const statsFlushInterval = 30 * time.Second
+
+// StatsStore accumulates lifetime statistics in memory and persists them to
+// the state file periodically, so that a busy download queue doesn't
+// rewrite it after every file.
+type StatsStore struct {
+	mu        sync.Mutex
+	stats     LifetimeStats
+	dirty     bool // events were recorded since the last flush
+	lastFlush time.Time
+	state     *stateFile
+}
+
+func newStatsStore(state *stateFile) *StatsStore {
+	return &StatsStore{
+		state:     state,
+		lastFlush: time.Now(),
+	}
+}
+
+// LoadLifetimeStats reads the persisted lifetime statistics from the state
+// file in targetDir. A missing file yields zero statistics.
+func LoadLifetimeStats(targetDir string) (LifetimeStats, error) {
+	st, err := newStateFile(targetDir).Read()
+	if err != nil && !os.IsNotExist(err) {
+		return LifetimeStats{}, err
+	}
+	return st.Stats, nil
+}
+
+// Load reads persisted statistics from disk and counts a new session.
+func (s *StatsStore) Load() {
+	st, err := s.state.Read()
+	if err != nil && !os.IsNotExist(err) {
+		log.Error("stats").Err(err).Msg("Failed to load lifetime statistics")
+	}
+
+	s.mu.Lock()
+	s.stats = st.Stats
+	s.stats.SessionCount++
+	s.lastFlush = time.Now()
+	s.mu.Unlock()
+
+	s.Flush()
+}
+
+// Snapshot returns the current statistics including unflushed active time.
+func (s *StatsStore) Snapshot() LifetimeStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := s.stats
+	stats.SecondsActive += int64(time.Since(s.lastFlush).Seconds())
+	return stats
+}
+
+// FileCompleted records a successfully downloaded file of the given size.
+func (s *StatsStore) FileCompleted(bytes int64) {
+	s.update(func(st *LifetimeStats) {
+		st.FilesCompleted++
+		st.BytesDownloaded += bytes
+	})
+}
+
+// FileFailed records a file that permanently failed to download.
+func (s *StatsStore) FileFailed() {
+	s.update(func(st *LifetimeStats) { st.FilesFailed++ })
+}
+
+// TransferCompleted records a transfer that was fully processed.
+func (s *StatsStore) TransferCompleted() {
+	s.update(func(st *LifetimeStats) { st.TransfersCompleted++ })
+}
+
+// TransferFailed records a transfer that failed.
+func (s *StatsStore) TransferFailed() {
+	s.update(func(st *LifetimeStats) { st.TransfersFailed++ })
+}
+
+func (s *StatsStore) update(fn func(*LifetimeStats)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(&s.stats)
+	s.dirty = true
+}
+
+// FlushChanged persists the statistics if events were recorded since the
+// last flush.
+func (s *StatsStore) FlushChanged() {
+	s.mu.Lock()
+	dirty := s.dirty
+	s.mu.Unlock()
+	if dirty {
+		s.Flush()
+	}
+}
+
+// Flush persists the current statistics to the state file.
+func (s *StatsStore) Flush() {
+	// Snapshot under the state file lock so concurrent flushes are written in order
+	err := s.state.Update(func(st *persistedState) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		// Only account whole seconds so frequent flushes don't lose time
+		elapsed := time.Since(s.lastFlush) / time.Second
+		s.stats.SecondsActive += int64(elapsed)
+		s.lastFlush = s.lastFlush.Add(elapsed * time.Second)
+		s.dirty = false
+		st.Stats = s.stats
+	})
+	if err != nil {
+		log.Error("stats").Err(err).Msg("Failed to save lifetime statistics")
+	}
+}
+
+// flushStats writes changed lifetime statistics every statsFlushInterval
+// until the manager stops.
+func (m *Manager) flushStats() {
+	ticker := time.NewTicker(statsFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stopChan:
+			return
+		case <-ticker.C:
+			m.stats.FlushChanged()
+		}
+	}
+}
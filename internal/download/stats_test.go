@@ -0,0 +1,178 @@
+package download
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStatsStore_PersistsAcrossSessions(t *testing.T) {
+	dir := t.TempDir()
+
+	s := newStatsStore(newStateFile(dir))
+	s.Load()
+	s.FileCompleted(1000)
+	s.FileCompleted(500)
+	s.FileFailed()
+	s.TransferCompleted()
+	s.TransferFailed()
+
+	// Events are only written on the next flush
+	if got, _ := LoadLifetimeStats(dir); got.FilesCompleted != 0 {
+		t.Errorf("files completed before flush = %d, want 0", got.FilesCompleted)
+	}
+	s.FlushChanged()
+
+	// A second session picks up where the first left off
+	s2 := newStatsStore(newStateFile(dir))
+	s2.Load()
+	s2.FileCompleted(250)
+	s2.Flush()
+
+	got, err := LoadLifetimeStats(dir)
+	if err != nil {
+		t.Fatalf("LoadLifetimeStats failed: %v", err)
+	}
+	want := LifetimeStats{
+		TransfersCompleted: 1,
+		TransfersFailed:    1,
+		FilesCompleted:     3,
+		FilesFailed:        1,
+		BytesDownloaded:    1750,
+		SessionCount:       2,
+	}
+	got.SecondsActive = 0
+	if got != want {
+		t.Errorf("LoadLifetimeStats = %+v, want %+v", got, want)
+	}
+}
+
+func TestStatsStore_KeepsCategories(t *testing.T) {
+	dir := t.TempDir()
+	sf := newStateFile(dir)
+
+	cs := newCategoryStoreWithState(sf)
+	cs.Set("abc123", "tv")
+
+	s := newStatsStore(sf)
+	s.Load()
+	s.TransferCompleted()
+
+	cs2 := newCategoryStore(dir)
+	cs2.Load()
+	if got := cs2.Get("abc123"); got != "tv" {
+		t.Errorf("category after stats flush = %q, want %q", got, "tv")
+	}
+}
+
+func TestLoadLifetimeStats_MissingFile(t *testing.T) {
+	got, err := LoadLifetimeStats(t.TempDir())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != (LifetimeStats{}) {
+		t.Errorf("LoadLifetimeStats = %+v, want zero value", got)
+	}
+}
+
+func TestStateFile_LegacyCategoryFormat(t *testing.T) {
+	dir := t.TempDir()
+	legacy := []byte(`{"abc123":"tv","def456":"movies"}`)
+	if err := os.WriteFile(filepath.Join(dir, stateFileName), legacy, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := newStateFile(dir).Read()
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if st.Categories["abc123"] != "tv" || st.Categories["def456"] != "movies" {
+		t.Errorf("legacy categories not decoded: %v", st.Categories)
+	}
+}
+
+func TestStateFile_Migrate(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, stateFileName)
+	legacy := []byte(`{"abc123":"tv"}`)
+	if err := os.WriteFile(path, legacy, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cs := newCategoryStore(dir)
+	cs.Load()
+	if got := cs.Get("abc123"); got != "tv" {
+		t.Errorf("category after migration = %q, want %q", got, "tv")
+	}
+
+	backup, err := os.ReadFile(path + ".v0.bak")
+	if err != nil {
+		t.Fatalf("expected backup of the original: %v", err)
+	}
+	if string(backup) != string(legacy) {
+		t.Errorf("backup = %s, want %s", backup, legacy)
+	}
+	st, err := newStateFile(dir).Read()
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if st.Version != stateVersion {
+		t.Errorf("version after migration = %d, want %d", st.Version, stateVersion)
+	}
+
+	from, backupPath, err := MigrateState(dir)
+	if err != nil || from != stateVersion || backupPath != "" {
+		t.Errorf("second MigrateState = (%d, %q, %v), want no-op", from, backupPath, err)
+	}
+}
+
+func TestStateFile_NewerVersionUntouched(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, stateFileName)
+	newer := []byte(`{"version":99,"categories":{"abc123":"tv"}}`)
+	if err := os.WriteFile(path, newer, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := MigrateState(dir); err == nil {
+		t.Error("expected MigrateState to reject a newer state file")
+	}
+	cs := newCategoryStore(dir)
+	cs.Set("def456", "movies")
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != string(newer) {
+		t.Errorf("newer state file was overwritten: %s", data)
+	}
+}
+
+func TestStateFile_WriteReplacesAtomically(t *testing.T) {
+	dir := t.TempDir()
+	sf := newStateFile(dir)
+
+	for _, category := range []string{"tv", "movies"} {
+		if err := sf.Update(func(st *persistedState) {
+			st.Categories = map[string]string{"abc123": category}
+		}); err != nil {
+			t.Fatalf("Update failed: %v", err)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != stateFileName {
+		t.Errorf("target dir holds %v, want only the state file", entries)
+	}
+	st, err := sf.Read()
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if st.Categories["abc123"] != "movies" {
+		t.Errorf("category = %q, want movies", st.Categories["abc123"])
+	}
+}
@@ -0,0 +1,131 @@
+package download
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// staleTempAge is how long a partial file in the temp directory may go
+// untouched before it is removed on startup. Younger ones are kept so that
+// their downloads resume.
+const staleTempAge = 7 * 24 * time.Hour
+
+// partialFile returns the partial path of the file name below targetDir.
+// With a temp directory, partial files are kept there under the same
+// relative path instead of next to their destination.
+func (m *Manager) partialFile(targetDir, name string) string {
+	if m.dlConfig.TempDir != "" {
+		return partialPath(filepath.Join(m.dlConfig.TempDir, name))
+	}
+	return partialPath(filepath.Join(targetDir, name))
+}
+
+// moveIntoPlace renames a completed partial file to its destination. If
+// the rename fails, e.g. because the temp directory is on another
+// filesystem, the file is copied next to the destination under its partial
+// name first, so importers still never see an incomplete file.
+func moveIntoPlace(src, dst string) error {
+	err := os.Rename(src, dst)
+	if err == nil || filepath.Dir(src) == filepath.Dir(dst) {
+		return err
+	}
+
+	tmp := partialPath(dst)
+	if err := copyFile(src, tmp); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("copy %s: %w", src, err)
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Remove(src); err != nil {
+		log.Warn("download").Str("path", src).Err(err).Msg("Failed to remove temp file after moving it")
+	}
+	return nil
+}
+
+// copyFile copies src to dst, syncing dst before it is closed.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// cleanTempDir removes partial files from the temp directory that haven't
+// been written to for staleTempAge, along with directories left empty.
+func (m *Manager) cleanTempDir(now time.Time) {
+	dir := m.dlConfig.TempDir
+	if dir == "" {
+		return
+	}
+
+	var dirs []string
+	removed := 0
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			if path != dir {
+				dirs = append(dirs, path)
+			}
+			return nil
+		}
+		name := strings.TrimSuffix(d.Name(), segmentsSuffix)
+		if !strings.HasPrefix(name, partialPrefix) || !strings.HasSuffix(name, partialSuffix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || now.Sub(info.ModTime()) < staleTempAge {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			log.Warn("download").Str("path", path).Err(err).Msg("Failed to remove stale temp file")
+			return nil
+		}
+		removed++
+		return nil
+	})
+	if err != nil {
+		log.Warn("download").Str("temp_dir", dir).Err(err).Msg("Failed to clean temp directory")
+	}
+
+	// Remove emptied directories, deepest first; non-empty ones stay
+	for i := len(dirs) - 1; i >= 0; i-- {
+		os.Remove(dirs[i])
+	}
+	if removed > 0 {
+		log.Info("download").
+			Str("temp_dir", dir).
+			Int("removed", removed).
+			Msg("Removed stale partial downloads from temp directory")
+	}
+}
@@ -0,0 +1,90 @@
+package download
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDownloadFileTempDir(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("01234567"))
+	}))
+	defer srv.Close()
+
+	m := newTestManager()
+	m.cfg.TargetDir = t.TempDir()
+	m.dlConfig.TempDir = t.TempDir()
+	m.client = &urlPutioClient{url: srv.URL}
+	name := filepath.Join("Show", "episode.mkv")
+
+	partial := m.partialFile(m.cfg.TargetDir, name)
+	if want := filepath.Join(m.dlConfig.TempDir, "Show", ".episode.mkv.part"); partial != want {
+		t.Fatalf("partialFile() = %q, want %q", partial, want)
+	}
+
+	if err := m.downloadFile(&DownloadState{FileID: 1, Name: name, StartTime: time.Now()}); err != nil {
+		t.Fatalf("downloadFile() error = %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(m.cfg.TargetDir, name)); err != nil || string(data) != "01234567" {
+		t.Errorf("final file = %q, %v; want complete content", data, err)
+	}
+	if _, err := os.Stat(partial); !os.IsNotExist(err) {
+		t.Errorf("temp file left behind (stat err = %v)", err)
+	}
+}
+
+func TestCopyFile(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	dst := filepath.Join(dir, "dst")
+	if err := os.WriteFile(src, []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := copyFile(src, dst); err != nil {
+		t.Fatalf("copyFile() error = %v", err)
+	}
+	if data, err := os.ReadFile(dst); err != nil || string(data) != "content" {
+		t.Errorf("copied file = %q, %v", data, err)
+	}
+}
+
+func TestCleanTempDir(t *testing.T) {
+	m := newTestManager()
+	m.dlConfig.TempDir = t.TempDir()
+	now := time.Now()
+
+	write := func(name string, age time.Duration) string {
+		path := filepath.Join(m.dlConfig.TempDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, now.Add(-age), now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	stale := write(filepath.Join("old", ".episode.mkv.part"), 8*24*time.Hour)
+	fresh := write(filepath.Join("new", ".episode.mkv.part"), time.Hour)
+	other := write("notes.txt", 30*24*time.Hour)
+
+	m.cleanTempDir(now)
+
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("stale partial file kept (stat err = %v)", err)
+	}
+	if _, err := os.Stat(filepath.Dir(stale)); !os.IsNotExist(err) {
+		t.Errorf("emptied directory kept (stat err = %v)", err)
+	}
+	for _, path := range []string{fresh, other} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("%s removed: %v", path, err)
+		}
+	}
+}
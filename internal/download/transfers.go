@@ -1,8 +1,11 @@
 package download
 
 import (
+	"cmp"
+	"context"
 	"os"
 	"path/filepath"
+	"slices"
 	"sync"
 	"time"
 
@@ -10,27 +13,71 @@ import (
 	"github.com/elsbrock/plundrio/internal/log"
 )
 
+// Orders in which ready transfers are started when MaxNewPerScan is set
+const (
+	PriorityAge  = "age"  // longest finished first
+	PrioritySize = "size" // smallest first
+)
+
 // TransferProcessor handles the processing of Put.io transfers
 type TransferProcessor struct {
 	manager            *Manager
-	transfers          map[string][]*putio.Transfer // Status -> Transfers
+	mu                 sync.RWMutex                 // protects all and queueTimedOut, which are read outside the monitor goroutine
+	transfers          map[string][]*putio.Transfer // Status -> Transfers, only used by the monitor goroutine and not guarded by mu
+	all                []*putio.Transfer            // Transfers in the watched folder, replaced on every scan
 	processedTransfers sync.Map                     // map[int64]bool - Tracks transfers that have been processed locally
 	retryAttempts      sync.Map                     // map[int64]int - Tracks retry attempts for errored transfers
-	folderID           int64
-	targetDir          string
+	noFilesAttempts    sync.Map                     // map[int64]int - Tracks scans that found no files for a completed transfer
+	queuedSince        map[int64]time.Time          // First time a transfer was seen waiting in the Put.io queue
+	queueTimedOut      map[int64]bool               // Transfers reported as errored for waiting in the queue too long
+	lowAvailability    map[int64]lowAvailability    // Transfers seen with availability below the threshold
+	stallProgress      map[int64]stallSnapshot      // Last observed local progress of downloading transfers
+	failedRequeues     map[int64]int                // Times a transfer with failed files was requeued
+	startedAt          time.Time                    // When the processor was created, for --adopt-existing
+	firstRun           time.Time                    // When plundrio first ran against the target dir, for --first-run-policy
+	hashByID           map[int64]string             // Last seen hash per transfer, to detect hash changes
 }
 
-// GetTransfers returns a copy of all transfers for a given folder ID
+// GetTransfers returns the transfers in the watched folder as of the last
+// scan. The slice is shared and must not be modified.
 func (p *TransferProcessor) GetTransfers() []*putio.Transfer {
-	var allTransfers []*putio.Transfer
-	for _, transfers := range p.transfers {
-		for _, t := range transfers {
-			if t.SaveParentID == p.folderID {
-				allTransfers = append(allTransfers, t)
-			}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.all
+}
+
+// categorize groups the transfers in the watched folder by status. The
+// per-status slices of the previous scan are reused since only the monitor
+// goroutine reads them; the list of all transfers is allocated anew on
+// every scan because GetTransfers shares it with other goroutines.
+func (p *TransferProcessor) categorize(transfers []*putio.Transfer) (map[string][]*putio.Transfer, []*putio.Transfer) {
+	byStatus := p.transfers
+	if byStatus == nil {
+		byStatus = make(map[string][]*putio.Transfer)
+	}
+	for status, list := range byStatus {
+		if len(list) == 0 {
+			delete(byStatus, status)
+			continue
 		}
+		clear(list) // Let transfers from the previous scan be collected
+		byStatus[status] = list[:0]
 	}
-	return allTransfers
+
+	all := make([]*putio.Transfer, 0, len(transfers))
+	for _, t := range transfers {
+		if !p.manager.cfg.IsWatchedFolder(t.SaveParentID) {
+			log.Debug("transfers").
+				Int64("transfer_id", t.ID).
+				Int64("parent_id", t.SaveParentID).
+				Int64("target_folder", p.manager.cfg.FolderID).
+				Msg("Skipping transfer from different folder")
+			continue
+		}
+		byStatus[t.Status] = append(byStatus[t.Status], t)
+		all = append(all, t)
+	}
+	return byStatus, all
 }
 
 // newTransferProcessor creates a new transfer processor
@@ -40,8 +87,13 @@ func newTransferProcessor(m *Manager) *TransferProcessor {
 		transfers:          make(map[string][]*putio.Transfer),
 		processedTransfers: sync.Map{},
 		retryAttempts:      sync.Map{},
-		folderID:           m.cfg.FolderID,
-		targetDir:          m.cfg.TargetDir,
+		queuedSince:        make(map[int64]time.Time),
+		queueTimedOut:      make(map[int64]bool),
+		lowAvailability:    make(map[int64]lowAvailability),
+		stallProgress:      make(map[int64]stallSnapshot),
+		failedRequeues:     make(map[int64]int),
+		startedAt:          time.Now(),
+		hashByID:           make(map[int64]string),
 	}
 }
 
@@ -50,15 +102,19 @@ func (m *Manager) monitorTransfers() {
 	log.Debug("transfers").Msg("Starting transfer monitor")
 
 	log.Debug("transfers").
-		Int64("folder_id", m.processor.folderID).
-		Str("target_dir", m.processor.targetDir).
+		Int64("folder_id", m.cfg.FolderID).
+		Str("target_dir", m.cfg.TargetDir).
+		Int("folder_mappings", len(m.cfg.FolderMappings)).
 		Msg("Transfer processor initialized")
 
 	// Initial check
-	m.processor.checkTransfers()
+	m.processor.checkTransfers(m.Context())
 
-	ticker := time.NewTicker(m.dlConfig.TransferCheckInterval)
+	ticker := time.NewTicker(m.transferCheckInterval())
 	defer ticker.Stop()
+	m.mu.Lock()
+	m.ticker = ticker
+	m.mu.Unlock()
 
 	for {
 		select {
@@ -66,50 +122,122 @@ func (m *Manager) monitorTransfers() {
 			log.Debug("transfers").Msg("Transfer monitor stopping")
 			return
 		case <-ticker.C:
-			m.processor.checkTransfers()
+			m.processor.checkTransfers(m.Context())
+		case done := <-m.rescans:
+			done <- m.processor.rescan(m.Context())
+			// The scan just ran, so the next one is a full interval away
+			ticker.Reset(m.transferCheckInterval())
 		}
 	}
 }
 
-// checkTransfers looks for completed or seeding transfers and processes them
-func (p *TransferProcessor) checkTransfers() {
+// checkTransfers looks for completed or seeding transfers and processes them.
+// The scan is abandoned between phases once ctx is cancelled, so that Stop
+// does not have to wait for a full scan to finish. It returns an error if
+// the transfer list could not be fetched or the scan was cancelled.
+func (p *TransferProcessor) checkTransfers(ctx context.Context) error {
 	log.Debug("transfers").Msg("Checking transfers")
 
-	transfers, err := p.manager.client.GetTransfers(p.manager.Context())
+	transfers, err := p.manager.client.GetTransfers(ctx)
 	if err != nil {
+		if ctx.Err() != nil {
+			log.Debug("transfers").Msg("Transfer check cancelled")
+			return ctx.Err()
+		}
 		log.Error("transfers").Err(err).Msg("Failed to get transfers")
-		return
+		return err
 	}
 
+	p.manager.lastPoll.Store(time.Now().UnixNano())
+
 	log.Debug("transfers").
 		Int("api_transfers_count", len(transfers)).
 		Msg("Retrieved transfers from API")
 
-	// Reset transfer status tracking
-	p.transfers = make(map[string][]*putio.Transfer)
-
 	// Categorize transfers by status
-	for _, t := range transfers {
-		if t.SaveParentID != p.folderID {
-			log.Debug("transfers").
-				Int64("transfer_id", t.ID).
-				Int64("parent_id", t.SaveParentID).
-				Int64("target_folder", p.folderID).
-				Msg("Skipping transfer from different folder")
-			continue
-		}
-		p.transfers[t.Status] = append(p.transfers[t.Status], t)
+	byStatus, all := p.categorize(transfers)
+
+	// Move state keyed by placeholder hashes to the real info-hash
+	p.reconcileHashes(byStatus)
+
+	// Forget downloaded transfers that are gone from Put.io
+	p.manager.downloaded.Retain(all)
+
+	// Replace transfer status tracking
+	p.transfers = byStatus
+	p.mu.Lock()
+	p.all = all
+	p.mu.Unlock()
+
+	if !p.manager.ready.Swap(true) {
+		log.Info("transfers").
+			Int("transfers", len(transfers)).
+			Msg("Initial transfer list loaded, ready to serve clients")
 	}
 
+	// Act on transfers stuck in the Put.io queue before they are reported
+	p.processQueuedTransfers(time.Now())
+
+	// Act on transfers Put.io can't finish for lack of seeders
+	p.processLowAvailabilityTransfers(time.Now())
+
+	// Act on transfers whose local download stopped advancing
+	p.processStalledTransfers(time.Now())
+
+	// Requeue or give up on transfers that finished with failed files
+	p.processFailedTransfers(time.Now())
+
 	// Log transfer summary
 	p.logTransferSummary()
 
 	// Process transfers by status
-	p.processReadyTransfers()
-	p.processErroredTransfers()
+	for _, phase := range []func(context.Context){
+		p.processReadyTransfers,
+		p.processErroredTransfers,
+		// Check for transfers that are in "Completed" state but haven't been fully cleaned up
+		p.finalizeCompletedTransfers,
+	} {
+		if ctx.Err() != nil {
+			log.Debug("transfers").Msg("Transfer check cancelled")
+			return ctx.Err()
+		}
+		phase(ctx)
+	}
+	return nil
+}
+
+// reconcileHashes detects transfers whose hash changed since the last check.
+// Magnet transfers may report a placeholder hash until Put.io has fetched the
+// metadata; anything stored under the old hash is moved to the new one so it
+// doesn't end up orphaned.
+func (p *TransferProcessor) reconcileHashes(byStatus map[string][]*putio.Transfer) {
+	seen := make(map[int64]bool)
+	for _, transfers := range byStatus {
+		for _, t := range transfers {
+			seen[t.ID] = true
+			hash := NormalizeHash(t.Hash)
+			if hash == "" {
+				continue
+			}
+			if old, ok := p.hashByID[t.ID]; ok && old != hash {
+				moved := p.manager.categories.Rename(old, hash)
+				log.Info("transfers").
+					Int64("transfer_id", t.ID).
+					Str("old_hash", old).
+					Str("new_hash", hash).
+					Bool("category_moved", moved).
+					Msg("Transfer hash changed")
+			}
+			p.hashByID[t.ID] = hash
+		}
+	}
 
-	// Check for transfers that are in "Completed" state but haven't been fully cleaned up
-	p.finalizeCompletedTransfers()
+	// Forget transfers that no longer exist
+	for id := range p.hashByID {
+		if !seen[id] {
+			delete(p.hashByID, id)
+		}
+	}
 }
 
 // logTransferSummary logs counts of transfers in each status and detailed information for all transfers
@@ -250,23 +378,119 @@ func (p *TransferProcessor) logAllTransfersDetails() {
 }
 
 // processReadyTransfers handles completed and seeding transfers
-func (p *TransferProcessor) processReadyTransfers() {
-	readyTransfers := append(p.transfers["COMPLETED"], p.transfers["SEEDING"]...)
+func (p *TransferProcessor) processReadyTransfers(ctx context.Context) {
+	readyTransfers := slices.Concat(p.transfers["COMPLETED"], p.transfers["SEEDING"])
 
+	var candidates []*putio.Transfer
 	for _, transfer := range readyTransfers {
+		if p.isTransferProcessed(transfer.ID) || p.isTransferBeingProcessed(transfer.ID) {
+			continue
+		}
+		if p.skipFirstRunBacklog(transfer) {
+			continue
+		}
+		if !p.manager.dlConfig.AdoptExisting && finishedBefore(transfer, p.startedAt) {
+			log.Debug("transfers").
+				Int64("transfer_id", transfer.ID).
+				Str("name", transfer.Name).
+				Msg("Ignoring transfer that finished before startup")
+			continue
+		}
+		if !transferSettled(transfer, time.Now(), p.manager.dlConfig.CompletionSettle) {
+			log.Debug("transfers").
+				Int64("transfer_id", transfer.ID).
+				Str("name", transfer.Name).
+				Msg("Transfer finished recently, waiting for Put.io to settle")
+			continue
+		}
+		candidates = append(candidates, transfer)
+	}
+
+	selected := selectNewTransfers(candidates, p.manager.dlConfig.MaxNewPerScan, p.manager.dlConfig.MaxNewPriority)
+	if deferred := len(candidates) - len(selected); deferred > 0 {
+		log.Info("transfers").
+			Int("starting", len(selected)).
+			Int("deferred", deferred).
+			Msg("Per-scan limit reached, deferring remaining transfers to next scan")
+	}
+
+	for _, transfer := range selected {
 		select {
-		case <-p.manager.stopChan:
+		case <-ctx.Done():
 			log.Debug("transfers").Msg("Stopping transfer processing")
 			return
 		default:
-			if p.isTransferBeingProcessed(transfer.ID) {
-				continue
-			}
-			p.startTransferProcessing(transfer)
+			p.startTransferProcessing(ctx, transfer)
 		}
 	}
 }
 
+// selectNewTransfers orders candidates by priority and returns at most max of
+// them (all if max <= 0). PriorityAge starts the longest finished transfers
+// first, PrioritySize the smallest.
+func selectNewTransfers(candidates []*putio.Transfer, max int, priority string) []*putio.Transfer {
+	if max <= 0 || len(candidates) <= max {
+		return candidates
+	}
+
+	sorted := slices.Clone(candidates)
+	switch priority {
+	case PrioritySize:
+		slices.SortStableFunc(sorted, func(a, b *putio.Transfer) int {
+			return cmp.Compare(a.Size, b.Size)
+		})
+	default:
+		slices.SortStableFunc(sorted, func(a, b *putio.Transfer) int {
+			return finishedAt(a).Compare(finishedAt(b))
+		})
+	}
+	return sorted[:max]
+}
+
+// finishedAt returns when a transfer finished, or the zero time if unknown,
+// so that transfers without a timestamp sort first.
+func finishedAt(transfer *putio.Transfer) time.Time {
+	if transfer.FinishedAt == nil {
+		return time.Time{}
+	}
+	return transfer.FinishedAt.Time
+}
+
+// transferSettled reports whether a finished transfer has been finished for at
+// least settle, giving Put.io time to finalize the file list. Transfers
+// without a FinishedAt timestamp are considered settled.
+func transferSettled(transfer *putio.Transfer, now time.Time, settle time.Duration) bool {
+	if settle <= 0 || transfer.FinishedAt == nil || transfer.FinishedAt.IsZero() {
+		return true
+	}
+	return now.Sub(transfer.FinishedAt.Time) >= settle
+}
+
+// finishedBefore reports whether a transfer had already finished on Put.io
+// before t. Transfers without a FinishedAt timestamp are treated as new.
+func finishedBefore(transfer *putio.Transfer, t time.Time) bool {
+	return transfer.FinishedAt != nil && !transfer.FinishedAt.IsZero() && transfer.FinishedAt.Before(t)
+}
+
+// leavesAlone reports whether a finished transfer is not downloaded because
+// it had finished before startup or, under FirstRunPolicySkipExisting,
+// before the first run.
+func (p *TransferProcessor) leavesAlone(transfer *putio.Transfer) bool {
+	if !p.manager.dlConfig.AdoptExisting && finishedBefore(transfer, p.startedAt) {
+		return true
+	}
+	return p.manager.dlConfig.FirstRunPolicy == FirstRunPolicySkipExisting &&
+		!p.firstRun.IsZero() && finishedBefore(transfer, p.firstRun)
+}
+
+// isTransferProcessed reports whether a transfer has already been downloaded
+// this session. Put.io may flip a finished transfer between SEEDING and
+// COMPLETED across scans, which must not cause it to be processed again.
+func (p *TransferProcessor) isTransferProcessed(transferID int64) bool {
+	_, processed := p.processedTransfers.Load(transferID)
+	return processed
+}
+
 // isTransferBeingProcessed checks if a transfer is already being handled
 func (p *TransferProcessor) isTransferBeingProcessed(transferID int64) bool {
 	if _, exists := p.manager.coordinator.GetTransferContext(transferID); exists {
@@ -279,7 +503,7 @@ func (p *TransferProcessor) isTransferBeingProcessed(transferID int64) bool {
 }
 
 // startTransferProcessing begins processing a transfer
-func (p *TransferProcessor) startTransferProcessing(transfer *putio.Transfer) {
+func (p *TransferProcessor) startTransferProcessing(ctx context.Context, transfer *putio.Transfer) {
 	log.Info("transfers").
 		Str("name", transfer.Name).
 		Str("status", transfer.Status).
@@ -289,12 +513,12 @@ func (p *TransferProcessor) startTransferProcessing(transfer *putio.Transfer) {
 	p.manager.workerWg.Add(1)
 	transferCopy := *transfer
 	go func() {
-		p.processTransfer(&transferCopy)
+		p.processTransfer(ctx, &transferCopy)
 	}()
 }
 
 // processTransfer handles downloading of a completed or seeding transfer
-func (p *TransferProcessor) processTransfer(transfer *putio.Transfer) {
+func (p *TransferProcessor) processTransfer(ctx context.Context, transfer *putio.Transfer) {
 	defer p.manager.workerWg.Done()
 
 	log.Debug("transfers").
@@ -303,17 +527,39 @@ func (p *TransferProcessor) processTransfer(transfer *putio.Transfer) {
 		Int64("file_id", transfer.FileID).
 		Msg("Processing transfer")
 
-	files, err := p.manager.client.GetAllTransferFiles(p.manager.Context(), transfer.FileID)
+	files, err := p.listTransferFiles(ctx, transfer)
 	if err != nil {
+		if ctx.Err() != nil {
+			// Shutting down; the transfer is picked up again on the next start
+			return
+		}
 		p.handleTransferError(transfer, err)
 		return
 	}
 
 	if len(files) == 0 {
+		// Put.io may not have indexed the files yet; try again on the next scan
+		attempts := 0
+		if v, ok := p.noFilesAttempts.Load(transfer.ID); ok {
+			attempts = v.(int)
+		}
+		if attempts < p.manager.dlConfig.NoFilesRetries {
+			p.noFilesAttempts.Store(transfer.ID, attempts+1)
+			log.Warn("transfers").
+				Str("name", transfer.Name).
+				Int64("id", transfer.ID).
+				Int("attempt", attempts+1).
+				Int("max_attempts", p.manager.dlConfig.NoFilesRetries).
+				Msg("No files found for completed transfer, retrying on next scan")
+			return
+		}
+		p.noFilesAttempts.Delete(transfer.ID)
+
 		err := NewNoFilesFoundError(transfer.ID)
 		p.manager.coordinator.FailTransfer(transfer.ID, err)
 		return
 	}
+	p.noFilesAttempts.Delete(transfer.ID)
 
 	// Initialize transfer with total number of files
 	if !p.initializeTransfer(transfer, len(files)) {
@@ -334,6 +580,30 @@ func (p *TransferProcessor) processTransfer(transfer *putio.Transfer) {
 	}
 }
 
+// listTransferFiles returns the files of a transfer. With PreserveStructure
+// each file's Name is its path within the transfer's Put.io folder, so that
+// it is written to the same nested location locally.
+func (p *TransferProcessor) listTransferFiles(ctx context.Context, transfer *putio.Transfer) ([]*putio.File, error) {
+	if !p.manager.dlConfig.PreserveStructure {
+		return p.manager.client.GetAllTransferFiles(ctx, transfer.FileID)
+	}
+
+	files, paths, err := p.manager.client.GetAllTransferFilePaths(ctx, transfer.FileID)
+	if err != nil {
+		return nil, err
+	}
+	nested := make([]*putio.File, len(files))
+	for i, file := range files {
+		f := *file
+		// Never let a path from Put.io escape the transfer directory
+		if rel := filepath.FromSlash(paths[file.ID]); rel != "" && filepath.IsLocal(rel) {
+			f.Name = rel
+		}
+		nested[i] = &f
+	}
+	return nested, nil
+}
+
 // handleTransferError processes transfer errors appropriately
 func (p *TransferProcessor) handleTransferError(transfer *putio.Transfer, err error) {
 	if putioErr, ok := err.(*putio.ErrorResponse); ok && putioErr.Type == "NotFound" {
@@ -377,18 +647,20 @@ func (p *TransferProcessor) queueTransferFiles(transfer *putio.Transfer, files [
 	// Update the transfer context with total size
 	ctx.SetTotalSize(totalSize)
 
-	log.Info("transfers").
-		Int64("transfer_id", transfer.ID).
-		Int64("total_size", totalSize).
-		Int("file_count", len(files)).
-		Msg("Updated transfer with total file size")
-
+	var skippedFiles int
+	var skippedBytes int64
 	for _, file := range files {
 		if p.shouldDownloadFile(transfer, file) {
 			filesToDownload++
+			// Bytes of a partial file from before a restart are resumed, not
+			// downloaded again, so report them right away
+			if resumed := p.partialFileSize(transfer, file); resumed > 0 {
+				ctx.AddDownloadedBytes(resumed)
+			}
 			p.queueFileDownload(transfer, file)
 		} else {
-			// For files we don't need to download (already exist), mark as completed
+			// For files we don't need to download (already exist, filtered out
+			// or too small), mark as completed
 			if err := p.manager.coordinator.FileCompleted(transfer.ID); err != nil {
 				log.Error("transfers").
 					Int64("transfer_id", transfer.ID).
@@ -399,6 +671,8 @@ func (p *TransferProcessor) queueTransferFiles(transfer *putio.Transfer, files [
 
 			// For existing files, add their size to the downloaded size
 			ctx.AddDownloadedBytes(file.Size)
+			skippedFiles++
+			skippedBytes += file.Size
 
 			log.Debug("transfers").
 				Int64("transfer_id", transfer.ID).
@@ -407,17 +681,48 @@ func (p *TransferProcessor) queueTransferFiles(transfer *putio.Transfer, files [
 				Msg("Added existing file size to downloaded total")
 		}
 	}
+
+	// One line summarizing what was decided for this transfer
+	log.Info("transfers").
+		Int64("transfer_id", transfer.ID).
+		Str("name", transfer.Name).
+		Int("total_files", len(files)).
+		Int64("total_size", totalSize).
+		Int("queued_files", filesToDownload).
+		Int64("queued_size", totalSize-skippedBytes).
+		Int("skipped_files", skippedFiles).
+		Int64("skipped_size", skippedBytes).
+		Msg("Transfer download plan")
+
 	return filesToDownload
 }
 
 // shouldDownloadFile determines if a file needs to be downloaded
 func (p *TransferProcessor) shouldDownloadFile(transfer *putio.Transfer, file *putio.File) bool {
-	category := p.manager.GetCategory(transfer.Hash)
-	targetPath := filepath.Join(p.targetDir, category, transfer.Name, file.Name)
+	// Skip files filtered out by the include and exclude patterns
+	if !p.manager.fileWanted(file.Name) {
+		log.Info("transfers").
+			Str("file_name", file.Name).
+			Int64("file_id", file.ID).
+			Msg("File filtered out by pattern, skipping download")
+		return false
+	}
+
+	// Skip files too small to be worth keeping, such as samples
+	if minSize := p.manager.dlConfig.MinFileSize; minSize > 0 && file.Size < minSize {
+		log.Info("transfers").
+			Str("file_name", file.Name).
+			Int64("file_id", file.ID).
+			Int64("file_size", file.Size).
+			Msg("File below minimum size, skipping download")
+		return false
+	}
+
+	targetPath := filepath.Join(p.manager.TransferTargetDir(transfer), p.manager.filePath(transfer, file))
 	info, err := os.Stat(targetPath)
 
-	// Skip if file exists with correct size
-	if err == nil && info.Size() == file.Size {
+	// Skip if file exists with correct size (and checksum, if verification is enabled)
+	if err == nil && info.Size() == file.Size && p.verifyExistingFile(targetPath, file) {
 		log.Info("transfers").
 			Str("file_name", file.Name).
 			Int64("file_id", file.ID).
@@ -437,13 +742,65 @@ func (p *TransferProcessor) shouldDownloadFile(transfer *putio.Transfer, file *p
 	return true
 }
 
+// partialFileSize returns how many bytes of a file a previous download left
+// in its partial file, or 0 if there is none.
+func (p *TransferProcessor) partialFileSize(transfer *putio.Transfer, file *putio.File) int64 {
+	partial := p.manager.partialFile(p.manager.TransferTargetDir(transfer), p.manager.filePath(transfer, file))
+	return min(partialBytes(partial), file.Size)
+}
+
+// verifyExistingFile checks an existing same-size file against the CRC32
+// reported by Put.io. It returns true if the file can be skipped. On a
+// mismatch the local file is removed so that it is downloaded from scratch
+// instead of being treated as complete by the downloader.
+func (p *TransferProcessor) verifyExistingFile(targetPath string, file *putio.File) bool {
+	if !p.manager.dlConfig.VerifyExisting {
+		return true
+	}
+	if file.CRC32 == "" {
+		log.Debug("transfers").
+			Str("file_name", file.Name).
+			Int64("file_id", file.ID).
+			Msg("No checksum available from Put.io, trusting file size")
+		return true
+	}
+
+	match, err := checksumMatches(targetPath, file.CRC32)
+	if err != nil {
+		log.Warn("transfers").
+			Str("file_name", file.Name).
+			Int64("file_id", file.ID).
+			Err(err).
+			Msg("Failed to verify existing file, trusting file size")
+		return true
+	}
+	if match {
+		return true
+	}
+
+	log.Warn("transfers").
+		Str("file_name", file.Name).
+		Int64("file_id", file.ID).
+		Str("expected_crc32", file.CRC32).
+		Msg("Existing file checksum mismatch, re-downloading")
+	if err := os.Remove(targetPath); err != nil {
+		log.Error("transfers").
+			Str("file_name", file.Name).
+			Str("target_path", targetPath).
+			Err(err).
+			Msg("Failed to remove corrupt file")
+	}
+	return false
+}
+
 // queueFileDownload adds a file to the download queue
 func (p *TransferProcessor) queueFileDownload(transfer *putio.Transfer, file *putio.File) {
-	category := p.manager.GetCategory(transfer.Hash)
 	p.manager.QueueDownload(downloadJob{
 		FileID:     file.ID,
-		Name:       filepath.Join(category, transfer.Name, file.Name),
+		Name:       p.manager.filePath(transfer, file),
+		Size:       file.Size,
 		TransferID: transfer.ID,
+		TargetDir:  p.manager.TransferTargetDir(transfer),
 	})
 	log.Debug("transfers").
 		Str("file_name", file.Name).
@@ -454,7 +811,10 @@ func (p *TransferProcessor) queueFileDownload(transfer *putio.Transfer, file *pu
 
 // initializeTransfer sets up transfer tracking
 func (p *TransferProcessor) initializeTransfer(transfer *putio.Transfer, filesToDownload int) bool {
-	p.manager.coordinator.InitiateTransfer(transfer.ID, transfer.Name, transfer.FileID, filesToDownload)
+	ctx := p.manager.coordinator.InitiateTransfer(transfer.ID, transfer.Name, transfer.FileID, filesToDownload)
+	ctx.SetHash(transfer.Hash)
+	category := p.manager.GetCategory(transfer.Hash)
+	ctx.SetLocation(category, filepath.Join(p.manager.TransferTargetDir(transfer), p.manager.TransferDir(transfer)))
 	if err := p.manager.coordinator.StartDownload(transfer.ID); err != nil {
 		log.Error("transfers").
 			Str("name", transfer.Name).
@@ -475,10 +835,18 @@ func (p *TransferProcessor) initializeTransfer(transfer *putio.Transfer, filesTo
 }
 
 // processErroredTransfers handles failed transfers with retry logic
-func (p *TransferProcessor) processErroredTransfers() {
+func (p *TransferProcessor) processErroredTransfers(ctx context.Context) {
 	const maxRetryAttempts = 3
 
 	for _, transfer := range p.transfers["ERROR"] {
+		if ctx.Err() != nil {
+			return
+		}
+
+		if p.manager.dlConfig.SalvageErrored && p.salvageErroredTransfer(ctx, transfer) {
+			continue
+		}
+
 		// Get current retry count
 		retryCountValue, exists := p.retryAttempts.Load(transfer.ID)
 		retryCount := 0
@@ -502,7 +870,7 @@ func (p *TransferProcessor) processErroredTransfers() {
 			logger.Msgf("Transfer errored, retrying (attempt %d of %d)", retryCount+1, maxRetryAttempts)
 
 			// Attempt to retry the transfer
-			retried, err := p.manager.client.RetryTransfer(p.manager.Context(), transfer.ID)
+			retried, err := p.manager.client.RetryTransfer(ctx, transfer.ID)
 			if err != nil {
 				log.Error("transfers").
 					Str("name", transfer.Name).
@@ -521,7 +889,7 @@ func (p *TransferProcessor) processErroredTransfers() {
 			logger.Msgf("Transfer errored, giving up after %d retry attempts", maxRetryAttempts)
 
 			// Delete the transfer after max retries
-			if err := p.manager.client.DeleteTransfer(p.manager.Context(), transfer.ID); err != nil {
+			if err := p.manager.client.DeleteTransfer(ctx, transfer.ID); err != nil {
 				log.Error("transfers").
 					Str("name", transfer.Name).
 					Int64("id", transfer.ID).
@@ -539,9 +907,50 @@ func (p *TransferProcessor) processErroredTransfers() {
 	}
 }
 
-// MarkTransferProcessed marks a transfer as processed locally
+// salvageErroredTransfer downloads the files of an errored transfer if Put.io
+// still holds all of them, judged by their total size. It reports whether the
+// transfer is being or has been salvaged, in which case it must be neither
+// retried nor deleted.
+func (p *TransferProcessor) salvageErroredTransfer(ctx context.Context, transfer *putio.Transfer) bool {
+	if p.isTransferProcessed(transfer.ID) || p.isTransferBeingProcessed(transfer.ID) {
+		return true
+	}
+	if transfer.FileID == 0 || transfer.Size <= 0 {
+		return false
+	}
+
+	files, err := p.listTransferFiles(ctx, transfer)
+	if err != nil {
+		log.Debug("transfers").
+			Str("name", transfer.Name).
+			Int64("id", transfer.ID).
+			Err(err).
+			Msg("Failed to list files of errored transfer")
+		return false
+	}
+	var size int64
+	for _, file := range files {
+		size += file.Size
+	}
+	if len(files) == 0 || size < int64(transfer.Size) {
+		return false
+	}
+
+	log.Warn("transfers").
+		Str("name", transfer.Name).
+		Int64("id", transfer.ID).
+		Str("error", transfer.ErrorMessage).
+		Int("files", len(files)).
+		Msg("Transfer errored but its files are complete, downloading them")
+	p.startTransferProcessing(ctx, transfer)
+	return true
+}
+
+// MarkTransferProcessed marks a transfer as processed locally and records
+// it as downloaded for later sessions
 func (p *TransferProcessor) MarkTransferProcessed(transferID int64) {
 	p.processedTransfers.Store(transferID, true)
+	p.manager.downloaded.Add(transferID, time.Now())
 	log.Debug("transfers").
 		Int64("transfer_id", transferID).
 		Msg("Marked transfer as processed locally")
@@ -549,7 +958,7 @@ func (p *TransferProcessor) MarkTransferProcessed(transferID int64) {
 
 // finalizeCompletedTransfers checks for transfers that are marked as completed in the
 // internal tracking system but haven't been fully cleaned up yet.
-func (p *TransferProcessor) finalizeCompletedTransfers() {
+func (p *TransferProcessor) finalizeCompletedTransfers(ctx context.Context) {
 	// Get all active transfers from the coordinator
 	var pendingCleanup []int64
 
@@ -567,17 +976,40 @@ func (p *TransferProcessor) finalizeCompletedTransfers() {
 		return true
 	})
 
-	// Process any transfers that need cleanup
+	// Process any transfers that need cleanup, a few at a time since the
+	// cleanup hooks make network calls to Put.io
+	workers := p.manager.dlConfig.CleanupWorkers
+	if workers <= 0 {
+		workers = 1
+	}
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+
 	for _, transferID := range pendingCleanup {
-		log.Info("transfers").
-			Int64("id", transferID).
-			Msg("Finalizing completed transfer")
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		}
+		wg.Add(1)
+		go func(transferID int64) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
 
-		if err := p.manager.coordinator.CompleteTransfer(transferID); err != nil {
-			log.Error("transfers").
+			log.Info("transfers").
 				Int64("id", transferID).
-				Err(err).
-				Msg("Failed to finalize completed transfer")
-		}
+				Msg("Finalizing completed transfer")
+
+			if err := p.manager.coordinator.CompleteTransfer(transferID); err != nil {
+				log.Error("transfers").
+					Int64("id", transferID).
+					Err(err).
+					Msg("Failed to finalize completed transfer")
+			}
+		}(transferID)
 	}
+	wg.Wait()
 }
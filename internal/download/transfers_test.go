@@ -0,0 +1,486 @@
+package download
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elsbrock/go-putio"
+)
+
+func TestTransferSettled(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	finishedAt := func(ago time.Duration) *putio.Time {
+		return &putio.Time{Time: now.Add(-ago)}
+	}
+
+	tests := []struct {
+		name     string
+		transfer *putio.Transfer
+		settle   time.Duration
+		want     bool
+	}{
+		{"disabled", &putio.Transfer{FinishedAt: finishedAt(0)}, 0, true},
+		{"no finished timestamp", &putio.Transfer{}, 10 * time.Second, true},
+		{"finished just now", &putio.Transfer{FinishedAt: finishedAt(2 * time.Second)}, 10 * time.Second, false},
+		{"finished long enough ago", &putio.Transfer{FinishedAt: finishedAt(10 * time.Second)}, 10 * time.Second, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := transferSettled(tt.transfer, now, tt.settle); got != tt.want {
+				t.Errorf("transferSettled() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFinishedBefore(t *testing.T) {
+	startup := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		transfer *putio.Transfer
+		want     bool
+	}{
+		{"finished before startup", &putio.Transfer{FinishedAt: &putio.Time{Time: startup.Add(-time.Hour)}}, true},
+		{"finished after startup", &putio.Transfer{FinishedAt: &putio.Time{Time: startup.Add(time.Minute)}}, false},
+		{"no finished timestamp", &putio.Transfer{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := finishedBefore(tt.transfer, startup); got != tt.want {
+				t.Errorf("finishedBefore() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectNewTransfers(t *testing.T) {
+	base := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	candidates := []*putio.Transfer{
+		{ID: 1, Size: 300, FinishedAt: &putio.Time{Time: base.Add(2 * time.Hour)}},
+		{ID: 2, Size: 100, FinishedAt: &putio.Time{Time: base.Add(3 * time.Hour)}},
+		{ID: 3, Size: 200, FinishedAt: &putio.Time{Time: base}},
+	}
+
+	tests := []struct {
+		name     string
+		max      int
+		priority string
+		want     []int64
+	}{
+		{"unlimited", 0, PriorityAge, []int64{1, 2, 3}},
+		{"under limit", 5, PriorityAge, []int64{1, 2, 3}},
+		{"oldest first", 2, PriorityAge, []int64{3, 1}},
+		{"smallest first", 2, PrioritySize, []int64{2, 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := selectNewTransfers(candidates, tt.max, tt.priority)
+			if len(got) != len(tt.want) {
+				t.Fatalf("selected %d transfers, want %d", len(got), len(tt.want))
+			}
+			for i, transfer := range got {
+				if transfer.ID != tt.want[i] {
+					t.Errorf("selected[%d] = %d, want %d", i, transfer.ID, tt.want[i])
+				}
+			}
+		})
+	}
+
+	if candidates[0].ID != 1 {
+		t.Error("selectNewTransfers must not reorder its input")
+	}
+}
+
+func TestFinalizeCompletedTransfersBoundedConcurrency(t *testing.T) {
+	m := newTestManager()
+	m.dlConfig.CleanupWorkers = 2
+
+	var mu sync.Mutex
+	running, maxRunning, cleaned := 0, 0, 0
+	m.coordinator.RegisterCleanupHook(func(event TransferEvent) error {
+		mu.Lock()
+		running++
+		maxRunning = max(maxRunning, running)
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		running--
+		cleaned++
+		mu.Unlock()
+		return nil
+	})
+
+	for id := int64(1); id <= 5; id++ {
+		m.coordinator.InitiateTransfer(id, "test", 100+id, 1)
+		m.coordinator.StartDownload(id)
+		m.coordinator.FileCompleted(id)
+	}
+
+	m.processor.finalizeCompletedTransfers(context.Background())
+
+	if cleaned != 5 {
+		t.Errorf("cleaned %d transfers, want 5", cleaned)
+	}
+	if maxRunning > 2 {
+		t.Errorf("max concurrent cleanups = %d, want <= 2", maxRunning)
+	}
+	for id := int64(1); id <= 5; id++ {
+		ctx, _ := m.coordinator.GetTransferContext(id)
+		if ctx.GetState() != TransferLifecycleProcessed {
+			t.Errorf("transfer %d state = %s, want Processed", id, ctx.GetState())
+		}
+	}
+}
+
+func TestReconcileHashesMovesCategory(t *testing.T) {
+	m := newTestManager()
+	m.categories = newCategoryStore(t.TempDir())
+	transfer := &putio.Transfer{ID: 1, Name: "show", Status: "IN_QUEUE", Hash: "PLACEHOLDER"}
+	m.client = &fakePutioClient{transfers: []*putio.Transfer{transfer}}
+
+	m.SetCategory("placeholder", "tv")
+	m.processor.checkTransfers(context.Background())
+
+	// Put.io assigns the real info-hash once metadata is fetched
+	transfer.Hash = "ABCDEF0123456789"
+	m.processor.checkTransfers(context.Background())
+
+	if got := m.GetCategory("abcdef0123456789"); got != "tv" {
+		t.Errorf("category for new hash = %q, want %q", got, "tv")
+	}
+	if got := m.GetCategory("placeholder"); got != "" {
+		t.Errorf("category for stale hash = %q, want it removed", got)
+	}
+	if got := m.processor.hashByID[1]; got != "abcdef0123456789" {
+		t.Errorf("tracked hash = %q, want new hash", got)
+	}
+
+	// Transfers that disappear are forgotten
+	m.client = &fakePutioClient{}
+	m.processor.checkTransfers(context.Background())
+	if _, ok := m.processor.hashByID[1]; ok {
+		t.Error("expected removed transfer to be forgotten")
+	}
+}
+
+func TestProcessTransferNoFilesRetries(t *testing.T) {
+	m := newTestManager()
+	m.dlConfig.NoFilesRetries = 2
+	client := &fakePutioClient{files: map[int64][]*putio.File{}}
+	m.client = client
+	transfer := &putio.Transfer{ID: 1, Name: "show", FileID: 10, Status: "COMPLETED"}
+
+	process := func() {
+		m.workerWg.Add(1)
+		m.processor.processTransfer(context.Background(), transfer)
+	}
+
+	for i := 1; i <= 2; i++ {
+		process()
+		v, ok := m.processor.noFilesAttempts.Load(transfer.ID)
+		if !ok || v.(int) != i {
+			t.Fatalf("after scan %d attempts = %v, want %d", i, v, i)
+		}
+		if _, exists := m.coordinator.GetTransferContext(transfer.ID); exists {
+			t.Fatal("transfer should not be initiated without files")
+		}
+	}
+
+	// Files show up before the retries are exhausted
+	client.files[10] = []*putio.File{{ID: 100, Name: "episode.mkv", Size: 10}}
+	process()
+	if _, ok := m.processor.noFilesAttempts.Load(transfer.ID); ok {
+		t.Error("expected attempts to be cleared once files are found")
+	}
+	if _, exists := m.coordinator.GetTransferContext(transfer.ID); !exists {
+		t.Error("expected transfer to be initiated once files are found")
+	}
+}
+
+func TestProcessTransferPreserveStructure(t *testing.T) {
+	client := &fakePutioClient{
+		files: map[int64][]*putio.File{10: {
+			{ID: 100, Name: "movie.mkv", Size: 10},
+			{ID: 101, Name: "movie.en.srt", Size: 1},
+			{ID: 102, Name: "VIDEO_TS.IFO", Size: 1},
+			{ID: 103, Name: "evil", Size: 1},
+		}},
+		paths: map[int64]map[int64]string{10: {
+			100: "movie.mkv",
+			101: "Subs/movie.en.srt",
+			102: "DVD/VIDEO_TS/VIDEO_TS.IFO",
+			103: "../evil",
+		}},
+	}
+
+	tests := []struct {
+		preserve bool
+		want     []string
+	}{
+		{false, []string{"movie.mkv", "movie.en.srt", "VIDEO_TS.IFO", "evil"}},
+		{true, []string{"movie.mkv", filepath.Join("Subs", "movie.en.srt"), filepath.Join("DVD", "VIDEO_TS", "VIDEO_TS.IFO"), "evil"}},
+	}
+
+	for _, tt := range tests {
+		m := newTestManager()
+		m.cfg.TargetDir = t.TempDir()
+		m.dlConfig.PreserveStructure = tt.preserve
+		m.client = client
+		transfer := &putio.Transfer{ID: 1, Name: "Movie", FileID: 10, Status: "COMPLETED"}
+
+		m.workerWg.Add(1)
+		m.processor.processTransfer(context.Background(), transfer)
+
+		var got []string
+		for range tt.want {
+			job, _ := m.queue.Pop()
+			got = append(got, job.Name)
+		}
+		for i, name := range tt.want {
+			if want := filepath.Join("Movie", name); got[i] != want {
+				t.Errorf("preserve=%v: job %d name = %q, want %q", tt.preserve, i, got[i], want)
+			}
+		}
+	}
+}
+
+func TestHasLocalData(t *testing.T) {
+	dir := t.TempDir()
+	earlier := newTestManager()
+	earlier.downloaded = newDownloadedStore(newStateFile(dir))
+	earlier.processor.MarkTransferProcessed(1)
+
+	// After a restart, only the record of the earlier session remains
+	m := newTestManager()
+	m.downloaded = newDownloadedStore(newStateFile(dir))
+	m.downloaded.Load()
+	m.processor.MarkTransferProcessed(3)
+	m.processor.startedAt = time.Now()
+	m.dlConfig.AdoptExisting = false
+	finished := &putio.Time{Time: m.processor.startedAt.Add(-time.Hour)}
+
+	tests := []struct {
+		name     string
+		transfer *putio.Transfer
+		want     bool
+	}{
+		{"downloaded before restart", &putio.Transfer{ID: 1, Name: "Earlier"}, true},
+		{"not downloaded yet", &putio.Transfer{ID: 2, Name: "Missing"}, false},
+		{"processed this session", &putio.Transfer{ID: 3, Name: "Moved.Away"}, true},
+		{"finished before startup", &putio.Transfer{ID: 4, Name: "Not.Adopted", FinishedAt: finished}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := m.HasLocalData(tt.transfer); got != tt.want {
+				t.Errorf("HasLocalData() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Transfers gone from Put.io are forgotten
+	m.downloaded.Retain([]*putio.Transfer{{ID: 3}})
+	reloaded := newDownloadedStore(newStateFile(dir))
+	reloaded.Load()
+	if reloaded.Has(1) || !reloaded.Has(3) {
+		t.Errorf("after retaining transfer 3: has 1 = %v, has 3 = %v", reloaded.Has(1), reloaded.Has(3))
+	}
+}
+
+// blockingPutioClient blocks GetTransfers until the request is cancelled,
+// simulating a slow Put.io API during shutdown.
+type blockingPutioClient struct {
+	fakePutioClient
+	started chan struct{}
+}
+
+func (b *blockingPutioClient) GetTransfers(ctx context.Context) ([]*putio.Transfer, error) {
+	close(b.started)
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestStopCancelsInProgressScan(t *testing.T) {
+	m := newTestManager()
+	m.cfg.TargetDir = t.TempDir()
+	m.stats = newStatsStore(newStateFile(m.cfg.TargetDir))
+	client := &blockingPutioClient{started: make(chan struct{})}
+	m.client = client
+
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+	m.running = true
+	m.monitorWg.Add(1)
+	go func() {
+		defer m.monitorWg.Done()
+		m.monitorTransfers()
+	}()
+
+	select {
+	case <-client.started:
+	case <-time.After(time.Second):
+		t.Fatal("scan did not start")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		m.Stop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Stop did not return while a scan was in progress")
+	}
+}
+
+func TestStatusFlappingDoesNotReprocess(t *testing.T) {
+	m := newTestManager()
+	m.cfg.TargetDir = t.TempDir()
+	m.categories = newCategoryStore(m.cfg.TargetDir)
+
+	// The only file already exists locally, so processing completes at once
+	if err := os.MkdirAll(filepath.Join(m.cfg.TargetDir, "show"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(m.cfg.TargetDir, "show", "episode.mkv"), []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	client := &fakePutioClient{files: map[int64][]*putio.File{
+		10: {{ID: 100, Name: "episode.mkv", Size: 10}},
+	}}
+	m.client = client
+
+	var cleanups int
+	m.coordinator.RegisterCleanupHook(func(event TransferEvent) error {
+		cleanups++
+		return nil
+	})
+
+	scan := func(status string) {
+		client.transfers = []*putio.Transfer{{ID: 1, Name: "show", FileID: 10, Status: status}}
+		m.processor.checkTransfers(context.Background())
+		m.workerWg.Wait()
+	}
+
+	scan("SEEDING")
+	scan("COMPLETED")
+	scan("SEEDING")
+
+	if len(client.listed) != 1 {
+		t.Errorf("transfer files listed %d times, want 1", len(client.listed))
+	}
+	if cleanups != 1 {
+		t.Errorf("cleanup ran %d times, want 1", cleanups)
+	}
+
+	// Even without a coordinator context the processed set prevents a rerun
+	m.coordinator.transfers.Delete(int64(1))
+	scan("COMPLETED")
+	if len(client.listed) != 1 {
+		t.Errorf("transfer files listed %d times after context loss, want 1", len(client.listed))
+	}
+}
+
+func TestProcessErroredTransfersSalvage(t *testing.T) {
+	complete := &putio.Transfer{ID: 1, Name: "Complete", FileID: 10, Size: 11, Status: "ERROR"}
+	partial := &putio.Transfer{ID: 2, Name: "Partial", FileID: 20, Size: 100, Status: "ERROR"}
+	client := &fakePutioClient{files: map[int64][]*putio.File{
+		10: {{ID: 100, Name: "movie.mkv", Size: 10}, {ID: 101, Name: "movie.srt", Size: 1}},
+		20: {{ID: 200, Name: "episode.mkv", Size: 50}},
+	}}
+
+	m := newTestManager()
+	m.cfg.TargetDir = t.TempDir()
+	m.dlConfig.SalvageErrored = true
+	m.client = client
+	m.processor.transfers = map[string][]*putio.Transfer{"ERROR": {complete, partial}}
+
+	m.processor.processErroredTransfers(context.Background())
+	m.workerWg.Wait()
+
+	if got := m.queue.Len(); got != 2 {
+		t.Errorf("queued jobs = %d, want the 2 files of the complete transfer", got)
+	}
+	if !reflect.DeepEqual(client.retried, []int64{2}) {
+		t.Errorf("retried = %v, want only the incomplete transfer", client.retried)
+	}
+
+	// While it downloads, and once done, the salvaged transfer is left alone
+	m.processor.processErroredTransfers(context.Background())
+	m.processor.MarkTransferProcessed(complete.ID)
+	m.processor.processErroredTransfers(context.Background())
+	if !reflect.DeepEqual(client.retried, []int64{2, 2, 2}) {
+		t.Errorf("retried = %v, want only the incomplete transfer", client.retried)
+	}
+
+	// Without --salvage-errored the transfer is retried as before
+	m = newTestManager()
+	client.retried = nil
+	m.client = client
+	m.processor.transfers = map[string][]*putio.Transfer{"ERROR": {complete}}
+	m.processor.processErroredTransfers(context.Background())
+	if !reflect.DeepEqual(client.retried, []int64{1}) {
+		t.Errorf("retried = %v, want the transfer retried", client.retried)
+	}
+}
+
+func TestCategorize(t *testing.T) {
+	p := newTestManager().processor
+	p.manager.cfg.FolderID = 7
+	scan := func(transfers ...*putio.Transfer) {
+		p.transfers, p.all = p.categorize(transfers)
+	}
+
+	first := []*putio.Transfer{
+		{ID: 1, Status: "COMPLETED", SaveParentID: 7},
+		{ID: 2, Status: "DOWNLOADING", SaveParentID: 7},
+		{ID: 3, Status: "COMPLETED", SaveParentID: 99},
+	}
+	scan(first...)
+	shared := p.GetTransfers()
+	if len(shared) != 2 || len(p.transfers["COMPLETED"]) != 1 || len(p.transfers["DOWNLOADING"]) != 1 {
+		t.Fatalf("all = %v, by status = %v, want transfers outside the folder skipped", shared, p.transfers)
+	}
+
+	// A later scan must not change what an earlier GetTransfers returned,
+	// and statuses that no longer occur are dropped
+	scan(&putio.Transfer{ID: 4, Status: "SEEDING", SaveParentID: 7})
+	scan(&putio.Transfer{ID: 5, Status: "SEEDING", SaveParentID: 7})
+	if shared[0].ID != 1 || shared[1].ID != 2 {
+		t.Errorf("earlier result changed to %v", shared)
+	}
+	if _, ok := p.transfers["COMPLETED"]; ok {
+		t.Errorf("by status = %v, want stale COMPLETED bucket dropped", p.transfers)
+	}
+	if got := p.transfers["SEEDING"]; len(got) != 1 || got[0].ID != 5 {
+		t.Errorf("SEEDING = %v, want only transfer 5", got)
+	}
+}
+
+func BenchmarkCategorize(b *testing.B) {
+	statuses := []string{"IN_QUEUE", "WAITING", "DOWNLOADING", "SEEDING", "COMPLETED", "ERROR"}
+	transfers := make([]*putio.Transfer, 2000)
+	for i := range transfers {
+		transfers[i] = &putio.Transfer{ID: int64(i), Status: statuses[i%len(statuses)]}
+	}
+
+	p := newTestManager().processor
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		p.transfers, p.all = p.categorize(transfers)
+		_ = p.GetTransfers()
+	}
+}
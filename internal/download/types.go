@@ -1,6 +1,7 @@
 package download
 
 import (
+	"fmt"
 	"sync"
 	"time"
 )
@@ -9,7 +10,9 @@ import (
 type downloadJob struct {
 	FileID     int64
 	Name       string
-	TransferID int64 // Parent transfer ID for group tracking
+	Size       int64  // File size reported by Put.io
+	TransferID int64  // Parent transfer ID for group tracking
+	TargetDir  string // Directory Name is relative to, the configured target dir if empty
 }
 
 // DownloadState tracks the progress of a file download
@@ -17,16 +20,38 @@ type DownloadState struct {
 	TransferID   int64
 	FileID       int64
 	Name         string
+	Size         int64  // File size reported by Put.io, 0 if unknown
+	TargetDir    string // Directory Name is relative to, the configured target dir if empty
 	Progress     float64
 	ETA          time.Time
 	LastProgress time.Time
 	StartTime    time.Time
+	Attempts     int // Download attempts made, including retries
 
 	// Mutex to protect access to downloaded bytes counter
 	mu         sync.Mutex
 	downloaded int64
 }
 
+// FileAttempts records how many download attempts a file of a transfer took.
+type FileAttempts struct {
+	FileID   int64
+	Name     string
+	Attempts int
+	Failed   bool
+}
+
+// TransferEvent describes a transfer to completion, failure and cleanup
+// hooks. Category and Path reflect where the transfer's files were written.
+type TransferEvent struct {
+	ID       int64
+	Name     string
+	Hash     string
+	FileID   int64
+	Category string
+	Path     string // Local directory of the transfer below the target dir
+}
+
 // TransferLifecycleState represents the possible states of a transfer
 type TransferLifecycleState int32
 
@@ -60,15 +85,20 @@ func (s TransferLifecycleState) String() string {
 }
 
 // TransferContext tracks the complete state of a transfer.
-// Write-once fields (ID, Name, FileID, TotalFiles) are safe to read without locking.
+// Write-once fields (ID, Name, FileID, TotalFiles, StartTime) are safe to read without locking.
 // All mutable fields are unexported and accessed through thread-safe methods.
 type TransferContext struct {
 	ID         int64
 	Name       string
 	FileID     int64
 	TotalFiles int32
+	StartTime  time.Time
 
 	// Mutable fields — access only via methods or under mu from same package.
+	hash           string
+	category       string
+	path           string
+	fileAttempts   map[int64]FileAttempts // Files that needed more than one attempt or failed
 	completedFiles int32
 	failedFiles    int32
 	totalSize      int64   // Total size of all files in bytes
@@ -76,6 +106,7 @@ type TransferContext struct {
 	localSpeed     float64 // Current local download speed in bytes/sec
 	localETA       time.Time
 	state          TransferLifecycleState
+	failedAt       time.Time // When all files were accounted for with some failed
 	err            error
 	mu             sync.RWMutex
 }
@@ -111,6 +142,96 @@ func (tc *TransferContext) SetTotalSize(size int64) {
 	tc.mu.Unlock()
 }
 
+// SetHash records the torrent hash of the transfer.
+func (tc *TransferContext) SetHash(hash string) {
+	tc.mu.Lock()
+	tc.hash = hash
+	tc.mu.Unlock()
+}
+
+// GetHash returns the torrent hash of the transfer, if known.
+func (tc *TransferContext) GetHash() string {
+	tc.mu.RLock()
+	h := tc.hash
+	tc.mu.RUnlock()
+	return h
+}
+
+// SetLocation records the category and local path the transfer's files are
+// written to.
+func (tc *TransferContext) SetLocation(category, path string) {
+	tc.mu.Lock()
+	tc.category = category
+	tc.path = path
+	tc.mu.Unlock()
+}
+
+// Event returns a TransferEvent describing the transfer.
+func (tc *TransferContext) Event() TransferEvent {
+	tc.mu.RLock()
+	defer tc.mu.RUnlock()
+	return tc.eventLocked()
+}
+
+// eventLocked is Event for callers already holding tc.mu.
+func (tc *TransferContext) eventLocked() TransferEvent {
+	return TransferEvent{
+		ID:       tc.ID,
+		Name:     tc.Name,
+		Hash:     tc.hash,
+		FileID:   tc.FileID,
+		Category: tc.category,
+		Path:     tc.path,
+	}
+}
+
+// RecordFileAttempts stores the number of download attempts for a file.
+// Files that succeeded on the first attempt are not tracked.
+func (tc *TransferContext) RecordFileAttempts(fileID int64, name string, attempts int, failed bool) {
+	if attempts <= 1 && !failed {
+		return
+	}
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	if tc.fileAttempts == nil {
+		tc.fileAttempts = make(map[int64]FileAttempts)
+	}
+	prev := tc.fileAttempts[fileID]
+	tc.fileAttempts[fileID] = FileAttempts{
+		FileID:   fileID,
+		Name:     name,
+		Attempts: prev.Attempts + attempts,
+		Failed:   failed,
+	}
+}
+
+// GetFileAttempts returns the files that needed retries or failed.
+func (tc *TransferContext) GetFileAttempts() []FileAttempts {
+	tc.mu.RLock()
+	defer tc.mu.RUnlock()
+	result := make([]FileAttempts, 0, len(tc.fileAttempts))
+	for _, fa := range tc.fileAttempts {
+		result = append(result, fa)
+	}
+	return result
+}
+
+// failedFilesSummary describes failed files, e.g. "2 files failed after 6
+// attempts". The caller must hold tc.mu.
+func (tc *TransferContext) failedFilesSummary() string {
+	files, attempts := 0, 0
+	for _, fa := range tc.fileAttempts {
+		if fa.Failed {
+			files++
+			attempts += fa.Attempts
+		}
+	}
+	if files == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d files failed after %d attempts", files, attempts)
+}
+
 // GetProgress returns a snapshot of download progress counters.
 func (tc *TransferContext) GetProgress() (downloadedSize, totalSize int64, completedFiles, failedFiles int32) {
 	tc.mu.RLock()
@@ -139,6 +260,15 @@ func (tc *TransferContext) GetState() TransferLifecycleState {
 	return s
 }
 
+// FailedSince returns when the transfer failed with all of its files
+// accounted for, or the zero time if it hasn't.
+func (tc *TransferContext) FailedSince() time.Time {
+	tc.mu.RLock()
+	t := tc.failedAt
+	tc.mu.RUnlock()
+	return t
+}
+
 // GetError returns the current error, if any.
 func (tc *TransferContext) GetError() error {
 	tc.mu.RLock()
@@ -0,0 +1,83 @@
+package download
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	grab "github.com/cavaliergopher/grab/v3"
+)
+
+// htmlSniffLen is the number of leading bytes inspected for an HTML error page
+const htmlSniffLen = 512
+
+// isHTMLFileName reports whether a file is expected to contain HTML, in which
+// case HTML responses are legitimate.
+func isHTMLFileName(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".html", ".htm", ".xhtml":
+		return true
+	}
+	return false
+}
+
+// looksLikeHTML reports whether data starts like an HTML document.
+func looksLikeHTML(data []byte) bool {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	return strings.HasPrefix(http.DetectContentType(data), "text/html")
+}
+
+// checkResponseContentType is a grab BeforeCopy hook that rejects responses
+// declaring an HTML body, which Put.io occasionally serves with a 200 status
+// instead of the file.
+func checkResponseContentType(resp *grab.Response) error {
+	if isHTMLFileName(finalPath(resp.Filename)) {
+		return nil
+	}
+	if isHTMLContentType(resp.HTTPResponse.Header.Get("Content-Type")) {
+		return NewInvalidContentError(filepath.Base(finalPath(resp.Filename)), "server returned an HTML page")
+	}
+	return nil
+}
+
+// isHTMLContentType reports whether a Content-Type header declares HTML.
+func isHTMLContentType(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
+
+// checkDownloadedContent is a grab AfterCopy hook that inspects the first
+// bytes of the written file for an HTML page served with a misleading
+// Content-Type. Offending files are removed so a retry starts from scratch.
+func checkDownloadedContent(resp *grab.Response) error {
+	if resp.DidResume {
+		return nil
+	}
+	return checkFileContent(resp.Filename, finalPath(resp.Filename))
+}
+
+// checkFileContent removes the file at path if it turns out to be an HTML
+// page although name isn't one.
+func checkFileContent(path, name string) error {
+	if isHTMLFileName(name) {
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil // the size check will catch missing files
+	}
+	head := make([]byte, htmlSniffLen)
+	n, _ := io.ReadFull(f, head)
+	f.Close()
+
+	if looksLikeHTML(head[:n]) {
+		os.Remove(path)
+		return NewInvalidContentError(filepath.Base(name), "downloaded body is an HTML page")
+	}
+	return nil
+}
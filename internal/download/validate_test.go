@@ -0,0 +1,87 @@
+package download
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	grab "github.com/cavaliergopher/grab/v3"
+)
+
+func TestLooksLikeHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want bool
+	}{
+		{"doctype", "<!DOCTYPE html><html><body>Error</body></html>", true},
+		{"html tag with leading whitespace", "\n  <html><head><title>502</title></head></html>", true},
+		{"utf8 bom", "\xef\xbb\xbf<!doctype html>", true},
+		{"matroska header", "\x1a\x45\xdf\xa3\x9f\x42\x86\x81\x01", false},
+		{"plain text", "Subtitle line 1\nSubtitle line 2", false},
+		{"empty", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := looksLikeHTML([]byte(tt.data)); got != tt.want {
+				t.Errorf("looksLikeHTML(%q) = %v, want %v", tt.data, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDownloadRejectsHTML(t *testing.T) {
+	tests := []struct {
+		name        string
+		file        string
+		contentType string
+		body        string
+		wantErr     bool
+	}{
+		{"html content type", "movie.mkv", "text/html; charset=utf-8", "<html>Error</html>", true},
+		{"html body with binary content type", "movie.mkv", "application/octet-stream", "<!DOCTYPE html><html></html>", true},
+		{"binary body", "movie.mkv", "application/octet-stream", "\x1a\x45\xdf\xa3 video data", false},
+		{"html file is allowed", "index.html", "text/html", "<html></html>", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			target := filepath.Join(t.TempDir(), tt.file)
+			req, err := grab.NewRequest(target, srv.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.BeforeCopy = checkResponseContentType
+			req.AfterCopy = checkDownloadedContent
+
+			err = grab.NewClient().Do(req).Err()
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			var downloadErr *DownloadError
+			if !errors.As(err, &downloadErr) || downloadErr.Type != "InvalidContent" {
+				t.Fatalf("expected InvalidContent error, got %v", err)
+			}
+			if !isTransientError(err) {
+				t.Error("expected invalid content error to be transient")
+			}
+			if info, err := os.Stat(target); err == nil && info.Size() > 0 {
+				t.Errorf("expected no HTML content left on disk, found %d bytes", info.Size())
+			}
+		})
+	}
+}
@@ -0,0 +1,353 @@
+package download
+
+import (
+	"slices"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// Actions taken when a transfer exceeds the queue timeout
+const (
+	QueueTimeoutActionCancel = "cancel" // cancel the transfer on Put.io
+	QueueTimeoutActionReport = "report" // keep the transfer but report it as errored to clients
+)
+
+// Actions taken when a transfer's local download makes no progress
+const (
+	TransferStallActionReenumerate = "reenumerate" // list the transfer's files again and queue missing ones
+	TransferStallActionFail        = "fail"        // fail the transfer
+)
+
+// Actions taken when a transfer with failed files exceeds the failed grace period
+const (
+	FailedTransferActionRequeue = "requeue" // process the transfer again, downloading the failed files
+	FailedTransferActionReport  = "report"  // give up and report the failure to clients
+	FailedTransferActionDelete  = "delete"  // give up, report the failure and delete the transfer on Put.io
+)
+
+// maxFailedRequeues is how often a failed transfer is requeued before it is
+// given up on as with FailedTransferActionReport
+const maxFailedRequeues = 3
+
+// stallSnapshot is the progress of a transfer when it was last seen advancing
+type stallSnapshot struct {
+	downloaded int64
+	completed  int32
+	failed     int32
+	since      time.Time
+}
+
+// queueTimeoutMessage is reported to clients for transfers that timed out in the queue
+const queueTimeoutMessage = "Timed out waiting in Put.io queue"
+
+// processQueuedTransfers tracks how long transfers have been sitting in
+// IN_QUEUE/WAITING and acts on those exceeding the configured queue timeout.
+func (p *TransferProcessor) processQueuedTransfers(now time.Time) {
+	timeout := p.manager.dlConfig.QueueTimeout
+	if timeout <= 0 {
+		return
+	}
+
+	queued := slices.Concat(p.transfers["IN_QUEUE"], p.transfers["WAITING"])
+
+	// Forget transfers that have advanced past the queue
+	seen := make(map[int64]bool, len(queued))
+	for _, t := range queued {
+		seen[t.ID] = true
+	}
+	for id := range p.queuedSince {
+		if !seen[id] {
+			delete(p.queuedSince, id)
+		}
+	}
+	p.mu.Lock()
+	for id := range p.queueTimedOut {
+		if !seen[id] {
+			delete(p.queueTimedOut, id)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, t := range queued {
+		since, tracked := p.queuedSince[t.ID]
+		if !tracked {
+			p.queuedSince[t.ID] = now
+			continue
+		}
+
+		waited := now.Sub(since)
+		if waited < timeout {
+			continue
+		}
+
+		switch p.manager.dlConfig.QueueTimeoutAction {
+		case QueueTimeoutActionReport:
+			p.mu.Lock()
+			reported := p.queueTimedOut[t.ID]
+			p.queueTimedOut[t.ID] = true
+			p.mu.Unlock()
+			if reported {
+				continue
+			}
+			log.Warn("transfers").
+				Str("name", t.Name).
+				Int64("id", t.ID).
+				Str("status", t.Status).
+				Dur("waited", waited).
+				Msg("Transfer timed out in queue, reporting as errored")
+		default:
+			if err := p.manager.client.DeleteTransfer(p.manager.Context(), t.ID); err != nil {
+				log.Error("transfers").
+					Str("name", t.Name).
+					Int64("id", t.ID).
+					Err(err).
+					Msg("Failed to cancel transfer stuck in queue")
+				continue
+			}
+			delete(p.queuedSince, t.ID)
+			log.Warn("transfers").
+				Str("name", t.Name).
+				Int64("id", t.ID).
+				Str("status", t.Status).
+				Dur("waited", waited).
+				Msg("Cancelled transfer stuck in queue")
+		}
+	}
+}
+
+// transferError returns the error reported for a transfer on top of the one
+// from Put.io, or "" if there is none.
+func (p *TransferProcessor) transferError(transferID int64) string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.queueTimedOut[transferID] {
+		return queueTimeoutMessage
+	}
+	return ""
+}
+
+// lowAvailability tracks a transfer whose availability on Put.io is below
+// the threshold
+type lowAvailability struct {
+	since  time.Time
+	warned bool
+}
+
+// processLowAvailabilityTransfers tracks transfers Put.io is still fetching
+// whose availability is below the threshold, i.e. torrents lacking seeders.
+// Once one stays that low for the grace period it is reported, and with
+// CancelLowAvailability cancelled on Put.io.
+func (p *TransferProcessor) processLowAvailabilityTransfers(now time.Time) {
+	grace := p.manager.dlConfig.LowAvailabilityGrace
+	if grace <= 0 {
+		return
+	}
+	threshold := p.manager.availabilityThreshold()
+
+	low := make(map[int64]bool)
+	for _, t := range slices.Concat(p.transfers["PREPARING"], p.transfers["DOWNLOADING"]) {
+		if t.Availability >= threshold {
+			continue
+		}
+		low[t.ID] = true
+
+		tracked, ok := p.lowAvailability[t.ID]
+		if !ok {
+			p.lowAvailability[t.ID] = lowAvailability{since: now}
+			continue
+		}
+		waited := now.Sub(tracked.since)
+		if waited < grace {
+			continue
+		}
+
+		if !p.manager.dlConfig.CancelLowAvailability {
+			if !tracked.warned {
+				log.Warn("transfers").
+					Str("name", t.Name).
+					Int64("id", t.ID).
+					Int("availability", t.Availability).
+					Int("threshold", threshold).
+					Dur("waited", waited).
+					Msg("Transfer has had low availability for a long time, it may never finish")
+				tracked.warned = true
+				p.lowAvailability[t.ID] = tracked
+			}
+			continue
+		}
+
+		if err := p.manager.client.DeleteTransfer(p.manager.Context(), t.ID); err != nil {
+			log.Error("transfers").
+				Str("name", t.Name).
+				Int64("id", t.ID).
+				Err(err).
+				Msg("Failed to cancel transfer with low availability")
+			continue
+		}
+		delete(p.lowAvailability, t.ID)
+		log.Warn("transfers").
+			Str("name", t.Name).
+			Int64("id", t.ID).
+			Int("availability", t.Availability).
+			Int("threshold", threshold).
+			Dur("waited", waited).
+			Msg("Cancelled transfer with low availability")
+	}
+
+	// Forget transfers that recovered, finished or are gone
+	for id := range p.lowAvailability {
+		if !low[id] {
+			delete(p.lowAvailability, id)
+		}
+	}
+}
+
+// processStalledTransfers acts on downloading transfers that have no file
+// queued or downloading and whose downloaded bytes and finished files haven't
+// advanced for the configured stall timeout. This catches transfers that are
+// stuck as a whole, e.g. because a file was never queued, which the
+// per-download stall monitor cannot see.
+func (p *TransferProcessor) processStalledTransfers(now time.Time) {
+	timeout := p.manager.dlConfig.TransferStallTimeout
+	if timeout <= 0 {
+		return
+	}
+
+	seen := make(map[int64]bool)
+	p.manager.coordinator.RangeTransfers(func(id int64, ctx *TransferContext) bool {
+		if ctx.GetState() != TransferLifecycleDownloading {
+			return true
+		}
+		seen[id] = true
+
+		// Files waiting for a worker or downloading are not a stall of the
+		// transfer; hung downloads are left to the per-download monitor
+		downloaded, _, completed, failed := ctx.GetProgress()
+		last, tracked := p.stallProgress[id]
+		if !tracked || p.hasActiveFiles(id) ||
+			downloaded != last.downloaded || completed != last.completed || failed != last.failed {
+			p.stallProgress[id] = stallSnapshot{downloaded: downloaded, completed: completed, failed: failed, since: now}
+			return true
+		}
+
+		stalled := now.Sub(last.since)
+		if stalled < timeout {
+			return true
+		}
+
+		log.Warn("transfers").
+			Str("name", ctx.Name).
+			Int64("id", id).
+			Int64("downloaded", downloaded).
+			Int32("completed_files", completed).
+			Int32("total_files", ctx.TotalFiles).
+			Dur("stalled", stalled).
+			Str("action", p.manager.dlConfig.TransferStallAction).
+			Msg("Transfer made no progress")
+
+		delete(p.stallProgress, id)
+		switch p.manager.dlConfig.TransferStallAction {
+		case TransferStallActionFail:
+			p.manager.coordinator.FailTransfer(id, NewTransferStalledError(id, stalled))
+		default:
+			// Without a context the transfer is processed from scratch on
+			// this scan: files on disk are skipped, missing ones queued
+			p.manager.coordinator.ForgetTransfer(id)
+		}
+		return true
+	})
+
+	for id := range p.stallProgress {
+		if !seen[id] {
+			delete(p.stallProgress, id)
+		}
+	}
+}
+
+// processFailedTransfers acts on transfers that finished with failed files
+// and have stayed failed for the configured grace period. Nothing else
+// re-drives such transfers, so without this they would linger forever.
+func (p *TransferProcessor) processFailedTransfers(now time.Time) {
+	grace := p.manager.dlConfig.FailedTransferGrace
+	if grace <= 0 {
+		return
+	}
+
+	for id := range p.failedRequeues {
+		if p.isTransferProcessed(id) {
+			delete(p.failedRequeues, id)
+		}
+	}
+
+	var expired []*TransferContext
+	p.manager.coordinator.RangeTransfers(func(id int64, ctx *TransferContext) bool {
+		// Transfers already given up on carry an error
+		if ctx.GetState() != TransferLifecycleFailed || ctx.GetError() != nil {
+			return true
+		}
+		failedAt := ctx.FailedSince()
+		if failedAt.IsZero() || now.Sub(failedAt) < grace || p.hasActiveFiles(id) {
+			return true
+		}
+		expired = append(expired, ctx)
+		return true
+	})
+
+	for _, ctx := range expired {
+		_, _, completed, failed := ctx.GetProgress()
+		action := p.manager.dlConfig.FailedTransferAction
+		requeues := p.failedRequeues[ctx.ID]
+		if action == FailedTransferActionRequeue && requeues >= maxFailedRequeues {
+			action = FailedTransferActionReport
+		}
+
+		log.Warn("transfers").
+			Str("name", ctx.Name).
+			Int64("id", ctx.ID).
+			Int32("completed_files", completed).
+			Int32("failed_files", failed).
+			Int32("total_files", ctx.TotalFiles).
+			Dur("failed_for", now.Sub(ctx.FailedSince())).
+			Int("requeues", requeues).
+			Str("action", action).
+			Msg("Transfer stayed failed past the grace period")
+
+		switch action {
+		case FailedTransferActionRequeue:
+			// Without a context the transfer is processed from scratch on
+			// the next scan: files on disk are skipped, failed ones queued
+			p.failedRequeues[ctx.ID] = requeues + 1
+			p.manager.coordinator.ForgetTransfer(ctx.ID)
+		default:
+			delete(p.failedRequeues, ctx.ID)
+			p.manager.coordinator.AbandonTransfer(ctx.ID, NewFilesFailedError(failed, ctx.TotalFiles))
+			if action != FailedTransferActionDelete {
+				continue
+			}
+			if err := p.manager.client.DeleteTransfer(p.manager.Context(), ctx.ID); err != nil {
+				log.Error("transfers").
+					Str("name", ctx.Name).
+					Int64("id", ctx.ID).
+					Err(err).
+					Msg("Failed to delete failed transfer")
+				continue
+			}
+			log.Info("transfers").
+				Str("name", ctx.Name).
+				Int64("id", ctx.ID).
+				Msg("Deleted failed transfer")
+		}
+	}
+}
+
+// hasActiveFiles reports whether any file of a transfer is queued or
+// downloading.
+func (p *TransferProcessor) hasActiveFiles(transferID int64) bool {
+	active := false
+	p.manager.activeFiles.Range(func(_, value any) bool {
+		active = value.(int64) == transferID
+		return !active
+	})
+	return active
+}
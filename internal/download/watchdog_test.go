@@ -0,0 +1,308 @@
+package download
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elsbrock/go-putio"
+)
+
+// fakePutioClient is an in-memory PutioClient for processor tests.
+type fakePutioClient struct {
+	mu           sync.Mutex
+	transfers    []*putio.Transfer
+	files        map[int64][]*putio.File
+	paths        map[int64]map[int64]string // transfer file id → file id → path within the transfer
+	deleted      []int64
+	retried      []int64
+	listed       []int64 // file ids passed to GetAllTransferFiles
+	deletedFiles []int64
+}
+
+func (f *fakePutioClient) GetTransfers(ctx context.Context) ([]*putio.Transfer, error) {
+	return f.transfers, nil
+}
+
+func (f *fakePutioClient) GetAllTransferFiles(ctx context.Context, fileID int64) ([]*putio.File, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.listed = append(f.listed, fileID)
+	return f.files[fileID], nil
+}
+
+func (f *fakePutioClient) GetAllTransferFilePaths(ctx context.Context, fileID int64) ([]*putio.File, map[int64]string, error) {
+	files, err := f.GetAllTransferFiles(ctx, fileID)
+	return files, f.paths[fileID], err
+}
+
+func (f *fakePutioClient) RetryTransfer(ctx context.Context, transferID int64) (*putio.Transfer, error) {
+	f.retried = append(f.retried, transferID)
+	return &putio.Transfer{ID: transferID}, nil
+}
+
+func (f *fakePutioClient) DeleteTransfer(ctx context.Context, transferID int64) error {
+	f.deleted = append(f.deleted, transferID)
+	return nil
+}
+
+func (f *fakePutioClient) DeleteFile(ctx context.Context, fileID int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.deletedFiles = append(f.deletedFiles, fileID)
+	return nil
+}
+
+func (f *fakePutioClient) GetDownloadURL(ctx context.Context, fileID int64) (string, error) {
+	return "", nil
+}
+
+func TestProcessQueuedTransfersCancel(t *testing.T) {
+	m := newTestManager()
+	client := &fakePutioClient{}
+	m.client = client
+	m.dlConfig.QueueTimeout = time.Hour
+
+	p := m.processor
+	now := time.Now()
+	p.transfers = map[string][]*putio.Transfer{
+		"IN_QUEUE": {{ID: 1, Name: "stuck", Status: "IN_QUEUE"}},
+		"WAITING":  {{ID: 2, Name: "waiting", Status: "WAITING"}},
+	}
+
+	// First sighting only starts the clock
+	p.processQueuedTransfers(now)
+	if len(client.deleted) != 0 {
+		t.Fatalf("expected no cancellations on first sighting, got %v", client.deleted)
+	}
+
+	// Transfer 2 leaves the queue, transfer 1 stays stuck past the timeout
+	p.transfers = map[string][]*putio.Transfer{
+		"IN_QUEUE":    {{ID: 1, Name: "stuck", Status: "IN_QUEUE"}},
+		"DOWNLOADING": {{ID: 2, Name: "waiting", Status: "DOWNLOADING"}},
+	}
+	p.processQueuedTransfers(now.Add(2 * time.Hour))
+
+	if len(client.deleted) != 1 || client.deleted[0] != 1 {
+		t.Fatalf("expected transfer 1 to be cancelled, got %v", client.deleted)
+	}
+	if _, tracked := p.queuedSince[2]; tracked {
+		t.Error("expected transfer 2 to no longer be tracked after leaving the queue")
+	}
+}
+
+func TestProcessQueuedTransfersReport(t *testing.T) {
+	m := newTestManager()
+	client := &fakePutioClient{}
+	m.client = client
+	m.dlConfig.QueueTimeout = time.Hour
+	m.dlConfig.QueueTimeoutAction = QueueTimeoutActionReport
+
+	p := m.processor
+	now := time.Now()
+	p.transfers = map[string][]*putio.Transfer{
+		"IN_QUEUE": {{ID: 1, Name: "stuck", Status: "IN_QUEUE"}},
+	}
+	p.processQueuedTransfers(now)
+
+	stuck := &putio.Transfer{ID: 1, Name: "stuck", Status: "IN_QUEUE"}
+	p.transfers = map[string][]*putio.Transfer{"IN_QUEUE": {stuck}}
+	p.processQueuedTransfers(now.Add(2 * time.Hour))
+
+	if len(client.deleted) != 0 {
+		t.Fatalf("expected no cancellations in report mode, got %v", client.deleted)
+	}
+	if stuck.ErrorMessage != "" {
+		t.Errorf("transfer shared with clients was modified: %q", stuck.ErrorMessage)
+	}
+	if got := m.TransferError(1); got != queueTimeoutMessage {
+		t.Errorf("TransferError() = %q, want %q", got, queueTimeoutMessage)
+	}
+
+	// The report is dropped once the transfer leaves the queue
+	p.transfers = map[string][]*putio.Transfer{"DOWNLOADING": {{ID: 1, Name: "stuck", Status: "DOWNLOADING"}}}
+	p.processQueuedTransfers(now.Add(3 * time.Hour))
+	if got := m.TransferError(1); got != "" {
+		t.Errorf("TransferError() = %q after leaving the queue, want none", got)
+	}
+}
+
+func TestProcessQueuedTransfersDisabled(t *testing.T) {
+	m := newTestManager()
+	client := &fakePutioClient{}
+	m.client = client
+
+	p := m.processor
+	p.transfers = map[string][]*putio.Transfer{
+		"IN_QUEUE": {{ID: 1, Name: "stuck", Status: "IN_QUEUE"}},
+	}
+	p.processQueuedTransfers(time.Now())
+
+	if len(p.queuedSince) != 0 {
+		t.Error("expected no tracking when queue timeout is disabled")
+	}
+}
+
+func TestProcessLowAvailabilityTransfers(t *testing.T) {
+	for _, cancel := range []bool{false, true} {
+		m := newTestManager()
+		client := &fakePutioClient{}
+		m.client = client
+		m.dlConfig.LowAvailabilityGrace = time.Hour
+		m.dlConfig.CancelLowAvailability = cancel
+
+		p := m.processor
+		now := time.Now()
+		p.transfers = map[string][]*putio.Transfer{
+			"PREPARING":   {{ID: 1, Name: "dead", Status: "PREPARING", Availability: 0}},
+			"DOWNLOADING": {{ID: 2, Name: "seeded", Status: "DOWNLOADING", Availability: 100}, {ID: 3, Name: "recovers", Status: "DOWNLOADING", Availability: 2}},
+		}
+
+		// First sighting only starts the clock
+		p.processLowAvailabilityTransfers(now)
+		if len(client.deleted) != 0 || len(p.lowAvailability) != 2 {
+			t.Fatalf("cancel=%v: tracked %v and cancelled %v on first sighting", cancel, p.lowAvailability, client.deleted)
+		}
+
+		// Transfer 3 finds seeders, transfer 1 stays dead past the grace period
+		p.transfers["DOWNLOADING"][1].Availability = 50
+		p.processLowAvailabilityTransfers(now.Add(2 * time.Hour))
+
+		if _, tracked := p.lowAvailability[3]; tracked {
+			t.Errorf("cancel=%v: expected transfer 3 to no longer be tracked", cancel)
+		}
+		if cancel {
+			if len(client.deleted) != 1 || client.deleted[0] != 1 {
+				t.Errorf("expected transfer 1 to be cancelled, got %v", client.deleted)
+			}
+			continue
+		}
+		if len(client.deleted) != 0 {
+			t.Errorf("expected no cancellations without --cancel-low-availability, got %v", client.deleted)
+		}
+		if !p.lowAvailability[1].warned {
+			t.Error("expected transfer 1 to be reported")
+		}
+	}
+}
+
+func TestCheckTransfersMarksManagerReady(t *testing.T) {
+	m := newTestManager()
+	m.client = &fakePutioClient{}
+
+	if m.Ready() {
+		t.Fatal("manager should not be ready before the first transfer check")
+	}
+	m.processor.checkTransfers(context.Background())
+	if !m.Ready() {
+		t.Error("manager should be ready after the first transfer check")
+	}
+}
+
+func TestProcessStalledTransfers(t *testing.T) {
+	tests := []struct {
+		name       string
+		action     string
+		active     bool // a file of the transfer is queued or downloading
+		progress   bool // the transfer advances between scans
+		wantState  TransferLifecycleState
+		wantExists bool
+	}{
+		{"reenumerate forgets context", TransferStallActionReenumerate, false, false, 0, false},
+		{"fail", TransferStallActionFail, false, false, TransferLifecycleFailed, true},
+		{"active files are not a stall", TransferStallActionFail, true, false, TransferLifecycleDownloading, true},
+		{"progress resets the timer", TransferStallActionFail, false, true, TransferLifecycleDownloading, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestManager()
+			m.dlConfig.TransferStallTimeout = time.Minute
+			m.dlConfig.TransferStallAction = tt.action
+			ctx := m.coordinator.InitiateTransfer(1, "show", 10, 2)
+			if err := m.coordinator.StartDownload(1); err != nil {
+				t.Fatal(err)
+			}
+			if tt.active {
+				m.activeFiles.Store(int64(100), int64(1))
+			}
+
+			p := m.processor
+			now := time.Now()
+			for i := range 3 {
+				if tt.progress {
+					ctx.AddDownloadedBytes(1)
+				}
+				p.processStalledTransfers(now.Add(time.Duration(i) * 45 * time.Second))
+			}
+
+			got, exists := m.coordinator.GetTransferContext(1)
+			if exists != tt.wantExists {
+				t.Fatalf("context exists = %v, want %v", exists, tt.wantExists)
+			}
+			if exists && got.GetState() != tt.wantState {
+				t.Errorf("state = %v, want %v", got.GetState(), tt.wantState)
+			}
+		})
+	}
+}
+
+func TestProcessFailedTransfers(t *testing.T) {
+	tests := []struct {
+		name        string
+		action      string
+		requeues    int
+		wantExists  bool
+		wantErr     bool
+		wantDeleted bool
+	}{
+		{"requeue forgets context", FailedTransferActionRequeue, 0, false, false, false},
+		{"requeue gives up eventually", FailedTransferActionRequeue, maxFailedRequeues, true, true, false},
+		{"report", FailedTransferActionReport, 0, true, true, false},
+		{"delete", FailedTransferActionDelete, 0, true, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestManager()
+			client := &fakePutioClient{}
+			m.client = client
+			m.dlConfig.FailedTransferAction = tt.action
+			m.coordinator.InitiateTransfer(1, "show", 10, 2)
+			if err := m.coordinator.StartDownload(1); err != nil {
+				t.Fatal(err)
+			}
+			m.coordinator.FileCompleted(1)
+			m.coordinator.FileFailure(1)
+
+			p := m.processor
+			p.failedRequeues[1] = tt.requeues
+
+			// Nothing happens within the grace period
+			p.processFailedTransfers(time.Now())
+			if _, exists := m.coordinator.GetTransferContext(1); !exists {
+				t.Fatal("transfer acted upon within the grace period")
+			}
+
+			p.processFailedTransfers(time.Now().Add(time.Hour))
+			ctx, exists := m.coordinator.GetTransferContext(1)
+			if exists != tt.wantExists {
+				t.Fatalf("context exists = %v, want %v", exists, tt.wantExists)
+			}
+			if exists && (ctx.GetError() != nil) != tt.wantErr {
+				t.Errorf("error = %v, wantErr %v", ctx.GetError(), tt.wantErr)
+			}
+			if (len(client.deleted) > 0) != tt.wantDeleted {
+				t.Errorf("deleted = %v, wantDeleted %v", client.deleted, tt.wantDeleted)
+			}
+
+			// A transfer given up on is not acted upon again
+			client.deleted = nil
+			p.processFailedTransfers(time.Now().Add(2 * time.Hour))
+			if len(client.deleted) != 0 {
+				t.Errorf("transfer deleted again: %v", client.deleted)
+			}
+		})
+	}
+}
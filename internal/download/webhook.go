@@ -0,0 +1,114 @@
+package download
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// webhookTimeout bounds a single webhook delivery
+const webhookTimeout = 10 * time.Second
+
+// WebhookSignatureHeader carries the hex HMAC-SHA256 of the request body,
+// prefixed with "sha256=", when a webhook secret is configured
+const WebhookSignatureHeader = "X-Plundrio-Signature"
+
+// WebhookPayload is the JSON body POSTed when a transfer has been processed.
+type WebhookPayload struct {
+	TransferID     int64  `json:"transferID"`
+	Name           string `json:"name"`
+	Hash           string `json:"hash,omitempty"`
+	FileID         int64  `json:"fileID"`
+	Category       string `json:"category,omitempty"`
+	Path           string `json:"path,omitempty"`
+	TotalSize      int64  `json:"totalSize"`
+	CompletedFiles int32  `json:"completedFiles"`
+}
+
+// webhookNotifier POSTs a payload to a URL for every processed transfer.
+type webhookNotifier struct {
+	url    string
+	secret []byte
+	client *http.Client
+}
+
+// newWebhookNotifier returns a notifier for url, or nil if url is empty.
+func newWebhookNotifier(url, secret string) *webhookNotifier {
+	if url == "" {
+		return nil
+	}
+	return &webhookNotifier{
+		url:    url,
+		secret: []byte(secret),
+		client: &http.Client{Timeout: webhookTimeout},
+	}
+}
+
+// Send delivers a payload, signing it if a secret is configured.
+func (w *webhookNotifier) Send(ctx context.Context, payload WebhookPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook payload: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(w.secret) > 0 {
+		mac := hmac.New(sha256.New, w.secret)
+		mac.Write(body)
+		req.Header.Set(WebhookSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
+
+// notifyWebhook sends the webhook for a processed transfer in the
+// background, so that a slow endpoint never holds up other transfers.
+// Failures are only logged.
+func (m *Manager) notifyWebhook(event TransferEvent) {
+	payload := WebhookPayload{
+		TransferID: event.ID,
+		Name:       event.Name,
+		Hash:       event.Hash,
+		FileID:     event.FileID,
+		Category:   event.Category,
+		Path:       event.Path,
+	}
+	if ctx, ok := m.coordinator.GetTransferContext(event.ID); ok {
+		_, payload.TotalSize, payload.CompletedFiles, _ = ctx.GetProgress()
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+		defer cancel()
+		if err := m.webhook.Send(ctx, payload); err != nil {
+			log.Warn("webhook").
+				Int64("transfer_id", event.ID).
+				Str("name", event.Name).
+				Err(err).
+				Msg("Failed to send transfer webhook")
+			return
+		}
+		log.Debug("webhook").
+			Int64("transfer_id", event.ID).
+			Msg("Sent transfer webhook")
+	}()
+}
@@ -0,0 +1,74 @@
+package download
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNotifyWebhook(t *testing.T) {
+	type delivery struct {
+		payload   WebhookPayload
+		signature string
+		body      []byte
+	}
+	deliveries := make(chan delivery, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var p WebhookPayload
+		if err := json.Unmarshal(body, &p); err != nil {
+			t.Errorf("invalid webhook body: %v", err)
+		}
+		deliveries <- delivery{p, r.Header.Get(WebhookSignatureHeader), body}
+	}))
+	defer srv.Close()
+
+	m := newTestManager()
+	m.webhook = newWebhookNotifier(srv.URL, "secret")
+	m.coordinator.RegisterCompletionHook(m.notifyWebhook)
+
+	ctx := m.coordinator.InitiateTransfer(1, "My.Show.S01", 100, 2)
+	ctx.SetTotalSize(2048)
+	m.coordinator.StartDownload(1)
+	m.coordinator.FileCompleted(1)
+	m.coordinator.FileCompleted(1)
+	if err := m.coordinator.CompleteTransfer(1); err != nil {
+		t.Fatalf("CompleteTransfer failed: %v", err)
+	}
+
+	select {
+	case d := <-deliveries:
+		want := WebhookPayload{TransferID: 1, Name: "My.Show.S01", FileID: 100, TotalSize: 2048, CompletedFiles: 2}
+		if d.payload != want {
+			t.Errorf("payload = %+v, want %+v", d.payload, want)
+		}
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write(d.body)
+		if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); d.signature != want {
+			t.Errorf("signature = %q, want %q", d.signature, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook was not delivered")
+	}
+}
+
+func TestWebhookSendFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	w := newWebhookNotifier(srv.URL, "")
+	if err := w.Send(t.Context(), WebhookPayload{}); err == nil {
+		t.Error("expected an error for a failing webhook")
+	}
+	if newWebhookNotifier("", "secret") != nil {
+		t.Error("expected nil notifier without URL")
+	}
+}
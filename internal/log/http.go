@@ -0,0 +1,63 @@
+package log
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// httpTransport is an http.RoundTripper that logs every request it sends
+type httpTransport struct {
+	base      http.RoundTripper
+	component string
+}
+
+// NewHTTPTransport wraps base so that every request's method, URL, status
+// and duration is logged at trace level under component. Credentials in the
+// URL are redacted. A nil base uses http.DefaultTransport.
+func NewHTTPTransport(base http.RoundTripper, component string) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &httpTransport{base: base, component: component}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *httpTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+
+	event := Trace(t.component).
+		Str("method", req.Method).
+		Str("url", RedactURL(req.URL)).
+		Dur("duration", time.Since(start))
+	if err != nil {
+		event.Err(err).Msg("HTTP request failed")
+		return resp, err
+	}
+	event.Int("status", resp.StatusCode).Msg("HTTP request")
+	return resp, nil
+}
+
+// RedactURL returns u as a string with its user info and the values of
+// token-like query parameters replaced by "REDACTED".
+func RedactURL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	redacted := *u
+	if redacted.User != nil {
+		redacted.User = url.User("REDACTED")
+	}
+	if redacted.RawQuery != "" {
+		query := redacted.Query()
+		for key := range query {
+			if strings.Contains(strings.ToLower(key), "token") {
+				query.Set(key, "REDACTED")
+			}
+		}
+		redacted.RawQuery = query.Encode()
+	}
+	return redacted.String()
+}
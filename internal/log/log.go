@@ -15,12 +15,18 @@ type LogLevel string
 
 const (
 	// Log levels
+	LevelTrace LogLevel = "trace"
 	LevelDebug LogLevel = "debug"
 	LevelInfo  LogLevel = "info"
 	LevelWarn  LogLevel = "warn"
 	LevelError LogLevel = "error"
 	LevelFatal LogLevel = "fatal"
+	LevelPanic LogLevel = "panic"
 	LevelNone  LogLevel = "none"
+
+	// LevelPretty logs at info level and always colorizes the output, even
+	// when it isn't written to a terminal
+	LevelPretty LogLevel = "pretty"
 )
 
 func init() {
@@ -36,11 +42,11 @@ func init() {
 
 // configureLogger sets up the logger with the specified level
 func configureLogger(level LogLevel) {
-	// Configure output writer with colors enabled by default
+	// Colors are only used on terminals, unless pretty output was requested
 	output := zerolog.ConsoleWriter{
 		Out:        os.Stdout,
 		TimeFormat: time.RFC3339,
-		NoColor:    false, // Always use colors
+		NoColor:    level != LevelPretty && !IsTerminal(os.Stdout),
 	}
 
 	log = zerolog.New(output).With().Timestamp().Logger()
@@ -57,30 +63,50 @@ func getLogLevel() LogLevel {
 	return LevelInfo
 }
 
+// IsTerminal reports whether f is an interactive terminal
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
 // setLogLevel sets the zerolog level
 func setLogLevel(level LogLevel) {
+	zerolog.SetGlobalLevel(zerologLevel(level))
+}
+
+// zerologLevel maps a log level to zerolog's, defaulting to info
+func zerologLevel(level LogLevel) zerolog.Level {
 	switch level {
+	case LevelTrace:
+		return zerolog.TraceLevel
 	case LevelDebug:
-		zerolog.SetGlobalLevel(zerolog.DebugLevel)
-	case LevelInfo:
-		zerolog.SetGlobalLevel(zerolog.InfoLevel)
+		return zerolog.DebugLevel
+	case LevelInfo, LevelPretty:
+		return zerolog.InfoLevel
 	case LevelWarn:
-		zerolog.SetGlobalLevel(zerolog.WarnLevel)
+		return zerolog.WarnLevel
 	case LevelError:
-		zerolog.SetGlobalLevel(zerolog.ErrorLevel)
+		return zerolog.ErrorLevel
 	case LevelFatal:
-		zerolog.SetGlobalLevel(zerolog.FatalLevel)
+		return zerolog.FatalLevel
+	case LevelPanic:
+		return zerolog.PanicLevel
 	case LevelNone:
-		zerolog.SetGlobalLevel(zerolog.Disabled)
+		return zerolog.Disabled
 	default:
-		zerolog.SetGlobalLevel(zerolog.InfoLevel)
+		return zerolog.InfoLevel
 	}
 }
 
-// SetLevel sets the global log level
+// SetLevel sets the global log level. Levels are case-insensitive.
 func SetLevel(level LogLevel) {
 	// Reconfigure the logger
-	configureLogger(level)
+	configureLogger(LogLevel(strings.ToLower(strings.TrimSpace(string(level)))))
+}
+
+// Trace returns a new Trace level event logger with component context
+func Trace(component string) *zerolog.Event {
+	return log.Trace().Str("component", component)
 }
 
 // Debug returns a new Debug level event logger with component context
@@ -0,0 +1,34 @@
+package log
+
+import (
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestZerologLevel(t *testing.T) {
+	tests := []struct {
+		level LogLevel
+		want  zerolog.Level
+	}{
+		{LevelTrace, zerolog.TraceLevel},
+		{LevelDebug, zerolog.DebugLevel},
+		{LevelPretty, zerolog.InfoLevel},
+		{LevelPanic, zerolog.PanicLevel},
+		{LevelNone, zerolog.Disabled},
+		{"bogus", zerolog.InfoLevel},
+	}
+	for _, tt := range tests {
+		if got := zerologLevel(tt.level); got != tt.want {
+			t.Errorf("zerologLevel(%q) = %v, want %v", tt.level, got, tt.want)
+		}
+	}
+}
+
+func TestSetLevelCaseInsensitive(t *testing.T) {
+	defer SetLevel(LevelInfo)
+	SetLevel(" TRACE ")
+	if got := zerolog.GlobalLevel(); got != zerolog.TraceLevel {
+		t.Errorf("global level = %v, want trace", got)
+	}
+}
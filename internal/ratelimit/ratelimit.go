@@ -0,0 +1,82 @@
+// Package ratelimit provides the token bucket that caps both the combined
+// download rate and the rate of requests to Put.io.
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Bucket is a token bucket refilled at a fixed rate. Up to one second worth
+// of tokens, but at least one, may burst. Callers reserve tokens up front,
+// which may drive the bucket negative; later callers then queue behind the
+// debt in turn. A nil or zero Bucket is unlimited until SetRate gives it a
+// rate. It satisfies grab.RateLimiter.
+type Bucket struct {
+	mu     sync.Mutex
+	rate   float64 // tokens per second
+	tokens float64 // tokens available now, negative if reserved ahead
+	last   time.Time
+}
+
+// New returns a bucket for perSec tokens per second, or nil if it is 0 or
+// less, meaning unlimited.
+func New(perSec float64) *Bucket {
+	if perSec <= 0 {
+		return nil
+	}
+	return &Bucket{rate: perSec, tokens: max(perSec, 1), last: time.Now()}
+}
+
+// Reserve takes n tokens from the bucket and returns how long to wait
+// before they may be used.
+func (b *Bucket) Reserve(n float64, now time.Time) time.Duration {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.rate <= 0 {
+		return 0
+	}
+	b.tokens = min(max(b.rate, 1), b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens -= n
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// SetRate changes the rate to perSec tokens per second, 0 or less meaning
+// unlimited. Tokens accrued at the old rate, or owed, are carried over up to
+// the new burst; a bucket that was unlimited starts with a full burst.
+func (b *Bucket) SetRate(perSec float64, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.rate > 0 {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+	} else {
+		b.tokens = max(perSec, 1)
+	}
+	b.rate = max(perSec, 0)
+	b.tokens = min(b.tokens, max(b.rate, 1))
+	b.last = now
+}
+
+// WaitN blocks until n more tokens may be used or ctx is done.
+func (b *Bucket) WaitN(ctx context.Context, n int) error {
+	wait := b.Reserve(float64(n), time.Now())
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
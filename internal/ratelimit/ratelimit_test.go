@@ -0,0 +1,86 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBucketReserve(t *testing.T) {
+	if New(0) != nil {
+		t.Fatal("expected no bucket for an unlimited rate")
+	}
+	if wait := (*Bucket)(nil).Reserve(1000, time.Now()); wait != 0 {
+		t.Errorf("nil bucket waits %s, want 0", wait)
+	}
+
+	b := New(1000)
+	now := b.last
+	// One second worth of tokens is available right away, the rest queues
+	for _, tt := range []struct {
+		n    float64
+		want time.Duration
+	}{
+		{1000, 0},
+		{500, 500 * time.Millisecond},
+		{500, time.Second},
+	} {
+		if got := b.Reserve(tt.n, now); got != tt.want {
+			t.Errorf("Reserve(%v) = %s, want %s", tt.n, got, tt.want)
+		}
+	}
+
+	// The debt is paid off over time, but idle time doesn't bank more than a second
+	if got := b.Reserve(1000, now.Add(5*time.Second)); got != 0 {
+		t.Errorf("Reserve after idling = %s, want 0", got)
+	}
+	if got := b.Reserve(1000, now.Add(5*time.Second)); got != time.Second {
+		t.Errorf("Reserve beyond the burst = %s, want 1s", got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := b.WaitN(ctx, 1000); err == nil {
+		t.Error("WaitN ignored the cancelled context")
+	}
+}
+
+func TestBucketSlowRateBurst(t *testing.T) {
+	// Rates below one per second still let a single token through
+	b := New(0.5)
+	now := b.last
+	if wait := b.Reserve(1, now); wait != 0 {
+		t.Fatalf("first token waits %v, want 0", wait)
+	}
+	if wait := b.Reserve(1, now); wait != 2*time.Second {
+		t.Fatalf("second token waits %v, want 2s", wait)
+	}
+}
+
+func TestBucketSetRate(t *testing.T) {
+	var b Bucket
+	now := time.Now()
+	if wait := b.Reserve(1e9, now); wait != 0 {
+		t.Fatalf("zero bucket waits %s, want 0", wait)
+	}
+
+	// Limiting an unlimited bucket starts with a full burst
+	b.SetRate(1000, now)
+	if wait := b.Reserve(1000, now); wait != 0 {
+		t.Errorf("first second waits %s, want 0", wait)
+	}
+	if wait := b.Reserve(1000, now); wait != time.Second {
+		t.Errorf("Reserve beyond the burst = %s, want 1s", wait)
+	}
+
+	// The debt carries over to the new rate
+	b.SetRate(2000, now)
+	if wait := b.Reserve(1000, now); wait != time.Second {
+		t.Errorf("Reserve after doubling the rate = %s, want 1s", wait)
+	}
+
+	b.SetRate(0, now)
+	if wait := b.Reserve(1e9, now); wait != 0 {
+		t.Errorf("unlimited bucket waits %s, want 0", wait)
+	}
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/elsbrock/plundrio/internal/download"
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// TorrentSource is a magnet link or the contents of a .torrent file to be
+// added to Put.io.
+type TorrentSource struct {
+	Magnet  string
+	Torrent []byte
+	Name    string // file name the torrent is uploaded as
+}
+
+// ParseTorrentSource detects whether data is a magnet link or a bencoded
+// .torrent file and checks that an info-hash can be derived from it, so
+// malformed input is rejected before it reaches Put.io.
+func ParseTorrentSource(data []byte, name string) (TorrentSource, error) {
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("magnet:")) {
+		magnet := string(trimmed)
+		if len(parseMagnetHashes(magnet).all()) == 0 {
+			return TorrentSource{}, errors.New("magnet link has no valid info-hash")
+		}
+		return TorrentSource{Magnet: magnet}, nil
+	}
+
+	if _, err := parseTorrentHashes(data); err != nil {
+		return TorrentSource{}, fmt.Errorf("input is neither a magnet link nor a valid .torrent file: %w", err)
+	}
+	return TorrentSource{Torrent: data, Name: name}, nil
+}
+
+// AddTorrent adds src to the Put.io folder and returns the hash of the new
+// transfer, or "" if none is known.
+func AddTorrent(ctx context.Context, client PutioClient, folderID int64, src TorrentSource) (string, error) {
+	hash, _, err := addTorrent(ctx, client, folderID, src)
+	return hash, err
+}
+
+// addTorrent adds src to the Put.io folder. It returns the hash Put.io
+// reports, falling back to the locally computed one, along with all
+// info-hashes of the torrent.
+func addTorrent(ctx context.Context, client PutioClient, folderID int64, src TorrentSource) (string, infoHashes, error) {
+	var hash string
+	var hashes infoHashes
+
+	if src.Torrent != nil {
+		name := src.Name
+		if name == "" {
+			name = "unknown.torrent"
+		}
+		var err error
+		if hashes, err = parseTorrentHashes(src.Torrent); err != nil {
+			log.Debug("rpc").
+				Str("operation", "torrent-add").
+				Str("name", name).
+				Err(err).
+				Msg("Failed to compute info-hash of torrent file")
+		}
+		h, err := client.UploadFile(ctx, src.Torrent, name, folderID)
+		if err != nil {
+			return "", hashes, fmt.Errorf("failed to upload torrent: %w", err)
+		}
+		hash = download.NormalizeHash(h)
+	} else {
+		hashes = parseMagnetHashes(src.Magnet)
+		h, err := client.AddTransfer(ctx, src.Magnet, folderID)
+		if err != nil {
+			return "", hashes, fmt.Errorf("failed to add transfer: %w", err)
+		}
+		hash = download.NormalizeHash(h)
+	}
+
+	// Fall back to the locally computed hash if Put.io didn't report one
+	if hash == "" {
+		if all := hashes.all(); len(all) > 0 {
+			hash = all[0]
+		}
+	}
+	return hash, hashes, nil
+}
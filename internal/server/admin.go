@@ -0,0 +1,38 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// handleRescan makes the download manager fetch and process the transfer
+// list right away and answers with what changed, so that changes made in the
+// Put.io web UI can be picked up without waiting for the check interval.
+func (s *Server) handleRescan(w http.ResponseWriter, r *http.Request) {
+	if !tokenAuthorized(r, s.cfg.AdminToken) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="plundrio"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	summary, err := s.dlService.Rescan(r.Context())
+	if err != nil {
+		log.Error("server").Err(err).Msg("Rescan failed")
+		http.Error(w, "rescan failed: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	log.Info("server").
+		Interface("statuses", summary.Statuses).
+		Int("added", len(summary.Added)).
+		Int("removed", len(summary.Removed)).
+		Int("changed", len(summary.Changed)).
+		Msg("Rescanned transfers on request")
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(summary); err != nil {
+		log.Debug("server").Err(err).Msg("Failed to write rescan response")
+	}
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/elsbrock/plundrio/internal/config"
+	"github.com/elsbrock/plundrio/internal/download"
+)
+
+func TestHandleRescan(t *testing.T) {
+	summary := download.RescanSummary{
+		Statuses: map[string]int{"COMPLETED": 2, "DOWNLOADING": 1},
+		Added:    []int64{3},
+		Removed:  []int64{},
+		Changed:  []int64{1},
+	}
+	tests := []struct {
+		name      string
+		token     string
+		err       error
+		wantCode  int
+		wantCalls int
+	}{
+		{"no token", "", nil, http.StatusUnauthorized, 0},
+		{"wrong token", "nope", nil, http.StatusUnauthorized, 0},
+		{"authorized", "secret", nil, http.StatusOK, 1},
+		{"scan fails", "secret", errors.New("put.io unavailable"), http.StatusBadGateway, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dl := &fakeDownloadService{ready: true, rescan: summary, rescanErr: tt.err}
+			s := New(&config.Config{DisableQuotaMonitor: true, AdminToken: "secret"}, &fakePutioClient{}, dl)
+
+			req := httptest.NewRequest(http.MethodPost, "/rescan", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			s.handleRescan(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("code = %d, want %d", rec.Code, tt.wantCode)
+			}
+			if dl.rescanned != tt.wantCalls {
+				t.Errorf("rescans = %d, want %d", dl.rescanned, tt.wantCalls)
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+			var got download.RescanSummary
+			if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if !reflect.DeepEqual(got, summary) {
+				t.Errorf("response = %+v, want %+v", got, summary)
+			}
+		})
+	}
+}
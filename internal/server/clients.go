@@ -0,0 +1,102 @@
+package server
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// clientActiveWindow is how recently a client must have made a request to
+// be considered connected. *arr apps poll every few seconds to a minute.
+const clientActiveWindow = 10 * time.Minute
+
+// maxTrackedClients bounds the number of clients remembered, since any peer
+// can make up new user agents
+const maxTrackedClients = 256
+
+// rpcClient describes an RPC client seen by the server.
+type rpcClient struct {
+	Host      string
+	UserAgent string
+	FirstSeen time.Time
+	LastSeen  time.Time
+	Requests  int64
+}
+
+// clientTracker records RPC clients keyed by remote host and user agent, so
+// that e.g. Sonarr and Radarr running on the same host are told apart.
+type clientTracker struct {
+	mu      sync.Mutex
+	clients map[string]*rpcClient
+}
+
+func newClientTracker() *clientTracker {
+	return &clientTracker{
+		clients: make(map[string]*rpcClient),
+	}
+}
+
+// Touch records a request from the given remote address and user agent at
+// time now. It returns true if the client has not been seen before. Clients
+// not seen within clientActiveWindow are forgotten, as is the least recently
+// seen one once maxTrackedClients are tracked.
+func (ct *clientTracker) Touch(remoteAddr, userAgent string, now time.Time) bool {
+	host := remoteAddr
+	if h, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		host = h
+	}
+	key := host + "|" + userAgent
+
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	c, exists := ct.clients[key]
+	if !exists {
+		ct.prune(now)
+		c = &rpcClient{
+			Host:      host,
+			UserAgent: userAgent,
+			FirstSeen: now,
+		}
+		ct.clients[key] = c
+	}
+	c.LastSeen = now
+	c.Requests++
+	return !exists
+}
+
+// prune makes room for a new client. ct.mu must be held.
+func (ct *clientTracker) prune(now time.Time) {
+	var oldest string
+	for key, c := range ct.clients {
+		if now.Sub(c.LastSeen) > clientActiveWindow {
+			delete(ct.clients, key)
+			continue
+		}
+		if oldest == "" || c.LastSeen.Before(ct.clients[oldest].LastSeen) {
+			oldest = key
+		}
+	}
+	if len(ct.clients) >= maxTrackedClients {
+		delete(ct.clients, oldest)
+	}
+}
+
+// Active returns a snapshot of clients seen within window of now, most
+// recently seen first.
+func (ct *clientTracker) Active(window time.Duration, now time.Time) []rpcClient {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	var active []rpcClient
+	for _, c := range ct.clients {
+		if now.Sub(c.LastSeen) <= window {
+			active = append(active, *c)
+		}
+	}
+	sort.Slice(active, func(i, j int) bool {
+		return active[i].LastSeen.After(active[j].LastSeen)
+	})
+	return active
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestClientTrackerTouch(t *testing.T) {
+	ct := newClientTracker()
+	now := time.Now()
+
+	if !ct.Touch("10.0.0.1:51000", "Sonarr/4.0", now) {
+		t.Error("expected first request from Sonarr to be a new client")
+	}
+	// Same host and user agent from a different source port is the same client
+	if ct.Touch("10.0.0.1:51001", "Sonarr/4.0", now) {
+		t.Error("expected second request from Sonarr to be a known client")
+	}
+	// Same host with a different user agent is a distinct client
+	if !ct.Touch("10.0.0.1:51002", "Radarr/5.0", now) {
+		t.Error("expected first request from Radarr to be a new client")
+	}
+
+	active := ct.Active(clientActiveWindow, now)
+	if len(active) != 2 {
+		t.Fatalf("expected 2 active clients, got %d", len(active))
+	}
+	for _, c := range active {
+		if c.Host != "10.0.0.1" {
+			t.Errorf("expected host 10.0.0.1, got %q", c.Host)
+		}
+		if c.UserAgent == "Sonarr/4.0" && c.Requests != 2 {
+			t.Errorf("expected 2 requests from Sonarr, got %d", c.Requests)
+		}
+	}
+}
+
+func TestClientTrackerActiveWindow(t *testing.T) {
+	ct := newClientTracker()
+	now := time.Now()
+
+	ct.Touch("10.0.0.1:51000", "Sonarr/4.0", now.Add(-time.Hour))
+	ct.Touch("10.0.0.2:51000", "Radarr/5.0", now.Add(-time.Minute))
+
+	active := ct.Active(clientActiveWindow, now)
+	if len(active) != 1 {
+		t.Fatalf("expected 1 active client, got %d", len(active))
+	}
+	if active[0].UserAgent != "Radarr/5.0" {
+		t.Errorf("expected Radarr to be active, got %q", active[0].UserAgent)
+	}
+}
+
+func TestClientTrackerPrunes(t *testing.T) {
+	ct := newClientTracker()
+	now := time.Now()
+
+	ct.Touch("10.0.0.1:51000", "Sonarr/4.0", now.Add(-time.Hour))
+	ct.Touch("10.0.0.2:51000", "Radarr/5.0", now)
+	if len(ct.clients) != 1 {
+		t.Errorf("tracked %d clients, want the stale one forgotten", len(ct.clients))
+	}
+
+	// Rotating user agents can't grow the tracker without bound
+	for i := range 2 * maxTrackedClients {
+		ct.Touch("10.0.0.3:51000", fmt.Sprintf("agent/%d", i), now.Add(time.Duration(i)*time.Millisecond))
+	}
+	if len(ct.clients) != maxTrackedClients {
+		t.Errorf("tracked %d clients, want %d", len(ct.clients), maxTrackedClients)
+	}
+	if _, ok := ct.clients["10.0.0.3|agent/0"]; ok {
+		t.Error("expected the least recently seen client to be evicted")
+	}
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/elsbrock/go-putio"
+)
+
+// Error codes reported to RPC clients. They are stable, so clients can
+// branch on them instead of parsing messages.
+const (
+	ErrCodeInvalidArgs     = "invalid-args"     // the request arguments are malformed or out of range
+	ErrCodeNotFound        = "not-found"        // no transfer matches the requested ids
+	ErrCodeUpstreamFailure = "upstream-failure" // a Put.io API call failed
+	ErrCodeOverQuota       = "over-quota"       // the Put.io account is out of space
+	ErrCodeUnknownMethod   = "unknown-method"   // the RPC method is not supported (strict mode)
+	ErrCodeInternal        = "internal"         // anything else
+)
+
+// RPCError is an error reported to RPC clients. Message is meant for
+// clients; the underlying error, which may expose internals, is only logged.
+type RPCError struct {
+	Code    string
+	Message string
+	Err     error
+}
+
+// Error implements the error interface
+func (e *RPCError) Error() string {
+	if e.Err == nil {
+		return e.Message
+	}
+	return e.Message + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *RPCError) Unwrap() error {
+	return e.Err
+}
+
+// HTTPStatus returns the HTTP status code the error is answered with
+func (e *RPCError) HTTPStatus() int {
+	switch e.Code {
+	case ErrCodeInvalidArgs, ErrCodeUnknownMethod:
+		return http.StatusBadRequest
+	case ErrCodeNotFound:
+		return http.StatusNotFound
+	case ErrCodeUpstreamFailure:
+		return http.StatusBadGateway
+	case ErrCodeOverQuota:
+		return http.StatusInsufficientStorage
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// errInvalidArgs reports malformed or out of range request arguments
+func errInvalidArgs(message string, err error) *RPCError {
+	return &RPCError{Code: ErrCodeInvalidArgs, Message: message, Err: err}
+}
+
+// errNotFound reports that none of the requested transfers exist
+func errNotFound(message string) *RPCError {
+	return &RPCError{Code: ErrCodeNotFound, Message: message}
+}
+
+// errUpstream reports a failed Put.io API call. Failures caused by the
+// account running out of space, as reported by Put.io or the quota monitor,
+// are reported as over quota.
+func (s *Server) errUpstream(message string, err error) *RPCError {
+	if s.quotaWarning.Load() || isOutOfSpace(err) {
+		return &RPCError{Code: ErrCodeOverQuota, Message: message + ": Put.io account is out of space", Err: err}
+	}
+	return &RPCError{Code: ErrCodeUpstreamFailure, Message: message, Err: err}
+}
+
+// isOutOfSpace reports whether err is a Put.io error about missing space
+func isOutOfSpace(err error) bool {
+	var respErr *putio.ErrorResponse
+	if !errors.As(err, &respErr) {
+		return false
+	}
+	if respErr.Response != nil && respErr.Response.StatusCode == http.StatusInsufficientStorage {
+		return true
+	}
+	kind := strings.ToLower(respErr.Type + " " + respErr.Message)
+	return strings.Contains(kind, "space") || strings.Contains(kind, "quota")
+}
+
+// asRPCError returns err as an RPCError, hiding errors of unknown kind
+// behind a generic message.
+func asRPCError(err error) *RPCError {
+	var rpcErr *RPCError
+	if errors.As(err, &rpcErr) {
+		return rpcErr
+	}
+	return &RPCError{Code: ErrCodeInternal, Message: "internal error", Err: err}
+}
@@ -1,28 +1,71 @@
 package server
 
 import (
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/elsbrock/plundrio/internal/log"
 )
 
+// maxRPCBodySize bounds the size of a request body. torrent-add requests
+// carry whole torrent files, base64 encoded.
+const maxRPCBodySize = 32 << 20
+
 // handleRPC processes transmission-rpc requests
 func (s *Server) handleRPC(w http.ResponseWriter, r *http.Request) {
-	// Check for session ID header
+	// With credentials configured, clients must send them like they would to
+	// Transmission, before the session ID handshake
+	if !s.rpcAuthorized(r) {
+		log.Warn("rpc").
+			Str("client_addr", r.RemoteAddr).
+			Msg("Client sent missing or wrong credentials")
+		w.Header().Set("WWW-Authenticate", `Basic realm="Transmission"`)
+		http.Error(w, "401 Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Clients must echo the session ID; without it, or with an ID of an
+	// earlier process, they get the current one and retry
 	sessionID := r.Header.Get("X-Transmission-Session-Id")
-	if sessionID == "" {
-		// Client needs to authenticate - send session ID
+	if subtle.ConstantTimeCompare([]byte(sessionID), []byte(s.sessionID)) != 1 {
+		msg := "Client needs authentication - sending session ID"
+		if sessionID != "" {
+			msg = "Client sent an unknown session ID - sending the current one"
+		}
 		log.Info("rpc").
 			Str("client_addr", r.RemoteAddr).
-			Msg("Client needs authentication - sending session ID")
-		w.Header().Set("X-Transmission-Session-Id", "123") // Using a simple static ID for now
+			Msg(msg)
+		w.Header().Set("X-Transmission-Session-Id", s.sessionID)
 		http.Error(w, "409 Conflict", http.StatusConflict)
 		return
 	}
 
+	// Track which clients are talking to us, once they are authenticated
+	if s.clients.Touch(r.RemoteAddr, r.UserAgent(), time.Now()) {
+		log.Info("rpc").
+			Str("client_addr", r.RemoteAddr).
+			Str("user_agent", r.UserAgent()).
+			Int("connected_clients", len(s.clients.Active(clientActiveWindow, time.Now()))).
+			Msg("New RPC client connected")
+	}
+
+	// Until the download manager has loaded the transfer list any answer
+	// would be empty or incomplete, so ask the client to come back later
+	if !s.dlService.Ready() {
+		log.Debug("rpc").
+			Str("client_addr", r.RemoteAddr).
+			Msg("Download manager not ready - rejecting request")
+		w.Header().Set("Retry-After", "5")
+		http.Error(w, "503 Service Unavailable: download manager is starting", http.StatusServiceUnavailable)
+		return
+	}
+
 	log.Debug("rpc").
 		Str("client_addr", r.RemoteAddr).
+		Str("user_agent", r.UserAgent()).
 		Str("session_id", sessionID).
 		Str("method", r.Method).
 		Msg("Handling RPC request")
@@ -42,12 +85,18 @@ func (s *Server) handleRPC(w http.ResponseWriter, r *http.Request) {
 			Msg("GET request converted to session-get")
 	} else if r.Method == http.MethodPost {
 		// Parse RPC request for POST method
+		r.Body = http.MaxBytesReader(w, r.Body, maxRPCBodySize)
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			log.Error("rpc").
 				Str("client_addr", r.RemoteAddr).
 				Str("method", "POST").
 				Err(err).
 				Msg("Failed to decode request")
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				http.Error(w, "Request too large", http.StatusRequestEntityTooLarge)
+				return
+			}
 			http.Error(w, "Invalid request", http.StatusBadRequest)
 			return
 		}
@@ -83,29 +132,51 @@ func (s *Server) handleRPC(w http.ResponseWriter, r *http.Request) {
 		result, err = s.handleTorrentGet(r.Context(), req.Arguments)
 	case "torrent-remove":
 		result, err = s.handleTorrentRemove(r.Context(), req.Arguments)
+	case "torrent-set":
+		result, err = s.handleTorrentSet(r.Context(), req.Arguments)
+	case "session-stats":
+		result = s.handleSessionStats()
+		log.Debug("rpc").
+			Str("client_addr", r.RemoteAddr).
+			Msg("Session statistics requested")
+	case "session-set":
+		result, err = s.handleSessionSet(req.Arguments)
 	case "session-get":
-		result = map[string]interface{}{
-			"download-dir":        s.cfg.TargetDir,
-			"version":             "2.94", // Transmission version to report
-			"rpc-version":         15,     // RPC version to report
-			"rpc-version-minimum": 1,
-		}
+		session := s.settings.Values()
+		session["download-dir"] = s.cfg.TargetDir
+		session["version"] = "2.94" // Transmission version to report
+		session["rpc-version"] = 15 // RPC version to report
+		session["rpc-version-minimum"] = 1
+		result = session
 		log.Debug("rpc").
 			Str("client_addr", r.RemoteAddr).
 			Str("download_dir", s.cfg.TargetDir).
 			Msg("Session information requested")
 	default:
-		// Return empty success for unsupported methods
-		result = struct{}{}
-		log.Debug("rpc").
-			Str("client_addr", r.RemoteAddr).
-			Str("rpc_method", req.Method).
-			Msg("Unsupported RPC method called")
+		if s.unsupported.Record(req.Method) {
+			log.Info("rpc").
+				Str("client_addr", r.RemoteAddr).
+				Str("user_agent", r.UserAgent()).
+				Str("rpc_method", req.Method).
+				Strs("unsupported_methods", s.unsupported.Methods()).
+				Msg("New unsupported RPC method called")
+		} else {
+			log.Debug("rpc").
+				Str("client_addr", r.RemoteAddr).
+				Str("rpc_method", req.Method).
+				Msg("Unsupported RPC method called")
+		}
+		if s.cfg.RPCStrict {
+			err = &RPCError{Code: ErrCodeUnknownMethod, Message: "method name not recognized: " + req.Method}
+		} else {
+			// Return empty success for unsupported methods
+			result = struct{}{}
+		}
 	}
 
 	// Send response
 	if err != nil {
-		s.sendError(w, err)
+		s.sendError(w, req.Tag, err)
 		return
 	}
 
@@ -114,5 +185,22 @@ func (s *Server) handleRPC(w http.ResponseWriter, r *http.Request) {
 		Str("rpc_method", req.Method).
 		Msg("Sending RPC response")
 
-	s.sendResponse(w, req.Tag, result)
+	s.sendResponse(w, r, req.Tag, result)
+}
+
+// rpcAuthorized reports whether the request carries the configured RPC
+// username and password as basic auth. Without credentials configured,
+// every request is authorized.
+func (s *Server) rpcAuthorized(r *http.Request) bool {
+	if s.cfg.RPCUsername == "" && s.cfg.RPCPassword == "" {
+		return true
+	}
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+	// Compare both so timing reveals neither
+	userOK := subtle.ConstantTimeCompare([]byte(username), []byte(s.cfg.RPCUsername))
+	passOK := subtle.ConstantTimeCompare([]byte(password), []byte(s.cfg.RPCPassword))
+	return userOK&passOK == 1
 }
@@ -0,0 +1,410 @@
+package server
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elsbrock/go-putio"
+	"github.com/elsbrock/plundrio/internal/config"
+	"github.com/elsbrock/plundrio/internal/download"
+)
+
+// fakeDownloadService is an in-memory DownloadService for handler tests.
+type fakeDownloadService struct {
+	ready      bool
+	rescan     download.RescanSummary
+	rescanErr  error
+	rescanned  int
+	paused     bool
+	metrics    download.Metrics
+	lifetime   download.LifetimeStats
+	lastPoll   time.Time
+	transfers  []*putio.Transfer
+	categories map[string]string
+	local      map[int64]bool
+	priorities map[string]int
+	contexts   map[int64]*download.TransferContext
+	errors     map[int64]string // errors reported on top of Put.io's
+	rateLimit  int64
+}
+
+func (f *fakeDownloadService) GetTransfers() []*putio.Transfer { return f.transfers }
+func (f *fakeDownloadService) GetTransferContext(id int64) (*download.TransferContext, bool) {
+	ctx, ok := f.contexts[id]
+	return ctx, ok
+}
+func (f *fakeDownloadService) TransferError(id int64) string { return f.errors[id] }
+func (f *fakeDownloadService) SetCategory(hash, category string) {
+	if f.categories == nil {
+		f.categories = make(map[string]string)
+	}
+	f.categories[hash] = category
+}
+func (f *fakeDownloadService) GetCategory(hash string) string { return f.categories[hash] }
+func (f *fakeDownloadService) RemoveCategory(hash string)     { delete(f.categories, hash) }
+func (f *fakeDownloadService) SetPriority(hash string, priority int) {
+	if f.priorities == nil {
+		f.priorities = make(map[string]int)
+	}
+	f.priorities[hash] = priority
+}
+func (f *fakeDownloadService) GetPriority(hash string) int { return f.priorities[hash] }
+func (f *fakeDownloadService) GetLifetimeStats() download.LifetimeStats {
+	return f.lifetime
+}
+func (f *fakeDownloadService) Metrics() download.Metrics { return f.metrics }
+func (f *fakeDownloadService) LastPoll() time.Time       { return f.lastPoll }
+func (f *fakeDownloadService) TransferDir(t *putio.Transfer) string {
+	return filepath.Join(f.categories[t.Hash], t.Name)
+}
+func (f *fakeDownloadService) HasLocalData(t *putio.Transfer) bool { return f.local[t.ID] }
+func (f *fakeDownloadService) Rescan(context.Context) (download.RescanSummary, error) {
+	f.rescanned++
+	return f.rescan, f.rescanErr
+}
+func (f *fakeDownloadService) Ready() bool  { return f.ready }
+func (f *fakeDownloadService) Paused() bool { return f.paused }
+func (f *fakeDownloadService) Stop()        {}
+func (f *fakeDownloadService) SetSessionRateLimit(bytesPerSec int64) {
+	f.rateLimit = bytesPerSec
+}
+
+// newTestServer creates a Server backed by fakes.
+func newTestServer(client *fakePutioClient, dl *fakeDownloadService) *Server {
+	return New(&config.Config{TargetDir: "/downloads", DisableQuotaMonitor: true}, client, dl)
+}
+
+// doRPC sends a transmission-rpc request with a valid session ID.
+func doRPC(s *Server, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/transmission/rpc", strings.NewReader(body))
+	req.Header.Set("X-Transmission-Session-Id", s.sessionID)
+	rec := httptest.NewRecorder()
+	s.handleRPC(rec, req)
+	return rec
+}
+
+func TestHandleRPCNotReady(t *testing.T) {
+	dl := &fakeDownloadService{}
+	s := newTestServer(&fakePutioClient{}, dl)
+
+	rec := doRPC(s, `{"method":"torrent-get","arguments":{}}`)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("expected Retry-After header")
+	}
+
+	dl.ready = true
+	rec = doRPC(s, `{"method":"torrent-get","arguments":{}}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status after ready = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestHandleRPCBasicAuth(t *testing.T) {
+	s := newTestServer(&fakePutioClient{}, &fakeDownloadService{ready: true})
+	s.cfg.RPCUsername = "sonarr"
+	s.cfg.RPCPassword = "secret"
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		noAuth   bool
+		want     int
+	}{
+		{name: "missing", noAuth: true, want: http.StatusUnauthorized},
+		{name: "wrong password", username: "sonarr", password: "guess", want: http.StatusUnauthorized},
+		{name: "wrong username", username: "radarr", password: "secret", want: http.StatusUnauthorized},
+		{name: "authorized", username: "sonarr", password: "secret", want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/transmission/rpc", strings.NewReader(`{"method":"session-get"}`))
+			req.Header.Set("X-Transmission-Session-Id", s.sessionID)
+			if !tt.noAuth {
+				req.SetBasicAuth(tt.username, tt.password)
+			}
+			rec := httptest.NewRecorder()
+			s.handleRPC(rec, req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if tt.want == http.StatusUnauthorized && !strings.HasPrefix(rec.Header().Get("WWW-Authenticate"), "Basic ") {
+				t.Errorf("WWW-Authenticate = %q, want a Basic challenge", rec.Header().Get("WWW-Authenticate"))
+			}
+			// Only authenticated clients are tracked
+			tracked := len(s.clients.Active(clientActiveWindow, time.Now())) > 0
+			if tracked != (tt.want == http.StatusOK) {
+				t.Errorf("client tracked = %v", tracked)
+			}
+		})
+	}
+}
+
+func TestHandleRPCNoAuthConfigured(t *testing.T) {
+	s := newTestServer(&fakePutioClient{}, &fakeDownloadService{ready: true})
+
+	// Credentials sent by a client are ignored without any configured
+	req := httptest.NewRequest(http.MethodPost, "/transmission/rpc", strings.NewReader(`{"method":"session-get"}`))
+	req.Header.Set("X-Transmission-Session-Id", s.sessionID)
+	req.SetBasicAuth("admin", "admin")
+	rec := httptest.NewRecorder()
+	s.handleRPC(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestHandleRPCBodyTooLarge(t *testing.T) {
+	s := newTestServer(&fakePutioClient{}, &fakeDownloadService{ready: true})
+
+	body := `{"method":"torrent-add","arguments":{"metainfo":"` + strings.Repeat("A", maxRPCBodySize) + `"}}`
+	if rec := doRPC(s, body); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusRequestEntityTooLarge)
+	}
+}
+
+func TestHandleRPCSessionHandshakeBeforeReady(t *testing.T) {
+	s := newTestServer(&fakePutioClient{}, &fakeDownloadService{})
+
+	req := httptest.NewRequest(http.MethodPost, "/transmission/rpc", strings.NewReader(`{}`))
+	rec := httptest.NewRecorder()
+	s.handleRPC(rec, req)
+
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+	if rec.Header().Get("X-Transmission-Session-Id") == "" {
+		t.Error("expected session ID header during startup")
+	}
+}
+
+func TestHandleRPCSessionHandshake(t *testing.T) {
+	s := newTestServer(&fakePutioClient{}, &fakeDownloadService{ready: true})
+	if other := newTestServer(&fakePutioClient{}, &fakeDownloadService{}); other.sessionID == s.sessionID {
+		t.Fatal("expected every server to generate its own session ID")
+	}
+
+	send := func(sessionID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/transmission/rpc", strings.NewReader(`{"method":"session-get"}`))
+		if sessionID != "" {
+			req.Header.Set("X-Transmission-Session-Id", sessionID)
+		}
+		rec := httptest.NewRecorder()
+		s.handleRPC(rec, req)
+		return rec
+	}
+
+	// Missing and stale IDs are answered with the current one
+	for _, sessionID := range []string{"", "123"} {
+		rec := send(sessionID)
+		if rec.Code != http.StatusConflict {
+			t.Errorf("session ID %q: status = %d, want %d", sessionID, rec.Code, http.StatusConflict)
+		}
+		if got := rec.Header().Get("X-Transmission-Session-Id"); got != s.sessionID {
+			t.Errorf("session ID %q: got %q, want %q", sessionID, got, s.sessionID)
+		}
+	}
+
+	// Retrying with the ID from the 409 succeeds
+	rec := send(send("").Header().Get("X-Transmission-Session-Id"))
+	if rec.Code != http.StatusOK {
+		t.Errorf("status with current session ID = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestHandleRPCUnsupportedMethod(t *testing.T) {
+	dl := &fakeDownloadService{ready: true}
+
+	s := newTestServer(&fakePutioClient{}, dl)
+	rec := doRPC(s, `{"method":"torrent-verify","arguments":{}}`)
+	if !strings.Contains(rec.Body.String(), `"result":"success"`) {
+		t.Errorf("lenient mode body = %s, want success", rec.Body.String())
+	}
+	doRPC(s, `{"method":"torrent-verify","arguments":{}}`)
+	doRPC(s, `{"method":"blocklist-update","arguments":{}}`)
+
+	counts := s.unsupported.Counts()
+	if counts["torrent-verify"] != 2 || counts["blocklist-update"] != 1 || len(counts) != 2 {
+		t.Errorf("unsupported method counts = %v", counts)
+	}
+	if methods := s.unsupported.Methods(); len(methods) != 2 || methods[0] != "blocklist-update" {
+		t.Errorf("unsupported methods = %v", methods)
+	}
+
+	s.cfg.RPCStrict = true
+	rec = doRPC(s, `{"method":"torrent-verify","arguments":{}}`)
+	if !strings.Contains(rec.Body.String(), `"result":"error"`) {
+		t.Errorf("strict mode body = %s, want error", rec.Body.String())
+	}
+
+	// Supported methods are not affected by strict mode
+	rec = doRPC(s, `{"method":"session-get","arguments":{}}`)
+	if !strings.Contains(rec.Body.String(), `"result":"success"`) {
+		t.Errorf("session-get in strict mode body = %s, want success", rec.Body.String())
+	}
+}
+
+func TestHandleRPCGzip(t *testing.T) {
+	var transfers []*putio.Transfer
+	for i := int64(1); i <= 50; i++ {
+		transfers = append(transfers, &putio.Transfer{ID: i, Name: "Some.Show.S01E01", Status: "DOWNLOADING"})
+	}
+	dl := &fakeDownloadService{ready: true, transfers: transfers}
+	s := newTestServer(&fakePutioClient{}, dl)
+
+	req := httptest.NewRequest(http.MethodPost, "/transmission/rpc", strings.NewReader(`{"method":"torrent-get","arguments":{}}`))
+	req.Header.Set("X-Transmission-Session-Id", s.sessionID)
+	req.Header.Set("Accept-Encoding", "br, gzip")
+	rec := httptest.NewRecorder()
+	s.handleRPC(rec, req)
+
+	if got := rec.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", got)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+	if got := rec.Header().Get("X-Transmission-Session-Id"); got != s.sessionID {
+		t.Errorf("X-Transmission-Session-Id = %q, want %q", got, s.sessionID)
+	}
+
+	gz, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("body is not gzip: %v", err)
+	}
+	var resp struct {
+		Result    string `json:"result"`
+		Arguments struct {
+			Torrents []map[string]interface{} `json:"torrents"`
+		} `json:"arguments"`
+	}
+	if err := json.NewDecoder(gz).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode body: %v", err)
+	}
+	if resp.Result != "success" || len(resp.Arguments.Torrents) != 50 {
+		t.Errorf("decoded result = %q with %d torrents, want success with 50", resp.Result, len(resp.Arguments.Torrents))
+	}
+
+	// Small responses and clients not accepting gzip get plain JSON
+	for _, tc := range []struct{ body, encoding string }{
+		{`{"method":"torrent-get","arguments":{"ids":[1]}}`, "gzip"},
+		{`{"method":"torrent-get","arguments":{}}`, "gzip;q=0"},
+		{`{"method":"torrent-get","arguments":{}}`, ""},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/transmission/rpc", strings.NewReader(tc.body))
+		req.Header.Set("X-Transmission-Session-Id", s.sessionID)
+		req.Header.Set("Accept-Encoding", tc.encoding)
+		rec := httptest.NewRecorder()
+		s.handleRPC(rec, req)
+		if got := rec.Header().Get("Content-Encoding"); got != "" {
+			t.Errorf("%s with Accept-Encoding %q: Content-Encoding = %q, want none", tc.body, tc.encoding, got)
+		}
+		if !json.Valid(rec.Body.Bytes()) {
+			t.Errorf("%s with Accept-Encoding %q: body is not plain JSON", tc.body, tc.encoding)
+		}
+	}
+}
+
+func TestHandleRPCErrors(t *testing.T) {
+	outOfSpace := &putio.ErrorResponse{
+		Response: &http.Response{StatusCode: http.StatusBadRequest, Request: httptest.NewRequest(http.MethodPost, "https://api.put.io/v2/transfers/add", nil)},
+		Type:     "NOT_ENOUGH_SPACE",
+		Message:  "You don't have enough space",
+	}
+	tests := []struct {
+		name       string
+		body       string
+		addErr     error
+		overQuota  bool
+		strict     bool
+		wantStatus int
+		wantCode   string
+	}{
+		{"invalid arguments", `{"method":"torrent-set","arguments":{"ids":[1],"bandwidthPriority":5}}`, nil, false, false, http.StatusBadRequest, ErrCodeInvalidArgs},
+		{"missing source", `{"method":"torrent-add","arguments":{}}`, nil, false, false, http.StatusBadRequest, ErrCodeInvalidArgs},
+		{"unknown transfer", `{"method":"torrent-remove","arguments":{"ids":[42]}}`, nil, false, false, http.StatusNotFound, ErrCodeNotFound},
+		{"upstream failure", `{"method":"torrent-add","arguments":{"magnetLink":"magnet:?xt=urn:btih:abc"}}`, errors.New("dial tcp 10.0.0.1:443: connection refused"), false, false, http.StatusBadGateway, ErrCodeUpstreamFailure},
+		{"out of space", `{"method":"torrent-add","arguments":{"magnetLink":"magnet:?xt=urn:btih:abc"}}`, outOfSpace, false, false, http.StatusInsufficientStorage, ErrCodeOverQuota},
+		{"over quota", `{"method":"torrent-add","arguments":{"magnetLink":"magnet:?xt=urn:btih:abc"}}`, errors.New("bad request"), true, false, http.StatusInsufficientStorage, ErrCodeOverQuota},
+		{"unknown method", `{"method":"torrent-verify","arguments":{},"tag":7}`, nil, false, true, http.StatusBadRequest, ErrCodeUnknownMethod},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(&fakePutioClient{addErr: tt.addErr}, &fakeDownloadService{ready: true})
+			s.cfg.RPCStrict = tt.strict
+			s.quotaWarning.Store(tt.overQuota)
+
+			rec := doRPC(s, tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get("X-Transmission-Session-Id"); got != s.sessionID {
+				t.Errorf("X-Transmission-Session-Id = %q, want %q", got, s.sessionID)
+			}
+
+			var resp struct {
+				Result  string      `json:"result"`
+				Code    string      `json:"code"`
+				Message string      `json:"message"`
+				Tag     interface{} `json:"tag"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("failed to decode %s: %v", rec.Body.String(), err)
+			}
+			if resp.Result != "error" || resp.Code != tt.wantCode || resp.Message == "" {
+				t.Errorf("response = %+v, want error with code %s", resp, tt.wantCode)
+			}
+			if tt.addErr != nil && strings.Contains(resp.Message, tt.addErr.Error()) {
+				t.Errorf("message %q leaks the upstream error", resp.Message)
+			}
+			if tt.strict && resp.Tag != float64(7) {
+				t.Errorf("tag = %v, want 7", resp.Tag)
+			}
+		})
+	}
+}
+
+func TestHandleSessionStats(t *testing.T) {
+	dl := &fakeDownloadService{ready: true, transfers: []*putio.Transfer{
+		{ID: 1, Status: "DOWNLOADING", DownloadSpeed: 100, UploadSpeed: 5},
+		{ID: 2, Status: "SEEDING", UploadSpeed: 10},
+		{ID: 3, Status: "ERROR"},
+	}}
+	s := newTestServer(&fakePutioClient{}, dl)
+
+	rec := doRPC(s, `{"method":"session-stats"}`)
+	var resp struct {
+		Result    string         `json:"result"`
+		Arguments map[string]int `json:"arguments"`
+	}
+	// Only the numeric fields are decoded
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if resp.Result != "success" {
+		t.Fatalf("result = %q, body %s", resp.Result, rec.Body)
+	}
+	want := map[string]int{
+		"torrentCount":       3,
+		"activeTorrentCount": 2,
+		"pausedTorrentCount": 1,
+		"downloadSpeed":      100,
+		"uploadSpeed":        15,
+	}
+	for field, v := range want {
+		if got := resp.Arguments[field]; got != v {
+			t.Errorf("%s = %d, want %d", field, got, v)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/api"
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// breakerReporter is implemented by Put.io clients that back off while
+// Put.io is unavailable.
+type breakerReporter interface {
+	BreakerStatus() api.BreakerStatus
+}
+
+// healthResponse is the body served by /healthz
+type healthResponse struct {
+	Status        string             `json:"status"` // "ok", "degraded" while Put.io is unavailable, or "stale"
+	Ready         bool               `json:"ready"`
+	Paused        bool               `json:"paused"`
+	Version       string             `json:"version,omitempty"`
+	UptimeSeconds int64              `json:"uptimeSeconds"`
+	LastPoll      *time.Time         `json:"lastPoll,omitempty"` // last successful fetch of the transfer list
+	Putio         *api.BreakerStatus `json:"putio,omitempty"`
+}
+
+// handleHealth reports whether plundrio is running and can reach Put.io.
+// It answers 200 even while Put.io is down, since restarting plundrio would
+// not help, unless --health-max-poll-age is set and the transfer list has
+// not been fetched for longer than that; then it answers 503.
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	resp := healthResponse{
+		Status:        "ok",
+		Ready:         s.dlService.Ready(),
+		Paused:        s.dlService.Paused(),
+		Version:       s.cfg.Version,
+		UptimeSeconds: int64(now.Sub(s.startedAt).Seconds()),
+	}
+	if br, ok := s.client.(breakerReporter); ok {
+		status := br.BreakerStatus()
+		resp.Putio = &status
+		if status.State == api.BreakerOpen {
+			resp.Status = "degraded"
+		}
+	}
+
+	code := http.StatusOK
+	lastPoll := s.dlService.LastPoll()
+	if !lastPoll.IsZero() {
+		resp.LastPoll = &lastPoll
+	}
+	// Before the first poll the uptime counts, so a slow start isn't fatal
+	if maxAge := s.cfg.HealthMaxPollAge; maxAge > 0 {
+		since := s.startedAt
+		if !lastPoll.IsZero() {
+			since = lastPoll
+		}
+		if now.Sub(since) > maxAge {
+			resp.Status = "stale"
+			code = http.StatusServiceUnavailable
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Debug("server").Err(err).Msg("Failed to write health response")
+	}
+}
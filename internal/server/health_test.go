@@ -0,0 +1,88 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/api"
+	"github.com/elsbrock/plundrio/internal/config"
+)
+
+type fakeBreakerClient struct {
+	fakePutioClient
+	status api.BreakerStatus
+}
+
+func (f *fakeBreakerClient) BreakerStatus() api.BreakerStatus { return f.status }
+
+func TestHandleHealth(t *testing.T) {
+	tests := []struct {
+		name       string
+		client     PutioClient
+		wantStatus string
+		wantPutio  bool
+	}{
+		{"no breaker", &fakePutioClient{}, "ok", false},
+		{"breaker closed", &fakeBreakerClient{status: api.BreakerStatus{State: api.BreakerClosed}}, "ok", true},
+		{"breaker open", &fakeBreakerClient{status: api.BreakerStatus{State: api.BreakerOpen, ConsecutiveFailures: 5}}, "degraded", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(&config.Config{DisableQuotaMonitor: true}, tt.client, &fakeDownloadService{ready: true})
+			rec := httptest.NewRecorder()
+			s.handleHealth(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("code = %d, want 200", rec.Code)
+			}
+			var got healthResponse
+			if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if got.Status != tt.wantStatus || !got.Ready || (got.Putio != nil) != tt.wantPutio {
+				t.Errorf("health = %+v, want status %q, putio %v", got, tt.wantStatus, tt.wantPutio)
+			}
+		})
+	}
+}
+
+func TestHandleHealthPollAge(t *testing.T) {
+	dl := &fakeDownloadService{ready: true}
+	s := New(&config.Config{DisableQuotaMonitor: true, HealthMaxPollAge: time.Minute, Version: "1.2.3"}, &fakePutioClient{}, dl)
+
+	check := func() (int, healthResponse) {
+		rec := httptest.NewRecorder()
+		s.handleHealth(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		var got healthResponse
+		if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return rec.Code, got
+	}
+
+	// Before the first poll, a fresh process is healthy
+	if code, got := check(); code != http.StatusOK || got.Version != "1.2.3" || got.LastPoll != nil {
+		t.Errorf("fresh process: code %d, health %+v", code, got)
+	}
+
+	dl.lastPoll = time.Now().Add(-30 * time.Second)
+	if code, got := check(); code != http.StatusOK || got.Status != "ok" || got.LastPoll == nil {
+		t.Errorf("recent poll: code %d, health %+v", code, got)
+	}
+
+	dl.lastPoll = time.Now().Add(-2 * time.Minute)
+	if code, got := check(); code != http.StatusServiceUnavailable || got.Status != "stale" {
+		t.Errorf("stale poll: code %d, health %+v, want 503 stale", code, got)
+	}
+
+	// Never polling at all also fails once the window has passed
+	dl.lastPoll = time.Time{}
+	s.startedAt = time.Now().Add(-2 * time.Minute)
+	if code, got := check(); code != http.StatusServiceUnavailable || got.UptimeSeconds < 120 {
+		t.Errorf("no poll since start: code %d, health %+v, want 503", code, got)
+	}
+}
@@ -0,0 +1,189 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/elsbrock/plundrio/internal/download"
+)
+
+// infoHashes holds the BitTorrent info-hashes of a torrent. V1 is the SHA-1
+// hash used by Put.io, V2 the SHA-256 hash of BEP 52 torrents. Hybrid
+// torrents have both.
+type infoHashes struct {
+	V1 string
+	V2 string
+}
+
+// all returns the non-empty hashes, including the truncated 40 character v2
+// form that v2-aware clients use where only 20 bytes fit.
+func (h infoHashes) all() []string {
+	var out []string
+	if h.V1 != "" {
+		out = append(out, h.V1)
+	}
+	if h.V2 != "" {
+		out = append(out, h.V2, h.V2[:40])
+	}
+	return out
+}
+
+// parseTorrentHashes computes the info-hashes of a bencoded .torrent file.
+// The v2 hash is only computed for torrents declaring "meta version" 2.
+func parseTorrentHashes(data []byte) (infoHashes, error) {
+	info, err := bencodeDictValue(data, "info")
+	if err != nil {
+		return infoHashes{}, err
+	}
+
+	sum1 := sha1.Sum(info)
+	hashes := infoHashes{V1: hex.EncodeToString(sum1[:])}
+
+	if version, err := bencodeDictValue(info, "meta version"); err == nil && string(version) == "i2e" {
+		sum2 := sha256.Sum256(info)
+		hashes.V2 = hex.EncodeToString(sum2[:])
+		// Pure v2 torrents have no v1 hash; the v1 field would be meaningless
+		if _, err := bencodeDictValue(info, "pieces"); err != nil {
+			hashes.V1 = ""
+		}
+	}
+	return hashes, nil
+}
+
+// parseMagnetHashes extracts the info-hashes from a magnet link's xt
+// parameters: urn:btih for v1 (hex or base32) and urn:btmh for v2
+// (a SHA-256 multihash).
+func parseMagnetHashes(link string) infoHashes {
+	var hashes infoHashes
+	u, err := url.Parse(link)
+	if err != nil || u.Scheme != "magnet" {
+		return hashes
+	}
+	for _, xt := range u.Query()["xt"] {
+		switch {
+		case strings.HasPrefix(xt, "urn:btih:"):
+			v := strings.TrimPrefix(xt, "urn:btih:")
+			if len(v) == 32 {
+				if b, err := base32.StdEncoding.DecodeString(strings.ToUpper(v)); err == nil {
+					v = hex.EncodeToString(b)
+				}
+			}
+			if len(v) == 40 {
+				hashes.V1 = download.NormalizeHash(v)
+			}
+		case strings.HasPrefix(xt, "urn:btmh:1220"):
+			if v := strings.TrimPrefix(xt, "urn:btmh:1220"); len(v) == 64 {
+				hashes.V2 = download.NormalizeHash(v)
+			}
+		}
+	}
+	return hashes
+}
+
+// rememberHashAliases records every alternate hash of a torrent as an alias
+// of primary, the hash Put.io reports, so clients can refer to the transfer
+// by either.
+func (s *Server) rememberHashAliases(primary string, hashes infoHashes) {
+	for _, h := range hashes.all() {
+		if h != primary {
+			s.hashAliases.Store(h, primary)
+		}
+	}
+}
+
+// resolveHashAlias maps an alternate info-hash to the hash Put.io reports.
+// Other ids are returned unchanged.
+func (s *Server) resolveHashAlias(id string) string {
+	if primary, ok := s.hashAliases.Load(download.NormalizeHash(id)); ok {
+		return primary.(string)
+	}
+	return id
+}
+
+// bencodeDictValue returns the raw bencoded value stored under key in the
+// top-level dictionary of data.
+func bencodeDictValue(data []byte, key string) ([]byte, error) {
+	if len(data) == 0 || data[0] != 'd' {
+		return nil, errors.New("bencode: not a dictionary")
+	}
+	i := 1
+	for i < len(data) && data[i] != 'e' {
+		k, next, err := bencodeString(data, i)
+		if err != nil {
+			return nil, err
+		}
+		end, err := bencodeSkip(data, next, 1)
+		if err != nil {
+			return nil, err
+		}
+		if string(k) == key {
+			return data[next:end], nil
+		}
+		i = end
+	}
+	return nil, fmt.Errorf("bencode: key %q not found", key)
+}
+
+// bencodeString decodes the byte string starting at i and returns it along
+// with the index following it.
+func bencodeString(data []byte, i int) ([]byte, int, error) {
+	colon := bytes.IndexByte(data[i:], ':')
+	if colon < 0 {
+		return nil, 0, errors.New("bencode: malformed string")
+	}
+	n, err := strconv.Atoi(string(data[i : i+colon]))
+	start := i + colon + 1
+	if err != nil || n < 0 || start+n > len(data) {
+		return nil, 0, errors.New("bencode: malformed string length")
+	}
+	return data[start : start+n], start + n, nil
+}
+
+// bencodeMaxDepth bounds the nesting of lists and dictionaries, so that
+// crafted metainfo can't exhaust the stack.
+const bencodeMaxDepth = 64
+
+// bencodeSkip returns the index just past the value starting at i, which is
+// nested in depth lists or dictionaries.
+func bencodeSkip(data []byte, i, depth int) (int, error) {
+	if i >= len(data) {
+		return 0, errors.New("bencode: unexpected end of data")
+	}
+	switch c := data[i]; {
+	case c == 'i':
+		end := bytes.IndexByte(data[i:], 'e')
+		if end < 0 {
+			return 0, errors.New("bencode: malformed integer")
+		}
+		return i + end + 1, nil
+	case c == 'l' || c == 'd':
+		if depth >= bencodeMaxDepth {
+			return 0, errors.New("bencode: nested too deeply")
+		}
+		i++
+		for i < len(data) && data[i] != 'e' {
+			next, err := bencodeSkip(data, i, depth+1)
+			if err != nil {
+				return 0, err
+			}
+			i = next
+		}
+		if i >= len(data) {
+			return 0, errors.New("bencode: unterminated container")
+		}
+		return i + 1, nil
+	case c >= '0' && c <= '9':
+		_, next, err := bencodeString(data, i)
+		return next, err
+	default:
+		return 0, fmt.Errorf("bencode: unexpected byte %q", c)
+	}
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/elsbrock/go-putio"
+)
+
+// hybridInfo is the info dictionary of a minimal hybrid (v1 + v2) torrent.
+const hybridInfo = "d9:file treed8:file.bind0:d6:lengthi4e11:pieces root32:" +
+	"0123456789abcdef0123456789abcdefeee6:lengthi4e12:meta versioni2e4:name8:file.bin" +
+	"12:piece lengthi16384e6:pieces20:abcdefghijklmnopqrste"
+
+func sha1Hex(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestParseTorrentHashes(t *testing.T) {
+	v1Info := "d6:lengthi4e4:name8:file.bin12:piece lengthi16384e6:pieces20:abcdefghijklmnopqrste"
+	v2Info := "d9:file treed8:file.bind0:d6:lengthi4eeee12:meta versioni2e4:name8:file.bin12:piece lengthi16384ee"
+
+	tests := []struct {
+		name    string
+		torrent string
+		want    infoHashes
+	}{
+		{
+			name:    "v1",
+			torrent: "d8:announce9:http://tr4:info" + v1Info + "e",
+			want:    infoHashes{V1: sha1Hex(v1Info)},
+		},
+		{
+			name:    "hybrid",
+			torrent: "d8:announce9:http://tr4:info" + hybridInfo + "12:piece layersdee",
+			want:    infoHashes{V1: sha1Hex(hybridInfo), V2: sha256Hex(hybridInfo)},
+		},
+		{
+			name:    "v2 only",
+			torrent: "d4:info" + v2Info + "e",
+			want:    infoHashes{V2: sha256Hex(v2Info)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTorrentHashes([]byte(tt.torrent))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("parseTorrentHashes() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := parseTorrentHashes([]byte("d4:name3:fooe")); err == nil {
+		t.Error("expected error for torrent without info dictionary")
+	}
+	if _, err := parseTorrentHashes([]byte("d4:infod")); err == nil {
+		t.Error("expected error for truncated torrent")
+	}
+	if _, err := parseTorrentHashes([]byte("d4:info" + strings.Repeat("l", 1<<20))); err == nil {
+		t.Error("expected error for deeply nested torrent")
+	}
+}
+
+func TestParseMagnetHashes(t *testing.T) {
+	v1 := "c12fe1c06bba254a9dc9f519b335aa7c1367a88a"
+	v2 := sha256Hex("info")
+
+	tests := []struct {
+		name   string
+		magnet string
+		want   infoHashes
+	}{
+		{"hex btih", "magnet:?xt=urn:btih:" + v1 + "&dn=x", infoHashes{V1: v1}},
+		{"base32 btih", "magnet:?xt=urn:btih:YEX6DQDLXISUVHOJ6UM3GNNKPQJWPKEK", infoHashes{V1: v1}},
+		{"hybrid", "magnet:?xt=urn:btih:" + v1 + "&xt=urn:btmh:1220" + v2, infoHashes{V1: v1, V2: v2}},
+		{"not a magnet", "http://example.com/a.torrent", infoHashes{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseMagnetHashes(tt.magnet); got != tt.want {
+				t.Errorf("parseMagnetHashes() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTorrentAddHybridResolvesByV2Hash(t *testing.T) {
+	torrent := "d4:info" + hybridInfo + "e"
+	v1, v2 := sha1Hex(hybridInfo), sha256Hex(hybridInfo)
+
+	client := &fakePutioClient{transfers: []*putio.Transfer{{ID: 7, Hash: v1}}}
+	s := newTestServer(client, &fakeDownloadService{ready: true})
+
+	args, _ := json.Marshal(map[string]string{
+		"metainfo":    base64.StdEncoding.EncodeToString([]byte(torrent)),
+		"downloadDir": "/downloads/tv",
+	})
+	if _, err := s.handleTorrentAdd(context.Background(), args); err != nil {
+		t.Fatalf("torrent-add failed: %v", err)
+	}
+
+	for _, id := range []string{v1, v2, v2[:40]} {
+		found, err := s.findTransfers(context.Background(), "test", []string{id})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(found) != 1 || found[0].ID != 7 {
+			t.Errorf("findTransfers(%s) = %v, want transfer 7", id, found)
+		}
+	}
+
+	// The fake upload reports no hash, so the category is stored under v1
+	if got := s.dlService.GetCategory(v1); got != "tv" {
+		t.Errorf("category = %q, want %q", got, "tv")
+	}
+}
+
+func TestParseTorrentSource(t *testing.T) {
+	torrent := []byte("d4:infod6:lengthi1e4:name1:a12:piece lengthi16384e6:pieces20:aaaaaaaaaaaaaaaaaaaaee")
+
+	tests := []struct {
+		name        string
+		data        []byte
+		wantMagnet  bool
+		wantTorrent bool
+	}{
+		{"magnet", []byte("magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567\n"), true, false},
+		{"magnet without hash", []byte("magnet:?dn=foo"), false, false},
+		{"torrent", torrent, false, true},
+		{"garbage", []byte("hello"), false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, err := ParseTorrentSource(tt.data, "x.torrent")
+			if wantErr := !tt.wantMagnet && !tt.wantTorrent; (err != nil) != wantErr {
+				t.Fatalf("err = %v, want error %v", err, wantErr)
+			}
+			if (src.Magnet != "") != tt.wantMagnet || (src.Torrent != nil) != tt.wantTorrent {
+				t.Errorf("src = %+v, want magnet %v, torrent %v", src, tt.wantMagnet, tt.wantTorrent)
+			}
+		})
+	}
+}
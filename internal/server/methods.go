@@ -0,0 +1,51 @@
+package server
+
+import (
+	"sort"
+	"sync"
+)
+
+// methodTracker counts calls to RPC methods plundrio does not implement, so
+// users can find out which methods their clients rely on.
+type methodTracker struct {
+	mu    sync.Mutex
+	calls map[string]int64
+}
+
+func newMethodTracker() *methodTracker {
+	return &methodTracker{
+		calls: make(map[string]int64),
+	}
+}
+
+// Record counts a call to method. It returns true the first time a method
+// is seen.
+func (mt *methodTracker) Record(method string) bool {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+	mt.calls[method]++
+	return mt.calls[method] == 1
+}
+
+// Methods returns the distinct methods seen so far, sorted by name.
+func (mt *methodTracker) Methods() []string {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+	methods := make([]string, 0, len(mt.calls))
+	for m := range mt.calls {
+		methods = append(methods, m)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// Counts returns a copy of the per-method call counts.
+func (mt *methodTracker) Counts() map[string]int64 {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+	counts := make(map[string]int64, len(mt.calls))
+	for m, n := range mt.calls {
+		counts[m] = n
+	}
+	return counts
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/elsbrock/plundrio/internal/api"
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// metricsWriter renders metrics in the Prometheus text exposition format.
+type metricsWriter struct {
+	buf bytes.Buffer
+}
+
+// family writes the help and type header of a metric.
+func (mw *metricsWriter) family(name, typ, help string) {
+	fmt.Fprintf(&mw.buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// sample writes a single value of a metric, with an optional label.
+func (mw *metricsWriter) sample(name, label, labelValue string, value int64) {
+	if label != "" {
+		fmt.Fprintf(&mw.buf, "%s{%s=%s} %d\n", name, label, strconv.Quote(labelValue), value)
+		return
+	}
+	fmt.Fprintf(&mw.buf, "%s %d\n", name, value)
+}
+
+// metric writes a metric without labels.
+func (mw *metricsWriter) metric(name, typ, help string, value int64) {
+	mw.family(name, typ, help)
+	mw.sample(name, "", "", value)
+}
+
+// handleMetrics serves the download manager's metrics for Prometheus.
+// Counters cover the running process and start from zero on restart; the
+// plundrio_lifetime_* counters add up all sessions.
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	m := s.dlService.Metrics()
+
+	var mw metricsWriter
+	mw.metric("plundrio_active_transfers", "gauge", "Transfers whose files are being downloaded.", int64(m.ActiveTransfers))
+	mw.metric("plundrio_downloading_files", "gauge", "Files being downloaded by a worker.", int64(m.DownloadingFiles))
+	mw.metric("plundrio_jobs_queued", "gauge", "Files waiting for a download worker.", int64(m.JobsQueued))
+	mw.metric("plundrio_paused", "gauge", "Whether downloads are paused (1) or not (0).", boolMetric(s.dlService.Paused()))
+	mw.metric("plundrio_files_completed_total", "counter", "Files downloaded.", m.FilesCompleted)
+	mw.metric("plundrio_files_failed_total", "counter", "Files given up on after retries.", m.FilesFailed)
+	mw.metric("plundrio_download_retries_total", "counter", "Download attempts retried after an error.", m.DownloadRetries)
+	mw.metric("plundrio_transfers_completed_total", "counter", "Transfers with all files downloaded.", m.TransfersCompleted)
+	mw.metric("plundrio_transfers_failed_total", "counter", "Transfers that failed.", m.TransfersFailed)
+	mw.metric("plundrio_download_bytes_total", "counter", "Bytes downloaded to the target directory.", m.BytesDownloaded)
+
+	lifetime := s.dlService.GetLifetimeStats()
+	mw.metric("plundrio_lifetime_files_completed_total", "counter", "Files downloaded across all sessions.", lifetime.FilesCompleted)
+	mw.metric("plundrio_lifetime_files_failed_total", "counter", "Files given up on across all sessions.", lifetime.FilesFailed)
+	mw.metric("plundrio_lifetime_transfers_completed_total", "counter", "Transfers with all files downloaded across all sessions.", lifetime.TransfersCompleted)
+	mw.metric("plundrio_lifetime_transfers_failed_total", "counter", "Transfers that failed across all sessions.", lifetime.TransfersFailed)
+	mw.metric("plundrio_lifetime_download_bytes_total", "counter", "Bytes downloaded across all sessions.", lifetime.BytesDownloaded)
+	mw.metric("plundrio_lifetime_sessions_total", "counter", "Times plundrio was started against the target directory.", lifetime.SessionCount)
+	mw.metric("plundrio_lifetime_active_seconds_total", "counter", "Seconds plundrio has been running across all sessions.", lifetime.SecondsActive)
+
+	if br, ok := s.client.(breakerReporter); ok {
+		mw.metric("plundrio_putio_available", "gauge", "Whether requests to Put.io are let through (1) or held back by the circuit breaker (0).",
+			boolMetric(br.BreakerStatus().State != api.BreakerOpen))
+	}
+
+	mw.family("plundrio_rpc_unsupported_requests_total", "counter", "Calls to RPC methods plundrio does not implement.")
+	counts := s.unsupported.Counts()
+	for _, method := range s.unsupported.Methods() {
+		mw.sample("plundrio_rpc_unsupported_requests_total", "method", method, counts[method])
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if _, err := w.Write(mw.buf.Bytes()); err != nil {
+		log.Debug("server").Err(err).Msg("Failed to write metrics")
+	}
+}
+
+// boolMetric converts b to the 0 or 1 of a Prometheus gauge.
+func boolMetric(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/elsbrock/plundrio/internal/api"
+	"github.com/elsbrock/plundrio/internal/config"
+	"github.com/elsbrock/plundrio/internal/download"
+)
+
+func TestHandleMetrics(t *testing.T) {
+	dl := &fakeDownloadService{ready: true, paused: true, metrics: download.Metrics{
+		ActiveTransfers: 2,
+		JobsQueued:      5,
+		FilesCompleted:  7,
+		BytesDownloaded: 1 << 20,
+	}, lifetime: download.LifetimeStats{
+		FilesCompleted:  70,
+		BytesDownloaded: 1 << 30,
+		SessionCount:    3,
+	}}
+	client := &fakeBreakerClient{status: api.BreakerStatus{State: api.BreakerOpen}}
+	s := New(&config.Config{DisableQuotaMonitor: true}, client, dl)
+	s.unsupported.Record("blocklist-update")
+	s.unsupported.Record("blocklist-update")
+
+	rec := httptest.NewRecorder()
+	s.handleMetrics(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Content-Type = %q, want text/plain", ct)
+	}
+	body := rec.Body.String()
+	for _, line := range []string{
+		"# TYPE plundrio_active_transfers gauge",
+		"plundrio_active_transfers 2",
+		"plundrio_jobs_queued 5",
+		"plundrio_paused 1",
+		"# TYPE plundrio_files_completed_total counter",
+		"plundrio_files_completed_total 7",
+		"plundrio_files_failed_total 0",
+		"plundrio_download_bytes_total 1048576",
+		"plundrio_lifetime_files_completed_total 70",
+		"plundrio_lifetime_download_bytes_total 1073741824",
+		"plundrio_lifetime_sessions_total 3",
+		"plundrio_putio_available 0",
+		`plundrio_rpc_unsupported_requests_total{method="blocklist-update"} 2`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("metrics lack %q:\n%s", line, body)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package server
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/elsbrock/plundrio/internal/download"
@@ -9,11 +12,48 @@ import (
 // Transmission status constants
 const (
 	trStatusStopped         = 0
+	trStatusCheckWaiting    = 1
+	trStatusCheck           = 2
 	trStatusDownloadWaiting = 3
 	trStatusDownload        = 4
+	trStatusSeedWaiting     = 5
 	trStatusSeed            = 6
 )
 
+// trStatusNames maps the names accepted in --status-map to Transmission status codes.
+var trStatusNames = map[string]int{
+	"stopped":       trStatusStopped,
+	"check-wait":    trStatusCheckWaiting,
+	"check":         trStatusCheck,
+	"download-wait": trStatusDownloadWaiting,
+	"download":      trStatusDownload,
+	"seed-wait":     trStatusSeedWaiting,
+	"seed":          trStatusSeed,
+}
+
+// ParseStatusMapping parses Put.io status → Transmission status overrides.
+// Values may be Transmission status names (e.g. "download") or codes (0–6).
+func ParseStatusMapping(raw map[string]string) (map[string]int, error) {
+	mapping := make(map[string]int, len(raw))
+	for putioStatus, value := range raw {
+		value = strings.ToLower(strings.TrimSpace(value))
+		code, ok := trStatusNames[value]
+		if !ok {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < trStatusStopped || n > trStatusSeed {
+				return nil, fmt.Errorf("invalid transmission status %q for %s", value, putioStatus)
+			}
+			code = n
+		}
+		mapping[strings.ToUpper(strings.TrimSpace(putioStatus))] = code
+	}
+	return mapping, nil
+}
+
+// defaultProgressSplit is the share of overall progress attributed to the
+// Put.io phase when no split is configured.
+const defaultProgressSplit = 0.5
+
 // progressInput holds the data needed to calculate transfer progress.
 type progressInput struct {
 	// Put.io side
@@ -23,6 +63,25 @@ type progressInput struct {
 
 	// Local side (nil when no transfer context exists)
 	TransferCtx *download.TransferContext
+
+	// LocalMissing is set for finished transfers without a context whose
+	// data has not been downloaded yet, e.g. right after a restart.
+	LocalMissing bool
+
+	// Split is the share (0–1, exclusive) of overall progress attributed to
+	// the Put.io phase; the remainder is the local download. Zero means 0.5.
+	Split float64
+
+	// StatusMap overrides the default Put.io → Transmission status mapping.
+	StatusMap map[string]int
+}
+
+// putioShare returns the validated Put.io share of overall progress.
+func (in progressInput) putioShare() float64 {
+	if in.Split <= 0 || in.Split >= 1 {
+		return defaultProgressSplit
+	}
+	return in.Split
 }
 
 // progressResult contains the calculated progress values.
@@ -30,13 +89,16 @@ type progressResult struct {
 	PercentDone   float64   // 0.0–1.0
 	Status        int       // Transmission status code
 	LeftUntilDone int64     // bytes remaining
+	TotalSize     int64     // summed file sizes once enumerated, Put.io's size before
 	LocalETA      time.Time // local ETA override (zero if not applicable)
 	LocalSpeed    float64   // local download speed override in bytes/sec (0 if not applicable)
 }
 
 // calculateProgress computes the combined progress for a transfer.
+// TotalSize is the summed size of the transfer's files once they have been
+// enumerated, which may differ from the size Put.io reports.
 //
-// Progress is split 50/50:
+// Progress is split between two phases, 50/50 by default (see Split):
 //   - Put.io downloading the torrent (0–50%)
 //   - Local download from Put.io (50–100%)
 //
@@ -44,28 +106,49 @@ type progressResult struct {
 // tracked by the download manager. Otherwise we rely solely on the Put.io
 // transfer metadata.
 func calculateProgress(in progressInput) progressResult {
-	// When we have a transfer context with files, calculate the 50/50 split.
+	result := calculatePhaseProgress(in)
+	result.TotalSize = int64(in.PutioSize)
+	if in.TransferCtx != nil {
+		if _, totalSize, _, _ := in.TransferCtx.GetProgress(); totalSize > 0 {
+			result.TotalSize = totalSize
+		}
+	}
+	return result
+}
+
+// calculatePhaseProgress computes percent done, status and bytes left for
+// calculateProgress.
+func calculatePhaseProgress(in progressInput) progressResult {
+	// When we have a transfer context with files, calculate the split.
 	if in.TransferCtx != nil && in.TransferCtx.TotalFiles > 0 {
 		return calculateProgressWithContext(in)
 	}
 
-	// Completed/seeding on Put.io without local context → already done.
+	// Completed/seeding on Put.io without local context → already done,
+	// unless the data is not on disk yet and is waiting to be downloaded.
 	if in.PutioStatus == "COMPLETED" || in.PutioStatus == "SEEDING" {
+		if in.LocalMissing {
+			return progressResult{
+				PercentDone:   in.putioShare(),
+				LeftUntilDone: int64(in.PutioSize),
+				Status:        trStatusDownloadWaiting,
+			}
+		}
 		return progressResult{
 			PercentDone:   1.0,
 			LeftUntilDone: 0,
-			Status:        trStatusSeed,
+			Status:        mapPutioStatusValue(in.PutioStatus, in.StatusMap),
 		}
 	}
 
-	// No context — put.io only progress (0–50%).
-	putioProgress := float64(in.PutioPercentDone) / 200.0
+	// No context — put.io only progress (0–split).
+	putioProgress := float64(in.PutioPercentDone) / 100.0 * in.putioShare()
 	leftUntilDone := int64(float64(in.PutioSize) * (1.0 - float64(in.PutioPercentDone)/100.0))
 
 	return progressResult{
 		PercentDone:   putioProgress,
 		LeftUntilDone: leftUntilDone,
-		Status:        mapPutioStatusValue(in.PutioStatus),
+		Status:        mapPutioStatusValue(in.PutioStatus, in.StatusMap),
 	}
 }
 
@@ -78,15 +161,17 @@ func calculateProgressWithContext(in progressInput) progressResult {
 	state := ctx.GetState()
 	localSpeed, localETA := ctx.GetLocalProgress()
 
-	// Put.io progress (0–50%)
-	putioProgress := float64(in.PutioPercentDone) / 200.0
+	share := in.putioShare()
+
+	// Put.io progress (0–split)
+	putioProgress := float64(in.PutioPercentDone) / 100.0 * share
 
-	// Local download progress (0–50%)
+	// Local download progress (split–100%)
 	var localProgress float64
 	if totalSize > 0 {
-		localProgress = float64(downloadedSize) / float64(totalSize) * 0.5
+		localProgress = float64(downloadedSize) / float64(totalSize) * (1 - share)
 	} else if totalFiles > 0 {
-		localProgress = float64(completedFiles) / float64(totalFiles) * 0.5
+		localProgress = float64(completedFiles) / float64(totalFiles) * (1 - share)
 	}
 
 	percentDone := putioProgress + localProgress
@@ -107,7 +192,7 @@ func calculateProgressWithContext(in progressInput) progressResult {
 		leftUntilDone = 0
 		status = trStatusSeed
 	case download.TransferLifecycleCompleted:
-		status = mapPutioStatusValue(in.PutioStatus)
+		status = mapPutioStatusValue(in.PutioStatus, in.StatusMap)
 	default:
 		status = trStatusDownload
 	}
@@ -118,7 +203,8 @@ func calculateProgressWithContext(in progressInput) progressResult {
 		LeftUntilDone: leftUntilDone,
 	}
 
-	if !localETA.IsZero() {
+	// Local speed and ETA are stale once plundrio stops downloading
+	if state == download.TransferLifecycleDownloading && !localETA.IsZero() {
 		result.LocalETA = localETA
 		result.LocalSpeed = localSpeed
 	}
@@ -126,8 +212,13 @@ func calculateProgressWithContext(in progressInput) progressResult {
 	return result
 }
 
-// mapPutioStatusValue maps a Put.io transfer status string to a Transmission status code.
-func mapPutioStatusValue(status string) int {
+// mapPutioStatusValue maps a Put.io transfer status string to a Transmission
+// status code, preferring an entry in overrides if present.
+func mapPutioStatusValue(status string, overrides map[string]int) int {
+	if code, ok := overrides[status]; ok {
+		return code
+	}
+
 	switch status {
 	case "IN_QUEUE":
 		return trStatusDownloadWaiting
@@ -86,6 +86,18 @@ func TestCalculateProgress(t *testing.T) {
 			wantStatus:        trStatusSeed,
 			wantLeftUntilDone: 0,
 		},
+		{
+			name: "no context, COMPLETED but not downloaded yet",
+			input: progressInput{
+				PutioPercentDone: 100,
+				PutioStatus:      "COMPLETED",
+				PutioSize:        1000,
+				LocalMissing:     true,
+			},
+			wantPercentDone:   0.5,
+			wantStatus:        trStatusDownloadWaiting,
+			wantLeftUntilDone: 1000,
+		},
 		{
 			name: "no context, SEEDING status",
 			input: progressInput{
@@ -235,6 +247,72 @@ func TestCalculateProgress(t *testing.T) {
 			wantStatus:        trStatusStopped,
 			wantLeftUntilDone: 700,
 		},
+		// ---------------------------------------------------------------
+		// Configurable split
+		// ---------------------------------------------------------------
+		{
+			name: "split 0.3, no context, putio 50%",
+			input: progressInput{
+				PutioPercentDone: 50,
+				PutioStatus:      "DOWNLOADING",
+				PutioSize:        1000,
+				Split:            0.3,
+			},
+			wantPercentDone:   0.15, // 0.5 * 0.3
+			wantStatus:        trStatusDownload,
+			wantLeftUntilDone: 500,
+		},
+		{
+			name: "split 0.3, with context, putio 100% + local 50%",
+			input: progressInput{
+				PutioPercentDone: 100,
+				PutioStatus:      "COMPLETED",
+				PutioSize:        1000,
+				TransferCtx:      newTestTransferCtx(download.TransferLifecycleDownloading, 2, 1, 1000, 500),
+				Split:            0.3,
+			},
+			wantPercentDone:   0.65, // 0.3 (putio) + 0.35 (local 500/1000 * 0.7)
+			wantStatus:        trStatusDownload,
+			wantLeftUntilDone: 500,
+		},
+		{
+			name: "split 0.8, with context, putio 100% + local 25%",
+			input: progressInput{
+				PutioPercentDone: 100,
+				PutioStatus:      "COMPLETED",
+				PutioSize:        4000,
+				TransferCtx:      newTestTransferCtx(download.TransferLifecycleDownloading, 4, 1, 4000, 1000),
+				Split:            0.8,
+			},
+			wantPercentDone:   0.85, // 0.8 (putio) + 0.05 (local 1000/4000 * 0.2)
+			wantStatus:        trStatusDownload,
+			wantLeftUntilDone: 3000,
+		},
+		{
+			name: "split 0.3, with context, processed state",
+			input: progressInput{
+				PutioPercentDone: 100,
+				PutioStatus:      "COMPLETED",
+				PutioSize:        1000,
+				TransferCtx:      newTestTransferCtx(download.TransferLifecycleProcessed, 3, 3, 1000, 1000),
+				Split:            0.3,
+			},
+			wantPercentDone:   1.0,
+			wantStatus:        trStatusSeed,
+			wantLeftUntilDone: 0,
+		},
+		{
+			name: "out of range split falls back to 0.5",
+			input: progressInput{
+				PutioPercentDone: 50,
+				PutioStatus:      "DOWNLOADING",
+				PutioSize:        1000,
+				Split:            1.5,
+			},
+			wantPercentDone:   0.25,
+			wantStatus:        trStatusDownload,
+			wantLeftUntilDone: 500,
+		},
 	}
 
 	for _, tt := range tests {
@@ -254,3 +332,78 @@ func TestCalculateProgress(t *testing.T) {
 		})
 	}
 }
+
+func TestCalculateProgressCustomStatusMap(t *testing.T) {
+	statusMap := map[string]int{"ERROR": trStatusDownload, "IN_QUEUE": trStatusStopped}
+
+	tests := []struct {
+		name       string
+		status     string
+		statusMap  map[string]int
+		wantStatus int
+	}{
+		{"default ERROR", "ERROR", nil, trStatusStopped},
+		{"custom ERROR", "ERROR", statusMap, trStatusDownload},
+		{"custom IN_QUEUE", "IN_QUEUE", statusMap, trStatusStopped},
+		{"unmapped status keeps default", "DOWNLOADING", statusMap, trStatusDownload},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := calculateProgress(progressInput{
+				PutioPercentDone: 30,
+				PutioStatus:      tt.status,
+				PutioSize:        1000,
+				StatusMap:        tt.statusMap,
+			})
+			if got.Status != tt.wantStatus {
+				t.Errorf("Status = %d, want %d", got.Status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestCalculateProgressTotalSize(t *testing.T) {
+	tests := []struct {
+		name string
+		ctx  *download.TransferContext
+		want int64
+	}{
+		{"no context uses Put.io size", nil, 1000},
+		{"files not enumerated yet", newTestTransferCtx(download.TransferLifecycleInitial, 0, 0, 0, 0), 1000},
+		{"enumerated files sum", newTestTransferCtx(download.TransferLifecycleDownloading, 3, 0, 950, 100), 950},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := calculateProgress(progressInput{
+				PutioPercentDone: 100,
+				PutioStatus:      "COMPLETED",
+				PutioSize:        1000,
+				TransferCtx:      tt.ctx,
+			})
+			if got.TotalSize != tt.want {
+				t.Errorf("TotalSize = %d, want %d", got.TotalSize, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseStatusMapping(t *testing.T) {
+	got, err := ParseStatusMapping(map[string]string{"error": "download", "IN_QUEUE": "0", "seeding": " Seed "})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]int{"ERROR": trStatusDownload, "IN_QUEUE": trStatusStopped, "SEEDING": trStatusSeed}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("mapping[%s] = %d, want %d", k, got[k], v)
+		}
+	}
+
+	for _, bad := range []string{"7", "-1", "paused"} {
+		if _, err := ParseStatusMapping(map[string]string{"ERROR": bad}); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
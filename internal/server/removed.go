@@ -0,0 +1,43 @@
+package server
+
+import (
+	"time"
+
+	"github.com/elsbrock/go-putio"
+)
+
+// markRemoved records that a transfer was removed via torrent-remove, so it
+// stays hidden from torrent-get for the configured grace period.
+func (s *Server) markRemoved(transferID int64) {
+	if s.cfg.RemovedGracePeriod > 0 {
+		s.removed.Store(transferID, time.Now())
+	}
+}
+
+// withoutRemoved filters out transfers removed within the grace period. The
+// transfer list is refreshed periodically, so it may still hold a removed
+// transfer, or a scan that raced with the removal may add it back. Expired
+// entries are dropped.
+func (s *Server) withoutRemoved(transfers []*putio.Transfer) []*putio.Transfer {
+	now := time.Now()
+	hidden := make(map[int64]bool)
+	s.removed.Range(func(key, value interface{}) bool {
+		if now.Sub(value.(time.Time)) >= s.cfg.RemovedGracePeriod {
+			s.removed.Delete(key)
+		} else {
+			hidden[key.(int64)] = true
+		}
+		return true
+	})
+	if len(hidden) == 0 {
+		return transfers
+	}
+
+	visible := make([]*putio.Transfer, 0, len(transfers))
+	for _, t := range transfers {
+		if !hidden[t.ID] {
+			visible = append(visible, t)
+		}
+	}
+	return visible
+}
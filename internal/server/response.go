@@ -1,32 +1,52 @@
 package server
 
 import (
+	"compress/gzip"
 	"encoding/json"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/elsbrock/plundrio/internal/log"
 )
 
-// sendError sends an error response
-func (s *Server) sendError(w http.ResponseWriter, err error) {
-	log.Error("server").Msgf("Error processing request: %v", err)
+// sendError sends an error response. The HTTP status and the "code" field
+// identify the kind of error; internals of errors other than RPCError are
+// only logged.
+func (s *Server) sendError(w http.ResponseWriter, tag interface{}, err error) {
+	rpcErr := asRPCError(err)
+	log.Error("server").
+		Str("code", rpcErr.Code).
+		Err(err).
+		Msg("Error processing request")
 
 	resp := struct {
-		Result  string `json:"result"`
-		Message string `json:"message,omitempty"`
+		Tag     interface{} `json:"tag,omitempty"`
+		Result  string      `json:"result"`
+		Code    string      `json:"code"`
+		Message string      `json:"message"`
 	}{
+		Tag:     tag,
 		Result:  "error",
-		Message: err.Error(),
+		Code:    rpcErr.Code,
+		Message: rpcErr.Message,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Transmission-Session-Id", s.sessionID)
+	w.WriteHeader(rpcErr.HTTPStatus())
 	if err := json.NewEncoder(w).Encode(resp); err != nil {
 		log.Error("server").Msgf("Failed to encode error response: %v", err)
 	}
 }
 
-// sendResponse sends a success response
-func (s *Server) sendResponse(w http.ResponseWriter, tag interface{}, result interface{}) {
+// gzipMinSize is the smallest response body that is compressed for clients
+// accepting gzip; smaller bodies aren't worth the overhead
+const gzipMinSize = 1024
+
+// sendResponse sends a success response, gzip-compressed if it is large and
+// the client accepts it
+func (s *Server) sendResponse(w http.ResponseWriter, r *http.Request, tag interface{}, result interface{}) {
 	// Create the response structure that matches what the Transmission client expects
 	resp := struct {
 		Tag       interface{} `json:"tag,omitempty"`
@@ -38,13 +58,50 @@ func (s *Server) sendResponse(w http.ResponseWriter, tag interface{}, result int
 		Arguments: result,
 	}
 
+	respBytes, err := json.Marshal(resp)
+	if err != nil {
+		log.Error("server").Msgf("Failed to encode response: %v", err)
+		return
+	}
+	respBytes = append(respBytes, '\n')
+
 	// Log the response for debugging
-	respBytes, _ := json.Marshal(resp)
 	log.Debug("server").Msgf("Sending response: %s", string(respBytes))
 
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("X-Transmission-Session-Id", "123") // Ensure session ID is always sent
-	if err := json.NewEncoder(w).Encode(resp); err != nil {
-		log.Error("server").Msgf("Failed to encode response: %v", err)
+	w.Header().Set("X-Transmission-Session-Id", s.sessionID) // Ensure session ID is always sent
+	w.Header().Add("Vary", "Accept-Encoding")
+
+	if len(respBytes) < gzipMinSize || !acceptsGzip(r) {
+		if _, err := w.Write(respBytes); err != nil {
+			log.Error("server").Msgf("Failed to write response: %v", err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Encoding", "gzip")
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(respBytes); err != nil {
+		log.Error("server").Msgf("Failed to write response: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		log.Error("server").Msgf("Failed to write response: %v", err)
+	}
+}
+
+// acceptsGzip reports whether the request's Accept-Encoding allows gzip.
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			continue
+		}
+		// "gzip;q=0" explicitly refuses gzip
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			q, err := strconv.ParseFloat(v, 64)
+			return err == nil && q > 0
+		}
+		return true
 	}
+	return false
 }
@@ -2,19 +2,25 @@ package server
 
 import (
 	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
 	"net/http"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	_ "net/http/pprof"
 
 	"github.com/elsbrock/go-putio"
+	"github.com/elsbrock/plundrio/internal/api"
 	"github.com/elsbrock/plundrio/internal/config"
 	"github.com/elsbrock/plundrio/internal/download"
 	"github.com/elsbrock/plundrio/internal/log"
 )
 
-// PutioClient abstracts the put.io API methods used by the RPC server.
+// PutioClient abstracts the put.io API methods used by the RPC server. It is
+// a subset of api.APIClient.
 type PutioClient interface {
 	GetAccountInfo(ctx context.Context) (*putio.AccountInfo, error)
 	GetTransfers(ctx context.Context) ([]*putio.Transfer, error)
@@ -22,15 +28,31 @@ type PutioClient interface {
 	AddTransfer(ctx context.Context, magnetLink string, folderID int64) (string, error)
 	DeleteFile(ctx context.Context, fileID int64) error
 	DeleteTransfer(ctx context.Context, transferID int64) error
+	GetAllTransferFilePaths(ctx context.Context, fileID int64) ([]*putio.File, map[int64]string, error)
+	GetDownloadURL(ctx context.Context, fileID int64) (string, error)
 }
 
+var _ PutioClient = api.APIClient(nil)
+
 // DownloadService abstracts the download manager for the RPC server.
 type DownloadService interface {
 	GetTransfers() []*putio.Transfer
 	GetTransferContext(transferID int64) (*download.TransferContext, bool)
+	TransferError(transferID int64) string
 	SetCategory(hash, category string)
 	GetCategory(hash string) string
 	RemoveCategory(hash string)
+	SetPriority(hash string, priority int)
+	GetPriority(hash string) int
+	TransferDir(transfer *putio.Transfer) string
+	GetLifetimeStats() download.LifetimeStats
+	Metrics() download.Metrics
+	HasLocalData(transfer *putio.Transfer) bool
+	Rescan(ctx context.Context) (download.RescanSummary, error)
+	Ready() bool
+	LastPoll() time.Time
+	Paused() bool
+	SetSessionRateLimit(bytesPerSec int64)
 	Stop()
 }
 
@@ -39,21 +61,62 @@ type Server struct {
 	cfg          *config.Config
 	client       PutioClient
 	srv          *http.Server
+	streamClient *http.Client // fetches files from Put.io for /stream
 	quotaTicker  *time.Ticker
 	stopChan     chan struct{}
 	dlService    DownloadService
+	clients      *clientTracker
+	unsupported  *methodTracker // RPC methods called by clients but not implemented
+	sessionID    string         // X-Transmission-Session-Id clients must echo, random per process
+	startedAt    time.Time      // for the uptime reported by /healthz
+	settings     *sessionSettings
+	hashAliases  sync.Map    // alternate info-hash (e.g. BEP 52 v2) → hash reported by Put.io
+	removed      sync.Map    // transfer id → time it was removed via torrent-remove
 	quotaWarning atomic.Bool // tracks if we've already warned about quota
 }
 
+// defaultQuotaCheckInterval is used when no quota check interval is configured
+const defaultQuotaCheckInterval = 15 * time.Minute
+
+// HTTP server timeouts. The write timeout is generous because torrent-get
+// responses for large libraries can be big, but bounded so that stuck
+// clients cannot hold connections forever.
+const (
+	defaultRPCReadTimeout  = 30 * time.Second
+	defaultRPCWriteTimeout = 2 * time.Minute
+	rpcReadHeaderTimeout   = 10 * time.Second
+	rpcIdleTimeout         = 2 * time.Minute
+)
+
 // New creates a new RPC server
 func New(cfg *config.Config, client PutioClient, dlService DownloadService) *Server {
-	return &Server{
+	s := &Server{
 		cfg:         cfg,
 		client:      client,
 		stopChan:    make(chan struct{}),
 		dlService:   dlService,
-		quotaTicker: time.NewTicker(15 * time.Minute),
+		clients:     newClientTracker(),
+		unsupported: newMethodTracker(),
+		sessionID:   rand.Text(),
+		startedAt:   time.Now(),
+		settings:    newSessionSettings(cfg.TargetDir, cfg.PersistSessionSettings),
+	}
+	s.streamClient = newStreamClient(cfg.TLSConfig, cfg.Proxy)
+
+	if err := s.settings.Load(); err != nil {
+		log.Warn("server").Err(err).Msg("Failed to load session settings")
+	}
+	s.applySpeedLimit()
+
+	if !cfg.DisableQuotaMonitor {
+		interval := cfg.QuotaCheckInterval
+		if interval <= 0 {
+			interval = defaultQuotaCheckInterval
+		}
+		s.quotaTicker = time.NewTicker(interval)
 	}
+
+	return s
 }
 
 // Start begins listening for RPC requests
@@ -61,10 +124,36 @@ func (s *Server) Start() error {
 	// Initialize server first
 	mux := http.NewServeMux()
 	mux.HandleFunc("/transmission/rpc", s.handleRPC)
+	mux.HandleFunc("GET /healthz", s.handleHealth)
+	if s.cfg.EnableStream {
+		mux.HandleFunc("GET /stream/{hash}/{file...}", s.handleStream)
+		log.Info("server").Msg("Streaming endpoint enabled")
+	}
+	if s.cfg.EnableMetrics {
+		mux.HandleFunc("GET /metrics", s.handleMetrics)
+		log.Info("server").Msg("Metrics endpoint enabled")
+	}
+	if s.cfg.AdminToken != "" {
+		mux.HandleFunc("POST /rescan", s.handleRescan)
+		log.Info("server").Msg("Admin endpoints enabled")
+	}
+
+	readTimeout := s.cfg.RPCReadTimeout
+	if readTimeout <= 0 {
+		readTimeout = defaultRPCReadTimeout
+	}
+	writeTimeout := s.cfg.RPCWriteTimeout
+	if writeTimeout <= 0 {
+		writeTimeout = defaultRPCWriteTimeout
+	}
 
 	s.srv = &http.Server{
-		Addr:    s.cfg.ListenAddr,
-		Handler: mux,
+		Addr:              s.cfg.ListenAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: min(rpcReadHeaderTimeout, readTimeout),
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       rpcIdleTimeout,
 	}
 
 	// Get and log account info
@@ -80,14 +169,44 @@ func (s *Server) Start() error {
 			Msg("Put.io account status")
 	}
 
-	// Check initial disk quota
+	if s.cfg.TrashOnRemove > 0 {
+		s.startTrashPurger()
+	}
+
+	if s.quotaTicker != nil {
+		s.startQuotaMonitor()
+	} else {
+		log.Info("server").Msg("Quota monitor disabled")
+	}
+
+	if s.cfg.RPCTLSCert == "" || s.cfg.RPCTLSKey == "" {
+		log.Info("server").Str("addr", s.cfg.ListenAddr).Msg("Starting transmission-rpc server")
+		err = s.srv.ListenAndServe()
+	} else {
+		if s.cfg.RPCTLSAuto {
+			if err := ensureSelfSignedCert(s.cfg.RPCTLSCert, s.cfg.RPCTLSKey, time.Now()); err != nil {
+				return fmt.Errorf("self-signed certificate: %w", err)
+			}
+		}
+		log.Info("server").Str("addr", s.cfg.ListenAddr).Msg("Starting transmission-rpc server over HTTPS")
+		err = s.srv.ListenAndServeTLS(s.cfg.RPCTLSCert, s.cfg.RPCTLSKey)
+	}
+	// Stop closes the server
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// startQuotaMonitor performs an initial disk quota check and then re-checks
+// on every tick of the quota ticker until the server is stopped.
+func (s *Server) startQuotaMonitor() {
 	if overQuota, err := s.checkDiskQuota(); err != nil {
 		log.Warn("server").Err(err).Msg("Failed to check initial disk quota")
 	} else if overQuota {
 		log.Warn("server").Msg("Put.io account is over quota on startup")
 	}
 
-	// Start quota monitoring
 	go func() {
 		for {
 			select {
@@ -100,16 +219,21 @@ func (s *Server) Start() error {
 			}
 		}
 	}()
-
-	log.Info("server").Str("addr", s.cfg.ListenAddr).Msg("Starting transmission-rpc server")
-	return s.srv.ListenAndServe()
 }
 
 // Stop gracefully shuts down the server
 func (s *Server) Stop() error {
-	s.quotaTicker.Stop()
+	if s.quotaTicker != nil {
+		s.quotaTicker.Stop()
+	}
 	close(s.stopChan)
 
+	if methods := s.unsupported.Counts(); len(methods) > 0 {
+		log.Info("server").
+			Interface("unsupported_methods", methods).
+			Msg("Unsupported RPC methods called during this session")
+	}
+
 	// Stop the download service
 	s.dlService.Stop()
 
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"time"
+)
+
+// handleSessionStats processes session-stats requests. Transfers count as
+// paused when reported as stopped and as active otherwise, as in
+// Transmission; speeds are summed from the rates torrent-get reports.
+func (s *Server) handleSessionStats() map[string]interface{} {
+	transfers := s.withoutRemoved(s.dlService.GetTransfers())
+
+	var active, paused, downloadSpeed, uploadSpeed int
+	for _, t := range transfers {
+		prog, _ := s.transferProgress(t)
+		if prog.Status == trStatusStopped {
+			paused++
+		} else {
+			active++
+		}
+		downloadSpeed += downloadRate(t, prog)
+		uploadSpeed += t.UploadSpeed
+	}
+
+	clients := s.clients.Active(clientActiveWindow, time.Now())
+
+	connected := make([]map[string]interface{}, 0, len(clients))
+	for _, c := range clients {
+		connected = append(connected, map[string]interface{}{
+			"host":      c.Host,
+			"userAgent": c.UserAgent,
+			"firstSeen": c.FirstSeen.Unix(),
+			"lastSeen":  c.LastSeen.Unix(),
+			"requests":  c.Requests,
+		})
+	}
+
+	lifetime := s.dlService.GetLifetimeStats()
+
+	return map[string]interface{}{
+		"torrentCount":       len(transfers),
+		"activeTorrentCount": active,
+		"pausedTorrentCount": paused,
+		"downloadSpeed":      downloadSpeed,
+		"uploadSpeed":        uploadSpeed,
+		"connectedClients":   len(clients),
+		"paused":             s.dlService.Paused(),
+		"clients":            connected,
+		"cumulative-stats": map[string]interface{}{
+			"downloadedBytes":    lifetime.BytesDownloaded,
+			"uploadedBytes":      0,
+			"filesAdded":         lifetime.FilesCompleted,
+			"sessionCount":       lifetime.SessionCount,
+			"secondsActive":      lifetime.SecondsActive,
+			"transfersCompleted": lifetime.TransfersCompleted,
+			"transfersFailed":    lifetime.TransfersFailed,
+			"filesFailed":        lifetime.FilesFailed,
+		},
+	}
+}
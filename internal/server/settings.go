@@ -0,0 +1,183 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// sessionSettingsFileName is the sidecar file in the target directory that
+// holds session-set values when persistence is enabled.
+const sessionSettingsFileName = ".plundrio-session.json"
+
+// sessionSettingKinds lists the session-set keys plundrio accepts, with the
+// JSON kind each value must have. Everything else, including runtime-only
+// values such as download-dir that are owned by the configuration and
+// upload limits as plundrio never uploads, is ignored.
+var sessionSettingKinds = map[string]string{
+	"speed-limit-down":         "number",
+	"speed-limit-down-enabled": "bool",
+	"alt-speed-down":           "number",
+	"alt-speed-enabled":        "bool",
+}
+
+// speedLimitUnit is the unit of Transmission's speed limits, kB/s, in
+// bytes per second
+const speedLimitUnit = 1000
+
+// sessionSettings holds values set by clients via session-set and reported
+// back by session-get. If path is set they are persisted across restarts.
+type sessionSettings struct {
+	mu     sync.Mutex
+	path   string
+	values map[string]interface{}
+}
+
+// newSessionSettings returns a settings store, persisted to the sidecar file
+// in targetDir if persist is set.
+func newSessionSettings(targetDir string, persist bool) *sessionSettings {
+	ss := &sessionSettings{values: make(map[string]interface{})}
+	if persist {
+		ss.path = filepath.Join(targetDir, sessionSettingsFileName)
+	}
+	return ss
+}
+
+// Load reads persisted settings. Unknown keys and values of the wrong kind
+// are dropped so that an edited file can't inject arbitrary session values.
+func (ss *sessionSettings) Load() error {
+	if ss.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(ss.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read session settings: %w", err)
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("failed to parse session settings: %w", err)
+	}
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	for k, v := range values {
+		if validSessionSetting(k, v) {
+			ss.values[k] = v
+		}
+	}
+	return nil
+}
+
+// Apply stores the supported settings from args and persists them if
+// enabled. It returns the keys that were ignored.
+func (ss *sessionSettings) Apply(args map[string]interface{}) ([]string, error) {
+	var ignored []string
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	changed := false
+	for k, v := range args {
+		if !validSessionSetting(k, v) {
+			ignored = append(ignored, k)
+			continue
+		}
+		ss.values[k] = v
+		changed = true
+	}
+	sort.Strings(ignored)
+
+	if !changed || ss.path == "" {
+		return ignored, nil
+	}
+	data, err := json.Marshal(ss.values)
+	if err != nil {
+		return ignored, fmt.Errorf("failed to marshal session settings: %w", err)
+	}
+	if err := os.WriteFile(ss.path, data, 0644); err != nil {
+		return ignored, fmt.Errorf("failed to write session settings: %w", err)
+	}
+	return ignored, nil
+}
+
+// Values returns a copy of the current settings.
+func (ss *sessionSettings) Values() map[string]interface{} {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	values := make(map[string]interface{}, len(ss.values))
+	for k, v := range ss.values {
+		values[k] = v
+	}
+	return values
+}
+
+// DownloadLimit returns the download rate limit the settings ask for in
+// bytes per second, or 0 if none: the alternative limit while it is
+// enabled, otherwise the regular one if enabled. A limit of 0 is treated
+// as none rather than stopping all downloads.
+func (ss *sessionSettings) DownloadLimit() int64 {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	var limit float64
+	switch {
+	case ss.values["alt-speed-enabled"] == true:
+		limit, _ = ss.values["alt-speed-down"].(float64)
+	case ss.values["speed-limit-down-enabled"] == true:
+		limit, _ = ss.values["speed-limit-down"].(float64)
+	}
+	return int64(max(limit, 0) * speedLimitUnit)
+}
+
+// applySpeedLimit hands the download limit of the session settings to the
+// download manager.
+func (s *Server) applySpeedLimit() {
+	limit := s.settings.DownloadLimit()
+	s.dlService.SetSessionRateLimit(limit)
+	log.Debug("rpc").
+		Int64("bytes_per_sec", limit).
+		Msg("Applied session download limit")
+}
+
+// validSessionSetting reports whether key is a supported setting and value
+// has the expected JSON kind.
+func validSessionSetting(key string, value interface{}) bool {
+	switch sessionSettingKinds[key] {
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "bool":
+		_, ok := value.(bool)
+		return ok
+	default:
+		return false
+	}
+}
+
+// handleSessionSet processes session-set requests
+func (s *Server) handleSessionSet(args json.RawMessage) (interface{}, error) {
+	var params map[string]interface{}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return nil, errInvalidArgs("invalid arguments", err)
+	}
+
+	ignored, err := s.settings.Apply(params)
+	s.applySpeedLimit()
+	if len(ignored) > 0 {
+		log.Debug("rpc").
+			Str("operation", "session-set").
+			Strs("ignored", ignored).
+			Msg("Ignoring unsupported session settings")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return struct{}{}, nil
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/elsbrock/plundrio/internal/config"
+)
+
+func TestSessionSettingsPersist(t *testing.T) {
+	dir := t.TempDir()
+
+	ss := newSessionSettings(dir, true)
+	ignored, err := ss.Apply(map[string]interface{}{
+		"speed-limit-down":         float64(500),
+		"speed-limit-down-enabled": true,
+		"download-dir":             "/elsewhere",
+		"alt-speed-enabled":        "yes",
+	})
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if want := []string{"alt-speed-enabled", "download-dir"}; !reflect.DeepEqual(ignored, want) {
+		t.Errorf("ignored = %v, want %v", ignored, want)
+	}
+
+	reloaded := newSessionSettings(dir, true)
+	if err := reloaded.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	want := map[string]interface{}{
+		"speed-limit-down":         float64(500),
+		"speed-limit-down-enabled": true,
+	}
+	if got := reloaded.Values(); !reflect.DeepEqual(got, want) {
+		t.Errorf("reloaded values = %v, want %v", got, want)
+	}
+}
+
+func TestSessionSettingsNotPersistedByDefault(t *testing.T) {
+	dir := t.TempDir()
+
+	ss := newSessionSettings(dir, false)
+	if _, err := ss.Apply(map[string]interface{}{"speed-limit-down": float64(10)}); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, sessionSettingsFileName)); !os.IsNotExist(err) {
+		t.Error("settings file should not be written when persistence is disabled")
+	}
+	if ss.Values()["speed-limit-down"] != float64(10) {
+		t.Error("settings should still apply for the running session")
+	}
+}
+
+func TestSessionSettingsLoadDropsUnknownKeys(t *testing.T) {
+	dir := t.TempDir()
+	data := `{"speed-limit-down": 20, "speed-limit-up": 20, "download-dir": "/tmp", "alt-speed-enabled": 1}`
+	if err := os.WriteFile(filepath.Join(dir, sessionSettingsFileName), []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ss := newSessionSettings(dir, true)
+	if err := ss.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got := ss.Values(); len(got) != 1 || got["speed-limit-down"] != float64(20) {
+		t.Errorf("values = %v, want only speed-limit-down", got)
+	}
+}
+
+func TestHandleSessionSetThenGet(t *testing.T) {
+	cfg := &config.Config{TargetDir: t.TempDir(), DisableQuotaMonitor: true, PersistSessionSettings: true}
+	s := New(cfg, &fakePutioClient{}, &fakeDownloadService{ready: true})
+
+	rec := doRPC(s, `{"method":"session-set","arguments":{"alt-speed-enabled":true}}`)
+	if !strings.Contains(rec.Body.String(), `"result":"success"`) {
+		t.Fatalf("session-set body = %s", rec.Body.String())
+	}
+
+	// A new server reads the persisted value back
+	s = New(cfg, &fakePutioClient{}, &fakeDownloadService{ready: true})
+	rec = doRPC(s, `{"method":"session-get","arguments":{}}`)
+
+	var resp struct {
+		Arguments map[string]interface{} `json:"arguments"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Arguments["alt-speed-enabled"] != true {
+		t.Errorf("session-get alt-speed-enabled = %v, want true", resp.Arguments["alt-speed-enabled"])
+	}
+	if resp.Arguments["download-dir"] != cfg.TargetDir {
+		t.Errorf("session-get download-dir = %v, want %v", resp.Arguments["download-dir"], cfg.TargetDir)
+	}
+}
+
+func TestHandleSessionSetAppliesDownloadLimit(t *testing.T) {
+	dl := &fakeDownloadService{ready: true}
+	s := newTestServer(&fakePutioClient{}, dl)
+
+	doRPC(s, `{"method":"session-set","arguments":{"speed-limit-down":500,"speed-limit-down-enabled":true,"alt-speed-down":50}}`)
+	if dl.rateLimit != 500000 {
+		t.Errorf("rate limit = %d, want 500000", dl.rateLimit)
+	}
+
+	// The alternative limit takes over while it is enabled
+	doRPC(s, `{"method":"session-set","arguments":{"alt-speed-enabled":true}}`)
+	if dl.rateLimit != 50000 {
+		t.Errorf("rate limit = %d, want 50000", dl.rateLimit)
+	}
+
+	doRPC(s, `{"method":"session-set","arguments":{"alt-speed-enabled":false,"speed-limit-down-enabled":false}}`)
+	if dl.rateLimit != 0 {
+		t.Errorf("rate limit = %d, want 0", dl.rateLimit)
+	}
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/download"
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// streamHeaders are the upstream response headers passed through to
+// streaming clients. They are enough for players to seek via range requests.
+var streamHeaders = []string{
+	"Accept-Ranges",
+	"Content-Length",
+	"Content-Range",
+	"Content-Type",
+	"ETag",
+	"Last-Modified",
+}
+
+// handleStream proxies a file of a Put.io transfer to the requesting client
+// without writing it to the target directory. Range requests are forwarded
+// so clients can seek.
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request) {
+	if !s.streamAuthorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="plundrio"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	hash := download.NormalizeHash(r.PathValue("hash"))
+	// The path of the file within the transfer, as several of its
+	// directories may hold files of the same name
+	name := strings.TrimPrefix(path.Clean("/"+r.PathValue("file")), "/")
+
+	transfers, err := s.findTransfers(r.Context(), "stream", []string{hash})
+	if err != nil {
+		log.Error("stream").Err(err).Msg("Failed to get transfers")
+		http.Error(w, "failed to get transfers", http.StatusBadGateway)
+		return
+	}
+	if len(transfers) == 0 || transfers[0].FileID == 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	files, paths, err := s.client.GetAllTransferFilePaths(r.Context(), transfers[0].FileID)
+	if err != nil {
+		log.Error("stream").Str("hash", hash).Err(err).Msg("Failed to get transfer files")
+		http.Error(w, "failed to get transfer files", http.StatusBadGateway)
+		return
+	}
+
+	var fileID int64
+	for _, f := range files {
+		if paths[f.ID] == name {
+			fileID = f.ID
+			break
+		}
+	}
+	if fileID == 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	url, err := s.client.GetDownloadURL(r.Context(), fileID)
+	if err != nil {
+		log.Error("stream").Int64("file_id", fileID).Err(err).Msg("Failed to get download URL")
+		http.Error(w, "failed to get download URL", http.StatusBadGateway)
+		return
+	}
+
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, url, nil)
+	if err != nil {
+		http.Error(w, "failed to create request", http.StatusInternalServerError)
+		return
+	}
+	if rng := r.Header.Get("Range"); rng != "" {
+		req.Header.Set("Range", rng)
+	}
+
+	resp, err := s.streamClient.Do(req)
+	if err != nil {
+		log.Error("stream").Int64("file_id", fileID).Err(err).Msg("Failed to fetch file")
+		http.Error(w, "failed to fetch file", http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	for _, h := range streamHeaders {
+		if v := resp.Header.Get(h); v != "" {
+			w.Header().Set(h, v)
+		}
+	}
+
+	// Streams can take far longer than the RPC write timeout allows
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil && err != http.ErrNotSupported {
+		log.Debug("stream").Err(err).Msg("Failed to clear write deadline")
+	}
+
+	log.Info("stream").
+		Str("hash", hash).
+		Str("file", name).
+		Str("range", req.Header.Get("Range")).
+		Msg("Streaming file")
+
+	w.WriteHeader(resp.StatusCode)
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		log.Debug("stream").Str("file", name).Err(err).Msg("Stream ended early")
+	}
+}
+
+// streamAuthorized reports whether the request carries the configured stream
+// token, either as a bearer token or as the "token" query parameter.
+func (s *Server) streamAuthorized(r *http.Request) bool {
+	return tokenAuthorized(r, s.cfg.StreamToken)
+}
+
+// tokenAuthorized reports whether the request carries want, either as a
+// bearer token or as the "token" query parameter. An empty want authorizes
+// nothing.
+func tokenAuthorized(r *http.Request, want string) bool {
+	if want == "" {
+		return false
+	}
+	token := r.URL.Query().Get("token")
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(want)) == 1
+}
+
+// newStreamClient returns the client used to fetch streamed files from
+// Put.io, applying tlsConfig and proxy if set.
+func newStreamClient(tlsConfig *tls.Config, proxy func(*http.Request) (*url.URL, error)) *http.Client {
+	if tlsConfig == nil && proxy == nil {
+		return http.DefaultClient
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	if proxy != nil {
+		transport.Proxy = proxy
+	}
+	return &http.Client{Transport: transport}
+}
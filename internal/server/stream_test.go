@@ -0,0 +1,79 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elsbrock/go-putio"
+	"github.com/elsbrock/plundrio/internal/config"
+)
+
+func TestHandleStream(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "episode.mkv", time.Time{}, strings.NewReader("0123456789"))
+	}))
+	defer upstream.Close()
+	sample := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "episode.mkv", time.Time{}, strings.NewReader("sample"))
+	}))
+	defer sample.Close()
+
+	client := &fakePutioClient{
+		transfers: []*putio.Transfer{{ID: 1, Hash: "abcdef", FileID: 10}},
+		files: map[int64][]*putio.File{
+			10: {{ID: 11, Name: "episode.mkv"}, {ID: 12, Name: "Sample/episode.mkv"}},
+		},
+		downloadURLs: map[int64]string{11: upstream.URL, 12: sample.URL},
+	}
+	cfg := &config.Config{DisableQuotaMonitor: true, EnableStream: true, StreamToken: "secret"}
+	s := New(cfg, client, &fakeDownloadService{ready: true})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /stream/{hash}/{file...}", s.handleStream)
+
+	tests := []struct {
+		name       string
+		path       string
+		auth       string
+		rng        string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "missing token", path: "/stream/abcdef/episode.mkv", wantStatus: http.StatusUnauthorized},
+		{name: "wrong token", path: "/stream/abcdef/episode.mkv", auth: "Bearer nope", wantStatus: http.StatusUnauthorized},
+		{name: "full file", path: "/stream/ABCDEF/episode.mkv", auth: "Bearer secret", wantStatus: http.StatusOK, wantBody: "0123456789"},
+		{name: "range", path: "/stream/abcdef/episode.mkv?token=secret", rng: "bytes=2-4", wantStatus: http.StatusPartialContent, wantBody: "234"},
+		{name: "same name in a subdirectory", path: "/stream/abcdef/Sample/episode.mkv", auth: "Bearer secret", wantStatus: http.StatusOK, wantBody: "sample"},
+		{name: "wrong directory", path: "/stream/abcdef/Show/episode.mkv", auth: "Bearer secret", wantStatus: http.StatusNotFound},
+		{name: "unknown file", path: "/stream/abcdef/other.mkv", auth: "Bearer secret", wantStatus: http.StatusNotFound},
+		{name: "unknown transfer", path: "/stream/123456/episode.mkv", auth: "Bearer secret", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			if tt.rng != "" {
+				req.Header.Set("Range", tt.rng)
+			}
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantBody != "" {
+				body, _ := io.ReadAll(rec.Body)
+				if string(body) != tt.wantBody {
+					t.Errorf("body = %q, want %q", body, tt.wantBody)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"bytes"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/config"
+)
+
+func TestEnsureSelfSignedCert(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "rpc.crt")
+	keyFile := filepath.Join(dir, "rpc.key")
+
+	if err := ensureSelfSignedCert(certFile, keyFile, time.Now()); err != nil {
+		t.Fatalf("ensureSelfSignedCert() error = %v", err)
+	}
+	if _, err := tls.LoadX509KeyPair(certFile, keyFile); err != nil {
+		t.Fatalf("generated pair doesn't load: %v", err)
+	}
+	if info, err := os.Stat(keyFile); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("key file mode = %v, %v; want 0600", info.Mode().Perm(), err)
+	}
+
+	// The certificate is kept on later runs so clients can pin it
+	first, _ := os.ReadFile(certFile)
+	if err := ensureSelfSignedCert(certFile, keyFile, time.Now()); err != nil {
+		t.Fatalf("ensureSelfSignedCert() second call error = %v", err)
+	}
+	if second, _ := os.ReadFile(certFile); !bytes.Equal(first, second) {
+		t.Error("existing certificate was replaced")
+	}
+}
+
+func TestServerStartTLS(t *testing.T) {
+	// Find a free port for the server
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	dir := t.TempDir()
+	s := New(&config.Config{
+		TargetDir:           t.TempDir(),
+		ListenAddr:          addr,
+		DisableQuotaMonitor: true,
+		RPCTLSCert:          filepath.Join(dir, "rpc.crt"),
+		RPCTLSKey:           filepath.Join(dir, "rpc.key"),
+		RPCTLSAuto:          true,
+	}, &fakePutioClient{}, &fakeDownloadService{ready: true})
+
+	errc := make(chan error, 1)
+	go func() { errc <- s.Start() }()
+
+	client := &http.Client{
+		Timeout:   time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+	}
+	var resp *http.Response
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, err = client.Get("https://" + addr + "/healthz")
+		if err == nil || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("GET over HTTPS failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.TLS == nil {
+		t.Error("response not served over TLS")
+	}
+
+	if err := s.Stop(); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Errorf("Start() after Stop() = %v, want nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Start() did not return after Stop()")
+	}
+}
@@ -7,112 +7,289 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/elsbrock/go-putio"
+	"github.com/elsbrock/plundrio/internal/config"
 	"github.com/elsbrock/plundrio/internal/download"
 	"github.com/elsbrock/plundrio/internal/log"
 )
 
 // extractCategory returns the relative category path from downloadDir.
 // For example, if targetDir="/downloads" and downloadDir="/downloads/tv",
-// it returns "tv". Returns "" if downloadDir is empty or equals targetDir.
+// it returns "tv". Returns "" if downloadDir is empty, equals targetDir or
+// lies outside of it.
 func extractCategory(targetDir, downloadDir string) string {
 	if downloadDir == "" {
 		return ""
 	}
-	rel, err := filepath.Rel(targetDir, downloadDir)
-	if err != nil || rel == "." {
+	rel, ok := relativeTo(targetDir, downloadDir)
+	if !ok || rel == "." {
 		return ""
 	}
-	// Clean up any trailing slashes or path oddities
-	return filepath.Clean(rel)
+	return rel
 }
 
-// findTransferByHash finds a transfer by its hash string
-func (s *Server) findTransferByHash(ctx context.Context, hash string) (*putio.Transfer, error) {
+// relativeTo returns path relative to dir, and false if it isn't within dir.
+func relativeTo(dir, path string) (string, bool) {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return rel, true
+}
+
+// downloadDirCategory returns the last path segment of a client's download
+// directory, for clients whose paths don't live below the target directory
+// (e.g. /data/media/movies → "movies"). Both slash styles are accepted.
+func downloadDirCategory(downloadDir string) string {
+	segments := strings.FieldsFunc(downloadDir, func(r rune) bool {
+		return r == '/' || r == '\\'
+	})
+	if len(segments) == 0 {
+		return ""
+	}
+	switch last := segments[len(segments)-1]; last {
+	case ".", "..":
+		return ""
+	default:
+		return last
+	}
+}
+
+// folderForDownloadDir returns the Put.io folder a transfer added with
+// downloadDir is saved to: that of the folder mapping whose target directory
+// contains downloadDir, the most specific one if several do, or else the
+// primary folder with a nil mapping.
+func (s *Server) folderForDownloadDir(downloadDir string) (int64, *config.FolderMapping) {
+	var best *config.FolderMapping
+	if downloadDir == "" {
+		return s.cfg.FolderID, nil
+	}
+	for i := range s.cfg.FolderMappings {
+		mapping := &s.cfg.FolderMappings[i]
+		if _, ok := relativeTo(mapping.TargetDir, downloadDir); !ok {
+			continue
+		}
+		if best == nil || len(mapping.TargetDir) > len(best.TargetDir) {
+			best = mapping
+		}
+	}
+	if best == nil {
+		return s.cfg.FolderID, nil
+	}
+	return best.FolderID, best
+}
+
+// labelCategory returns the first usable label of a torrent-add or
+// torrent-set request as a category. Labels are single folder names, so only the last segment of a
+// label containing slashes is kept.
+func labelCategory(labels []string) string {
+	for _, label := range labels {
+		if category := downloadDirCategory(strings.TrimSpace(label)); category != "" {
+			return category
+		}
+	}
+	return ""
+}
+
+// torrentIDs holds transmission-rpc torrent identifiers. Clients may send a
+// single id or a list, each either a numeric id or a hash string.
+type torrentIDs []string
+
+// UnmarshalJSON accepts a number, a string or a list of either. The special
+// value "recently-active" is treated as no filter.
+func (ids *torrentIDs) UnmarshalJSON(data []byte) error {
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	values, ok := raw.([]interface{})
+	if !ok {
+		values = []interface{}{raw}
+	}
+
+	*ids = (*ids)[:0]
+	for _, v := range values {
+		switch id := v.(type) {
+		case string:
+			if id == "recently-active" {
+				continue
+			}
+			*ids = append(*ids, id)
+		case float64:
+			*ids = append(*ids, strconv.FormatInt(int64(id), 10))
+		case nil:
+		default:
+			return fmt.Errorf("invalid torrent id: %v", v)
+		}
+	}
+	return nil
+}
+
+// accountReporter is implemented by Put.io clients combining several
+// accounts, so transfers can be tagged with the account they belong to.
+type accountReporter interface {
+	TransferAccount(transferID int64) string
+}
+
+// limitTransfers returns the max most recently created transfers, newest
+// first. Transfers are returned unchanged if max is 0 or not exceeded.
+func limitTransfers(transfers []*putio.Transfer, max int) []*putio.Transfer {
+	if max <= 0 || len(transfers) <= max {
+		return transfers
+	}
+
+	sorted := slices.Clone(transfers)
+	slices.SortStableFunc(sorted, func(a, b *putio.Transfer) int {
+		return createdAt(b).Compare(createdAt(a))
+	})
+	return sorted[:max]
+}
+
+// requiredFields are always returned by torrent-get, since clients correlate
+// torrents by them
+var requiredFields = []string{"id", "hashString"}
+
+// selectFields reduces a torrent-get entry to the requested fields plus
+// requiredFields, ignoring unknown ones. Without requested fields the entry
+// is returned in full.
+func selectFields(info map[string]interface{}, fields []string) map[string]interface{} {
+	if len(fields) == 0 {
+		return info
+	}
+	selected := make(map[string]interface{}, len(fields)+len(requiredFields))
+	for _, names := range [][]string{requiredFields, fields} {
+		for _, name := range names {
+			if v, ok := info[name]; ok {
+				selected[name] = v
+			}
+		}
+	}
+	return selected
+}
+
+// createdAt returns when a transfer was created, or the zero time if unknown
+func createdAt(transfer *putio.Transfer) time.Time {
+	if transfer.CreatedAt == nil {
+		return time.Time{}
+	}
+	return transfer.CreatedAt.Time
+}
+
+// matchesTorrentID reports whether id refers to transfer t, either by its
+// Put.io transfer id or by its hash.
+func matchesTorrentID(t *putio.Transfer, id string) bool {
+	if n, err := strconv.ParseInt(id, 10, 64); err == nil && n == t.ID {
+		return true
+	}
+	return download.NormalizeHash(id) == download.NormalizeHash(t.Hash)
+}
+
+// findTransfers resolves torrent ids with a single transfer list lookup.
+// Ids that don't match any transfer are logged and skipped.
+func (s *Server) findTransfers(ctx context.Context, operation string, ids []string) ([]*putio.Transfer, error) {
 	transfers, err := s.client.GetTransfers(ctx)
 	if err != nil {
 		return nil, err
 	}
-	for _, t := range transfers {
-		if t.Hash == hash {
-			return t, nil
+
+	var found []*putio.Transfer
+	for _, id := range ids {
+		var match *putio.Transfer
+		for _, t := range transfers {
+			if matchesTorrentID(t, s.resolveHashAlias(id)) {
+				match = t
+				break
+			}
 		}
+		if match == nil {
+			log.Error("rpc").
+				Str("operation", operation).
+				Str("id", id).
+				Msg("Failed to find transfer")
+			continue
+		}
+		found = append(found, match)
 	}
-	return nil, fmt.Errorf("transfer not found with hash: %s", hash)
+	return found, nil
 }
 
 // handleTorrentAdd processes torrent-add requests
 func (s *Server) handleTorrentAdd(ctx context.Context, args json.RawMessage) (interface{}, error) {
 	var params struct {
-		Filename    string `json:"filename"`    // For .torrent files
-		MetaInfo    string `json:"metainfo"`    // Base64 encoded .torrent
-		MagnetLink  string `json:"magnetLink"`  // Magnet link
-		DownloadDir string `json:"downloadDir"` // Category subfolder (e.g. /downloads/tv)
+		Filename    string   `json:"filename"`    // For .torrent files
+		MetaInfo    string   `json:"metainfo"`    // Base64 encoded .torrent
+		MagnetLink  string   `json:"magnetLink"`  // Magnet link
+		DownloadDir string   `json:"downloadDir"` // Category subfolder (e.g. /downloads/tv)
+		Labels      []string `json:"labels"`      // Used as the category if downloadDir names none
 	}
 
 	if err := json.Unmarshal(args, &params); err != nil {
-		return nil, fmt.Errorf("invalid arguments: %w", err)
+		return nil, errInvalidArgs("invalid arguments", err)
 	}
 
+	folderID, mapping := s.folderForDownloadDir(params.DownloadDir)
 	category := extractCategory(s.cfg.TargetDir, params.DownloadDir)
-	var name string
-	var hash string
+	switch {
+	case mapping != nil:
+		category = extractCategory(mapping.TargetDir, params.DownloadDir)
+	case s.cfg.DownloadDirAsCategory:
+		category = downloadDirCategory(params.DownloadDir)
+	}
+	if category == "" {
+		category = labelCategory(params.Labels)
+	}
+	var src TorrentSource
 
 	// Handle .torrent file upload if metainfo is provided
 	if params.MetaInfo != "" {
 		// Decode base64 torrent data
 		torrentData, err := base64.StdEncoding.DecodeString(params.MetaInfo)
 		if err != nil {
-			return nil, fmt.Errorf("failed to decode torrent data: %w", err)
+			return nil, errInvalidArgs("failed to decode torrent data", err)
 		}
+		src = TorrentSource{Torrent: torrentData, Name: params.Filename}
+	} else if params.MagnetLink != "" {
+		src = TorrentSource{Magnet: params.MagnetLink}
+	} else if params.Filename != "" && strings.HasPrefix(params.Filename, "magnet:") {
+		src = TorrentSource{Magnet: params.Filename}
+	} else {
+		return nil, errInvalidArgs("invalid torrent or magnet link provided", nil)
+	}
 
-		// Upload torrent file to Put.io
-		name = params.Filename
-		if name == "" {
-			name = "unknown.torrent"
-		}
-		h, err := s.client.UploadFile(ctx, torrentData, name, s.cfg.FolderID)
-		if err != nil {
-			return nil, fmt.Errorf("failed to upload torrent: %w", err)
-		}
-		hash = h
+	hash, hashes, err := addTorrent(ctx, s.client, folderID, src)
+	if err != nil {
+		return nil, s.errUpstream("failed to add torrent", err)
+	}
 
+	if src.Torrent != nil {
 		log.Info("rpc").
 			Str("operation", "torrent-add").
 			Str("type", "torrent").
-			Str("name", name).
+			Str("name", src.Name).
 			Str("category", category).
-			Int64("folder_id", s.cfg.FolderID).
+			Int64("folder_id", folderID).
 			Msg("Torrent file uploaded")
 	} else {
-		// Handle magnet links
-		if params.MagnetLink != "" {
-			name = params.MagnetLink
-		} else if params.Filename != "" && strings.HasPrefix(params.Filename, "magnet:") {
-			name = params.Filename
-		} else {
-			return nil, fmt.Errorf("invalid torrent or magnet link provided")
-		}
-
-		// Add magnet link to Put.io
-		h, err := s.client.AddTransfer(ctx, name, s.cfg.FolderID)
-		if err != nil {
-			return nil, fmt.Errorf("failed to add transfer: %w", err)
-		}
-		hash = h
-
 		log.Info("rpc").
 			Str("operation", "torrent-add").
 			Str("type", "magnet").
-			Str("magnet", name).
+			Str("magnet", src.Magnet).
 			Str("category", category).
-			Int64("folder_id", s.cfg.FolderID).
+			Int64("folder_id", folderID).
 			Msg("Magnet link added")
 	}
 
+	// Let clients refer to the transfer by any of its hashes
+	if hash != "" {
+		s.rememberHashAliases(hash, hashes)
+	}
+
 	// Store category mapping if we have both a hash and a category
 	if hash != "" && category != "" {
 		s.dlService.SetCategory(hash, category)
@@ -129,15 +306,52 @@ func (s *Server) handleTorrentAdd(ctx context.Context, args json.RawMessage) (in
 	}, nil
 }
 
+// transferProgress looks up the local context of a transfer, if any, and
+// calculates its combined progress.
+func (s *Server) transferProgress(t *putio.Transfer) (progressResult, *download.TransferContext) {
+	var transferCtx *download.TransferContext
+	if ctx, exists := s.dlService.GetTransferContext(t.ID); exists {
+		transferCtx = ctx
+	}
+
+	// Finished transfers without a context are only reported as done
+	// once their data is on disk
+	localMissing := false
+	if transferCtx == nil && s.cfg.CheckLocalCompleted &&
+		(t.Status == "COMPLETED" || t.Status == "SEEDING") {
+		localMissing = !s.dlService.HasLocalData(t)
+	}
+
+	prog := calculateProgress(progressInput{
+		PutioPercentDone: t.PercentDone,
+		PutioStatus:      t.Status,
+		PutioSize:        t.Size,
+		TransferCtx:      transferCtx,
+		LocalMissing:     localMissing,
+		Split:            s.cfg.ProgressSplit,
+		StatusMap:        s.cfg.StatusMapping,
+	})
+	return prog, transferCtx
+}
+
+// downloadRate returns the download rate reported for a transfer: the
+// local download speed while plundrio fetches its files, Put.io's otherwise.
+func downloadRate(t *putio.Transfer, prog progressResult) int {
+	if !prog.LocalETA.IsZero() && prog.LocalSpeed > 0 {
+		return int(prog.LocalSpeed)
+	}
+	return t.DownloadSpeed
+}
+
 // handleTorrentGet processes torrent-get requests
 func (s *Server) handleTorrentGet(_ context.Context, args json.RawMessage) (interface{}, error) {
 	var params struct {
-		IDs    []string `json:"ids"`
-		Fields []string `json:"fields"`
+		IDs    torrentIDs `json:"ids"`
+		Fields []string   `json:"fields"`
 	}
 
 	if err := json.Unmarshal(args, &params); err != nil {
-		return nil, fmt.Errorf("invalid arguments: %w", err)
+		return nil, errInvalidArgs("invalid arguments", err)
 	}
 
 	// Log input parameters
@@ -159,14 +373,23 @@ func (s *Server) handleTorrentGet(_ context.Context, args json.RawMessage) (inte
 		Int("all_transfers_count", len(transfers)).
 		Msg("Retrieved all transfers from processor")
 
+	transfers = s.withoutRemoved(transfers)
+
+	// Requests for specific transfers are always answered in full
+	if len(params.IDs) == 0 {
+		transfers = limitTransfers(transfers, s.cfg.MaxListedTransfers)
+	}
+
 	// Convert Put.io transfers to transmission format
 	torrents := make([]map[string]interface{}, 0, len(transfers))
 	for _, t := range transfers {
+		hash := download.NormalizeHash(t.Hash)
+
 		// Filter by IDs if specified
 		if len(params.IDs) > 0 {
 			found := false
 			for _, id := range params.IDs {
-				if id == t.Hash {
+				if matchesTorrentID(t, s.resolveHashAlias(id)) {
 					found = true
 					break
 				}
@@ -176,34 +399,19 @@ func (s *Server) handleTorrentGet(_ context.Context, args json.RawMessage) (inte
 			}
 		}
 
-		// Look up transfer context if available
-		var transferCtx *download.TransferContext
-		if ctx, exists := s.dlService.GetTransferContext(t.ID); exists {
-			transferCtx = ctx
-		}
-
-		// Calculate combined progress
-		prog := calculateProgress(progressInput{
-			PutioPercentDone: t.PercentDone,
-			PutioStatus:      t.Status,
-			PutioSize:        t.Size,
-			TransferCtx:      transferCtx,
-		})
+		prog, transferCtx := s.transferProgress(t)
 
 		percentDone := prog.PercentDone
 		status := prog.Status
 		leftUntilDone := prog.LeftUntilDone
 		eta := t.EstimatedTime
-		rateDownload := t.DownloadSpeed
+		rateDownload := downloadRate(t, prog)
 
-		// Override ETA and rate with local values when available
+		// Override ETA with the local one when available
 		if !prog.LocalETA.IsZero() {
 			if secsUntil := int64(time.Until(prog.LocalETA).Seconds()); secsUntil > 0 {
 				eta = secsUntil
 			}
-			if prog.LocalSpeed > 0 {
-				rateDownload = int(prog.LocalSpeed)
-			}
 		}
 
 		log.Debug("rpc").
@@ -215,14 +423,25 @@ func (s *Server) handleTorrentGet(_ context.Context, args json.RawMessage) (inte
 			Int("status", status).
 			Msg("Calculated progress")
 
+		// Report transfers given up on locally as errored
+		errorString := t.ErrorMessage
+		if errorString == "" {
+			errorString = s.dlService.TransferError(t.ID)
+		}
+		if errorString == "" && transferCtx != nil && transferCtx.GetState() == download.TransferLifecycleFailed {
+			if err := transferCtx.GetError(); err != nil {
+				errorString = err.Error()
+			}
+		}
+
 		torrentInfo := map[string]interface{}{
 			"id":             t.ID,
-			"hashString":     t.Hash,
+			"hashString":     hash,
 			"name":           t.Name,
 			"eta":            eta,
 			"status":         status,
-			"downloadDir":    filepath.Join(s.cfg.TargetDir, s.dlService.GetCategory(t.Hash)),
-			"totalSize":      t.Size,
+			"downloadDir":    filepath.Join(s.cfg.TransferTargetDir(t.SaveParentID), filepath.Dir(s.dlService.TransferDir(t))),
+			"totalSize":      prog.TotalSize,
 			"leftUntilDone":  leftUntilDone,
 			"uploadedEver":   t.Uploaded,
 			"downloadedEver": t.Downloaded,
@@ -235,17 +454,21 @@ func (s *Server) handleTorrentGet(_ context.Context, args json.RawMessage) (inte
 				}
 				return 0
 			}(),
-			"error":       t.ErrorMessage != "",
-			"errorString": t.ErrorMessage,
+			"error":             errorString != "",
+			"errorString":       errorString,
+			"bandwidthPriority": s.dlService.GetPriority(hash),
+		}
+		if ar, ok := s.client.(accountReporter); ok {
+			torrentInfo["putioAccount"] = ar.TransferAccount(t.ID)
 		}
 
-		torrents = append(torrents, torrentInfo)
+		torrents = append(torrents, selectFields(torrentInfo, params.Fields))
 
 		// Log each torrent being added to the response
 		log.Debug("rpc").
 			Str("operation", "torrent-get").
 			Int64("id", t.ID).
-			Str("hash", t.Hash).
+			Str("hash", hash).
 			Str("name", t.Name).
 			Str("status", t.Status).
 			Int("size", t.Size).
@@ -273,27 +496,94 @@ func (s *Server) handleTorrentGet(_ context.Context, args json.RawMessage) (inte
 	return result, nil
 }
 
-// handleTorrentRemove processes torrent-remove requests
-func (s *Server) handleTorrentRemove(ctx context.Context, args json.RawMessage) (interface{}, error) {
+// handleTorrentSet processes torrent-set requests. Only bandwidthPriority
+// and labels are supported; other fields are ignored. The first usable
+// label becomes the transfer's category, so a label assigned after the add
+// still decides where the transfer is downloaded to. Transfers with local
+// data keep their category, as their files would no longer be found.
+func (s *Server) handleTorrentSet(ctx context.Context, args json.RawMessage) (interface{}, error) {
 	var params struct {
-		IDs             []string `json:"ids"`
-		DeleteLocalData bool     `json:"delete-local-data"`
+		IDs               torrentIDs `json:"ids"`
+		BandwidthPriority *int       `json:"bandwidthPriority"`
+		Labels            []string   `json:"labels"`
 	}
 
 	if err := json.Unmarshal(args, &params); err != nil {
-		return nil, fmt.Errorf("invalid arguments: %w", err)
+		return nil, errInvalidArgs("invalid arguments", err)
+	}
+	category := labelCategory(params.Labels)
+	if len(params.IDs) == 0 || (params.BandwidthPriority == nil && category == "") {
+		return struct{}{}, nil
 	}
 
-	for _, hash := range params.IDs {
-		transfer, err := s.findTransferByHash(ctx, hash)
-		if err != nil {
-			log.Error("rpc").
-				Str("operation", "torrent-remove").
+	if params.BandwidthPriority != nil {
+		priority := *params.BandwidthPriority
+		if priority < download.BandwidthPriorityLow || priority > download.BandwidthPriorityHigh {
+			return nil, errInvalidArgs(fmt.Sprintf("invalid bandwidthPriority %d, must be -1, 0 or 1", priority), nil)
+		}
+	}
+
+	transfers, err := s.findTransfers(ctx, "torrent-set", params.IDs)
+	if err != nil {
+		return nil, s.errUpstream("failed to get transfers", err)
+	}
+
+	for _, transfer := range transfers {
+		hash := download.NormalizeHash(transfer.Hash)
+		if params.BandwidthPriority != nil {
+			s.dlService.SetPriority(hash, *params.BandwidthPriority)
+			log.Info("rpc").
+				Str("operation", "torrent-set").
 				Str("hash", hash).
-				Err(err).
-				Msg("Failed to find transfer")
+				Int("bandwidth_priority", *params.BandwidthPriority).
+				Msg("Set transfer priority")
+		}
+		if category == "" || category == s.dlService.GetCategory(hash) {
 			continue
 		}
+		if s.dlService.HasLocalData(transfer) {
+			log.Warn("rpc").
+				Str("operation", "torrent-set").
+				Str("hash", hash).
+				Str("category", category).
+				Msg("Not changing the category of a transfer with local data")
+			continue
+		}
+		s.dlService.SetCategory(hash, category)
+		log.Info("rpc").
+			Str("operation", "torrent-set").
+			Str("hash", hash).
+			Str("category", category).
+			Msg("Set transfer category from label")
+	}
+
+	return struct{}{}, nil
+}
+
+// handleTorrentRemove processes torrent-remove requests
+func (s *Server) handleTorrentRemove(ctx context.Context, args json.RawMessage) (interface{}, error) {
+	var params struct {
+		IDs             torrentIDs `json:"ids"`
+		DeleteLocalData bool       `json:"delete-local-data"`
+	}
+
+	if err := json.Unmarshal(args, &params); err != nil {
+		return nil, errInvalidArgs("invalid arguments", err)
+	}
+	if len(params.IDs) == 0 {
+		return struct{}{}, nil
+	}
+
+	transfers, err := s.findTransfers(ctx, "torrent-remove", params.IDs)
+	if err != nil {
+		return nil, s.errUpstream("failed to get transfers", err)
+	}
+	if len(transfers) == 0 {
+		return nil, errNotFound("no torrent matches the given ids")
+	}
+
+	for _, transfer := range transfers {
+		hash := download.NormalizeHash(transfer.Hash)
 
 		// Seeding-only transfers (where the file was already deleted) have no
 		// file_id. Calling DeleteFile(0) would target the root folder and
@@ -321,6 +611,7 @@ func (s *Server) handleTorrentRemove(ctx context.Context, args json.RawMessage)
 				Err(err).
 				Msg("Failed to delete transfer")
 		} else {
+			s.markRemoved(transfer.ID)
 			log.Info("rpc").
 				Str("operation", "torrent-remove").
 				Str("hash", hash).
@@ -332,8 +623,11 @@ func (s *Server) handleTorrentRemove(ctx context.Context, args json.RawMessage)
 		// Delete local files if requested (closes #23)
 		if params.DeleteLocalData {
 			category := s.dlService.GetCategory(hash)
-			localTargetDir := filepath.Join(s.cfg.TargetDir, category)
-			if err := deleteLocalData(localTargetDir, transfer.Name); err != nil {
+			remove := deleteLocalData
+			if s.cfg.TrashOnRemove > 0 {
+				remove = s.trashLocalData
+			}
+			if err := remove(s.cfg.TransferTargetDir(transfer.SaveParentID), s.dlService.TransferDir(transfer)); err != nil {
 				log.Error("rpc").
 					Str("operation", "torrent-remove").
 					Str("transfer_name", transfer.Name).
@@ -345,12 +639,14 @@ func (s *Server) handleTorrentRemove(ctx context.Context, args json.RawMessage)
 					Str("operation", "torrent-remove").
 					Str("transfer_name", transfer.Name).
 					Str("category", category).
+					Bool("trashed", s.cfg.TrashOnRemove > 0).
 					Msg("Deleted local files")
 			}
 		}
 
 		// Clean up category mapping
 		s.dlService.RemoveCategory(hash)
+		s.dlService.SetPriority(hash, download.BandwidthPriorityNormal)
 	}
 
 	return struct{}{}, nil
@@ -359,17 +655,27 @@ func (s *Server) handleTorrentRemove(ctx context.Context, args json.RawMessage)
 // deleteLocalData removes downloaded files for a transfer from the target directory.
 // It validates that the resolved path is inside targetDir to prevent path traversal.
 func deleteLocalData(targetDir, transferName string) error {
+	absLocal, err := resolveLocalPath(targetDir, transferName)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(absLocal)
+}
+
+// resolveLocalPath returns the absolute path of a transfer's local data,
+// failing if it would resolve outside targetDir.
+func resolveLocalPath(targetDir, transferName string) (string, error) {
 	localPath := filepath.Join(targetDir, transferName)
 	absLocal, err := filepath.Abs(localPath)
 	if err != nil {
-		return fmt.Errorf("failed to resolve local path %q: %w", localPath, err)
+		return "", fmt.Errorf("failed to resolve local path %q: %w", localPath, err)
 	}
 	absTarget, err := filepath.Abs(targetDir)
 	if err != nil {
-		return fmt.Errorf("failed to resolve target dir %q: %w", targetDir, err)
+		return "", fmt.Errorf("failed to resolve target dir %q: %w", targetDir, err)
 	}
 	if !strings.HasPrefix(absLocal, absTarget+string(os.PathSeparator)) {
-		return fmt.Errorf("path %q is outside target directory %q", absLocal, absTarget)
+		return "", fmt.Errorf("path %q is outside target directory %q", absLocal, absTarget)
 	}
-	return os.RemoveAll(absLocal)
+	return absLocal, nil
 }
@@ -1,11 +1,71 @@
 package server
 
 import (
+	"context"
+	"encoding/json"
 	"os"
 	"path/filepath"
+	"slices"
 	"testing"
+	"time"
+
+	"github.com/elsbrock/go-putio"
+	"github.com/elsbrock/plundrio/internal/config"
+	"github.com/elsbrock/plundrio/internal/download"
 )
 
+// fakePutioClient is an in-memory PutioClient for handler tests.
+type fakePutioClient struct {
+	transfers        []*putio.Transfer
+	files            map[int64][]*putio.File
+	downloadURLs     map[int64]string
+	deletedFiles     []int64
+	deletedTransfers []int64
+	addedFolders     []int64
+	addErr           error
+}
+
+func (f *fakePutioClient) GetAccountInfo(ctx context.Context) (*putio.AccountInfo, error) {
+	return &putio.AccountInfo{}, nil
+}
+
+func (f *fakePutioClient) GetTransfers(ctx context.Context) ([]*putio.Transfer, error) {
+	return f.transfers, nil
+}
+
+func (f *fakePutioClient) UploadFile(ctx context.Context, data []byte, filename string, folderID int64) (string, error) {
+	return "", nil
+}
+
+func (f *fakePutioClient) AddTransfer(ctx context.Context, magnetLink string, folderID int64) (string, error) {
+	f.addedFolders = append(f.addedFolders, folderID)
+	return "", f.addErr
+}
+
+func (f *fakePutioClient) DeleteFile(ctx context.Context, fileID int64) error {
+	f.deletedFiles = append(f.deletedFiles, fileID)
+	return nil
+}
+
+func (f *fakePutioClient) DeleteTransfer(ctx context.Context, transferID int64) error {
+	f.deletedTransfers = append(f.deletedTransfers, transferID)
+	return nil
+}
+
+// GetAllTransferFilePaths returns the files of fileID, each file's Name
+// being its path within the transfer.
+func (f *fakePutioClient) GetAllTransferFilePaths(ctx context.Context, fileID int64) ([]*putio.File, map[int64]string, error) {
+	paths := make(map[int64]string)
+	for _, file := range f.files[fileID] {
+		paths[file.ID] = file.Name
+	}
+	return f.files[fileID], paths, nil
+}
+
+func (f *fakePutioClient) GetDownloadURL(ctx context.Context, fileID int64) (string, error) {
+	return f.downloadURLs[fileID], nil
+}
+
 func TestDeleteLocalData(t *testing.T) {
 	tests := []struct {
 		name         string
@@ -137,6 +197,12 @@ func TestExtractCategory(t *testing.T) {
 			downloadDir: "/downloads/media/tv",
 			want:        "media/tv",
 		},
+		{
+			name:        "outside targetDir",
+			targetDir:   "/downloads",
+			downloadDir: "/data/movies",
+			want:        "",
+		},
 		{
 			name:        "trailing slash on downloadDir",
 			targetDir:   "/downloads",
@@ -196,3 +262,408 @@ func TestDeleteLocalDataDoesNotAffectSiblings(t *testing.T) {
 		t.Error("transfer-b should not have been affected")
 	}
 }
+
+func TestFindTransfers(t *testing.T) {
+	client := &fakePutioClient{transfers: []*putio.Transfer{
+		{ID: 1, Hash: "ABCDEF0123456789ABCDEF0123456789ABCDEF01"},
+		{ID: 2, Hash: "fedcba9876543210fedcba9876543210fedcba98"},
+	}}
+	s := &Server{client: client}
+
+	tests := []struct {
+		name    string
+		ids     []string
+		wantIDs []int64
+	}{
+		{"lowercase hash", []string{"abcdef0123456789abcdef0123456789abcdef01"}, []int64{1}},
+		{"mixed case hash", []string{"AbCdEf0123456789aBcDeF0123456789AbCdEf01"}, []int64{1}},
+		{"uppercase hash", []string{"FEDCBA9876543210FEDCBA9876543210FEDCBA98"}, []int64{2}},
+		{"numeric id", []string{"2"}, []int64{2}},
+		{"mixed ids", []string{"1", "fedcba9876543210fedcba9876543210fedcba98"}, []int64{1, 2}},
+		{"unknown ids are skipped", []string{"0000", "99"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found, err := s.findTransfers(context.Background(), "test", tt.ids)
+			if err != nil {
+				t.Fatalf("findTransfers failed: %v", err)
+			}
+			if len(found) != len(tt.wantIDs) {
+				t.Fatalf("found %d transfers, want %d", len(found), len(tt.wantIDs))
+			}
+			for i, transfer := range found {
+				if transfer.ID != tt.wantIDs[i] {
+					t.Errorf("transfer %d = %d, want %d", i, transfer.ID, tt.wantIDs[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLimitTransfers(t *testing.T) {
+	at := func(day int) *putio.Time {
+		return &putio.Time{Time: time.Date(2024, 6, day, 0, 0, 0, 0, time.UTC)}
+	}
+	transfers := []*putio.Transfer{
+		{ID: 1, CreatedAt: at(1)},
+		{ID: 2, CreatedAt: at(3)},
+		{ID: 3},
+		{ID: 4, CreatedAt: at(2)},
+	}
+
+	tests := []struct {
+		max  int
+		want []int64
+	}{
+		{0, []int64{1, 2, 3, 4}},
+		{4, []int64{1, 2, 3, 4}},
+		{2, []int64{2, 4}},
+		{3, []int64{2, 4, 1}},
+	}
+
+	for _, tt := range tests {
+		var got []int64
+		for _, tr := range limitTransfers(transfers, tt.max) {
+			got = append(got, tr.ID)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("limitTransfers(max=%d) = %v, want %v", tt.max, got, tt.want)
+		}
+	}
+}
+
+func TestTorrentIDsUnmarshal(t *testing.T) {
+	tests := []struct {
+		json string
+		want []string
+	}{
+		{`[1, "abc"]`, []string{"1", "abc"}},
+		{`42`, []string{"42"}},
+		{`"abc"`, []string{"abc"}},
+		{`"recently-active"`, nil},
+	}
+
+	for _, tt := range tests {
+		var ids torrentIDs
+		if err := json.Unmarshal([]byte(tt.json), &ids); err != nil {
+			t.Errorf("Unmarshal(%s) failed: %v", tt.json, err)
+			continue
+		}
+		if len(ids) != len(tt.want) {
+			t.Errorf("Unmarshal(%s) = %v, want %v", tt.json, ids, tt.want)
+			continue
+		}
+		for i := range ids {
+			if ids[i] != tt.want[i] {
+				t.Errorf("Unmarshal(%s) = %v, want %v", tt.json, ids, tt.want)
+			}
+		}
+	}
+}
+
+func TestHandleTorrentRemoveByNumericID(t *testing.T) {
+	client := &fakePutioClient{transfers: []*putio.Transfer{
+		{ID: 7, Hash: "abc", FileID: 70},
+		{ID: 8, Hash: "def", FileID: 80},
+	}}
+	dl := &fakeDownloadService{ready: true}
+	dl.SetCategory("abc", "tv")
+	s := newTestServer(client, dl)
+
+	if _, err := s.handleTorrentRemove(context.Background(), json.RawMessage(`{"ids":[7]}`)); err != nil {
+		t.Fatalf("handleTorrentRemove failed: %v", err)
+	}
+
+	if len(client.deletedTransfers) != 1 || client.deletedTransfers[0] != 7 {
+		t.Errorf("deleted transfers = %v, want [7]", client.deletedTransfers)
+	}
+	if len(client.deletedFiles) != 1 || client.deletedFiles[0] != 70 {
+		t.Errorf("deleted files = %v, want [70]", client.deletedFiles)
+	}
+	if got := dl.GetCategory("abc"); got != "" {
+		t.Errorf("category after remove = %q, want it cleared", got)
+	}
+}
+
+func TestRemovedTransferHiddenFromStaleList(t *testing.T) {
+	transfers := []*putio.Transfer{
+		{ID: 7, Hash: "abc", FileID: 70, Status: "COMPLETED"},
+		{ID: 8, Hash: "def", FileID: 80, Status: "COMPLETED"},
+	}
+	client := &fakePutioClient{transfers: transfers}
+	// The download manager's list was fetched before the removal
+	dl := &fakeDownloadService{ready: true, transfers: transfers}
+	s := newTestServer(client, dl)
+	s.cfg.RemovedGracePeriod = time.Minute
+
+	if _, err := s.handleTorrentRemove(context.Background(), json.RawMessage(`{"ids":[7]}`)); err != nil {
+		t.Fatalf("handleTorrentRemove failed: %v", err)
+	}
+
+	listedIDs := func() []int64 {
+		result, err := s.handleTorrentGet(context.Background(), json.RawMessage(`{}`))
+		if err != nil {
+			t.Fatalf("handleTorrentGet failed: %v", err)
+		}
+		var ids []int64
+		for _, torrent := range result.(map[string]interface{})["torrents"].([]map[string]interface{}) {
+			ids = append(ids, torrent["id"].(int64))
+		}
+		return ids
+	}
+
+	if got := listedIDs(); !slices.Equal(got, []int64{8}) {
+		t.Errorf("torrent-get after remove = %v, want [8]", got)
+	}
+
+	// Once the grace period is over the entry expires
+	s.removed.Store(int64(7), time.Now().Add(-2*time.Minute))
+	if got := listedIDs(); !slices.Equal(got, []int64{7, 8}) {
+		t.Errorf("torrent-get after grace period = %v, want [7 8]", got)
+	}
+	if _, ok := s.removed.Load(int64(7)); ok {
+		t.Error("expected expired entry to be dropped")
+	}
+}
+
+func TestHandleTorrentSetBandwidthPriority(t *testing.T) {
+	client := &fakePutioClient{transfers: []*putio.Transfer{
+		{ID: 7, Hash: "ABC", FileID: 70},
+		{ID: 8, Hash: "def", FileID: 80},
+	}}
+	dl := &fakeDownloadService{ready: true}
+	s := newTestServer(client, dl)
+
+	if _, err := s.handleTorrentSet(context.Background(), json.RawMessage(`{"ids":[7,"def"],"bandwidthPriority":1}`)); err != nil {
+		t.Fatalf("handleTorrentSet failed: %v", err)
+	}
+	if dl.GetPriority("abc") != 1 || dl.GetPriority("def") != 1 {
+		t.Errorf("priorities = %v, want abc and def high", dl.priorities)
+	}
+
+	if _, err := s.handleTorrentSet(context.Background(), json.RawMessage(`{"ids":[7],"bandwidthPriority":5}`)); err == nil {
+		t.Error("expected error for out of range priority")
+	}
+}
+
+func TestHandleTorrentSetLabels(t *testing.T) {
+	client := &fakePutioClient{transfers: []*putio.Transfer{
+		{ID: 7, Hash: "ABC", FileID: 70},
+		{ID: 8, Hash: "def", FileID: 80},
+	}}
+	dl := &fakeDownloadService{ready: true, local: map[int64]bool{8: true}}
+	dl.SetCategory("def", "movies")
+	s := newTestServer(client, dl)
+
+	result, err := s.handleTorrentSet(context.Background(), json.RawMessage(`{"ids":["abc",8],"labels":["","tv-sonarr"]}`))
+	if err != nil {
+		t.Fatalf("handleTorrentSet failed: %v", err)
+	}
+	if result != struct{}{} {
+		t.Errorf("result = %#v, want empty arguments", result)
+	}
+	if got := dl.GetCategory("abc"); got != "tv-sonarr" {
+		t.Errorf("category of abc = %q, want tv-sonarr", got)
+	}
+	// Transfers already downloaded keep their category
+	if got := dl.GetCategory("def"); got != "movies" {
+		t.Errorf("category of def = %q, want movies", got)
+	}
+
+	// Labels without a usable name leave the category alone
+	if _, err := s.handleTorrentSet(context.Background(), json.RawMessage(`{"ids":["abc"],"labels":[]}`)); err != nil {
+		t.Fatalf("handleTorrentSet failed: %v", err)
+	}
+	if got := dl.GetCategory("abc"); got != "tv-sonarr" {
+		t.Errorf("category of abc after empty labels = %q, want tv-sonarr", got)
+	}
+}
+
+func TestTorrentAddDownloadDirAsCategory(t *testing.T) {
+	const hash = "0123456789abcdef0123456789abcdef01234567"
+	tests := []struct {
+		name        string
+		asCategory  bool
+		downloadDir string
+		labels      []string
+		want        string
+	}{
+		{"relative to target", false, "/downloads/media/movies", nil, "media/movies"},
+		{"last segment", true, "/downloads/media/movies", nil, "movies"},
+		{"outside target", true, "/data/radarr/movies/", nil, "movies"},
+		{"windows path", true, `D:\Downloads\tv`, nil, "tv"},
+		{"root", true, "/", nil, ""},
+		{"label", false, "", []string{"", "tv-sonarr"}, "tv-sonarr"},
+		{"downloadDir before label", false, "/downloads/movies", []string{"tv"}, "movies"},
+		{"label traversal", false, "", []string{"../.."}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dl := &fakeDownloadService{ready: true}
+			s := newTestServer(&fakePutioClient{}, dl)
+			s.cfg.DownloadDirAsCategory = tt.asCategory
+
+			args, _ := json.Marshal(map[string]any{
+				"filename":    "magnet:?xt=urn:btih:" + hash,
+				"downloadDir": tt.downloadDir,
+				"labels":      tt.labels,
+			})
+			if _, err := s.handleTorrentAdd(context.Background(), args); err != nil {
+				t.Fatalf("torrent-add failed: %v", err)
+			}
+			if got := dl.GetCategory(hash); got != tt.want {
+				t.Errorf("category = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTorrentAddFolderMapping(t *testing.T) {
+	const hash = "0123456789abcdef0123456789abcdef01234567"
+	tests := []struct {
+		name        string
+		downloadDir string
+		wantFolder  int64
+		wantCat     string
+	}{
+		{"primary", "/downloads/tv", 1, "tv"},
+		{"mapped", "/media/movies", 2, ""},
+		{"below mapping", "/media/movies/4k", 2, "4k"},
+		{"most specific mapping", "/media/movies/kids/new", 3, "new"},
+		{"sibling of mapping", "/media/movies-old", 1, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakePutioClient{}
+			dl := &fakeDownloadService{ready: true}
+			s := newTestServer(client, dl)
+			s.cfg.TargetDir = "/downloads"
+			s.cfg.FolderID = 1
+			s.cfg.FolderMappings = []config.FolderMapping{
+				{PutioFolder: "movies", TargetDir: "/media/movies", FolderID: 2},
+				{PutioFolder: "kids", TargetDir: "/media/movies/kids", FolderID: 3},
+			}
+
+			args, _ := json.Marshal(map[string]string{
+				"filename":    "magnet:?xt=urn:btih:" + hash,
+				"downloadDir": tt.downloadDir,
+			})
+			if _, err := s.handleTorrentAdd(context.Background(), args); err != nil {
+				t.Fatalf("torrent-add failed: %v", err)
+			}
+			if !slices.Equal(client.addedFolders, []int64{tt.wantFolder}) {
+				t.Errorf("added to folders %v, want %d", client.addedFolders, tt.wantFolder)
+			}
+			if got := dl.GetCategory(hash); got != tt.wantCat {
+				t.Errorf("category = %q, want %q", got, tt.wantCat)
+			}
+		})
+	}
+}
+
+func TestHandleTorrentGetFields(t *testing.T) {
+	dl := &fakeDownloadService{ready: true, transfers: []*putio.Transfer{
+		{ID: 7, Hash: "ABC", Name: "Show", Status: "DOWNLOADING", PercentDone: 50},
+	}}
+	s := newTestServer(&fakePutioClient{}, dl)
+
+	torrentKeys := func(args string) []string {
+		result, err := s.handleTorrentGet(context.Background(), json.RawMessage(args))
+		if err != nil {
+			t.Fatalf("handleTorrentGet(%s) failed: %v", args, err)
+		}
+		torrents := result.(map[string]interface{})["torrents"].([]map[string]interface{})
+		if len(torrents) != 1 {
+			t.Fatalf("got %d torrents, want 1", len(torrents))
+		}
+		var keys []string
+		for k := range torrents[0] {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		return keys
+	}
+
+	// id and hashString are always included, unknown fields are ignored
+	if got := torrentKeys(`{"fields":["percentDone","unknownField"]}`); !slices.Equal(got, []string{"hashString", "id", "percentDone"}) {
+		t.Errorf("keys = %v, want hashString, id and percentDone", got)
+	}
+	if got := torrentKeys(`{"fields":["id","name"]}`); !slices.Equal(got, []string{"hashString", "id", "name"}) {
+		t.Errorf("keys = %v, want hashString, id and name", got)
+	}
+	if got := torrentKeys(`{}`); len(got) < 10 {
+		t.Errorf("keys = %v, want all fields without a fields parameter", got)
+	}
+}
+
+func TestHandleTorrentGetLocalRate(t *testing.T) {
+	downloading := newTestTransferCtx(download.TransferLifecycleDownloading, 1, 0, 1000, 100)
+	downloading.SetLocalProgress(4096, time.Now().Add(time.Hour))
+	completed := newTestTransferCtx(download.TransferLifecycleCompleted, 1, 1, 1000, 1000)
+	completed.SetLocalProgress(4096, time.Now().Add(time.Hour))
+	idle := newTestTransferCtx(download.TransferLifecycleDownloading, 1, 0, 1000, 0)
+
+	tests := []struct {
+		name     string
+		ctx      *download.TransferContext
+		wantRate int
+		local    bool
+	}{
+		{"no local context", nil, 100, false},
+		{"active local download", downloading, 4096, true},
+		{"local download finished", completed, 100, false},
+		{"no local progress yet", idle, 100, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dl := &fakeDownloadService{ready: true, transfers: []*putio.Transfer{
+				{ID: 7, Hash: "ABC", Name: "Show", Status: "COMPLETED", PercentDone: 100, DownloadSpeed: 100, EstimatedTime: 5},
+			}}
+			if tt.ctx != nil {
+				dl.contexts = map[int64]*download.TransferContext{7: tt.ctx}
+			}
+			s := newTestServer(&fakePutioClient{}, dl)
+
+			result, err := s.handleTorrentGet(context.Background(), json.RawMessage(`{"fields":["rateDownload","eta"]}`))
+			if err != nil {
+				t.Fatalf("handleTorrentGet failed: %v", err)
+			}
+			torrent := result.(map[string]interface{})["torrents"].([]map[string]interface{})[0]
+			if got := torrent["rateDownload"]; got != tt.wantRate {
+				t.Errorf("rateDownload = %v, want %d", got, tt.wantRate)
+			}
+			eta := torrent["eta"].(int64)
+			if tt.local && (eta < 3500 || eta > 3600) {
+				t.Errorf("eta = %d, want about an hour", eta)
+			}
+			if !tt.local && eta != 5 {
+				t.Errorf("eta = %d, want Put.io's 5", eta)
+			}
+		})
+	}
+}
+
+func TestHandleTorrentGetTransferError(t *testing.T) {
+	dl := &fakeDownloadService{ready: true, transfers: []*putio.Transfer{
+		{ID: 7, Hash: "ABC", Name: "Show", Status: "IN_QUEUE"},
+		{ID: 8, Hash: "DEF", Name: "Movie", Status: "ERROR", ErrorMessage: "tracker gone"},
+	}, errors: map[int64]string{7: "Timed out waiting in Put.io queue", 8: "Timed out waiting in Put.io queue"}}
+	s := newTestServer(&fakePutioClient{}, dl)
+
+	result, err := s.handleTorrentGet(context.Background(), json.RawMessage(`{"fields":["errorString"]}`))
+	if err != nil {
+		t.Fatalf("handleTorrentGet failed: %v", err)
+	}
+	torrents := result.(map[string]interface{})["torrents"].([]map[string]interface{})
+	want := map[int64]string{7: "Timed out waiting in Put.io queue", 8: "tracker gone"}
+	for _, torrent := range torrents {
+		id := torrent["id"].(int64)
+		if got := torrent["errorString"]; got != want[id] {
+			t.Errorf("errorString of %d = %q, want %q", id, got, want[id])
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/elsbrock/plundrio/internal/log"
+)
+
+// trashDirName is the directory below each target directory that holds
+// local data removed via torrent-remove until it is purged.
+const trashDirName = ".trash"
+
+// trashPurgeInterval is how often the trash directory is checked for entries
+// past their retention.
+const trashPurgeInterval = 15 * time.Minute
+
+// trashLocalData moves a transfer's local data into the trash directory of
+// its target directory instead of deleting it, so an accidental removal can
+// be undone. Keeping the trash on the same filesystem lets it be a rename.
+func (s *Server) trashLocalData(targetDir, transferName string) error {
+	return moveToTrash(targetDir, filepath.Join(targetDir, trashDirName), transferName, time.Now())
+}
+
+// moveToTrash moves targetDir/transferName into trashDir. The entry is
+// suffixed with the current time so repeated removals of the same name do
+// not collide, and its modification time is set to now so that purgeTrash
+// measures retention from the removal rather than the download.
+func moveToTrash(targetDir, trashDir, transferName string, now time.Time) error {
+	absLocal, err := resolveLocalPath(targetDir, transferName)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(absLocal); os.IsNotExist(err) {
+		return nil
+	}
+
+	if err := os.MkdirAll(trashDir, 0755); err != nil {
+		return fmt.Errorf("failed to create trash dir %q: %w", trashDir, err)
+	}
+
+	dest := filepath.Join(trashDir, fmt.Sprintf("%s.%d", filepath.Base(absLocal), now.UnixNano()))
+	if err := os.Rename(absLocal, dest); err != nil {
+		return fmt.Errorf("failed to move %q to trash: %w", absLocal, err)
+	}
+	if err := os.Chtimes(dest, now, now); err != nil {
+		return fmt.Errorf("failed to update trash entry %q: %w", dest, err)
+	}
+	return nil
+}
+
+// purgeTrash deletes entries in trashDir that were trashed more than
+// retention ago and returns how many were removed.
+func purgeTrash(trashDir string, retention time.Duration, now time.Time) (int, error) {
+	entries, err := os.ReadDir(trashDir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to read trash dir %q: %w", trashDir, err)
+	}
+
+	purged := 0
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if now.Sub(info.ModTime()) < retention {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(trashDir, entry.Name())); err != nil {
+			return purged, fmt.Errorf("failed to purge %q: %w", entry.Name(), err)
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// startTrashPurger purges expired trash entries now and then periodically
+// until the server is stopped.
+func (s *Server) startTrashPurger() {
+	trashDirs := []string{filepath.Join(s.cfg.TargetDir, trashDirName)}
+	for _, mapping := range s.cfg.FolderMappings {
+		trashDirs = append(trashDirs, filepath.Join(mapping.TargetDir, trashDirName))
+	}
+	purge := func() {
+		for _, trashDir := range trashDirs {
+			n, err := purgeTrash(trashDir, s.cfg.TrashOnRemove, time.Now())
+			if err != nil {
+				log.Error("trash").Str("dir", trashDir).Err(err).Msg("Failed to purge trash")
+			}
+			if n > 0 {
+				log.Info("trash").Str("dir", trashDir).Int("purged", n).Msg("Purged expired trash entries")
+			}
+		}
+	}
+
+	log.Info("trash").
+		Strs("dirs", trashDirs).
+		Dur("retention", s.cfg.TrashOnRemove).
+		Msg("Removed local data will be moved to trash")
+	purge()
+
+	go func() {
+		ticker := time.NewTicker(min(trashPurgeInterval, s.cfg.TrashOnRemove))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				purge()
+			case <-s.stopChan:
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMoveToTrashThenPurge(t *testing.T) {
+	targetDir := t.TempDir()
+	trashDir := filepath.Join(targetDir, trashDirName)
+
+	dir := filepath.Join(targetDir, "tv", "Show.S01")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "episode.mkv"), []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	removedAt := time.Now().Add(-2 * time.Hour)
+	if err := moveToTrash(filepath.Join(targetDir, "tv"), trashDir, "Show.S01", removedAt); err != nil {
+		t.Fatalf("moveToTrash: %v", err)
+	}
+
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatalf("expected %q to be moved away", dir)
+	}
+	entries, err := os.ReadDir(trashDir)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("trash entries = %v (err %v), want 1", entries, err)
+	}
+	if _, err := os.Stat(filepath.Join(trashDir, entries[0].Name(), "episode.mkv")); err != nil {
+		t.Fatalf("trashed data should be recoverable: %v", err)
+	}
+
+	// Still within retention
+	n, err := purgeTrash(trashDir, 3*time.Hour, time.Now())
+	if err != nil || n != 0 {
+		t.Fatalf("purgeTrash within retention = %d, %v; want 0, nil", n, err)
+	}
+
+	// Past retention
+	n, err = purgeTrash(trashDir, time.Hour, time.Now())
+	if err != nil || n != 1 {
+		t.Fatalf("purgeTrash past retention = %d, %v; want 1, nil", n, err)
+	}
+	if entries, _ := os.ReadDir(trashDir); len(entries) != 0 {
+		t.Errorf("trash should be empty, has %d entries", len(entries))
+	}
+}
+
+func TestMoveToTrashRejectsTraversal(t *testing.T) {
+	targetDir := t.TempDir()
+	if err := moveToTrash(targetDir, filepath.Join(targetDir, trashDirName), "../escape", time.Now()); err == nil {
+		t.Error("expected error for path outside target directory")
+	}
+}
+
+func TestMoveToTrashMissingData(t *testing.T) {
+	targetDir := t.TempDir()
+	trashDir := filepath.Join(targetDir, trashDirName)
+	if err := moveToTrash(targetDir, trashDir, "missing", time.Now()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(trashDir); !os.IsNotExist(err) {
+		t.Error("trash dir should not be created when there is nothing to move")
+	}
+}
+
+func TestPurgeTrashMissingDir(t *testing.T) {
+	n, err := purgeTrash(filepath.Join(t.TempDir(), trashDirName), time.Hour, time.Now())
+	if err != nil || n != 0 {
+		t.Fatalf("purgeTrash = %d, %v; want 0, nil", n, err)
+	}
+}